@@ -29,6 +29,7 @@ var grpcCmd = &cobra.Command{
 			svc.WithAllowGetWithReqBody(allowGetWithReqBody),
 			svc.WithCaseConverter(fn),
 			svc.WithOmitempty(omitempty),
+			svc.WithErrorCatalog(errorCatalog),
 		)
 		s.Grpc()
 	},
@@ -39,7 +40,8 @@ func init() {
 	grpcCmd.Flags().BoolVarP(&omitempty, "omitempty", "o", false, `if true, ",omitempty" will be appended to json tag of fields in every generated anonymous struct in handlers`)
 	grpcCmd.Flags().StringVar(&naming, "case", "lowerCamel", `protobuf message field naming strategy, only support "lowerCamel" and "snake"`)
 	grpcCmd.Flags().StringVar(&protocCmd, "grpc_gen_cmd", "protoc --proto_path=. --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative --go-json_out=. --go-json_opt=paths=source_relative,allow_unknown=true", `command to generate grpc service and message code`)
-	grpcCmd.Flags().BoolVar(&http2grpc, "http2grpc", false, `whether need RESTful api for your grpc service`)
+	grpcCmd.Flags().BoolVar(&http2grpc, "http2grpc", false, `whether need RESTful api for your grpc service, they are served on one port`)
 	grpcCmd.Flags().BoolVar(&allowGetWithReqBody, "allow_get_body", false, "Whether allow get http request with request body.")
+	grpcCmd.Flags().StringVar(&errorCatalog, "errcatalog", "", `error catalog yaml file whose error codes are documented for methods annotated with @errors, default is errcode.yaml in service root directory if exists`)
 	grpcCmd.Flags().BoolVar(&annotatedOnly, "annotated_only", false, "Whether generate grpc api only for method annotated with @grpc or not")
 }
@@ -13,6 +13,7 @@ var doc bool
 var jsonCase string
 var routePatternStrategy int
 var allowGetWithReqBody bool
+var errorCatalog string
 
 // httpCmd generates scaffold code of restful service
 var httpCmd = &cobra.Command{
@@ -34,6 +35,7 @@ var httpCmd = &cobra.Command{
 			Env:                  baseURLEnv,
 			RoutePatternStrategy: routePatternStrategy,
 			AllowGetWithReqBody:  allowGetWithReqBody,
+			ErrorCatalog:         errorCatalog,
 		}
 		s.Http()
 	},
@@ -50,4 +52,5 @@ func init() {
 	httpCmd.Flags().StringVarP(&baseURLEnv, "env", "e", "", `base url environment variable name`)
 	httpCmd.Flags().IntVarP(&routePatternStrategy, "routePattern", "r", 0, "route pattern generate strategy. 0 means splitting each methods of service interface by slash / after converting to snake case. 1 means no splitting, only lowercase. recommend default value.")
 	httpCmd.Flags().BoolVar(&allowGetWithReqBody, "allowGetWithReqBody", false, "Whether allow get http request with request body.")
+	httpCmd.Flags().StringVar(&errorCatalog, "errcatalog", "", `error catalog yaml file whose error codes are documented for methods annotated with @errors, default is errcode.yaml in service root directory if exists`)
 }
@@ -662,8 +662,6 @@ import (
 	"encoding/json"
 	"github.com/go-resty/resty/v2"
 	"github.com/pkg/errors"
-	"github.com/opentracing-contrib/go-stdlib/nethttp"
-	"github.com/opentracing/opentracing-go"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry"
 	_querystring "github.com/google/go-querystring/query"
 	"github.com/unionj-cloud/toolkit/fileutils"
@@ -863,18 +861,6 @@ func New{{.Meta.Name}}(opts ...restclient.RestClientOption) *{{.Meta.Name}}Clien
 		return nil
 	})
 
-	svcClient.client.SetPreRequestHook(func(_ *resty.Client, request *http.Request) error {
-		traceReq, _ := nethttp.TraceRequest(opentracing.GlobalTracer(), request,
-			nethttp.OperationName(fmt.Sprintf("HTTP %s: %s", request.Method, request.URL.Path)))
-		*request = *traceReq
-		return nil
-	})
-
-	svcClient.client.OnAfterResponse(func(_ *resty.Client, response *resty.Response) error {
-		nethttp.TracerFromRequest(response.Request.RawRequest).Finish()
-		return nil
-	})
-
 	return svcClient
 }
 `
@@ -6,17 +6,13 @@ package test
 
 import (
 	"context"
-	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/go-resty/resty/v2"
 	_querystring "github.com/google/go-querystring/query"
-	"github.com/opentracing-contrib/go-stdlib/nethttp"
-	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry"
 	"github.com/unionj-cloud/go-doudou/v2/framework/restclient"
@@ -114,17 +110,5 @@ func NewDownload(opts ...restclient.RestClientOption) *DownloadClient {
 		return nil
 	})
 
-	svcClient.client.SetPreRequestHook(func(_ *resty.Client, request *http.Request) error {
-		traceReq, _ := nethttp.TraceRequest(opentracing.GlobalTracer(), request,
-			nethttp.OperationName(fmt.Sprintf("HTTP %s: %s", request.Method, request.URL.Path)))
-		*request = *traceReq
-		return nil
-	})
-
-	svcClient.client.OnAfterResponse(func(_ *resty.Client, response *resty.Response) error {
-		nethttp.TracerFromRequest(response.Request.RawRequest).Finish()
-		return nil
-	})
-
 	return svcClient
 }
@@ -7,12 +7,8 @@ package test
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-	"net/http"
 
 	"github.com/go-resty/resty/v2"
-	"github.com/opentracing-contrib/go-stdlib/nethttp"
-	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry"
 	"github.com/unionj-cloud/go-doudou/v2/framework/restclient"
@@ -114,17 +110,5 @@ func NewPage(opts ...restclient.RestClientOption) *PageClient {
 		return nil
 	})
 
-	svcClient.client.SetPreRequestHook(func(_ *resty.Client, request *http.Request) error {
-		traceReq, _ := nethttp.TraceRequest(opentracing.GlobalTracer(), request,
-			nethttp.OperationName(fmt.Sprintf("HTTP %s: %s", request.Method, request.URL.Path)))
-		*request = *traceReq
-		return nil
-	})
-
-	svcClient.client.OnAfterResponse(func(_ *resty.Client, response *resty.Response) error {
-		nethttp.TracerFromRequest(response.Request.RawRequest).Finish()
-		return nil
-	})
-
 	return svcClient
 }
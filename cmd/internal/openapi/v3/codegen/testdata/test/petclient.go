@@ -8,12 +8,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
 
 	"github.com/go-resty/resty/v2"
 	_querystring "github.com/google/go-querystring/query"
-	"github.com/opentracing-contrib/go-stdlib/nethttp"
-	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry"
 	"github.com/unionj-cloud/go-doudou/v2/framework/restclient"
@@ -248,17 +245,5 @@ func NewPet(opts ...restclient.RestClientOption) *PetClient {
 		return nil
 	})
 
-	svcClient.client.SetPreRequestHook(func(_ *resty.Client, request *http.Request) error {
-		traceReq, _ := nethttp.TraceRequest(opentracing.GlobalTracer(), request,
-			nethttp.OperationName(fmt.Sprintf("HTTP %s: %s", request.Method, request.URL.Path)))
-		*request = *traceReq
-		return nil
-	})
-
-	svcClient.client.OnAfterResponse(func(_ *resty.Client, response *resty.Response) error {
-		nethttp.TracerFromRequest(response.Request.RawRequest).Finish()
-		return nil
-	})
-
 	return svcClient
 }
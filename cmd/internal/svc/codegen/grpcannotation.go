@@ -43,6 +43,10 @@ var MethodAnnotationStore = framework.AnnotationStore{
 	{{- end }}
 	{{- end }}
 }
+
+func init() {
+	framework.RegisterAnnotationStore(MethodAnnotationStore)
+}
 `
 
 func GenMethodAnnotationStore(dir string, ic astutils.InterfaceCollector) {
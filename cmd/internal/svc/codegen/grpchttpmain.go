@@ -20,13 +20,13 @@ import (
 	grpczerolog "github.com/grpc-ecosystem/go-grpc-middleware/providers/zerolog/v2"
 	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
-	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/tags"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/unionj-cloud/toolkit/zlogger"
 	"google.golang.org/grpc"
     "github.com/unionj-cloud/go-doudou/v2/framework/grpcx"
+    "github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_deadline"
 	{{.ServiceAlias}} "{{.ServicePackage}}"
     "{{.ConfigPackage}}"
 	pb "{{.PbPackage}}"
@@ -38,38 +38,36 @@ func main() {
 	conf := config.LoadFromEnv()
 	svc := {{.ServiceAlias}}.New{{.SvcName}}(conf)
 
-	go func() {
-		grpcServer := grpcx.NewGrpcServer(
-			grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
-				grpc_ctxtags.StreamServerInterceptor(),
-				grpc_opentracing.StreamServerInterceptor(),
-				grpc_prometheus.StreamServerInterceptor,
-				tags.StreamServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
-				logging.StreamServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
-				grpc_recovery.StreamServerInterceptor(),
-			)),
-			grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
-				grpc_ctxtags.UnaryServerInterceptor(),
-				grpc_opentracing.UnaryServerInterceptor(),
-				grpc_prometheus.UnaryServerInterceptor,
-				tags.UnaryServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
-				logging.UnaryServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
-				grpc_recovery.UnaryServerInterceptor(),
-			)),
-		)
-		pb.Register{{.GrpcSvcName}}Server(grpcServer, svc)
-		grpcServer.Run()
-	}()
+	grpcServer := grpcx.NewGrpcServer(
+		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
+			grpc_ctxtags.StreamServerInterceptor(),
+			grpc_prometheus.StreamServerInterceptor,
+			tags.StreamServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
+			logging.StreamServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
+			grpc_recovery.StreamServerInterceptor(),
+			grpcx_deadline.StreamServerInterceptor(),
+		)),
+		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
+			grpc_ctxtags.UnaryServerInterceptor(),
+			grpc_prometheus.UnaryServerInterceptor,
+			tags.UnaryServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
+			logging.UnaryServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
+			grpc_recovery.UnaryServerInterceptor(),
+			grpcx_deadline.UnaryServerInterceptor(),
+		)),
+	)
+	pb.Register{{.GrpcSvcName}}Server(grpcServer, svc)
 
+	// grpc calls are served on GDD_PORT together with RESTful api
 	handler := httpsrv.New{{.SvcName}}Http2Grpc(svc)
-	srv := rest.NewRestServer()
+	srv := rest.NewRestServerWithOptions(rest.WithGrpcServer(grpcServer))
 	srv.AddRoutes(httpsrv.Routes(handler))
 	srv.AddRoutes(rest.DocRoutes(service.Oas))
 	srv.Run()
 }
 `
 
-// GenMainGrpcHttp generates main function for grpc service
+// GenMainGrpcHttp generates main function for grpc service which serves grpc and RESTful api on one port
 func GenMainGrpcHttp(dir string, ic astutils.InterfaceCollector, grpcSvc v3.Service) {
 	var (
 		err      error
@@ -30,19 +30,19 @@ func main() {
 	grpcServer := grpcx.NewGrpcServer(
 		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
 			grpc_ctxtags.StreamServerInterceptor(),
-			grpc_opentracing.StreamServerInterceptor(),
 			grpc_prometheus.StreamServerInterceptor,
 			tags.StreamServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
 			logging.StreamServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
 			grpc_recovery.StreamServerInterceptor(),
+			grpcx_deadline.StreamServerInterceptor(),
 		)),
 		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
 			grpc_ctxtags.UnaryServerInterceptor(),
-			grpc_opentracing.UnaryServerInterceptor(),
 			grpc_prometheus.UnaryServerInterceptor,
 			tags.UnaryServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
 			logging.UnaryServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
 			grpc_recovery.UnaryServerInterceptor(),
+			grpcx_deadline.UnaryServerInterceptor(),
 		)),
 	)
 	pb.Register{{.GrpcSvcName}}Server(grpcServer, svc)
@@ -55,19 +55,19 @@ go func() {
 	grpcServer := grpcx.NewGrpcServer(
 		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
 			grpc_ctxtags.StreamServerInterceptor(),
-			grpc_opentracing.StreamServerInterceptor(),
 			grpc_prometheus.StreamServerInterceptor,
 			tags.StreamServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
 			logging.StreamServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
 			grpc_recovery.StreamServerInterceptor(),
+			grpcx_deadline.StreamServerInterceptor(),
 		)),
 		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
 			grpc_ctxtags.UnaryServerInterceptor(),
-			grpc_opentracing.UnaryServerInterceptor(),
 			grpc_prometheus.UnaryServerInterceptor,
 			tags.UnaryServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
 			logging.UnaryServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
 			grpc_recovery.UnaryServerInterceptor(),
+			grpcx_deadline.UnaryServerInterceptor(),
 		)),
 	)
 	pb.Register{{.GrpcSvcName}}Server(grpcServer, svc)
@@ -80,13 +80,13 @@ var gRPCImportBlock = `
 	grpczerolog "github.com/grpc-ecosystem/go-grpc-middleware/providers/zerolog/v2"
 	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
-	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/tags"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/unionj-cloud/toolkit/zlogger"
 	"google.golang.org/grpc"
     "github.com/unionj-cloud/go-doudou/v2/framework/grpcx"
+    "github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_deadline"
 	{{.ServiceAlias}} "{{.ServicePackage}}"
     "{{.ConfigPackage}}"
 	pb "{{.PbPackage}}"
@@ -49,8 +49,8 @@ var appendHttp2GrpcTmpl = `
 			rest.PanicBadRequestErr(_err)
 		}
 		{{- else }}
-		if _err := json.NewDecoder(_req.Body).Decode({{$p.Name}}); _err != nil {
-			rest.PanicBadRequestErr(_err)	
+		if _err := rest.DecodeBody(_req, {{$p.Name}}); _err != nil {
+			rest.HandleDecodeBodyErr(_err)
 		}
 		if _err := rest.ValidateStruct({{$p.Name}}); _err != nil {
 			rest.PanicBadRequestErr(_err)
@@ -84,13 +84,12 @@ var appendHttp2GrpcTmpl = `
 				}
 			{{- end }}
 		{{- end }}
-		_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
 		{{- if eq (len $m.Results) 1 }}
-			if _err := json.NewEncoder(_writer).Encode(struct {}{}); _err != nil {
+			if _err := rest.EncodeBody(_writer, _req, struct {}{}); _err != nil {
 				rest.HandleInternalServerError(_err)
 			}
 		{{- else }}
-			if _err := json.NewEncoder(_writer).Encode(struct {
+			if _err := rest.EncodeBody(_writer, _req, struct {
 				{{- range $r := $m.Results }}
 				{{- if ne $r.Type "error" }}
 				{{ $r.Name | toCamel }} *{{ trimLeft $r.Type "*" | replacePkg }} ` + "`" + `json:"{{ $r.Name | convertCase }}{{if $.Config.Omitempty}},omitempty{{end}}"` + "`" + `
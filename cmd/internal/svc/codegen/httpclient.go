@@ -23,6 +23,7 @@ var clientTmpl = `/**
 package client
 
 import (
+	"bytes"
 	"context"
 	"github.com/bytedance/sonic"
 	"github.com/go-resty/resty/v2"
@@ -31,10 +32,9 @@ import (
 	"github.com/unionj-cloud/toolkit/fileutils"
 	"github.com/unionj-cloud/toolkit/stringutils"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
 	"github.com/unionj-cloud/go-doudou/v2/framework/restclient"
 	v3 "github.com/unionj-cloud/toolkit/openapi/v3"
-	"github.com/opentracing-contrib/go-stdlib/nethttp"
-	"github.com/opentracing/opentracing-go"
 	"io"
 	"net/http"
 	"mime/multipart"
@@ -80,6 +80,9 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 			_req.SetHeaders(_headers)
 		}
 		_req.SetContext(ctx)
+		if stringutils.IsNotEmpty(options.Accept) {
+			_req.SetHeader("Accept", options.Accept)
+		}
 		{{- range $p := $m.Params }}
 		{{- if $p.IsPathVariable }}
 		{{- if IsEnum $p }}
@@ -161,11 +164,20 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 		}
 		_req.SetQueryParamsFromValues({{$p.Name}}UrlValues)
 		{{- else }}
+		{{$p.Name}}Codec, _err := rest.LookupCodec(options.ContentType)
+		if _err != nil {
+			{{- range $r := $m.Results }}
+				{{- if eq $r.Type "error" }}
+			{{ $r.Name }} = errors.Wrap(_err, "error")
+				{{- end }}
+			{{- end }}
+			return
+		}
 		if options.GzipReqBody {
 			pr, pw := io.Pipe()
 			go func() {
 				gw := gzip.NewWriter(pw)
-				_err = json.NewEncoder(gw).Encode({{$p.Name}})
+				_err = {{$p.Name}}Codec.Encode(gw, {{$p.Name}})
 				if _err != nil {
 					{{- range $r := $m.Results }}
 						{{- if eq $r.Type "error" }}
@@ -189,9 +201,21 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 					{{- end }}
 				{{- end }}
 			}()
-			_req.SetHeader("Content-Type", "application/json")
+			_req.SetHeader("Content-Type", {{$p.Name}}Codec.ContentType())
 			_req.SetHeader("Content-Encoding", "gzip")
 			_req.SetBody(pr)
+		} else if stringutils.IsNotEmpty(options.ContentType) {
+			var _buf bytes.Buffer
+			if _err = {{$p.Name}}Codec.Encode(&_buf, {{$p.Name}}); _err != nil {
+				{{- range $r := $m.Results }}
+					{{- if eq $r.Type "error" }}
+				{{ $r.Name }} = errors.Wrap(_err, "error")
+					{{- end }}
+				{{- end }}
+				return
+			}
+			_req.SetHeader("Content-Type", {{$p.Name}}Codec.ContentType())
+			_req.SetBody(_buf.Bytes())
 		} else {
 			_req.SetBody({{$p.Name}})
 		}
@@ -336,7 +360,7 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 				{{- end }}
 				{{- end }}
 			}
-			if _err = json.Unmarshal(_resp.Body(), &_result); _err != nil {
+			if _err = rest.Unmarshal(_resp.Header().Get("Content-Type"), _resp.Body(), &_result); _err != nil {
 				{{- range $r := $m.Results }}
 					{{- if eq $r.Type "error" }}
 				{{ $r.Name }} = errors.Wrap(_err, "error")
@@ -371,18 +395,6 @@ func New{{.Meta.Name}}Client(opts ...restclient.RestClientOption) *{{.Meta.Name}
 		return nil
 	})
 
-	svcClient.client.SetPreRequestHook(func(_ *resty.Client, request *http.Request) error {
-		traceReq, _ := nethttp.TraceRequest(opentracing.GlobalTracer(), request,
-			nethttp.OperationName(fmt.Sprintf("HTTP %s: %s", request.Method, request.URL.Path)))
-		*request = *traceReq
-		return nil
-	})
-
-	svcClient.client.OnAfterResponse(func(_ *resty.Client, response *resty.Response) error {
-		nethttp.TracerFromRequest(response.Request.RawRequest).Finish()
-		return nil
-	})
-
 	return svcClient
 }
 `
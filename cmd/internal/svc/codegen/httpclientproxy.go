@@ -31,6 +31,7 @@ var cpimportTmpl = `
 	"github.com/slok/goresilience/metrics"
 	"github.com/slok/goresilience/retry"
 	"github.com/slok/goresilience/timeout"
+	"github.com/unionj-cloud/go-doudou/v2/framework/restclient"
 	v3 "github.com/unionj-cloud/toolkit/openapi/v3"
 	"os"
 	"time"
@@ -137,7 +138,8 @@ func New{{.SvcName}}ClientProxy(client *{{.SvcName}}Client, opts ...ProxyOption)
 			}),
 			retry.NewMiddleware(retry.Config{
 				Times: 3,
-			}))
+			}),
+			restclient.FailFast())
 
 		cp.runner = goresilience.RunnerChain(mid...)
 	}
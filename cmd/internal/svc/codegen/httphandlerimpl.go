@@ -175,9 +175,9 @@ var appendHttpHandlerImplTmpl = `
 		{{- end }}
 		{{- else }}
 		{{- if isOptional $p.Type }}
-		if _err := json.NewDecoder(_req.Body).Decode(&{{$p.Name}}); _err != nil {
+		if _err := rest.DecodeBody(_req, &{{$p.Name}}); _err != nil {
 			if _err != io.EOF {
-				rest.HandleBadRequestErr(_err)				
+				rest.HandleDecodeBodyErr(_err)
 			}
 		} else {
 			{{- if isStruct $p }}
@@ -191,8 +191,8 @@ var appendHttpHandlerImplTmpl = `
 			{{- end }}
 		}
 		{{- else }}
-		if _err := json.NewDecoder(_req.Body).Decode(&{{$p.Name}}); _err != nil {
-			rest.HandleBadRequestErr(_err)	
+		if _err := rest.DecodeBody(_req, &{{$p.Name}}); _err != nil {
+			rest.HandleDecodeBodyErr(_err)
 		} else {
 			{{- if isStruct $p }}
 			if _err := rest.ValidateStruct({{$p.Name}}); _err != nil {
@@ -387,8 +387,7 @@ var appendHttpHandlerImplTmpl = `
 			{{- end }}
 		{{- end }}
 		{{- if not $done }}
-			_writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
-			if _err := json.NewEncoder(_writer).Encode(struct {
+			if _err := rest.EncodeBody(_writer, _req, struct {
 				{{- range $r := $m.Results }}
 				{{- if ne $r.Type "error" }}
 				{{ $r.Name | toCamel }} {{ $r.Type }} ` + "`" + `json:"{{ $r.Name | convertCase }}{{if $.Config.Omitempty}},omitempty{{end}}"` + "`" + `
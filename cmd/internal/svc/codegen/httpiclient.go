@@ -28,6 +28,10 @@ import (
 
 type Options struct {
 	GzipReqBody bool
+	// ContentType is media type request body is encoded in, e.g. application/msgpack, default is json
+	ContentType string
+	// Accept is value of Accept header, e.g. application/cbor, responses are decoded by their Content-Type
+	Accept string
 }
 
 type I{{.Meta.Name}}Client interface {
@@ -12,13 +12,16 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
 
 	"github.com/iancoleman/strcase"
+	"github.com/pkg/errors"
 	"github.com/samber/lo"
 	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/go-doudou/v2/framework/errcode"
 	"github.com/unionj-cloud/toolkit/astutils"
 	"github.com/unionj-cloud/toolkit/constants"
 	v3 "github.com/unionj-cloud/toolkit/openapi/v3"
@@ -361,10 +364,7 @@ func pathsOf(ic astutils.InterfaceCollector, config GenDocConfig) map[string]v3.
 	pathmap := make(map[string]v3.Path)
 	inter := ic.Interfaces[0]
 	for _, method := range inter.Methods {
-		endpoint := fmt.Sprintf("/%s", ApiPattern(method.Name))
-		if config.RoutePatternStrategy == 1 {
-			endpoint = fmt.Sprintf("/%s/%s", strings.ToLower(inter.Name), NoSplitPattern(method.Name))
-		}
+		endpoint := endpointOf(inter, method, config)
 		hm, _ := astutils.Pattern(method.Name)
 		op := operationOf(method, hm, config)
 		if val, ok := pathmap[endpoint]; ok {
@@ -379,6 +379,158 @@ func pathsOf(ic astutils.InterfaceCollector, config GenDocConfig) map[string]v3.
 	return pathmap
 }
 
+func endpointOf(inter astutils.InterfaceMeta, method astutils.MethodMeta, config GenDocConfig) string {
+	if config.RoutePatternStrategy == 1 {
+		return fmt.Sprintf("/%s/%s", strings.ToLower(inter.Name), NoSplitPattern(method.Name))
+	}
+	return fmt.Sprintf("/%s", ApiPattern(method.Name))
+}
+
+const errorsAnnotation = "@errors"
+
+// errorResponses documents error responses of operations annotated with @errors(code1,code2) from error catalog.
+// Responses are grouped by http status code, and error codes with message templates are listed in description and
+// x-error-codes extension. v3.Responses only has fields for fixed status codes, so the marshaled document is
+// patched as generic json.
+func errorResponses(data []byte, ic astutils.InterfaceCollector, config GenDocConfig, defs []errcode.ErrorDef) ([]byte, error) {
+	defmap := make(map[int]errcode.ErrorDef, len(defs))
+	for _, def := range defs {
+		defmap[def.Code] = def
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	paths, _ := doc["paths"].(map[string]interface{})
+	var documented bool
+	inter := ic.Interfaces[0]
+	for _, method := range inter.Methods {
+		var codes []int
+		for _, annotation := range method.Annotations {
+			if "@"+strings.TrimPrefix(annotation.Name, "@") != errorsAnnotation {
+				continue
+			}
+			for _, param := range annotation.Params {
+				code, err := strconv.Atoi(strings.TrimSpace(param))
+				if err != nil {
+					return nil, errors.Errorf("invalid error code %s in %s annotation of method %s", param, errorsAnnotation, method.Name)
+				}
+				if _, ok := defmap[code]; !ok {
+					return nil, errors.Errorf("error code %d of method %s is not defined in error catalog", code, method.Name)
+				}
+				codes = append(codes, code)
+			}
+		}
+		if len(codes) == 0 {
+			continue
+		}
+		hm, _ := astutils.Pattern(method.Name)
+		path, _ := paths[endpointOf(inter, method, config)].(map[string]interface{})
+		operation, _ := path[strings.ToLower(hm)].(map[string]interface{})
+		if operation == nil {
+			continue
+		}
+		responses, _ := operation["responses"].(map[string]interface{})
+		if responses == nil {
+			responses = make(map[string]interface{})
+			operation["responses"] = responses
+		}
+		byStatus := make(map[int][]errcode.ErrorDef)
+		for _, code := range codes {
+			def := defmap[code]
+			byStatus[def.HTTPStatus] = append(byStatus[def.HTTPStatus], def)
+		}
+		for httpStatus, items := range byStatus {
+			var lines []string
+			var xcodes []interface{}
+			for _, def := range items {
+				locales := def.Locales()
+				lines = append(lines, fmt.Sprintf("%d: %s", def.Code, def.Messages[locales[0]]))
+				xcodes = append(xcodes, map[string]interface{}{
+					"code":     def.Code,
+					"grpcCode": def.GRPCCode.String(),
+					"messages": def.Messages,
+				})
+			}
+			responses[strconv.Itoa(httpStatus)] = map[string]interface{}{
+				"description": strings.Join(lines, "\n"),
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": map[string]interface{}{
+							"$ref": "#/components/schemas/" + errorRespSchema,
+						},
+					},
+				},
+				"x-error-codes": xcodes,
+			}
+		}
+		documented = true
+	}
+	if !documented {
+		return data, nil
+	}
+	components, _ := doc["components"].(map[string]interface{})
+	if components == nil {
+		components = make(map[string]interface{})
+		doc["components"] = components
+	}
+	schemas, _ := components["schemas"].(map[string]interface{})
+	if schemas == nil {
+		schemas = make(map[string]interface{})
+		components["schemas"] = schemas
+	}
+	schemas[errorRespSchema] = map[string]interface{}{
+		"title": errorRespSchema,
+		"type":  "object",
+		"properties": map[string]interface{}{
+			"code":    map[string]interface{}{"type": "integer", "format": "int32"},
+			"message": map[string]interface{}{"type": "string"},
+		},
+		"required": []string{"code", "message"},
+	}
+	return json.Marshal(doc)
+}
+
+const errorRespSchema = "ErrorResp"
+
+// bodyMediaTypes lists mediaTypes with the same schema wherever request body or successful response is json
+func bodyMediaTypes(data []byte, mediaTypes []string) ([]byte, error) {
+	var doc map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	addTo := func(holder interface{}) {
+		h, _ := holder.(map[string]interface{})
+		content, _ := h["content"].(map[string]interface{})
+		mt, ok := content["application/json"]
+		if !ok {
+			return
+		}
+		for _, item := range mediaTypes {
+			if _, exists := content[item]; !exists {
+				content[item] = mt
+			}
+		}
+	}
+	paths, _ := doc["paths"].(map[string]interface{})
+	for _, path := range paths {
+		operations, _ := path.(map[string]interface{})
+		for _, op := range operations {
+			operation, _ := op.(map[string]interface{})
+			addTo(operation["requestBody"])
+			responses, _ := operation["responses"].(map[string]interface{})
+			for status, resp := range responses {
+				if strings.HasPrefix(status, "2") {
+					addTo(resp)
+				}
+			}
+		}
+	}
+	return json.Marshal(doc)
+}
+
 var gofileTmpl = `package {{.SvcPackage}}
 
 var Oas = ` + "`" + `{{.Doc}}` + "`" + `
@@ -387,8 +539,16 @@ var Oas = ` + "`" + `{{.Doc}}` + "`" + `
 type GenDocConfig struct {
 	RoutePatternStrategy int
 	AllowGetWithReqBody  bool
+	// ErrorCatalog is path of error catalog file, default is errcode.yaml in service root directory if exists
+	ErrorCatalog string
+	// MediaTypes are media types of request and response bodies listed besides application/json,
+	// default is DefaultMediaTypes. Add application/x-protobuf if dto types are generated proto messages.
+	MediaTypes []string
 }
 
+// DefaultMediaTypes are media types which generated handlers and clients negotiate besides json
+var DefaultMediaTypes = []string{"application/msgpack", "application/cbor"}
+
 // GenDoc generates OpenAPI 3.0 description json file.
 // Not support alias type in vo or dto file.
 func GenDoc(dir string, ic astutils.InterfaceCollector, config GenDocConfig) {
@@ -441,6 +601,32 @@ func GenDoc(dir string, ic astutils.InterfaceCollector, config GenDocConfig) {
 		},
 	}
 	data, err = json.Marshal(api)
+	if err != nil {
+		panic(err)
+	}
+	mediaTypes := config.MediaTypes
+	if len(mediaTypes) == 0 {
+		mediaTypes = DefaultMediaTypes
+	}
+	if data, err = bodyMediaTypes(data, mediaTypes); err != nil {
+		panic(err)
+	}
+	catalog := config.ErrorCatalog
+	if stringutils.IsEmpty(catalog) {
+		catalog = filepath.Join(dir, errcode.CatalogFile)
+		if _, err = os.Stat(catalog); err != nil {
+			catalog = ""
+		}
+	}
+	if stringutils.IsNotEmpty(catalog) {
+		var defs []errcode.ErrorDef
+		if defs, err = errcode.ParseFile(catalog); err != nil {
+			panic(err)
+		}
+		if data, err = errorResponses(data, ic, config, defs); err != nil {
+			panic(err)
+		}
+	}
 	err = ioutil.WriteFile(docfile, data, os.ModePerm)
 	if err != nil {
 		panic(err)
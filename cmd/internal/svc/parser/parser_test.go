@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/errcode"
+	"github.com/unionj-cloud/toolkit/astutils"
+	"google.golang.org/grpc/codes"
+)
+
+func errorsTestIc(params ...string) astutils.InterfaceCollector {
+	return astutils.InterfaceCollector{
+		Interfaces: []astutils.InterfaceMeta{
+			{
+				Name: "Usersvc",
+				Methods: []astutils.MethodMeta{
+					{
+						Name: "GetUser",
+						Annotations: []astutils.Annotation{
+							{Name: "@errors", Params: params},
+						},
+					},
+					{
+						Name: "PostUser",
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	ic := errorsTestIc("40401", " 40001", "40402")
+	inter := ic.Interfaces[0]
+	getPath := endpointOf(inter, inter.Methods[0], GenDocConfig{})
+	postPath := endpointOf(inter, inter.Methods[1], GenDocConfig{})
+	data, err := json.Marshal(map[string]interface{}{
+		"paths": map[string]interface{}{
+			getPath: map[string]interface{}{
+				"get": map[string]interface{}{
+					"responses": map[string]interface{}{"200": map[string]interface{}{}},
+				},
+			},
+			postPath: map[string]interface{}{
+				"post": map[string]interface{}{
+					"responses": map[string]interface{}{"200": map[string]interface{}{}},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defs := []errcode.ErrorDef{
+		{Code: 40401, HTTPStatus: 404, GRPCCode: codes.NotFound, Messages: map[string]string{"en": "user {id} not found"}},
+		{Code: 40402, HTTPStatus: 404, GRPCCode: codes.NotFound, Messages: map[string]string{"en": "group not found"}},
+		{Code: 40001, HTTPStatus: 400, GRPCCode: codes.InvalidArgument, Messages: map[string]string{"en": "invalid name"}},
+	}
+	data, err = errorResponses(data, ic, GenDocConfig{}, defs)
+	require.NoError(t, err)
+
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Responses map[string]struct {
+				Description string                 `json:"description"`
+				Content     map[string]interface{} `json:"content"`
+				ErrorCodes  []struct {
+					Code     int    `json:"code"`
+					GrpcCode string `json:"grpcCode"`
+				} `json:"x-error-codes"`
+			} `json:"responses"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(data, &doc))
+	responses := doc.Paths[getPath]["get"].Responses
+	assert.Len(t, responses, 3)
+	assert.Equal(t, "40401: user {id} not found\n40402: group not found", responses["404"].Description)
+	require.Len(t, responses["404"].ErrorCodes, 2)
+	assert.Equal(t, codes.NotFound.String(), responses["404"].ErrorCodes[0].GrpcCode)
+	assert.Equal(t, "40001: invalid name", responses["400"].Description)
+	assert.Contains(t, responses["400"].Content, "application/json")
+	assert.Len(t, doc.Paths[postPath]["post"].Responses, 1, "methods without @errors are kept as is")
+	assert.Contains(t, doc.Components.Schemas, errorRespSchema)
+}
+
+func TestErrorResponses_Invalid(t *testing.T) {
+	defs := []errcode.ErrorDef{{Code: 40401, HTTPStatus: 404}}
+	_, err := errorResponses([]byte(`{"paths":{}}`), errorsTestIc("40499"), GenDocConfig{}, defs)
+	assert.Error(t, err, "undefined error code")
+	_, err = errorResponses([]byte(`{"paths":{}}`), errorsTestIc("abc"), GenDocConfig{}, defs)
+	assert.Error(t, err, "invalid error code")
+
+	data := []byte(`{"paths":{}}`)
+	result, err := errorResponses(data, errorsTestIc(), GenDocConfig{}, defs)
+	require.NoError(t, err)
+	assert.Equal(t, data, result, "document is untouched without @errors")
+}
@@ -87,6 +87,10 @@ type Svc struct {
 	// it will try to decode json format encoded request body.
 	AllowGetWithReqBody bool
 
+	// ErrorCatalog is path of error catalog file documented in OpenAPI json, default is errcode.yaml
+	// in service root directory if exists
+	ErrorCatalog string
+
 	DbConfig *DbConfig
 
 	module         bool
@@ -167,6 +171,7 @@ func (receiver *Svc) Http() {
 	parser.GenDoc(dir, ic, parser.GenDocConfig{
 		RoutePatternStrategy: receiver.RoutePatternStrategy,
 		AllowGetWithReqBody:  receiver.AllowGetWithReqBody,
+		ErrorCatalog:         receiver.ErrorCatalog,
 	})
 	// here go mod tidy cause performance issue on some computer
 	//runner := receiver.runner
@@ -233,6 +238,12 @@ func WithAllowGetWithReqBody(allowGetWithReqBody bool) SvcOption {
 	}
 }
 
+func WithErrorCatalog(errorCatalog string) SvcOption {
+	return func(svc *Svc) {
+		svc.ErrorCatalog = errorCatalog
+	}
+}
+
 func WithRunner(runner executils.Runner) SvcOption {
 	return func(svc *Svc) {
 		svc.runner = runner
@@ -563,6 +574,7 @@ func (receiver *Svc) Grpc() {
 		parser.GenDoc(dir, ic, parser.GenDocConfig{
 			RoutePatternStrategy: receiver.RoutePatternStrategy,
 			AllowGetWithReqBody:  receiver.AllowGetWithReqBody,
+			ErrorCatalog:         receiver.ErrorCatalog,
 		})
 	} else {
 		codegen.GenMainGrpc(dir, ic, grpcSvc)
@@ -7,11 +7,11 @@ import (
 	grpczerolog "github.com/grpc-ecosystem/go-grpc-middleware/providers/zerolog/v2"
 	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
-	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/tags"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_deadline"
 	"github.com/unionj-cloud/go-doudou/v2/framework/plugin"
 	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
 	"github.com/unionj-cloud/toolkit/pipeconn"
@@ -24,19 +24,19 @@ func main() {
 	grpcServer := grpcx.NewGrpcServer(
 		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
 			grpc_ctxtags.StreamServerInterceptor(),
-			grpc_opentracing.StreamServerInterceptor(),
 			grpc_prometheus.StreamServerInterceptor,
 			tags.StreamServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
 			logging.StreamServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
 			grpc_recovery.StreamServerInterceptor(),
+			grpcx_deadline.StreamServerInterceptor(),
 		)),
 		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
 			grpc_ctxtags.UnaryServerInterceptor(),
-			grpc_opentracing.UnaryServerInterceptor(),
 			grpc_prometheus.UnaryServerInterceptor,
 			tags.UnaryServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
 			logging.UnaryServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
 			grpc_recovery.UnaryServerInterceptor(),
+			grpcx_deadline.UnaryServerInterceptor(),
 		)),
 	)
 	lis, dialCtx := pipeconn.NewPipeListener()
@@ -49,10 +49,6 @@ func main() {
 		if r := recover(); r != nil {
 			zlogger.Info().Msgf("Recovered. Error: %v\n", r)
 		}
-		for _, key := range plugins.Keys() {
-			value, _ := plugins.Get(key)
-			value.Close()
-		}
 	}()
 	go func() {
 		grpcServer.RunWithPipe(lis)
@@ -30,10 +30,6 @@ func main() {
 		if r := recover(); r != nil {
 			zlogger.Info().Msgf("Recovered. Error: %v\n", r)
 		}
-		for _, key := range plugins.Keys() {
-			value, _ := plugins.Get(key)
-			value.Close()
-		}
 	}()
 	{{- if ne .ProjectType "rest" }}
 	go func() {
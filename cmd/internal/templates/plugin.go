@@ -4,6 +4,7 @@ var PluginTmpl = EditableHeaderTmpl + `package plugin
 
 import (
 	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_deadline"
 	"github.com/unionj-cloud/go-doudou/v2/framework/plugin"
 	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
 	"github.com/unionj-cloud/toolkit/pipeconn"
@@ -19,7 +20,6 @@ import (
 	grpczerolog "github.com/grpc-ecosystem/go-grpc-middleware/providers/zerolog/v2"
 	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
-	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/tags"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
@@ -63,24 +63,25 @@ func (receiver *{{.SvcName}}Plugin) Initialize(restServer *rest.RestServer, grpc
 	restServer.GroupRoutes("/{{.SvcName | toLower}}", rest.DocRoutes(service.Oas))
 	{{- if ne .ProjectType "rest" }}
 	if grpcServer.Server == nil {
-		grpcServer.Server = grpc.NewServer(
+		// grpcx.NewGrpcServer adds tracing, metrics and tls options like services run by themselves
+		grpcServer.Server = grpcx.NewGrpcServer(
 			grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
 				grpc_ctxtags.StreamServerInterceptor(),
-				grpc_opentracing.StreamServerInterceptor(),
 				grpc_prometheus.StreamServerInterceptor,
 				tags.StreamServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
 				logging.StreamServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
 				grpc_recovery.StreamServerInterceptor(),
+				grpcx_deadline.StreamServerInterceptor(),
 			)),
 			grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
 				grpc_ctxtags.UnaryServerInterceptor(),
-				grpc_opentracing.UnaryServerInterceptor(),
 				grpc_prometheus.UnaryServerInterceptor,
 				tags.UnaryServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
 				logging.UnaryServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
 				grpc_recovery.UnaryServerInterceptor(),
+				grpcx_deadline.UnaryServerInterceptor(),
 			)),
-		)
+		).Server
 	}
 	pb.Register{{.SvcName}}ServiceServer(grpcServer, svc)
 	{{- end }}
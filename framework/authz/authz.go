@@ -0,0 +1,237 @@
+// Package authz enforces annotations written in svc.go like @role(admin) and @permission(create,update) at runtime.
+// Annotations are looked up from the store registered by framework.RegisterAnnotationStore, by matched route name
+// for http requests and by method name for grpc requests, then checked by a Policy against claims in context
+// which are put by package jwtauth.
+package authz
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_auth"
+	"github.com/unionj-cloud/go-doudou/v2/framework/jwtauth"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest/httprouter"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrUnauthenticated is returned if an annotated operation is called without claims in context
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrForbidden is returned if claims in context don't satisfy annotations
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Checker checks one annotation against ctx, params are params of the annotation
+type Checker func(ctx context.Context, params []string) error
+
+// Policy decides whether operation having annotations can be called with ctx. Operation is route name for http
+// requests and grpc method name for grpc requests. Returning error wrapping ErrUnauthenticated results in
+// 401 Unauthorized or codes.Unauthenticated, other errors result in 403 Forbidden or codes.PermissionDenied.
+type Policy func(ctx context.Context, operation string, annotations []framework.Annotation) error
+
+// AnnotationPolicy returns Policy which requires all annotations having a checker pass,
+// annotations without checker are ignored
+func AnnotationPolicy(checkers map[string]Checker) Policy {
+	return func(ctx context.Context, operation string, annotations []framework.Annotation) error {
+		for _, annotation := range annotations {
+			check, ok := checkers[annotation.Name]
+			if !ok {
+				continue
+			}
+			if err := check(ctx, annotation.Params); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// DefaultPolicy enforces @role by RequireAnyRole and @permission by RequireAllPermissions
+var DefaultPolicy = AnnotationPolicy(map[string]Checker{
+	"role":       RequireAnyRole,
+	"permission": RequireAllPermissions,
+})
+
+// claimValues returns values of claim at dot separated claimPath, a string claim is split by space and comma
+func claimValues(claims jwtauth.Claims, claimPath string) []string {
+	var current interface{} = map[string]interface{}(claims)
+	for _, key := range strings.Split(claimPath, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	var ret []string
+	switch v := current.(type) {
+	case string:
+		ret = strings.FieldsFunc(v, func(r rune) bool {
+			return r == ' ' || r == ','
+		})
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				ret = append(ret, s)
+			}
+		}
+	case []string:
+		ret = v
+	}
+	return ret
+}
+
+func claimValuesFromContext(ctx context.Context, claimPath string) ([]string, error) {
+	claims, ok := jwtauth.FromContext(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	return claimValues(claims, claimPath), nil
+}
+
+func contains(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireAnyRole requires the claim configured by GDD_AUTHZ_ROLES_CLAIM contains at least one of roles
+func RequireAnyRole(ctx context.Context, roles []string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+	owned, err := claimValuesFromContext(ctx, config.GddAuthzRolesClaim.LoadOrDefault(config.DefaultGddAuthzRolesClaim))
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if contains(owned, role) {
+			return nil
+		}
+	}
+	return errors.Wrapf(ErrForbidden, "one of roles %s is required", strings.Join(roles, ","))
+}
+
+// RequireAllPermissions requires the claim configured by GDD_AUTHZ_PERMISSIONS_CLAIM contains all permissions
+func RequireAllPermissions(ctx context.Context, permissions []string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+	owned, err := claimValuesFromContext(ctx, config.GddAuthzPermissionsClaim.LoadOrDefault(config.DefaultGddAuthzPermissionsClaim))
+	if err != nil {
+		return err
+	}
+	for _, permission := range permissions {
+		if !contains(owned, permission) {
+			return errors.Wrapf(ErrForbidden, "permission %s is required", permission)
+		}
+	}
+	return nil
+}
+
+// Authorizer enforces annotations of http routes and grpc methods, it implements grpcx_auth.Authorizer
+type Authorizer struct {
+	policy        Policy
+	annotations   func(operation string) []framework.Annotation
+	errorRenderer rest.ErrorRenderer
+}
+
+var _ grpcx_auth.Authorizer = (*Authorizer)(nil)
+
+type AuthorizerOption func(*Authorizer)
+
+// WithPolicy replaces DefaultPolicy
+func WithPolicy(policy Policy) AuthorizerOption {
+	return func(a *Authorizer) {
+		a.policy = policy
+	}
+}
+
+// WithAnnotationStore looks up annotations from store instead of the one registered by framework.RegisterAnnotationStore
+func WithAnnotationStore(store framework.AnnotationStore) AuthorizerOption {
+	return func(a *Authorizer) {
+		a.annotations = func(operation string) []framework.Annotation {
+			return store[operation]
+		}
+	}
+}
+
+// WithErrorRenderer customizes how 401 and 403 errors are written by Middleware, default is rest.JSONErrorRenderer
+func WithErrorRenderer(renderer rest.ErrorRenderer) AuthorizerOption {
+	return func(a *Authorizer) {
+		a.errorRenderer = renderer
+	}
+}
+
+// NewAuthorizer creates an Authorizer
+func NewAuthorizer(opts ...AuthorizerOption) *Authorizer {
+	a := &Authorizer{
+		policy:        DefaultPolicy,
+		annotations:   framework.GetAnnotations,
+		errorRenderer: rest.JSONErrorRenderer,
+	}
+	for _, fn := range opts {
+		fn(a)
+	}
+	return a
+}
+
+// Check runs policy for operation, operations without annotations are allowed
+func (a *Authorizer) Check(ctx context.Context, operation string) error {
+	annotations := a.annotations(operation)
+	if len(annotations) == 0 {
+		return nil
+	}
+	return a.policy(ctx, operation, annotations)
+}
+
+// Middleware enforces annotations of matched route, it should be used after jwtauth middleware, e.g.
+// srv.AddRoutes(httpsrv.Routes(handler), jwtauth.Middleware, authz.Middleware)
+func (a *Authorizer) Middleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operation := httprouter.ParamsFromContext(r.Context()).MatchedRouteName()
+		if err := a.Check(r.Context(), operation); err != nil {
+			statusCode := http.StatusForbidden
+			if errors.Is(err, ErrUnauthenticated) {
+				statusCode = http.StatusUnauthorized
+			}
+			a.errorRenderer(w, r, rest.NewBizError(err, rest.WithStatusCode(statusCode)))
+			return
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// Authorize enforces annotations of grpc method, annotations are looked up by the last segment of fullMethod
+// like GetUserRpc, which is the key generated by go-doudou svc grpc
+func (a *Authorizer) Authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	if err := a.Check(ctx, path.Base(fullMethod)); err != nil {
+		code := codes.PermissionDenied
+		if errors.Is(err, ErrUnauthenticated) {
+			code = codes.Unauthenticated
+		}
+		return nil, status.Error(code, err.Error())
+	}
+	return ctx, nil
+}
+
+var defaultAuthorizer = NewAuthorizer()
+
+// Default returns Authorizer with DefaultPolicy and annotations registered by framework.RegisterAnnotationStore
+func Default() *Authorizer {
+	return defaultAuthorizer
+}
+
+// Middleware enforces annotations by Default authorizer
+func Middleware(inner http.Handler) http.Handler {
+	return defaultAuthorizer.Middleware(inner)
+}
@@ -0,0 +1,111 @@
+package authz
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/jwtauth"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var store = framework.AnnotationStore{
+	"GetUser": {
+		{Name: "role", Params: []string{"admin", "auditor"}},
+	},
+	"SignUp": {
+		{Name: "role", Params: []string{"admin"}},
+		{Name: "permission", Params: []string{"create", "update"}},
+	},
+	"DeleteUserRpc": {
+		{Name: "role", Params: []string{"admin"}},
+	},
+}
+
+func withClaims(claims jwtauth.Claims) context.Context {
+	return jwtauth.NewContext(context.Background(), claims)
+}
+
+func TestAuthorizer_Check(t *testing.T) {
+	a := NewAuthorizer(WithAnnotationStore(store))
+
+	assert.NoError(t, a.Check(context.Background(), "PublicApi"), "operations without annotations are allowed")
+	assert.ErrorIs(t, a.Check(context.Background(), "GetUser"), ErrUnauthenticated)
+	assert.NoError(t, a.Check(withClaims(jwtauth.Claims{"roles": []interface{}{"auditor"}}), "GetUser"))
+	assert.ErrorIs(t, a.Check(withClaims(jwtauth.Claims{"roles": []interface{}{"user"}}), "GetUser"), ErrForbidden)
+
+	assert.NoError(t, a.Check(withClaims(jwtauth.Claims{
+		"roles":       "admin",
+		"permissions": "create update delete",
+	}), "SignUp"))
+	assert.ErrorIs(t, a.Check(withClaims(jwtauth.Claims{
+		"roles":       "admin",
+		"permissions": []interface{}{"create"},
+	}), "SignUp"), ErrForbidden)
+
+	t.Setenv("GDD_AUTHZ_ROLES_CLAIM", "realm_access.roles")
+	assert.NoError(t, a.Check(withClaims(jwtauth.Claims{
+		"realm_access": map[string]interface{}{"roles": []interface{}{"admin"}},
+	}), "GetUser"), "nested claim")
+}
+
+func TestAuthorizer_Middleware(t *testing.T) {
+	a := NewAuthorizer(WithAnnotationStore(store))
+	srv := rest.NewRestServer()
+	srv.AddRoutes([]rest.Route{
+		{
+			Name:    "GetUser",
+			Method:  http.MethodGet,
+			Pattern: "/user",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("go-doudou"))
+			},
+		},
+	}, func(inner http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if role := r.Header.Get("X-Role"); role != "" {
+				r = r.WithContext(jwtauth.NewContext(r.Context(), jwtauth.Claims{"roles": []interface{}{role}}))
+			}
+			inner.ServeHTTP(w, r)
+		})
+	}, a.Middleware)
+	do := func(role string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/user", nil)
+		req.Header.Set("X-Role", role)
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("admin")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "go-doudou", rec.Body.String())
+	assert.Equal(t, http.StatusForbidden, do("user").Code)
+	assert.Equal(t, http.StatusUnauthorized, do("").Code)
+}
+
+func TestAuthorizer_Authorize(t *testing.T) {
+	denyAll := func(ctx context.Context, operation string, annotations []framework.Annotation) error {
+		return errors.Errorf("%s is disabled", operation)
+	}
+	a := NewAuthorizer(WithAnnotationStore(store))
+
+	_, err := a.Authorize(withClaims(jwtauth.Claims{"roles": []interface{}{"admin"}}), "/usersvc.UsersvcService/DeleteUserRpc")
+	require.NoError(t, err)
+	_, err = a.Authorize(withClaims(jwtauth.Claims{"roles": []interface{}{"user"}}), "/usersvc.UsersvcService/DeleteUserRpc")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = a.Authorize(context.Background(), "/usersvc.UsersvcService/DeleteUserRpc")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	a = NewAuthorizer(WithAnnotationStore(store), WithPolicy(denyAll))
+	_, err = a.Authorize(withClaims(jwtauth.Claims{"roles": []interface{}{"admin"}}), "/usersvc.UsersvcService/DeleteUserRpc")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "DeleteUserRpc is disabled")
+}
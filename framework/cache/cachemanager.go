@@ -1,12 +1,15 @@
 package cache
 
 import (
+	"context"
+	"io"
 	"strings"
 	"time"
 	"unsafe"
 
 	"github.com/dgraph-io/ristretto"
 	go_cache "github.com/patrickmn/go-cache"
+	"github.com/pkg/errors"
 	"github.com/redis/go-redis/v9"
 	gocache "github.com/unionj-cloud/toolkit/gocache/lib/cache"
 	"github.com/unionj-cloud/toolkit/gocache/lib/metrics"
@@ -16,6 +19,8 @@ import (
 	ristretto_store "github.com/unionj-cloud/toolkit/gocache/store/ristretto"
 
 	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/health"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
 	"github.com/unionj-cloud/toolkit/cast"
 	"github.com/unionj-cloud/toolkit/sliceutils"
 	"github.com/unionj-cloud/toolkit/stringutils"
@@ -23,6 +28,10 @@ import (
 
 var CacheManager gocache.CacheInterface[any]
 
+// RedisClient is the client of redis store of CacheManager, it is nil if redis is not in GDD_CACHE_STORES.
+// It is used for atomic operations across instances, e.g. locks of idempotency middleware.
+var RedisClient redis.UniversalClient
+
 const (
 	// CacheStoreRistretto TODO
 	// There is a bug for CacheStoreRistretto, do not use it.
@@ -103,17 +112,40 @@ func init() {
 		},
 	}
 
-	CacheManager = NewCacheManager(conf)
+	CacheManager, RedisClient = newCacheManager(conf)
+}
+
+// healthCheckKey is read by health checker of cache stores, it is never written
+const healthCheckKey = "go-doudou:health"
+
+// storeChecker reads healthCheckKey from the store, a store is healthy if it returns the value or not found error
+func storeChecker(c gocache.SetterCacheInterface[any]) health.CheckerFunc {
+	return func(ctx context.Context) error {
+		if _, err := c.Get(ctx, healthCheckKey); err != nil && !errors.Is(err, &store.NotFound{}) {
+			return err
+		}
+		return nil
+	}
 }
 
+// NewCacheManager creates cache manager from conf, a readiness checker named cache.{store} is registered
+// for each store. Ristretto cache and redis client are closed by a shutdown hook with lifecycle.PriorityCache.
 func NewCacheManager(conf config.Config) gocache.CacheInterface[any] {
+	cacheManager, _ := newCacheManager(conf)
+	return cacheManager
+}
+
+// newCacheManager creates cache manager from conf, redis client of the redis store is returned as well
+func newCacheManager(conf config.Config) (gocache.CacheInterface[any], redis.UniversalClient) {
 	storesStr := conf.Cache.Stores
 	if stringutils.IsEmpty(storesStr) {
-		return nil
+		return nil, nil
 	}
 	stores := strings.Split(storesStr, ",")
 
 	var setterCaches []gocache.SetterCacheInterface[any]
+	var closers []func() error
+	var universalClient redis.UniversalClient
 	ttl := conf.Cache.TTL
 
 	if sliceutils.StringContains(stores, CacheStoreRistretto) {
@@ -128,6 +160,10 @@ func NewCacheManager(conf config.Config) gocache.CacheInterface[any] {
 		if err != nil {
 			panic(err)
 		}
+		closers = append(closers, func() error {
+			ristrettoCache.Close()
+			return nil
+		})
 		var ristrettoStore *ristretto_store.RistrettoStore
 		if ttl > 0 {
 			ristrettoStore = ristretto_store.NewRistretto(ristrettoCache, store.WithExpiration(time.Duration(ttl)*time.Second), store.WithSynchronousSet())
@@ -135,11 +171,13 @@ func NewCacheManager(conf config.Config) gocache.CacheInterface[any] {
 			ristrettoStore = ristretto_store.NewRistretto(ristrettoCache, store.WithSynchronousSet())
 		}
 		setterCaches = append(setterCaches, gocache.New[any](ristrettoStore))
+		health.Register("cache."+CacheStoreRistretto, storeChecker(setterCaches[len(setterCaches)-1]))
 	}
 
 	if sliceutils.StringContains(stores, CacheStoreGoCache) {
 		gocacheClient := go_cache.New(conf.Cache.GoCache.Expiration, conf.Cache.GoCache.CleanupInterval)
 		setterCaches = append(setterCaches, gocache.New[any](go_cache_store.NewGoCache(gocacheClient)))
+		health.Register("cache."+CacheStoreGoCache, storeChecker(setterCaches[len(setterCaches)-1]))
 	}
 
 	if sliceutils.StringContains(stores, CacheStoreRedis) {
@@ -172,6 +210,10 @@ func NewCacheManager(conf config.Config) gocache.CacheInterface[any] {
 				})
 			}
 		}
+		universalClient, _ = redisClient.(redis.UniversalClient)
+		if closer, ok := redisClient.(io.Closer); ok {
+			closers = append(closers, closer.Close)
+		}
 		var redisStore *redis_store.RedisStore
 		if ttl > 0 {
 			redisStore = redis_store.NewRedis(redisClient, store.WithExpiration(time.Duration(ttl)*time.Second))
@@ -179,6 +221,19 @@ func NewCacheManager(conf config.Config) gocache.CacheInterface[any] {
 			redisStore = redis_store.NewRedis(redisClient)
 		}
 		setterCaches = append(setterCaches, gocache.New[any](redisStore))
+		health.Register("cache."+CacheStoreRedis, storeChecker(setterCaches[len(setterCaches)-1]))
+	}
+
+	if len(closers) > 0 {
+		lifecycle.OnShutdown("cache", lifecycle.PriorityCache, func(ctx context.Context) error {
+			var result error
+			for _, closer := range closers {
+				if err := closer(); err != nil && result == nil {
+					result = err
+				}
+			}
+			return result
+		})
 	}
 
 	var cacheManager gocache.CacheInterface[any]
@@ -195,5 +250,5 @@ func NewCacheManager(conf config.Config) gocache.CacheInterface[any] {
 		cacheManager = gocache.NewMetric[any](promMetrics, cacheManager)
 	}
 
-	return cacheManager
+	return cacheManager, universalClient
 }
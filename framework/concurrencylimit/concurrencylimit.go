@@ -0,0 +1,306 @@
+// Package concurrencylimit sheds load by an adaptive concurrency limit instead of a fixed worker pool like
+// rest.BulkHead. The limit is adjusted by an Algorithm from observed latency and failures: it grows while requests
+// are served fast and shrinks once latency increases or requests fail, so that a service admits as many
+// requests as it can handle without queueing. Requests beyond the limit are rejected with 503 Service Unavailable
+// or codes.Unavailable. Critical requests like health checks and manage routes are never rejected, sheddable
+// requests are rejected before the limit is reached.
+package concurrencylimit
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/toolkit/cast"
+)
+
+// ErrLimitExceeded is returned when a request is rejected
+var ErrLimitExceeded = errors.New("concurrency limit exceeded, please retry later")
+
+var (
+	limitGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "go_doudou_concurrency_limit",
+		Help: "Current adaptive concurrency limit.",
+	}, []string{"limiter"})
+	inflightGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "go_doudou_concurrency_inflight",
+		Help: "Number of requests in processing counted by concurrency limiter.",
+	}, []string{"limiter"})
+	rejectedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "go_doudou_concurrency_rejected_count",
+		Help: "Number of requests rejected by concurrency limiter.",
+	}, []string{"limiter", "priority"})
+)
+
+func init() {
+	prometheus.Register(limitGauge)
+	prometheus.Register(inflightGauge)
+	prometheus.Register(rejectedCounter)
+}
+
+// Priority decides whether a request can be rejected
+type Priority int
+
+const (
+	// PriorityNormal requests are rejected when inflight requests reach the limit
+	PriorityNormal Priority = iota
+	// PriorityCritical requests are never rejected and not counted, e.g. health checks
+	PriorityCritical
+	// PrioritySheddable requests are rejected when inflight requests reach sheddableRatio of the limit
+	PrioritySheddable
+)
+
+// sheddableRatio leaves room for normal requests when sheddable ones are rejected
+const sheddableRatio = 0.8
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityCritical:
+		return "critical"
+	case PrioritySheddable:
+		return "sheddable"
+	default:
+		return "normal"
+	}
+}
+
+// ParsePriority parses critical, normal and sheddable
+func ParsePriority(s string) (Priority, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "critical":
+		return PriorityCritical, nil
+	case "normal":
+		return PriorityNormal, nil
+	case "sheddable":
+		return PrioritySheddable, nil
+	default:
+		return PriorityNormal, errors.Errorf("unknown priority %s", s)
+	}
+}
+
+// Result is outcome of a request fed to Algorithm
+type Result int
+
+const (
+	// ResultSuccess means the request is processed, its latency is sampled
+	ResultSuccess Result = iota
+	// ResultDropped means the request failed because of overload like timeout or 503, the limit is decreased
+	ResultDropped
+	// ResultIgnore means the outcome says nothing about load, e.g. the client cancelled or the handler panicked
+	ResultIgnore
+)
+
+// Algorithm computes new limit from a sample, it is called with lock held so needs not be goroutine safe
+type Algorithm interface {
+	// Update returns new limit, inflight is the number of requests in processing when the sampled one started
+	Update(limit int, rtt time.Duration, inflight int, dropped bool) int
+}
+
+// AIMD increases limit by one when requests are served within LatencyThreshold while the limit is well utilized,
+// and multiplies it by BackoffRatio when a request is slower than LatencyThreshold or dropped
+type AIMD struct {
+	LatencyThreshold time.Duration
+	BackoffRatio     float64
+}
+
+func (a *AIMD) Update(limit int, rtt time.Duration, inflight int, dropped bool) int {
+	if dropped || rtt > a.LatencyThreshold {
+		return int(float64(limit) * a.BackoffRatio)
+	}
+	if inflight*2 >= limit {
+		return limit + 1
+	}
+	return limit
+}
+
+// Gradient compares short term latency with long term latency. The limit shrinks in proportion as requests become
+// slower than usual and grows by sqrt(limit) as long as latency is stable. It is inspired by gradient2 of
+// https://github.com/Netflix/concurrency-limits
+type Gradient struct {
+	// Tolerance is how much slower than long term latency is tolerated before the limit shrinks, default is 1.5
+	Tolerance float64
+	// Smoothing is weight of new limit, default is 0.2
+	Smoothing float64
+	// Window is number of samples of long term latency, default is 600
+	Window int
+	// BackoffRatio is ratio by which the limit is multiplied when a request is dropped, default is 0.9
+	BackoffRatio float64
+	longRtt      float64
+}
+
+func (g *Gradient) Update(limit int, rtt time.Duration, inflight int, dropped bool) int {
+	if dropped {
+		return int(float64(limit) * g.BackoffRatio)
+	}
+	sample := float64(rtt)
+	if g.longRtt == 0 {
+		g.longRtt = sample
+	} else {
+		g.longRtt += (sample - g.longRtt) / float64(g.Window)
+	}
+	// recover long term latency fast after a period of overload, otherwise the limit keeps growing
+	if g.longRtt/sample > 2 {
+		g.longRtt *= 0.95
+	}
+	// the limit is not utilized, latency says nothing about whether it should grow
+	if inflight*2 < limit {
+		return limit
+	}
+	gradient := math.Max(0.5, math.Min(1, g.Tolerance*g.longRtt/sample))
+	current := float64(limit)
+	next := current*gradient + math.Sqrt(current)
+	return int(math.Round(current*(1-g.Smoothing) + next*g.Smoothing))
+}
+
+// NewGradient creates Gradient with default parameters
+func NewGradient() *Gradient {
+	return &Gradient{
+		Tolerance:    1.5,
+		Smoothing:    0.2,
+		Window:       600,
+		BackoffRatio: config.DefaultGddConcurrencyLimitBackoffRatio,
+	}
+}
+
+// Config configures Limiter
+type Config struct {
+	// Algorithm adjusts the limit, default is AIMD
+	Algorithm Algorithm
+	// Initial is the limit at startup
+	Initial int
+	// Min is the lowest limit
+	Min int
+	// Max is the highest limit
+	Max int
+}
+
+// LoadConfig loads Config from GDD_CONCURRENCY_LIMIT_* environment variables
+func LoadConfig() (Config, error) {
+	conf := Config{
+		Initial: cast.ToIntOrDefault(config.GddConcurrencyLimitInitial.Load(), config.DefaultGddConcurrencyLimitInitial),
+		Min:     cast.ToIntOrDefault(config.GddConcurrencyLimitMin.Load(), config.DefaultGddConcurrencyLimitMin),
+		Max:     cast.ToIntOrDefault(config.GddConcurrencyLimitMax.Load(), config.DefaultGddConcurrencyLimitMax),
+	}
+	backoffRatio := cast.ToFloat64OrDefault(config.GddConcurrencyLimitBackoffRatio.Load(), config.DefaultGddConcurrencyLimitBackoffRatio)
+	if backoffRatio <= 0 || backoffRatio >= 1 {
+		return conf, errors.Errorf("%s must be between 0 and 1", config.GddConcurrencyLimitBackoffRatio)
+	}
+	switch algorithm := config.GddConcurrencyLimitAlgorithm.LoadOrDefault(config.DefaultGddConcurrencyLimitAlgorithm); algorithm {
+	case "aimd":
+		latencyThreshold, err := time.ParseDuration(config.GddConcurrencyLimitLatencyThreshold.LoadOrDefault(config.DefaultGddConcurrencyLimitLatencyThreshold))
+		if err != nil {
+			return conf, errors.Wrapf(err, "invalid %s", config.GddConcurrencyLimitLatencyThreshold)
+		}
+		conf.Algorithm = &AIMD{
+			LatencyThreshold: latencyThreshold,
+			BackoffRatio:     backoffRatio,
+		}
+	case "gradient":
+		gradient := NewGradient()
+		gradient.BackoffRatio = backoffRatio
+		conf.Algorithm = gradient
+	default:
+		return conf, errors.Errorf("unknown %s %s", config.GddConcurrencyLimitAlgorithm, algorithm)
+	}
+	return conf, nil
+}
+
+// Limiter admits requests as long as inflight requests are fewer than the adaptive limit
+type Limiter struct {
+	name     string
+	conf     Config
+	mu       sync.Mutex
+	limit    int
+	inflight int
+}
+
+// New creates Limiter, name is value of limiter label of exported metrics
+func New(name string, conf Config) *Limiter {
+	if conf.Algorithm == nil {
+		conf.Algorithm = &AIMD{
+			LatencyThreshold: time.Second,
+			BackoffRatio:     config.DefaultGddConcurrencyLimitBackoffRatio,
+		}
+	}
+	if conf.Min <= 0 {
+		conf.Min = 1
+	}
+	if conf.Max < conf.Min {
+		conf.Max = conf.Min
+	}
+	l := &Limiter{
+		name:  name,
+		conf:  conf,
+		limit: min(max(conf.Initial, conf.Min), conf.Max),
+	}
+	limitGauge.WithLabelValues(name).Set(float64(l.limit))
+	return l
+}
+
+// Limit returns current limit
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// Inflight returns number of counted requests in processing
+func (l *Limiter) Inflight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight
+}
+
+// Token is acquired for an admitted request, it must be released when the request is done
+type Token struct {
+	l        *Limiter
+	start    time.Time
+	inflight int
+}
+
+// Acquire admits a request of priority p, ok is false if it is rejected
+func (l *Limiter) Acquire(p Priority) (token *Token, ok bool) {
+	if p == PriorityCritical {
+		return &Token{}, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	threshold := float64(l.limit)
+	if p == PrioritySheddable {
+		threshold *= sheddableRatio
+	}
+	if float64(l.inflight) >= threshold {
+		rejectedCounter.WithLabelValues(l.name, p.String()).Inc()
+		return nil, false
+	}
+	l.inflight++
+	inflightGauge.WithLabelValues(l.name).Set(float64(l.inflight))
+	return &Token{
+		l:        l,
+		start:    time.Now(),
+		inflight: l.inflight,
+	}, true
+}
+
+// Release feeds result of the request to the algorithm, tokens of critical requests are no-op
+func (t *Token) Release(result Result) {
+	l := t.l
+	if l == nil {
+		return
+	}
+	rtt := time.Since(t.start)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	inflightGauge.WithLabelValues(l.name).Set(float64(l.inflight))
+	if result == ResultIgnore {
+		return
+	}
+	limit := l.conf.Algorithm.Update(l.limit, rtt, t.inflight, result == ResultDropped)
+	l.limit = min(max(limit, l.conf.Min), l.conf.Max)
+	limitGauge.WithLabelValues(l.name).Set(float64(l.limit))
+}
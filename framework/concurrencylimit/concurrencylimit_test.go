@@ -0,0 +1,198 @@
+package concurrencylimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAIMD(t *testing.T) {
+	a := &AIMD{LatencyThreshold: 100 * time.Millisecond, BackoffRatio: 0.5}
+	assert.Equal(t, 11, a.Update(10, time.Millisecond, 5, false))
+	assert.Equal(t, 10, a.Update(10, time.Millisecond, 4, false), "limit is not utilized")
+	assert.Equal(t, 5, a.Update(10, time.Second, 10, false))
+	assert.Equal(t, 5, a.Update(10, time.Millisecond, 10, true))
+}
+
+func TestGradient(t *testing.T) {
+	g := NewGradient()
+	limit := 20
+	for i := 0; i < 100; i++ {
+		limit = g.Update(limit, 10*time.Millisecond, limit, false)
+	}
+	assert.Greater(t, limit, 100, "limit grows while latency is stable")
+	grown := limit
+	for i := 0; i < 20; i++ {
+		limit = g.Update(limit, 100*time.Millisecond, limit, false)
+	}
+	assert.Less(t, limit, grown/2, "limit shrinks when latency increases")
+}
+
+func TestLimiter(t *testing.T) {
+	l := New("test", Config{
+		Algorithm: &AIMD{LatencyThreshold: time.Second, BackoffRatio: 0.5},
+		Initial:   10,
+		Min:       2,
+		Max:       11,
+	})
+	var tokens []*Token
+	for i := 0; i < 8; i++ {
+		token, ok := l.Acquire(PriorityNormal)
+		require.True(t, ok)
+		tokens = append(tokens, token)
+	}
+	_, ok := l.Acquire(PrioritySheddable)
+	assert.False(t, ok, "sheddable requests are rejected at 80% of the limit")
+	for i := 0; i < 2; i++ {
+		token, ok := l.Acquire(PriorityNormal)
+		require.True(t, ok)
+		tokens = append(tokens, token)
+	}
+	_, ok = l.Acquire(PriorityNormal)
+	assert.False(t, ok)
+	critical, ok := l.Acquire(PriorityCritical)
+	assert.True(t, ok, "critical requests are never rejected")
+	critical.Release(ResultSuccess)
+	assert.Equal(t, 10, l.Inflight())
+	assert.Equal(t, float64(10), testutil.ToFloat64(inflightGauge.WithLabelValues("test")))
+
+	tokens[0].Release(ResultSuccess)
+	assert.Equal(t, 10, l.Limit(), "limit was not utilized when the request started")
+	tokens[9].Release(ResultSuccess)
+	tokens[8].Release(ResultSuccess)
+	assert.Equal(t, 11, l.Limit(), "limit is capped by Max")
+	tokens[7].Release(ResultDropped)
+	assert.Equal(t, 5, l.Limit())
+	assert.Equal(t, float64(5), testutil.ToFloat64(limitGauge.WithLabelValues("test")))
+	tokens[6].Release(ResultDropped)
+	tokens[5].Release(ResultDropped)
+	assert.Equal(t, 2, l.Limit(), "limit is capped by Min")
+	tokens[4].Release(ResultIgnore)
+	assert.Equal(t, 2, l.Limit())
+	assert.Equal(t, 3, l.Inflight())
+}
+
+func TestMiddleware(t *testing.T) {
+	l := New("middleware", Config{Initial: 1, Min: 1, Max: 1})
+	srv := rest.NewRestServer()
+	entered := make(chan struct{})
+	proceed := make(chan struct{})
+	srv.AddRoutes([]rest.Route{
+		{
+			Name:    "GetSlow",
+			Method:  http.MethodGet,
+			Pattern: "/slow",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				entered <- struct{}{}
+				<-proceed
+			},
+		},
+		{
+			Name:    "GetFast",
+			Method:  http.MethodGet,
+			Pattern: "/fast",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("go-doudou"))
+			},
+		},
+	}, l.Middleware(WithPriority(func(r *http.Request) Priority {
+		if r.Header.Get("X-Critical") != "" {
+			return PriorityCritical
+		}
+		return HTTPPriority(r)
+	})))
+	do := func(target string, critical bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if critical {
+			req.Header.Set("X-Critical", "true")
+		}
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		do("/slow", false)
+	}()
+	<-entered
+	rec := do("/fast", false)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, do("/fast", true).Code)
+	close(proceed)
+	<-done
+	assert.Equal(t, http.StatusOK, do("/fast", false).Code)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	l := New("grpc_test", Config{Initial: 1, Min: 1, Max: 1})
+	interceptor := l.UnaryServerInterceptor(nil)
+	token, ok := l.Acquire(PriorityNormal)
+	require.True(t, ok)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/usersvc.UsersvcService/GetUserRpc"}, handler)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	resp, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+	token.Release(ResultSuccess)
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/usersvc.UsersvcService/GetUserRpc"}, handler)
+	assert.NoError(t, err)
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("GDD_CONCURRENCY_LIMIT_ALGORITHM", "gradient")
+	t.Setenv("GDD_CONCURRENCY_LIMIT_INITIAL", "50")
+	t.Setenv("GDD_CONCURRENCY_LIMIT_BACKOFF_RATIO", "0.8")
+	conf, err := LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, 50, conf.Initial)
+	require.IsType(t, &Gradient{}, conf.Algorithm)
+	assert.Equal(t, 0.8, conf.Algorithm.(*Gradient).BackoffRatio)
+
+	t.Setenv("GDD_CONCURRENCY_LIMIT_ALGORITHM", "vegas")
+	_, err = LoadConfig()
+	assert.Error(t, err)
+}
+
+func TestResult(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/user", nil)
+	assert.Equal(t, ResultSuccess, httpResult(r, http.StatusOK))
+	assert.Equal(t, ResultSuccess, httpResult(r, http.StatusInternalServerError), "500 is not overload")
+	assert.Equal(t, ResultSuccess, httpResult(r, http.StatusBadGateway))
+	assert.Equal(t, ResultDropped, httpResult(r, http.StatusServiceUnavailable))
+	assert.Equal(t, ResultDropped, httpResult(r, http.StatusGatewayTimeout))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, ResultIgnore, httpResult(r.WithContext(ctx), http.StatusServiceUnavailable), "client disconnected")
+	timeout, cancelTimeout := context.WithTimeout(context.Background(), 0)
+	defer cancelTimeout()
+	assert.Equal(t, ResultDropped, httpResult(r.WithContext(timeout), http.StatusOK))
+
+	assert.Equal(t, ResultSuccess, grpcResult(context.Background(), status.Error(codes.Internal, "bug")))
+	assert.Equal(t, ResultDropped, grpcResult(context.Background(), status.Error(codes.DeadlineExceeded, "timeout")))
+	assert.Equal(t, ResultDropped, grpcResult(context.Background(), status.Error(codes.ResourceExhausted, "overload")))
+	assert.Equal(t, ResultIgnore, grpcResult(context.Background(), status.Error(codes.Canceled, "canceled")))
+	assert.Equal(t, ResultIgnore, grpcResult(ctx, nil))
+	assert.Equal(t, ResultDropped, grpcResult(timeout, nil))
+}
+
+func TestHTTPPriority(t *testing.T) {
+	assert.Equal(t, PriorityCritical, HTTPPriority(httptest.NewRequest(http.MethodGet, "/go-doudou/health/ready", nil)))
+	assert.Equal(t, PriorityNormal, HTTPPriority(httptest.NewRequest(http.MethodGet, "/user/go-doudou/1", nil)))
+}
@@ -0,0 +1,246 @@
+package concurrencylimit
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/loglevel"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest/httprouter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var logger = loglevel.Named("concurrencylimit")
+
+// Annotation sets priority of a route or grpc method, e.g. @priority(critical) or @priority(sheddable)
+const Annotation = "priority"
+
+// priorityOf returns priority from @priority annotation of operation
+func priorityOf(operation string) (Priority, bool) {
+	item, ok := framework.GetAnnotation(operation, Annotation)
+	if !ok || len(item.Params) == 0 {
+		return PriorityNormal, false
+	}
+	p, err := ParsePriority(item.Params[0])
+	if err != nil {
+		logger.Warn().Err(err).Msgf("[go-doudou] invalid @%s on %s", Annotation, operation)
+		return PriorityNormal, false
+	}
+	return p, true
+}
+
+// managePathPrefix is prefix of health checks and manage routes under GDD_ROUTE_ROOT_PATH
+func managePathPrefix() string {
+	return path.Join("/", config.GddConfig.RouteRootPath, "go-doudou") + "/"
+}
+
+// HTTPPriority is default priority of http requests. Health checks and manage routes under
+// {GDD_ROUTE_ROOT_PATH}/go-doudou/ are critical, other routes are normal unless they are annotated by @priority.
+func HTTPPriority(r *http.Request) Priority {
+	if strings.HasPrefix(r.URL.Path, managePathPrefix()) {
+		return PriorityCritical
+	}
+	p, _ := priorityOf(httprouter.ParamsFromContext(r.Context()).MatchedRouteName())
+	return p
+}
+
+// GrpcPriority is default priority of grpc requests. Methods of grpc.health.v1.Health and grpc reflection are
+// critical, other methods are normal unless they are annotated by @priority.
+func GrpcPriority(ctx context.Context, fullMethod string) Priority {
+	if strings.HasPrefix(fullMethod, "/grpc.health.v1.Health/") || strings.HasPrefix(fullMethod, "/grpc.reflection.") {
+		return PriorityCritical
+	}
+	p, _ := priorityOf(path.Base(fullMethod))
+	return p
+}
+
+// ctxResult ignores requests cancelled by clients, which disconnect for reasons unrelated to load, e.g. mobile
+// clients switching networks, and treats exceeded deadlines as dropped
+func ctxResult(ctx context.Context) (Result, bool) {
+	switch ctx.Err() {
+	case nil:
+		return ResultSuccess, false
+	case context.DeadlineExceeded:
+		return ResultDropped, true
+	}
+	return ResultIgnore, true
+}
+
+// httpResult treats 503, 504 and timeouts as dropped, as they are signs of overload. Other errors, e.g. 500
+// caused by bugs or bad input, are not and count as success.
+func httpResult(r *http.Request, code int) Result {
+	if result, done := ctxResult(r.Context()); done {
+		return result
+	}
+	switch code {
+	case http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ResultDropped
+	}
+	return ResultSuccess
+}
+
+// grpcResult treats errors caused by overload and timeouts as dropped, cancellations are ignored
+func grpcResult(ctx context.Context, err error) Result {
+	if result, done := ctxResult(ctx); done {
+		return result
+	}
+	switch status.Code(err) {
+	case codes.Canceled:
+		return ResultIgnore
+	case codes.DeadlineExceeded, codes.Unavailable, codes.ResourceExhausted:
+		return ResultDropped
+	}
+	return ResultSuccess
+}
+
+type middlewareOptions struct {
+	priority      func(r *http.Request) Priority
+	errorRenderer rest.ErrorRenderer
+}
+
+type MiddlewareOption func(*middlewareOptions)
+
+// WithPriority replaces HTTPPriority
+func WithPriority(fn func(r *http.Request) Priority) MiddlewareOption {
+	return func(o *middlewareOptions) {
+		o.priority = fn
+	}
+}
+
+// WithErrorRenderer customizes how 503 errors are written, default is rest.JSONErrorRenderer
+func WithErrorRenderer(renderer rest.ErrorRenderer) MiddlewareOption {
+	return func(o *middlewareOptions) {
+		o.errorRenderer = renderer
+	}
+}
+
+// Middleware returns http middleware rejecting requests beyond the limit with 503 Service Unavailable
+func (l *Limiter) Middleware(opts ...MiddlewareOption) func(inner http.Handler) http.Handler {
+	o := middlewareOptions{
+		priority:      HTTPPriority,
+		errorRenderer: rest.JSONErrorRenderer,
+	}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return func(inner http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := l.Acquire(o.priority(r))
+			if !ok {
+				w.Header().Set("Retry-After", "1")
+				o.errorRenderer(w, r, rest.NewBizError(ErrLimitExceeded, rest.WithStatusCode(http.StatusServiceUnavailable)))
+				return
+			}
+			result := ResultIgnore
+			defer func() {
+				token.Release(result)
+			}()
+			m := httpsnoop.CaptureMetrics(inner, w, r)
+			result = httpResult(r, m.Code)
+		})
+	}
+}
+
+// UnaryServerInterceptor returns grpc interceptor rejecting requests beyond the limit with codes.Unavailable,
+// priority is GrpcPriority if it is nil
+func (l *Limiter) UnaryServerInterceptor(priority func(ctx context.Context, fullMethod string) Priority) grpc.UnaryServerInterceptor {
+	if priority == nil {
+		priority = GrpcPriority
+	}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		token, ok := l.Acquire(priority(ctx, info.FullMethod))
+		if !ok {
+			return nil, status.Error(codes.Unavailable, ErrLimitExceeded.Error())
+		}
+		result := ResultIgnore
+		defer func() {
+			token.Release(result)
+		}()
+		resp, err = handler(ctx, req)
+		result = grpcResult(ctx, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns grpc interceptor rejecting streams beyond the limit with codes.Unavailable,
+// priority is GrpcPriority if it is nil
+func (l *Limiter) StreamServerInterceptor(priority func(ctx context.Context, fullMethod string) Priority) grpc.StreamServerInterceptor {
+	if priority == nil {
+		priority = GrpcPriority
+	}
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		ctx := stream.Context()
+		token, ok := l.Acquire(priority(ctx, info.FullMethod))
+		if !ok {
+			return status.Error(codes.Unavailable, ErrLimitExceeded.Error())
+		}
+		result := ResultIgnore
+		defer func() {
+			token.Release(result)
+		}()
+		err = handler(srv, stream)
+		result = grpcResult(ctx, err)
+		return err
+	}
+}
+
+var (
+	defaultOnce         sync.Once
+	defaultHttpLimiter  *Limiter
+	defaultGrpcLimiter  *Limiter
+	defaultHttpHandlers func(inner http.Handler) http.Handler
+)
+
+func initDefault() {
+	defaultOnce.Do(func() {
+		conf, err := LoadConfig()
+		if err != nil {
+			logger.Panic().Err(err).Msg("[go-doudou] invalid concurrency limit config")
+		}
+		defaultHttpLimiter = New("http", conf)
+		// algorithms keep state, so grpc limiter needs its own
+		if conf, err = LoadConfig(); err != nil {
+			logger.Panic().Err(err).Msg("[go-doudou] invalid concurrency limit config")
+		}
+		defaultGrpcLimiter = New("grpc", conf)
+		defaultHttpHandlers = defaultHttpLimiter.Middleware()
+	})
+}
+
+// Default returns Limiter of http requests configured by GDD_CONCURRENCY_LIMIT_* environment variables,
+// it panics if the configuration is invalid
+func Default() *Limiter {
+	initDefault()
+	return defaultHttpLimiter
+}
+
+// DefaultGrpc returns Limiter of grpc requests configured by GDD_CONCURRENCY_LIMIT_* environment variables,
+// it panics if the configuration is invalid
+func DefaultGrpc() *Limiter {
+	initDefault()
+	return defaultGrpcLimiter
+}
+
+// Middleware limits concurrency of http requests by Default, e.g. srv.Use(concurrencylimit.Middleware)
+func Middleware(inner http.Handler) http.Handler {
+	initDefault()
+	return defaultHttpHandlers(inner)
+}
+
+// UnaryServerInterceptor limits concurrency of grpc requests by DefaultGrpc
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return DefaultGrpc().UnaryServerInterceptor(nil)
+}
+
+// StreamServerInterceptor limits concurrency of grpc streams by DefaultGrpc
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return DefaultGrpc().StreamServerInterceptor(nil)
+}
@@ -39,12 +39,22 @@ func LoadConfigFromLocal() {
 	if "" == env {
 		env = "dev"
 	}
-	yaml.Load(env)
-	dotenv.Load(env)
+	trackSource(SourceYaml, func() {
+		yaml.Load(env)
+	})
+	trackSource(SourceDotenv, func() {
+		dotenv.Load(env)
+	})
 }
 
 func LoadConfigFromRemote() {
 	configType := GddConfigRemoteType.LoadOrDefault(DefaultGddConfigRemoteType)
+	trackSource(configType, func() {
+		loadConfigFromRemote(configType)
+	})
+}
+
+func loadConfigFromRemote(configType string) {
 	switch configType {
 	case "":
 		return
@@ -177,8 +187,153 @@ const (
 	// GddLogStyle is only valid when GDD_LOG_PATH is specified, accepts json or console.
 	// Default is json
 	GddLogStyle envVariable = "GDD_LOG_STYLE"
+	// GddLogReqBodyLimit sets max bytes of request body and response body to be logged
+	GddLogReqBodyLimit envVariable = "GDD_LOG_REQ_BODY_LIMIT"
+	// GddLogReqRedactHeaders sets comma separated header names whose values are masked in request and response log
+	GddLogReqRedactHeaders envVariable = "GDD_LOG_REQ_REDACT_HEADERS"
+	// GddLogReqRedactFields sets comma separated json field names and query/form parameter names whose values are masked
+	// in request and response log, matching is case-insensitive
+	GddLogReqRedactFields envVariable = "GDD_LOG_REQ_REDACT_FIELDS"
+	// GddLogReqSkipContentTypes sets comma separated content type prefixes whose body is not logged
+	GddLogReqSkipContentTypes envVariable = "GDD_LOG_REQ_SKIP_CONTENT_TYPES"
 	// GddGraceTimeout sets graceful shutdown timeout
 	GddGraceTimeout envVariable = "GDD_GRACE_TIMEOUT"
+	// GddPreStopDelay sets how long to wait after readiness is turned off and service is deregistered before draining
+	// connections, so that load balancers and clients have time to stop sending new requests
+	GddPreStopDelay envVariable = "GDD_PRE_STOP_DELAY"
+	// GddUpgradeEnable sets whether SIGHUP restarts the process gracefully: listening sockets are passed to a new
+	// process started from the same executable, and this process is drained once the new one is ready
+	GddUpgradeEnable envVariable = "GDD_UPGRADE_ENABLE"
+	// GddUpgradeTimeout sets how long to wait for the new process to become ready before the restart is aborted
+	GddUpgradeTimeout envVariable = "GDD_UPGRADE_TIMEOUT"
+	// GddHealthCheckTimeout sets timeout of running all health checkers for one probe
+	GddHealthCheckTimeout envVariable = "GDD_HEALTH_CHECK_TIMEOUT"
+
+	// GddTLSCertFile sets PEM encoded certificate file, TLS is enabled for RestServer and GrpcServer if both
+	// GDD_TLS_CERT_FILE and GDD_TLS_KEY_FILE are set. The certificate is also presented by clients for mutual TLS
+	GddTLSCertFile envVariable = "GDD_TLS_CERT_FILE"
+	// GddTLSKeyFile sets PEM encoded private key file of GDD_TLS_CERT_FILE
+	GddTLSKeyFile envVariable = "GDD_TLS_KEY_FILE"
+	// GddTLSCAFile sets PEM encoded CA certificates file, servers use it to verify client certificates,
+	// clients use it to verify server certificates instead of system roots
+	GddTLSCAFile envVariable = "GDD_TLS_CA_FILE"
+	// GddTLSClientAuth sets client certificate policy of servers, accept values are none, request, require,
+	// verify_if_given and require_and_verify
+	GddTLSClientAuth envVariable = "GDD_TLS_CLIENT_AUTH"
+	// GddTLSReloadInterval sets how often certificate, key and CA files are checked for changes
+	GddTLSReloadInterval envVariable = "GDD_TLS_RELOAD_INTERVAL"
+	// GddTLSServerName sets server name clients use to verify server certificates, default is host of the address
+	GddTLSServerName envVariable = "GDD_TLS_SERVER_NAME"
+	// GddTLSInsecureSkipVerify disables verification of server certificates by clients, only for testing
+	GddTLSInsecureSkipVerify envVariable = "GDD_TLS_INSECURE_SKIP_VERIFY"
+	// GddTLSClientEnable makes grpc clients created by service registries connect by TLS. It is false by default
+	// because peers may serve plaintext even if this service serves TLS. Https requests of rest clients use
+	// the certificate and CA file anyway.
+	GddTLSClientEnable envVariable = "GDD_TLS_CLIENT_ENABLE"
+
+	// GddCorsEnable enables CORS for business routes
+	GddCorsEnable envVariable = "GDD_CORS_ENABLE"
+	// GddCorsAllowedOrigins sets comma separated origins allowed to make cross-origin requests, an origin may contain
+	// one wildcard, e.g. https://*.example.com, * allows all origins
+	GddCorsAllowedOrigins envVariable = "GDD_CORS_ALLOWED_ORIGINS"
+	// GddCorsAllowedMethods sets comma separated methods allowed in cross-origin requests
+	GddCorsAllowedMethods envVariable = "GDD_CORS_ALLOWED_METHODS"
+	// GddCorsAllowedHeaders sets comma separated non-simple headers allowed in cross-origin requests, * allows all headers
+	GddCorsAllowedHeaders envVariable = "GDD_CORS_ALLOWED_HEADERS"
+	// GddCorsExposedHeaders sets comma separated response headers exposed to browsers
+	GddCorsExposedHeaders envVariable = "GDD_CORS_EXPOSED_HEADERS"
+	// GddCorsAllowCredentials allows cross-origin requests to include credentials like cookies and authorization headers,
+	// it can't be combined with * in GddCorsAllowedOrigins
+	GddCorsAllowCredentials envVariable = "GDD_CORS_ALLOW_CREDENTIALS"
+	// GddCorsMaxAge sets how long browsers can cache results of preflight requests, e.g. 10m
+	GddCorsMaxAge envVariable = "GDD_CORS_MAX_AGE"
+
+	// GddJWTIssuer sets expected iss claim of bearer tokens, it is also used to discover JWKS url by
+	// {issuer}/.well-known/openid-configuration if GDD_JWT_JWKS_URL is not set
+	GddJWTIssuer envVariable = "GDD_JWT_ISSUER"
+	// GddJWTAudience sets comma separated audiences, tokens must have at least one of them in aud claim
+	GddJWTAudience envVariable = "GDD_JWT_AUDIENCE"
+	// GddJWTJwksUrl sets url of JSON Web Key Set to verify RS, PS and ES signed tokens, a local file path is also accepted
+	GddJWTJwksUrl envVariable = "GDD_JWT_JWKS_URL"
+	// GddJWTJwksRefreshInterval sets how long fetched JSON Web Key Set is cached
+	GddJWTJwksRefreshInterval envVariable = "GDD_JWT_JWKS_REFRESH_INTERVAL"
+	// GddJWTSecret sets shared secret to verify HS signed tokens
+	GddJWTSecret envVariable = "GDD_JWT_SECRET"
+	// GddJWTAlgorithms sets comma separated accepted signing algorithms
+	GddJWTAlgorithms envVariable = "GDD_JWT_ALGORITHMS"
+	// GddJWTLeeway sets allowed clock skew when validating exp, nbf and iat claims
+	GddJWTLeeway envVariable = "GDD_JWT_LEEWAY"
+
+	// GddAuthzRolesClaim sets claim holding roles checked by @role annotation, nested claim is accessed by dot
+	// separated path like realm_access.roles
+	GddAuthzRolesClaim envVariable = "GDD_AUTHZ_ROLES_CLAIM"
+	// GddAuthzPermissionsClaim sets claim holding permissions checked by @permission annotation, nested claim is
+	// accessed by dot separated path
+	GddAuthzPermissionsClaim envVariable = "GDD_AUTHZ_PERMISSIONS_CLAIM"
+
+	// GddIdempotencyTTL sets how long responses of requests having Idempotency-Key header are kept for replaying,
+	// it can be overridden by @idempotent(ttl) annotation
+	GddIdempotencyTTL envVariable = "GDD_IDEMPOTENCY_TTL"
+	// GddIdempotencyLockTTL sets how long a request in processing blocks duplicates, in case the instance processing
+	// it crashes
+	GddIdempotencyLockTTL envVariable = "GDD_IDEMPOTENCY_LOCK_TTL"
+	// GddIdempotencyWaitTimeout sets how long a duplicate request waits for the one in processing before 409 Conflict
+	// is returned, 0 means returning 409 Conflict immediately
+	GddIdempotencyWaitTimeout envVariable = "GDD_IDEMPOTENCY_WAIT_TIMEOUT"
+	// GddIdempotencyMaxBodySize sets max bytes of response body to be stored, larger responses are not replayed
+	GddIdempotencyMaxBodySize envVariable = "GDD_IDEMPOTENCY_MAX_BODY_SIZE"
+	// GddIdempotencyMaxRequestBodySize sets max bytes of request body read for fingerprinting, larger requests get
+	// 413 Request Entity Too Large
+	GddIdempotencyMaxRequestBodySize envVariable = "GDD_IDEMPOTENCY_MAX_REQUEST_BODY_SIZE"
+
+	// GddHttpCacheTTL sets how long responses of routes annotated by @cache are cached, it can be overridden by
+	// @cache(ttl) annotation and by max-age directive of Cache-Control header written by handlers
+	GddHttpCacheTTL envVariable = "GDD_HTTPCACHE_TTL"
+	// GddHttpCacheVaryHeaders sets comma separated request headers whose values are part of cache key
+	GddHttpCacheVaryHeaders envVariable = "GDD_HTTPCACHE_VARY_HEADERS"
+	// GddHttpCacheMaxBodySize sets max bytes of response body to be cached, larger responses are not cached
+	GddHttpCacheMaxBodySize envVariable = "GDD_HTTPCACHE_MAX_BODY_SIZE"
+	// GddHttpCacheLocalSize sets max number of responses cached in memory if GDD_CACHE_STORES is not set
+	GddHttpCacheLocalSize envVariable = "GDD_HTTPCACHE_LOCAL_SIZE"
+
+	// GddRateLimitDefault sets limit of routes without their own limit, in format of ratelimit.Parse like 100-S-200,
+	// empty means routes without their own limit are not limited
+	GddRateLimitDefault envVariable = "GDD_RATELIMIT_DEFAULT"
+	// GddRateLimitRoutes sets limits of routes, e.g. GetUser=10-S,SignUp=5-M-10, they take precedence over
+	// @ratelimit annotations
+	GddRateLimitRoutes envVariable = "GDD_RATELIMIT_ROUTES"
+	// GddRateLimitKey sets what requests are limited by, one of ip, subject, route and header:{name}
+	GddRateLimitKey envVariable = "GDD_RATELIMIT_KEY"
+	// GddRateLimitMaxKeys sets max number of keys whose limiters are kept in memory
+	GddRateLimitMaxKeys envVariable = "GDD_RATELIMIT_MAX_KEYS"
+
+	// GddConcurrencyLimitAlgorithm sets how concurrency limit is adjusted, aimd or gradient
+	GddConcurrencyLimitAlgorithm envVariable = "GDD_CONCURRENCY_LIMIT_ALGORITHM"
+	// GddConcurrencyLimitInitial sets concurrency limit at startup
+	GddConcurrencyLimitInitial envVariable = "GDD_CONCURRENCY_LIMIT_INITIAL"
+	// GddConcurrencyLimitMin sets the lowest concurrency limit
+	GddConcurrencyLimitMin envVariable = "GDD_CONCURRENCY_LIMIT_MIN"
+	// GddConcurrencyLimitMax sets the highest concurrency limit
+	GddConcurrencyLimitMax envVariable = "GDD_CONCURRENCY_LIMIT_MAX"
+	// GddConcurrencyLimitLatencyThreshold sets latency above which aimd algorithm treats a request as overloaded
+	GddConcurrencyLimitLatencyThreshold envVariable = "GDD_CONCURRENCY_LIMIT_LATENCY_THRESHOLD"
+	// GddConcurrencyLimitBackoffRatio sets ratio by which concurrency limit is multiplied when overloaded
+	GddConcurrencyLimitBackoffRatio envVariable = "GDD_CONCURRENCY_LIMIT_BACKOFF_RATIO"
+
+	// GddMetricsEnable sets whether RED metrics of http routes and grpc methods are collected, independent of
+	// GddManageEnable. They are served at /go-doudou/prometheus behind basic auth only if GddManageEnable is true,
+	// unless GddMetricsPublic is true
+	GddMetricsEnable envVariable = "GDD_METRICS_ENABLE"
+	// GddMetricsPublic sets whether /go-doudou/prometheus is served without basic auth, it is served even if
+	// GddManageEnable is false in this case
+	GddMetricsPublic envVariable = "GDD_METRICS_PUBLIC"
+	// GddMetricsLegacy sets whether go_doudou_http_request_count and go_doudou_http_response_time_seconds labelled
+	// by raw url path are still recorded besides go_doudou_http_requests_total and
+	// go_doudou_http_request_duration_seconds labelled by route template, so that dashboards can be migrated
+	GddMetricsLegacy envVariable = "GDD_METRICS_LEGACY"
+	// GddMetricsBuckets sets comma separated buckets in seconds of request duration histograms
+	GddMetricsBuckets envVariable = "GDD_METRICS_BUCKETS"
+
 	// GddWriteTimeout sets http connection write timeout
 	GddWriteTimeout envVariable = "GDD_WRITE_TIMEOUT"
 	// GddReadTimeout sets http connection read timeout
@@ -197,6 +352,14 @@ const (
 	GddPort envVariable = "GDD_PORT"
 	// GddGrpcPort sets bind port for grpc server
 	GddGrpcPort envVariable = "GDD_GRPC_PORT"
+	// GddListen sets comma separated listen addresses of http server instead of GddHost and GddPort,
+	// e.g. tcp://:6060,unix:///run/app/http.sock?mode=0660,systemd://http
+	GddListen envVariable = "GDD_LISTEN"
+	// GddGrpcListen sets comma separated listen addresses of grpc server instead of GddGrpcPort
+	GddGrpcListen envVariable = "GDD_GRPC_LISTEN"
+	// GddReusePort sets SO_REUSEPORT on tcp listeners so that several processes can serve the same port,
+	// it is ignored if rest.WithListenConfig or grpcx.GrpcServer.SetListenConfig is used
+	GddReusePort envVariable = "GDD_REUSEPORT"
 	// GddManage if true, it will add built-in apis with /go-doudou path prefix for online api document and service status monitor etc.
 	GddManage envVariable = "GDD_MANAGE_ENABLE"
 	// GddManageUser manage api endpoint http basic auth user
@@ -214,8 +377,24 @@ const (
 	// GddConfigRemoteType has two options available: nacos, apollo
 	GddConfigRemoteType envVariable = "GDD_CONFIG_REMOTE_TYPE"
 
-	GddRetryCount         envVariable = "GDD_RETRY_COUNT"
+	GddRetryCount envVariable = "GDD_RETRY_COUNT"
+	// GddTracingMetricsRoot was used as metrics namespace by jaeger tracer
+	// Deprecated: tracing has moved to OpenTelemetry
 	GddTracingMetricsRoot envVariable = "GDD_TRACING_METRICS_ROOT"
+	// GddTracingExporter has five options available: otlpgrpc, otlphttp, stdout, file, none
+	GddTracingExporter envVariable = "GDD_TRACING_EXPORTER"
+	// GddTracingEndpoint sets host:port of OTLP collector. If empty, OTEL_EXPORTER_OTLP_ENDPOINT or exporter default will be used
+	GddTracingEndpoint envVariable = "GDD_TRACING_ENDPOINT"
+	// GddTracingInsecure disables client transport security for OTLP exporters
+	GddTracingInsecure envVariable = "GDD_TRACING_INSECURE"
+	// GddTracingTimeout sets timeout for OTLP exporters sending each batch of spans
+	GddTracingTimeout envVariable = "GDD_TRACING_TIMEOUT"
+	// GddTracingFile is only valid when GDD_TRACING_EXPORTER is file, spans will be appended to it as json
+	GddTracingFile envVariable = "GDD_TRACING_FILE"
+	// GddTracingSampler accepts always_on, always_off, traceidratio, parentbased_always_on, parentbased_always_off, parentbased_traceidratio
+	GddTracingSampler envVariable = "GDD_TRACING_SAMPLER"
+	// GddTracingSamplerArg is sampling ratio for traceidratio and parentbased_traceidratio sampler
+	GddTracingSamplerArg envVariable = "GDD_TRACING_SAMPLER_ARG"
 
 	GddServiceDiscoveryMode envVariable = "GDD_SERVICE_DISCOVERY_MODE"
 
@@ -358,6 +537,32 @@ const (
 	GddCacheGocacheExpiration      envVariable = "GDD_CACHE_GOCACHE_EXPIRATION"
 	GddCacheGocacheCleanupInterval envVariable = "GDD_CACHE_GOCACHE_CLEANUP_INTERVAL"
 
+	// GddGatewayUpstreams declares static upstreams for rest.Proxy gateway, services are separated by semicolon,
+	// urls are separated by comma, weight is optional and appended after a vertical bar, default is 1.
+	// e.g. legacy=http://10.0.0.1:8080|3,http://10.0.0.2:8080;billing=http://billing:9000
+	// version is optional and appended after weight, e.g. legacy=http://10.0.0.3:8080|1|v2
+	GddGatewayUpstreams envVariable = "GDD_GATEWAY_UPSTREAMS"
+	// GddGatewayRoutesFile is path of yaml file which declares routing rules for rest.Proxy gateway
+	GddGatewayRoutesFile envVariable = "GDD_GATEWAY_ROUTES_FILE"
+	// GddGatewayRoutesDataId is nacos dataId or apollo namespace which holds routing rules in yaml for rest.Proxy gateway,
+	// rules will be reloaded on change. Which remote config center to use is decided by GDD_CONFIG_REMOTE_TYPE.
+	GddGatewayRoutesDataId envVariable = "GDD_GATEWAY_ROUTES_DATAID"
+	// GddGatewayTimeout is default timeout of each attempt to upstream, empty means no timeout
+	GddGatewayTimeout envVariable = "GDD_GATEWAY_TIMEOUT"
+	// GddGatewayRetries is default max retries of idempotent requests without body on another instance,
+	// default is 0, requests are not retried unless it is set
+	GddGatewayRetries envVariable = "GDD_GATEWAY_RETRIES"
+	// GddGatewayOutlierConsecutiveErrors is the number of consecutive 5xx responses or connection errors
+	// after which an instance is ejected, default is 0 which means outlier ejection is disabled
+	GddGatewayOutlierConsecutiveErrors envVariable = "GDD_GATEWAY_OUTLIER_CONSECUTIVE_ERRORS"
+	// GddGatewayOutlierBaseEjectionTime is ejection duration of the first ejection, it is multiplied by the number of
+	// continuous ejections of the instance
+	GddGatewayOutlierBaseEjectionTime envVariable = "GDD_GATEWAY_OUTLIER_BASE_EJECTION_TIME"
+	GddGatewayOutlierMaxEjectionTime  envVariable = "GDD_GATEWAY_OUTLIER_MAX_EJECTION_TIME"
+	// GddGatewayPolicies overrides above policies per service, services are separated by semicolon, options are separated by comma
+	// e.g. order=timeout:3s,retries:2;billing=timeout:10s,retries:0,consecutiveErrors:3
+	GddGatewayPolicies envVariable = "GDD_GATEWAY_POLICIES"
+
 	GddZkServers          envVariable = "GDD_ZK_SERVERS"
 	GddZkSequence         envVariable = "GDD_ZK_SEQUENCE"
 	GddZkDirectoryPattern envVariable = "GDD_ZK_DIRECTORY_PATTERN"
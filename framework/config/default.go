@@ -30,6 +30,7 @@ const (
 	DefaultGddHost               = ""
 	DefaultGddPort               = 6060
 	DefaultGddGrpcPort           = 50051
+	DefaultGddReusePort          = false
 	DefaultGddRetryCount         = 0
 	DefaultGddManage             = true
 	DefaultGddManageUser         = "admin"
@@ -37,6 +38,70 @@ const (
 	DefaultGddTracingMetricsRoot = "tracing"
 	DefaultGddWeight             = 1
 
+	DefaultGddPreStopDelay   = "0s"
+	DefaultGddUpgradeEnable  = false
+	DefaultGddUpgradeTimeout = "1m"
+
+	DefaultGddHealthCheckTimeout = "3s"
+
+	DefaultGddTLSClientAuth         = "none"
+	DefaultGddTLSReloadInterval     = "10s"
+	DefaultGddTLSInsecureSkipVerify = false
+	DefaultGddTLSClientEnable       = false
+
+	DefaultGddCorsEnable           = false
+	DefaultGddCorsAllowedOrigins   = "*"
+	DefaultGddCorsAllowedMethods   = "GET,POST,PUT,PATCH,DELETE,HEAD"
+	DefaultGddCorsAllowedHeaders   = "*"
+	DefaultGddCorsAllowCredentials = false
+	DefaultGddCorsMaxAge           = "0s"
+
+	DefaultGddJWTJwksRefreshInterval = "1h"
+	DefaultGddJWTAlgorithms          = "HS256,HS384,HS512,RS256,RS384,RS512,PS256,PS384,PS512,ES256,ES384,ES512"
+	DefaultGddJWTLeeway              = "30s"
+
+	DefaultGddAuthzRolesClaim       = "roles"
+	DefaultGddAuthzPermissionsClaim = "permissions"
+
+	DefaultGddIdempotencyTTL                = "24h"
+	DefaultGddIdempotencyLockTTL            = "1m"
+	DefaultGddIdempotencyWaitTimeout        = "5s"
+	DefaultGddIdempotencyMaxBodySize        = 1 << 20
+	DefaultGddIdempotencyMaxRequestBodySize = 4 << 20
+
+	DefaultGddHttpCacheTTL         = "1m"
+	DefaultGddHttpCacheVaryHeaders = "Accept,Accept-Encoding,Accept-Language"
+	DefaultGddHttpCacheMaxBodySize = 1 << 20
+	DefaultGddHttpCacheLocalSize   = 1000
+
+	DefaultGddRateLimitKey     = "ip"
+	DefaultGddRateLimitMaxKeys = 10000
+
+	DefaultGddConcurrencyLimitAlgorithm        = "aimd"
+	DefaultGddConcurrencyLimitInitial          = 20
+	DefaultGddConcurrencyLimitMin              = 5
+	DefaultGddConcurrencyLimitMax              = 1000
+	DefaultGddConcurrencyLimitLatencyThreshold = "1s"
+	DefaultGddConcurrencyLimitBackoffRatio     = 0.9
+
+	DefaultGddMetricsEnable  = true
+	DefaultGddMetricsPublic  = false
+	DefaultGddMetricsLegacy  = false
+	DefaultGddMetricsBuckets = "0.005,0.01,0.025,0.05,0.1,0.25,0.5,1,2.5,5,10"
+
+	DefaultGddLogReqBodyLimit        = 4096
+	DefaultGddLogReqRedactHeaders    = "Authorization,Proxy-Authorization,Cookie,Set-Cookie,X-Api-Key"
+	DefaultGddLogReqRedactFields     = "password,passwd,secret,token,accessToken,refreshToken"
+	DefaultGddLogReqSkipContentTypes = "multipart/,image/,audio/,video/,font/,application/octet-stream,application/zip,application/gzip,application/pdf,application/grpc,application/x-protobuf,application/msgpack,application/cbor"
+
+	DefaultGddTracingExporter   = "otlpgrpc"
+	DefaultGddTracingEndpoint   = ""
+	DefaultGddTracingInsecure   = false
+	DefaultGddTracingTimeout    = "10s"
+	DefaultGddTracingFile       = "traces.json"
+	DefaultGddTracingSampler    = "parentbased_always_on"
+	DefaultGddTracingSamplerArg = 1.0
+
 	DefaultGddServiceDiscoveryMode = ""
 
 	DefaultGddNacosNamespaceId         = "public"
@@ -128,6 +193,17 @@ const (
 	DefaultGddDBPostgresPreferSimpleProtocol = false
 	DefaultGddDBPostgresWithoutReturning     = false
 
+	DefaultGddGatewayUpstreams    = ""
+	DefaultGddGatewayRoutesFile   = ""
+	DefaultGddGatewayRoutesDataId = ""
+	DefaultGddGatewayTimeout      = ""
+	DefaultGddGatewayRetries      = 0
+
+	DefaultGddGatewayOutlierConsecutiveErrors = 0
+	DefaultGddGatewayOutlierBaseEjectionTime  = "30s"
+	DefaultGddGatewayOutlierMaxEjectionTime   = "5m"
+	DefaultGddGatewayPolicies                 = ""
+
 	DefaultGddZkServers          = ""
 	DefaultGddZkSequence         = false
 	DefaultGddZkDirectoryPattern = "/registry/%s/providers"
@@ -59,3 +59,35 @@ type BaseApolloListener struct {
 
 func (c *BaseApolloListener) OnNewestChange(event *storage.FullChangeEvent) {
 }
+
+// ApolloContentKey is the key under which apollo stores whole content of a non-properties namespace like routes.yaml
+const ApolloContentKey = "content"
+
+type rawApolloListener struct {
+	namespace string
+	onChange  func(content string)
+}
+
+func (l *rawApolloListener) OnChange(event *storage.ChangeEvent) {
+	if event.Namespace != l.namespace {
+		return
+	}
+	if change, ok := event.Changes[ApolloContentKey]; ok {
+		l.onChange(fmt.Sprint(change.NewValue))
+	}
+}
+
+func (l *rawApolloListener) OnNewestChange(event *storage.FullChangeEvent) {
+}
+
+// ListenApolloRaw passes raw content of namespace to onChange at once and again whenever it changes.
+// It's for namespaces which are not loaded as environment variables, such as gateway routing rules.
+func ListenApolloRaw(namespace string, onChange func(content string)) {
+	if c := ApolloClient.GetConfigAndInit(namespace); c != nil {
+		onChange(c.GetValue(ApolloContentKey))
+	}
+	ApolloClient.AddChangeListener(&rawApolloListener{
+		namespace: namespace,
+		onChange:  onChange,
+	})
+}
@@ -206,3 +206,20 @@ func (m *NacosConfigMgr) AddChangeListener(param NacosConfigListenerParam) {
 	}
 	m.listeners.Set(key, param)
 }
+
+// ListenRaw passes raw content of dataId to onChange at once and again whenever it changes.
+// It's for dataIds which are not loaded as environment variables, such as gateway routing rules.
+func (m *NacosConfigMgr) ListenRaw(dataId string, onChange func(content string)) error {
+	content, err := m.fetchConfig(dataId)
+	if err != nil {
+		return errors.Wrapf(err, "[go-doudou] failed to fetch nacos config %s", dataId)
+	}
+	onChange(content)
+	return m.client.ListenConfig(vo.ConfigParam{
+		DataId: dataId,
+		Group:  m.group,
+		OnChange: func(namespace, group, dataId, data, old string) {
+			onChange(data)
+		},
+	})
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"log"
 	"os"
 	"strings"
@@ -20,6 +21,8 @@ import (
 
 	"github.com/unionj-cloud/go-doudou/v2/framework/cache"
 	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/health"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
 	"github.com/unionj-cloud/toolkit/caches"
 	"github.com/unionj-cloud/toolkit/cast"
 	"github.com/unionj-cloud/toolkit/errorx"
@@ -152,6 +155,11 @@ func init() {
 		maxIdleTime = config.DefaultGddDBConnMaxIdleTime
 	}
 	sqlDB.SetConnMaxIdleTime(maxIdleTime)
+	lifecycle.OnShutdown("database", lifecycle.PriorityDB, func(ctx context.Context) error {
+		return sqlDB.Close()
+	})
+	health.Register("database", health.CheckerFunc(sqlDB.PingContext))
+	ConfigureTracing(Db)
 	if cast.ToBoolOrDefault(config.GddDbPrometheusEnable.Load(), config.DefaultGddDbPrometheusEnable) &&
 		stringutils.IsNotEmpty(config.GddDbPrometheusDBName.LoadOrDefault(config.DefaultGddDbPrometheusDBName)) {
 		var collectors []prometheus.MetricsCollector
@@ -286,6 +294,7 @@ func NewDb(conf config.Config) (db *gorm.DB) {
 		}
 	}
 	sqlDB.SetConnMaxIdleTime(maxIdleTime)
+	ConfigureTracing(db)
 
 	if conf.Db.Prometheus.Enable &&
 		stringutils.IsNotEmpty(conf.Db.Prometheus.DBName) {
@@ -319,6 +328,13 @@ func ConfigureMetrics(db *gorm.DB, dbName string, refreshInterval uint32, labels
 	}))
 }
 
+// ConfigureTracing registers OpenTelemetry gorm callbacks, spans are started from the context passed by db.WithContext
+func ConfigureTracing(db *gorm.DB) {
+	if err := db.Use(NewTracingPlugin()); err != nil {
+		zlogger.Error().Err(err).Msg("[go-doudou] failed to register gorm tracing plugin")
+	}
+}
+
 func ConfigureDBCache(db *gorm.DB, cacheManager gocache.CacheInterface[any], conf CacherAdapterConfig) {
 	db.Use(&caches.Caches{Conf: &caches.Config{
 		Easer:  true,
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"github.com/wubin1989/gorm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName         = "github.com/unionj-cloud/go-doudou/v2/framework/database"
+	tracingSpanKey     = "go-doudou:otel:span"
+	tracingCallbackPre = "go-doudou:otel"
+)
+
+// TracingPlugin is a gorm plugin which starts an OpenTelemetry client span for each
+// create/query/update/delete/row/raw operation from db.Statement.Context
+type TracingPlugin struct {
+	tracer trace.Tracer
+}
+
+// NewTracingPlugin creates a gorm tracing plugin using global TracerProvider
+func NewTracingPlugin() *TracingPlugin {
+	return &TracingPlugin{
+		tracer: otel.Tracer(tracerName),
+	}
+}
+
+func (p *TracingPlugin) Name() string {
+	return "go-doudou:otel"
+}
+
+func (p *TracingPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register(tracingCallbackPre+":before_create", p.before("gorm.Create")); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:create").Register(tracingCallbackPre+":after_create", p.after); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register(tracingCallbackPre+":before_query", p.before("gorm.Query")); err != nil {
+		return err
+	}
+	if err := cb.Query().After("gorm:query").Register(tracingCallbackPre+":after_query", p.after); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register(tracingCallbackPre+":before_update", p.before("gorm.Update")); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register(tracingCallbackPre+":after_update", p.after); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register(tracingCallbackPre+":before_delete", p.before("gorm.Delete")); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:delete").Register(tracingCallbackPre+":after_delete", p.after); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register(tracingCallbackPre+":before_row", p.before("gorm.Row")); err != nil {
+		return err
+	}
+	if err := cb.Row().After("gorm:row").Register(tracingCallbackPre+":after_row", p.after); err != nil {
+		return err
+	}
+	if err := cb.Raw().Before("gorm:raw").Register(tracingCallbackPre+":before_raw", p.before("gorm.Raw")); err != nil {
+		return err
+	}
+	return cb.Raw().After("gorm:raw").Register(tracingCallbackPre+":after_raw", p.after)
+}
+
+func (p *TracingPlugin) before(spanName string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Statement == nil || db.Statement.Context == nil {
+			return
+		}
+		ctx, span := p.tracer.Start(db.Statement.Context, spanName, trace.WithSpanKind(trace.SpanKindClient))
+		if db.Dialector != nil {
+			span.SetAttributes(semconv.DBSystemKey.String(db.Dialector.Name()))
+		}
+		db.Statement.Context = ctx
+		db.InstanceSet(tracingSpanKey, span)
+	}
+}
+
+func (p *TracingPlugin) after(db *gorm.DB) {
+	value, ok := db.InstanceGet(tracingSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+	if db.Statement != nil {
+		if db.Statement.Table != "" {
+			span.SetAttributes(attribute.String("db.sql.table", db.Statement.Table))
+		}
+		if db.Statement.SQL.Len() > 0 {
+			span.SetAttributes(semconv.DBQueryText(db.Statement.SQL.String()))
+		}
+	}
+	span.SetAttributes(attribute.Int64("db.rows_affected", db.RowsAffected))
+	if db.Error != nil && db.Error != gorm.ErrRecordNotFound {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
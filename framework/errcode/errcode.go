@@ -0,0 +1,272 @@
+// Package errcode provides a central catalog of business error definitions. Each definition binds an error code
+// to http status code, gRPC status code and message templates per locale. The catalog is usually declared in
+// errcode.yaml file in the service project root, registered at startup by LoadFile or Load, used by rest.NewCodedError
+// to localise messages from Accept-Language header, and documented by go-doudou svc http --doc in OpenAPI 3.0 file
+// for operations annotated with @errors(code1,code2).
+package errcode
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/toolkit/stringutils"
+	"golang.org/x/text/language"
+	"google.golang.org/grpc/codes"
+)
+
+// CatalogFile is the default file name of error catalog in service project root
+const CatalogFile = "errcode.yaml"
+
+// ErrorDef defines a business error. Messages maps BCP 47 language tag like en or zh-CN to message template,
+// template is formatted by fmt.Sprintf with arguments given at runtime, so use %[1]s like verbs if argument order
+// differs among locales.
+type ErrorDef struct {
+	Code       int
+	HTTPStatus int
+	GRPCCode   codes.Code
+	Messages   map[string]string
+}
+
+type catalogFile struct {
+	Errors []struct {
+		Code       int               `yaml:"code"`
+		HTTPStatus int               `yaml:"httpStatus"`
+		GRPCCode   string            `yaml:"grpcCode"`
+		Messages   map[string]string `yaml:"messages"`
+	} `yaml:"errors"`
+}
+
+// Parse parses error definitions from yaml content like below. grpcCode accepts names like NOT_FOUND or numbers,
+// it defaults to UNKNOWN. httpStatus defaults to 500.
+//
+//	errors:
+//	  - code: 40401
+//	    httpStatus: 404
+//	    grpcCode: NOT_FOUND
+//	    messages:
+//	      en: order %s not found
+//	      zh-CN: 订单%s不存在
+func Parse(data []byte) ([]ErrorDef, error) {
+	var file catalogFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, errors.Wrap(err, "invalid error catalog")
+	}
+	defs := make([]ErrorDef, 0, len(file.Errors))
+	for _, item := range file.Errors {
+		def := ErrorDef{
+			Code:       item.Code,
+			HTTPStatus: item.HTTPStatus,
+			GRPCCode:   codes.Unknown,
+			Messages:   item.Messages,
+		}
+		if stringutils.IsNotEmpty(item.GRPCCode) {
+			raw := strconv.Quote(strings.ToUpper(item.GRPCCode))
+			if _, err := strconv.Atoi(item.GRPCCode); err == nil {
+				raw = item.GRPCCode
+			}
+			if err := def.GRPCCode.UnmarshalJSON([]byte(raw)); err != nil {
+				return nil, errors.Wrapf(err, "invalid grpcCode of error %d", item.Code)
+			}
+		}
+		if def.HTTPStatus == 0 {
+			def.HTTPStatus = 500
+		}
+		if err := def.validate(); err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+	return defs, nil
+}
+
+// ParseFile parses error definitions from yaml file
+func ParseFile(file string) ([]ErrorDef, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return Parse(data)
+}
+
+func (d ErrorDef) validate() error {
+	if d.Code <= 0 {
+		return errors.Errorf("invalid error code %d", d.Code)
+	}
+	if d.HTTPStatus < 100 || d.HTTPStatus > 599 {
+		return errors.Errorf("invalid http status %d of error %d", d.HTTPStatus, d.Code)
+	}
+	if len(d.Messages) == 0 {
+		return errors.Errorf("no message defined for error %d", d.Code)
+	}
+	for locale := range d.Messages {
+		if _, err := language.Parse(locale); err != nil {
+			return errors.Wrapf(err, "invalid locale %s of error %d", locale, d.Code)
+		}
+	}
+	return nil
+}
+
+// Locales returns locales of messages, default locale comes first if defined, the others are sorted
+func (d ErrorDef) Locales() []string {
+	locales := make([]string, 0, len(d.Messages))
+	for locale := range d.Messages {
+		locales = append(locales, locale)
+	}
+	defaultLocale := DefaultLocale()
+	sort.Slice(locales, func(i, j int) bool {
+		if locales[i] == defaultLocale || locales[j] == defaultLocale {
+			return locales[i] == defaultLocale
+		}
+		return locales[i] < locales[j]
+	})
+	return locales
+}
+
+type entry struct {
+	def     ErrorDef
+	locales []string
+	matcher language.Matcher
+}
+
+func newEntry(def ErrorDef) *entry {
+	locales := def.Locales()
+	tags := make([]language.Tag, 0, len(locales))
+	for _, locale := range locales {
+		tags = append(tags, language.MustParse(locale))
+	}
+	return &entry{
+		def:     def,
+		locales: locales,
+		matcher: language.NewMatcher(tags),
+	}
+}
+
+func (e *entry) localize(acceptLanguage string, args ...interface{}) (string, string) {
+	index := 0
+	if tags, _, err := language.ParseAcceptLanguage(acceptLanguage); err == nil && len(tags) > 0 {
+		_, index, _ = e.matcher.Match(tags...)
+	}
+	locale := e.locales[index]
+	tpl := e.def.Messages[locale]
+	if len(args) == 0 {
+		return tpl, locale
+	}
+	return fmt.Sprintf(tpl, args...), locale
+}
+
+var (
+	lock          sync.RWMutex
+	registry      = make(map[int]*entry)
+	defaultLocale = "en"
+)
+
+// DefaultLocale returns locale used when Accept-Language is absent or matches none of defined locales
+func DefaultLocale() string {
+	lock.RLock()
+	defer lock.RUnlock()
+	return defaultLocale
+}
+
+// SetDefaultLocale sets locale used when Accept-Language is absent or matches none of defined locales, default is en.
+// It should be called before registering error definitions.
+func SetDefaultLocale(locale string) {
+	lock.Lock()
+	defer lock.Unlock()
+	defaultLocale = locale
+}
+
+// Register adds error definitions to the catalog, it returns error if any definition is invalid or its code
+// has been registered
+func Register(defs ...ErrorDef) error {
+	entries := make(map[int]*entry, len(defs))
+	for _, def := range defs {
+		if err := def.validate(); err != nil {
+			return err
+		}
+		if _, ok := entries[def.Code]; ok {
+			return errors.Errorf("error code %d is defined more than once", def.Code)
+		}
+		entries[def.Code] = newEntry(def)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	for code := range entries {
+		if _, ok := registry[code]; ok {
+			return errors.Errorf("error code %d has been registered", code)
+		}
+	}
+	for code, e := range entries {
+		registry[code] = e
+	}
+	return nil
+}
+
+// MustRegister is like Register but panics if any error occurs
+func MustRegister(defs ...ErrorDef) {
+	if err := Register(defs...); err != nil {
+		panic(err)
+	}
+}
+
+// Load parses and registers error definitions from yaml content, it can be used with go:embed
+func Load(data []byte) error {
+	defs, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	return Register(defs...)
+}
+
+// LoadFile parses and registers error definitions from yaml file
+func LoadFile(file string) error {
+	defs, err := ParseFile(file)
+	if err != nil {
+		return err
+	}
+	return Register(defs...)
+}
+
+// Lookup returns registered error definition of code
+func Lookup(code int) (ErrorDef, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+	e, ok := registry[code]
+	if !ok {
+		return ErrorDef{}, false
+	}
+	return e.def, true
+}
+
+// Defs returns all registered error definitions sorted by code
+func Defs() []ErrorDef {
+	lock.RLock()
+	defer lock.RUnlock()
+	defs := make([]ErrorDef, 0, len(registry))
+	for _, e := range registry {
+		defs = append(defs, e.def)
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Code < defs[j].Code
+	})
+	return defs
+}
+
+// Localize formats message template of code in the locale best matching acceptLanguage, which is value of
+// Accept-Language header like zh-CN,zh;q=0.9,en;q=0.8. It returns the message and the matched locale,
+// ok is false if code has not been registered.
+func Localize(code int, acceptLanguage string, args ...interface{}) (message string, locale string, ok bool) {
+	lock.RLock()
+	e, ok := registry[code]
+	lock.RUnlock()
+	if !ok {
+		return "", "", false
+	}
+	message, locale = e.localize(acceptLanguage, args...)
+	return message, locale, true
+}
@@ -0,0 +1,133 @@
+package errcode
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+const catalogYaml = `
+errors:
+  - code: 40401
+    httpStatus: 404
+    grpcCode: not_found
+    messages:
+      en: order %s not found
+      zh-CN: 订单%s不存在
+  - code: 40901
+    grpcCode: "6"
+    messages:
+      zh-CN: 订单已存在
+`
+
+func reset() {
+	lock.Lock()
+	defer lock.Unlock()
+	registry = make(map[int]*entry)
+	defaultLocale = "en"
+}
+
+func TestParse(t *testing.T) {
+	defs, err := Parse([]byte(catalogYaml))
+	require.NoError(t, err)
+	assert.Equal(t, []ErrorDef{
+		{
+			Code:       40401,
+			HTTPStatus: 404,
+			GRPCCode:   codes.NotFound,
+			Messages:   map[string]string{"en": "order %s not found", "zh-CN": "订单%s不存在"},
+		},
+		{
+			Code:       40901,
+			HTTPStatus: 500,
+			GRPCCode:   codes.AlreadyExists,
+			Messages:   map[string]string{"zh-CN": "订单已存在"},
+		},
+	}, defs)
+
+	for name, data := range map[string]string{
+		"bad yaml":      "errors: 1",
+		"no code":       "errors:\n  - messages: {en: a}",
+		"bad status":    "errors:\n  - code: 1\n    httpStatus: 99\n    messages: {en: a}",
+		"no message":    "errors:\n  - code: 1",
+		"bad locale":    "errors:\n  - code: 1\n    messages: {'!!': a}",
+		"bad grpc code": "errors:\n  - code: 1\n    grpcCode: NOPE\n    messages: {en: a}",
+	} {
+		_, err = Parse([]byte(data))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	defer reset()
+	file := filepath.Join(t.TempDir(), CatalogFile)
+	require.NoError(t, os.WriteFile(file, []byte(catalogYaml), 0644))
+	require.NoError(t, LoadFile(file))
+	def, ok := Lookup(40401)
+	require.True(t, ok)
+	assert.Equal(t, codes.NotFound, def.GRPCCode)
+	_, ok = Lookup(1)
+	assert.False(t, ok)
+	assert.Len(t, Defs(), 2)
+	assert.Equal(t, 40401, Defs()[0].Code)
+
+	assert.Error(t, LoadFile(file), "codes have been registered")
+	assert.Error(t, LoadFile(filepath.Join(t.TempDir(), "missing.yaml")))
+}
+
+func TestRegister(t *testing.T) {
+	defer reset()
+	def := ErrorDef{Code: 1, HTTPStatus: 400, Messages: map[string]string{"en": "a"}}
+	assert.Error(t, Register(def, def))
+	assert.Empty(t, Defs())
+	assert.Error(t, Register(ErrorDef{Code: 2, Messages: map[string]string{"en": "a"}}))
+	MustRegister(def)
+	assert.Panics(t, func() {
+		MustRegister(def)
+	})
+}
+
+func TestLocalize(t *testing.T) {
+	defer reset()
+	require.NoError(t, Load([]byte(catalogYaml)))
+	cases := []struct {
+		code           int
+		acceptLanguage string
+		message        string
+		locale         string
+	}{
+		{40401, "", "order 1 not found", "en"},
+		{40401, "zh-CN,zh;q=0.9,en;q=0.8", "订单1不存在", "zh-CN"},
+		{40401, "zh", "订单1不存在", "zh-CN"},
+		{40401, "fr-FR,en;q=0.5", "order 1 not found", "en"},
+		{40401, "ja", "order 1 not found", "en"},
+		{40401, "invalid;;", "order 1 not found", "en"},
+	}
+	for _, c := range cases {
+		message, locale, ok := Localize(c.code, c.acceptLanguage, "1")
+		require.True(t, ok)
+		assert.Equal(t, c.message, message, c.acceptLanguage)
+		assert.Equal(t, c.locale, locale, c.acceptLanguage)
+	}
+	message, _, _ := Localize(40401, "en")
+	assert.Equal(t, "order %s not found", message, "template is not formatted without args")
+	// default locale is not defined, falls back to the first locale
+	message, locale, _ := Localize(40901, "en")
+	assert.Equal(t, "订单已存在", message)
+	assert.Equal(t, "zh-CN", locale)
+	_, _, ok := Localize(1, "en")
+	assert.False(t, ok)
+}
+
+func TestSetDefaultLocale(t *testing.T) {
+	defer reset()
+	SetDefaultLocale("zh-CN")
+	require.NoError(t, Load([]byte(catalogYaml)))
+	message, locale, _ := Localize(40401, "ja", "1")
+	assert.Equal(t, "订单1不存在", message)
+	assert.Equal(t, "zh-CN", locale)
+}
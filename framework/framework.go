@@ -23,6 +23,11 @@ func HasAnnotation(key string, annotationName string) bool {
 	return false
 }
 
+// GetAnnotations returns all annotations registered for key, key is route name for http and method name for grpc
+func GetAnnotations(key string) []Annotation {
+	return annotationStoreInstance[key]
+}
+
 func GetAnnotation(key string, annotationName string) (Annotation, bool) {
 	for _, item := range annotationStoreInstance[key] {
 		if item.Name == annotationName {
@@ -33,8 +38,8 @@ func GetAnnotation(key string, annotationName string) (Annotation, bool) {
 }
 
 type Annotation struct {
-	Name   string
-	Params []string
+	Name   string   `json:"name"`
+	Params []string `json:"params"`
 }
 
 type AnnotationStore map[string][]Annotation
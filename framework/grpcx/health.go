@@ -0,0 +1,106 @@
+package grpcx
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/health"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// healthWatchInterval is how often Watch re-runs readiness checkers
+var healthWatchInterval = 5 * time.Second
+
+// healthServer implements grpc.health.v1.Health by readiness checkers of package health. Empty service name
+// means the whole server, other names must be services registered on the server.
+type healthServer struct {
+	healthpb.UnimplementedHealthServer
+	server       *grpc.Server
+	lifecycle    func() *lifecycle.Lifecycle
+	draining     chan struct{}
+	drainingOnce sync.Once
+}
+
+// newHealthServer creates healthServer whose status follows readiness of the lifecycle returned by lc,
+// it is looked up on each check because the lifecycle may be set after the server is created
+func newHealthServer(server *grpc.Server, lc func() *lifecycle.Lifecycle) *healthServer {
+	return &healthServer{
+		server:    server,
+		lifecycle: lc,
+		draining:  make(chan struct{}),
+	}
+}
+
+// drain ends all Watch streams with NOT_SERVING status, so that they don't block graceful stop
+func (h *healthServer) drain() {
+	h.drainingOnce.Do(func() {
+		close(h.draining)
+	})
+}
+
+func (h *healthServer) known(service string) bool {
+	if service == "" {
+		return true
+	}
+	_, ok := h.server.GetServiceInfo()[service]
+	return ok
+}
+
+func (h *healthServer) status(ctx context.Context) healthpb.HealthCheckResponse_ServingStatus {
+	if health.ReadyOf(ctx, h.lifecycle()).Up() {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
+
+// Check implements healthpb.HealthServer
+func (h *healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if !h.known(req.GetService()) {
+		return nil, status.Errorf(codes.NotFound, "unknown service %s", req.GetService())
+	}
+	return &healthpb.HealthCheckResponse{Status: h.status(ctx)}, nil
+}
+
+// Watch implements healthpb.HealthServer, it sends current status at once and then whenever status changes
+func (h *healthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ctx := stream.Context()
+	last := healthpb.HealthCheckResponse_UNKNOWN
+	ticker := time.NewTicker(healthWatchInterval)
+	defer ticker.Stop()
+	for {
+		current := healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+		if h.known(req.GetService()) {
+			current = h.status(ctx)
+		}
+		if current != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: current}); err != nil {
+				return status.Error(codes.Canceled, "stream has ended")
+			}
+			last = current
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return status.Error(codes.Canceled, "stream has ended")
+		case <-h.draining:
+			if last != healthpb.HealthCheckResponse_NOT_SERVING {
+				stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING})
+			}
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+	}
+}
+
+// registerHealthServer registers grpc.health.v1.Health service if it is not registered by user
+func (srv *GrpcServer) registerHealthServer() {
+	if _, ok := srv.GetServiceInfo()[healthpb.Health_ServiceDesc.ServiceName]; ok {
+		return
+	}
+	srv.health = newHealthServer(srv.Server, srv.getLifecycle)
+	healthpb.RegisterHealthServer(srv.Server, srv.health)
+}
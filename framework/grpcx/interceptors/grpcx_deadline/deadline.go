@@ -0,0 +1,95 @@
+// Package grpcx_deadline bounds processing time of grpc methods by @timeout annotations, e.g. @timeout(5s).
+// Deadlines of callers are propagated by grpc itself, so the shorter of the caller deadline and the annotated
+// timeout applies. Requests whose deadline has been exceeded before they are handled are rejected with
+// codes.DeadlineExceeded instead of wasting resources on callers who have already given up.
+package grpcx_deadline
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/loglevel"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var logger = loglevel.Named("grpcx.deadline")
+
+// Annotation sets timeout of a grpc method, e.g. @timeout(5s)
+const Annotation = "timeout"
+
+// MethodTimeout returns timeout set by @timeout annotation of the grpc method, it is zero if there is none
+func MethodTimeout(fullMethod string) time.Duration {
+	operation := path.Base(fullMethod)
+	item, ok := framework.GetAnnotation(operation, Annotation)
+	if !ok || len(item.Params) == 0 {
+		return 0
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(item.Params[0]))
+	if err != nil || d <= 0 {
+		logger.Warn().Err(err).Msgf("[go-doudou] invalid @%s on %s", Annotation, operation)
+		return 0
+	}
+	return d
+}
+
+// withDeadline returns context bounded by timeout of the method, cancel must be called
+func withDeadline(ctx context.Context, fullMethod string) (context.Context, context.CancelFunc, error) {
+	if err := ctx.Err(); err != nil {
+		return ctx, func() {}, status.FromContextError(err).Err()
+	}
+	if timeout := MethodTimeout(fullMethod); timeout > 0 {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		return ctx, cancel, nil
+	}
+	return ctx, func() {}, nil
+}
+
+// UnaryServerInterceptor returns a server interceptor function to apply deadline of unary RPC
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, cancel, err := withDeadline(ctx, info.FullMethod)
+		defer cancel()
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a server interceptor function to apply deadline of stream RPC
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, cancel, err := withDeadline(stream.Context(), info.FullMethod)
+		defer cancel()
+		if err != nil {
+			return err
+		}
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = ctx
+		return handler(srv, wrapped)
+	}
+}
+
+// UnaryClientInterceptor returns a client interceptor function failing fast with codes.DeadlineExceeded or
+// codes.Canceled without sending the request once the context is done
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// DialOptions returns dial options adding client interceptors of this package, clients created by registries
+// include them by default
+func DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(UnaryClientInterceptor()),
+	}
+}
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_deadline"
+)
+
+type mockServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (m *mockServerStream) Context() context.Context {
+	return m.ctx
+}
+
+func init() {
+	framework.RegisterAnnotationStore(framework.AnnotationStore{
+		"GetUserRpc": {{Name: grpcx_deadline.Annotation, Params: []string{"50ms"}}},
+	})
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := grpcx_deadline.UnaryServerInterceptor()
+	var remaining time.Duration
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			return nil, nil
+		}
+		remaining = time.Until(deadline)
+		return "ok", nil
+	}
+
+	resp, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/usersvc.UsersvcService/GetUserRpc"}, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+	assert.InDelta(t, 50*time.Millisecond, remaining, float64(10*time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/usersvc.UsersvcService/GetUserRpc"}, handler)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, remaining, 20*time.Millisecond, "shorter deadline of caller wins")
+
+	resp, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/usersvc.UsersvcService/PageUsersRpc"}, handler)
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	_, err = interceptor(expired, nil, &grpc.UnaryServerInfo{FullMethod: "/usersvc.UsersvcService/PageUsersRpc"}, handler)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	interceptor := grpcx_deadline.StreamServerInterceptor()
+	var deadline bool
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		_, deadline = stream.Context().Deadline()
+		return nil
+	}
+	err := interceptor(nil, &mockServerStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: "/usersvc.UsersvcService/GetUserRpc"}, handler)
+	require.NoError(t, err)
+	assert.True(t, deadline)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = interceptor(nil, &mockServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/usersvc.UsersvcService/GetUserRpc"}, handler)
+	assert.Equal(t, codes.Canceled, status.Code(err))
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	interceptor := grpcx_deadline.UnaryClientInterceptor()
+	var invoked bool
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		invoked = true
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	err := interceptor(ctx, "/usersvc.UsersvcService/GetUserRpc", nil, nil, nil, invoker)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.False(t, invoked)
+	require.NoError(t, interceptor(context.Background(), "/usersvc.UsersvcService/GetUserRpc", nil, nil, nil, invoker))
+	assert.True(t, invoked)
+}
+
+func TestDialOptions(t *testing.T) {
+	var sent bool
+	conn, err := grpc.NewClient("passthrough:///127.0.0.1:1", append(grpcx_deadline.DialOptions(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			sent = true
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}))...)
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	err = conn.Invoke(ctx, "/usersvc.UsersvcService/GetUserRpc", nil, nil)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.False(t, sent, "expired requests are not sent")
+}
@@ -0,0 +1,291 @@
+// Package grpcx_metrics collects RED metrics of grpc methods on both server and client side: request count by
+// status code, error count, duration histograms with buckets from GDD_METRICS_BUCKETS, in-flight requests and
+// message sizes. Duration and count carry trace id of the request as exemplar. GrpcServer and clients created
+// by service discovery add the interceptors by default unless GDD_METRICS_ENABLE is false.
+package grpcx_metrics
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	gddmetrics "github.com/unionj-cloud/go-doudou/v2/framework/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// metricSet holds metrics of one side of grpc calls
+type metricSet struct {
+	requests     *prometheus.CounterVec
+	errors       *prometheus.CounterVec
+	duration     *prometheus.HistogramVec
+	inflight     *prometheus.GaugeVec
+	requestSize  *prometheus.SummaryVec
+	responseSize *prometheus.SummaryVec
+}
+
+func newMetricSet(side string) *metricSet {
+	prefix := "go_doudou_grpc_" + side + "_"
+	return &metricSet{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "requests_total",
+			Help: "Number of grpc requests.",
+		}, []string{"service", "method", "code"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prefix + "request_errors_total",
+			Help: "Number of grpc requests failed by server errors.",
+		}, []string{"service", "method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    prefix + "request_duration_seconds",
+			Help:    "Duration of grpc requests.",
+			Buckets: gddmetrics.Buckets(),
+		}, []string{"service", "method", "code"}),
+		inflight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: prefix + "requests_in_flight",
+			Help: "Number of grpc requests in processing.",
+		}, []string{"service", "method"}),
+		requestSize: prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Name: prefix + "request_size_bytes",
+			Help: "Size of grpc request messages.",
+		}, []string{"service", "method"}),
+		responseSize: prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Name: prefix + "response_size_bytes",
+			Help: "Size of grpc response messages.",
+		}, []string{"service", "method"}),
+	}
+}
+
+func (m *metricSet) register() {
+	prometheus.Register(m.requests)
+	prometheus.Register(m.errors)
+	prometheus.Register(m.duration)
+	prometheus.Register(m.inflight)
+	prometheus.Register(m.requestSize)
+	prometheus.Register(m.responseSize)
+}
+
+var (
+	serverMetrics = newMetricSet("server")
+	clientMetrics = newMetricSet("client")
+)
+
+func init() {
+	serverMetrics.register()
+	clientMetrics.register()
+}
+
+// splitMethod splits full method like /usersvc.UsersvcService/GetUserRpc into service and method
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.Index(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", path.Base(fullMethod)
+}
+
+// isServerError reports whether code means the server failed to handle the request
+func isServerError(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented, codes.Internal, codes.Unavailable, codes.DataLoss:
+		return true
+	}
+	return false
+}
+
+// messageSize returns size of proto message, it is zero for other messages
+func messageSize(msg interface{}) float64 {
+	if m, ok := msg.(proto.Message); ok {
+		return float64(proto.Size(m))
+	}
+	return 0
+}
+
+// call tracks one grpc request or stream
+type call struct {
+	set     *metricSet
+	ctx     context.Context
+	service string
+	method  string
+	start   time.Time
+}
+
+func (m *metricSet) begin(ctx context.Context, fullMethod string) *call {
+	c := &call{set: m, ctx: ctx, start: time.Now()}
+	c.service, c.method = splitMethod(fullMethod)
+	m.inflight.WithLabelValues(c.service, c.method).Inc()
+	return c
+}
+
+func (c *call) sent(msg interface{}, server bool) {
+	if server {
+		c.set.responseSize.WithLabelValues(c.service, c.method).Observe(messageSize(msg))
+		return
+	}
+	c.set.requestSize.WithLabelValues(c.service, c.method).Observe(messageSize(msg))
+}
+
+func (c *call) received(msg interface{}, server bool) {
+	c.sent(msg, !server)
+}
+
+func (c *call) end(err error) {
+	c.set.inflight.WithLabelValues(c.service, c.method).Dec()
+	code := status.Code(err)
+	gddmetrics.Inc(c.set.requests.WithLabelValues(c.service, c.method, code.String()), c.ctx)
+	if isServerError(code) {
+		gddmetrics.Inc(c.set.errors.WithLabelValues(c.service, c.method, code.String()), c.ctx)
+	}
+	gddmetrics.Observe(c.set.duration.WithLabelValues(c.service, c.method, code.String()), time.Since(c.start).Seconds(), c.ctx)
+}
+
+// UnaryServerInterceptor returns a server interceptor function to collect metrics of unary RPC
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		c := serverMetrics.begin(ctx, info.FullMethod)
+		c.received(req, true)
+		panicked := true
+		defer func() {
+			if panicked {
+				c.end(status.Error(codes.Internal, "panic"))
+				return
+			}
+			c.end(err)
+		}()
+		resp, err = handler(ctx, req)
+		panicked = false
+		if err == nil {
+			c.sent(resp, true)
+		}
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a server interceptor function to collect metrics of stream RPC
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		c := serverMetrics.begin(stream.Context(), info.FullMethod)
+		panicked := true
+		defer func() {
+			if panicked {
+				c.end(status.Error(codes.Internal, "panic"))
+				return
+			}
+			c.end(err)
+		}()
+		err = handler(srv, &serverStream{ServerStream: stream, call: c})
+		panicked = false
+		return err
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	call *call
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.call.sent(m, true)
+	}
+	return err
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.call.received(m, true)
+	}
+	return err
+}
+
+// UnaryClientInterceptor returns a client interceptor function to collect metrics of unary RPC
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		c := clientMetrics.begin(ctx, method)
+		c.sent(req, false)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil {
+			c.received(reply, false)
+		}
+		c.end(err)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns a client interceptor function to collect metrics of stream RPC,
+// a stream ends when it is closed by an error or io.EOF is received
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		c := clientMetrics.begin(ctx, method)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			c.end(err)
+			return nil, err
+		}
+		return &clientStream{ClientStream: stream, call: c}, nil
+	}
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	call *call
+	once sync.Once
+}
+
+func (s *clientStream) finish(err error) {
+	s.once.Do(func() {
+		s.call.end(err)
+	})
+}
+
+func (s *clientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.call.sent(m, false)
+	} else if err != io.EOF {
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil:
+		s.call.received(m, false)
+	case err == io.EOF:
+		s.finish(nil)
+	default:
+		s.finish(err)
+	}
+	return err
+}
+
+// ServerOptions returns server options adding metrics interceptors, it is empty if metrics are disabled
+func ServerOptions() []grpc.ServerOption {
+	if !gddmetrics.Enabled() {
+		return nil
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(StreamServerInterceptor()),
+	}
+}
+
+// DialOptions returns dial options adding metrics interceptors, it is empty if metrics are disabled
+func DialOptions() []grpc.DialOption {
+	if !gddmetrics.Enabled() {
+		return nil
+	}
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(StreamClientInterceptor()),
+	}
+}
@@ -0,0 +1,125 @@
+package test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_metrics"
+)
+
+type mockServerStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	recv int
+}
+
+func (m *mockServerStream) Context() context.Context {
+	return m.ctx
+}
+
+func (m *mockServerStream) RecvMsg(msg interface{}) error {
+	if m.recv == 2 {
+		return io.EOF
+	}
+	m.recv++
+	msg.(*wrapperspb.StringValue).Value = "go-doudou"
+	return nil
+}
+
+func (m *mockServerStream) SendMsg(msg interface{}) error {
+	return nil
+}
+
+func scrape(t *testing.T) string {
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := grpcx_metrics.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/usersvc.UsersvcService/GetUserRpc"}
+	_, err := interceptor(context.Background(), wrapperspb.String("go-doudou"), info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return wrapperspb.String("hello"), nil
+	})
+	require.NoError(t, err)
+	_, err = interceptor(context.Background(), wrapperspb.String("go-doudou"), info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Unavailable, "overloaded")
+	})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	_, err = interceptor(context.Background(), wrapperspb.String("go-doudou"), info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "no such user")
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Panics(t, func() {
+		interceptor(context.Background(), wrapperspb.String("go-doudou"), info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			panic("something wrong")
+		})
+	})
+
+	body := scrape(t)
+	assert.Contains(t, body, `go_doudou_grpc_server_requests_total{code="OK",method="GetUserRpc",service="usersvc.UsersvcService"} 1`)
+	assert.Contains(t, body, `go_doudou_grpc_server_requests_total{code="NotFound",method="GetUserRpc",service="usersvc.UsersvcService"} 1`)
+	assert.Contains(t, body, `go_doudou_grpc_server_request_errors_total{code="Unavailable",method="GetUserRpc",service="usersvc.UsersvcService"} 1`)
+	assert.Contains(t, body, `go_doudou_grpc_server_request_errors_total{code="Internal",method="GetUserRpc",service="usersvc.UsersvcService"} 1`)
+	assert.NotContains(t, body, `go_doudou_grpc_server_request_errors_total{code="NotFound"`, "client errors are not server errors")
+	assert.Contains(t, body, `go_doudou_grpc_server_request_duration_seconds_count{code="OK",method="GetUserRpc",service="usersvc.UsersvcService"} 1`)
+	assert.Contains(t, body, `go_doudou_grpc_server_requests_in_flight{method="GetUserRpc",service="usersvc.UsersvcService"} 0`)
+	assert.Contains(t, body, `go_doudou_grpc_server_request_size_bytes_sum{method="GetUserRpc",service="usersvc.UsersvcService"} 44`)
+	assert.Contains(t, body, `go_doudou_grpc_server_response_size_bytes_sum{method="GetUserRpc",service="usersvc.UsersvcService"} 7`)
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	interceptor := grpcx_metrics.StreamServerInterceptor()
+	info := &grpc.StreamServerInfo{FullMethod: "/usersvc.UsersvcService/ListUsersRpc"}
+	err := interceptor(nil, &mockServerStream{ctx: context.Background()}, info, func(srv interface{}, stream grpc.ServerStream) error {
+		for {
+			var msg wrapperspb.StringValue
+			if err := stream.RecvMsg(&msg); err != nil {
+				break
+			}
+		}
+		return stream.SendMsg(wrapperspb.String("hello"))
+	})
+	require.NoError(t, err)
+
+	body := scrape(t)
+	assert.Contains(t, body, `go_doudou_grpc_server_requests_total{code="OK",method="ListUsersRpc",service="usersvc.UsersvcService"} 1`)
+	assert.Contains(t, body, `go_doudou_grpc_server_request_size_bytes_count{method="ListUsersRpc",service="usersvc.UsersvcService"} 2`)
+	assert.Contains(t, body, `go_doudou_grpc_server_response_size_bytes_count{method="ListUsersRpc",service="usersvc.UsersvcService"} 1`)
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	interceptor := grpcx_metrics.UnaryClientInterceptor()
+	err := interceptor(context.Background(), "/usersvc.UsersvcService/GetUserRpc", wrapperspb.String("go-doudou"), &wrapperspb.StringValue{}, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return status.Error(codes.DeadlineExceeded, "deadline exceeded")
+		})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	body := scrape(t)
+	assert.Contains(t, body, `go_doudou_grpc_client_requests_total{code="DeadlineExceeded",method="GetUserRpc",service="usersvc.UsersvcService"} 1`)
+	assert.Contains(t, body, `go_doudou_grpc_client_request_errors_total{code="DeadlineExceeded",method="GetUserRpc",service="usersvc.UsersvcService"} 1`)
+	assert.Contains(t, body, `go_doudou_grpc_client_request_size_bytes_sum{method="GetUserRpc",service="usersvc.UsersvcService"} 11`)
+}
+
+func TestOptions(t *testing.T) {
+	assert.Len(t, grpcx_metrics.ServerOptions(), 2)
+	assert.Len(t, grpcx_metrics.DialOptions(), 2)
+	t.Setenv("GDD_METRICS_ENABLE", "false")
+	assert.Empty(t, grpcx_metrics.ServerOptions())
+	assert.Empty(t, grpcx_metrics.DialOptions())
+}
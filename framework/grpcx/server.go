@@ -4,22 +4,28 @@ import (
 	"context"
 	"fmt"
 	"net"
-	"os"
-	"os/signal"
+	"net/http"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/olekukonko/tablewriter"
 	"github.com/unionj-cloud/go-doudou/v2/framework"
 	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_metrics"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
+	"github.com/unionj-cloud/go-doudou/v2/framework/listener"
+	"github.com/unionj-cloud/go-doudou/v2/framework/loglevel"
 	register "github.com/unionj-cloud/go-doudou/v2/framework/registry"
-	"github.com/unionj-cloud/toolkit/timeutils"
-	logger "github.com/unionj-cloud/toolkit/zlogger"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
 
+var logger = loglevel.Named("grpcx")
+
 var startAt time.Time
 var reflectionRegisterOnce sync.Once
 
@@ -29,13 +35,20 @@ func init() {
 
 type GrpcServer struct {
 	*grpc.Server
-	data map[string]interface{}
+	data         map[string]interface{}
+	lifecycle    *lifecycle.Lifecycle
+	listenConfig *net.ListenConfig
+	health       *healthServer
+	prepareOnce  sync.Once
+	// servingHTTP is true if requests are served by grpc.Server.ServeHTTP through HTTPHandler
+	servingHTTP atomic.Bool
+	httpCalls   atomic.Int64
 }
 
+// NewGrpcServer creates GrpcServer with tracing, metrics and TLS options, it panics if GDD_TLS_* environment
+// variables are invalid
 func NewGrpcServer(opt ...grpc.ServerOption) *GrpcServer {
-	return &GrpcServer{
-		Server: grpc.NewServer(opt...),
-	}
+	return NewGrpcServerWithData(nil, opt...)
 }
 
 func NewEmptyGrpcServer() *GrpcServer {
@@ -46,10 +59,27 @@ func NewGrpcServerWithData(data map[string]interface{}, opt ...grpc.ServerOption
 	server := GrpcServer{
 		data: data,
 	}
-	server.Server = grpc.NewServer(opt...)
+	opt, err := withTLS(opt)
+	if err != nil {
+		logger.Panic().Err(err).Msg("[go-doudou] invalid tls config")
+	}
+	server.Server = grpc.NewServer(withMetrics(withTracing(opt))...)
 	return &server
 }
 
+// withTracing prepends OpenTelemetry stats handler to server options, span context is
+// extracted from W3C traceparent and baggage metadata by the global propagator
+func withTracing(opt []grpc.ServerOption) []grpc.ServerOption {
+	return append([]grpc.ServerOption{grpc.StatsHandler(otelgrpc.NewServerHandler())}, opt...)
+}
+
+// withMetrics appends interceptors collecting RED metrics of grpc methods to server options unless
+// GDD_METRICS_ENABLE is false. They are chained after interceptors set by grpc.UnaryInterceptor and
+// grpc.StreamInterceptor, so panics turned into errors by recovery interceptors are counted as well.
+func withMetrics(opt []grpc.ServerOption) []grpc.ServerOption {
+	return append(opt, grpcx_metrics.ServerOptions()...)
+}
+
 func (srv *GrpcServer) printServices() {
 	if !config.CheckDev() {
 		return
@@ -85,39 +115,79 @@ func (srv *GrpcServer) Run() {
 	srv.RunWithPipe(nil)
 }
 
-// RunWithPipe runs grpc server
+// RunWithPipe runs grpc server and blocks until it is shut down by SIGINT, SIGTERM or SIGQUIT.
+// Shutdown is coordinated by lifecycle.Default() unless SetLifecycle is called, see package lifecycle for details.
+// Connections from network are served with TLS if GDD_TLS_CERT_FILE and GDD_TLS_KEY_FILE are set, connections
+// from pipe are always served without TLS. It listens on addresses in GDD_GRPC_LISTEN, or :GDD_GRPC_PORT
+// if it is empty, see package listener for details.
 func (srv *GrpcServer) RunWithPipe(pipe net.Listener) {
-	ln, err := net.Listen("tcp", fmt.Sprintf(":%s", config.GddConfig.Grpc.Port))
+	addrs, err := listener.ParseAddresses(config.GddGrpcListen.LoadOrDefault(fmt.Sprintf(":%s", config.GddConfig.Grpc.Port)))
+	if err != nil {
+		logger.Panic().Msgf("failed to listen: %v", err)
+	}
+	lns, err := listener.Listen(context.Background(), listener.ListenConfig(srv.listenConfig), addrs)
 	if err != nil {
 		logger.Panic().Msgf("failed to listen: %v", err)
 	}
-	srv.ServeWithPipe(ln, pipe)
-	defer func() {
-		logger.Info().Msgf("Grpc server is gracefully shutting down in %s", config.GddConfig.GraceTimeout)
-		// Make sure to set a deadline on exiting the process
-		// after upg.Exit() is closed. No new upgrades can be
-		// performed if the parent doesn't exit.
-		time.AfterFunc(config.GddConfig.GraceTimeout, func() {
-			logger.Error().Msg("Graceful shutdown timed out")
-			config.Shutdown()
-			os.Exit(1)
-		})
-		register.ShutdownGrpc()
-		if err := timeutils.CallWithCtx(context.Background(), func() struct{} {
+	srv.ServeListeners(pipe, lns...)
+	lc := srv.getLifecycle()
+	lc.AddServer("grpc", srv)
+	lc.SetReady(true)
+	lc.Wait()
+}
+
+// SetListenConfig sets net.ListenConfig of listeners opened by Run and RunWithPipe, e.g.
+// SetListenConfig(listener.ReusePort()) to set SO_REUSEPORT on tcp sockets. GDD_REUSEPORT applies if it is not set.
+func (srv *GrpcServer) SetListenConfig(lc *net.ListenConfig) {
+	srv.listenConfig = lc
+}
+
+// SetLifecycle sets lifecycle.Lifecycle instance which coordinates shutdown of the server, default is lifecycle.Default()
+func (srv *GrpcServer) SetLifecycle(lc *lifecycle.Lifecycle) {
+	srv.lifecycle = lc
+}
+
+func (srv *GrpcServer) getLifecycle() *lifecycle.Lifecycle {
+	if srv.lifecycle == nil {
+		return lifecycle.Default()
+	}
+	return srv.lifecycle
+}
+
+// Deregister removes the grpc service from service registry, it implements lifecycle.Server
+func (srv *GrpcServer) Deregister() {
+	register.ShutdownGrpc()
+}
+
+// Drain gracefully stops the grpc server, pending RPCs are cancelled if ctx is done before they finish, so
+// streaming RPCs should return once their context is done. Health watch streams end at once.
+// It implements lifecycle.Server
+func (srv *GrpcServer) Drain(ctx context.Context) error {
+	if srv.Server == nil {
+		return nil
+	}
+	if srv.health != nil {
+		srv.health.drain()
+	}
+	stopped := make(chan struct{})
+	go func() {
+		if srv.servingHTTP.Load() {
+			// GracefulStop doesn't support grpc.Server.ServeHTTP, new calls are refused by the http server
+			for srv.httpCalls.Load() > 0 {
+				time.Sleep(10 * time.Millisecond)
+			}
+		} else {
 			srv.GracefulStop()
-			return struct{}{}
-		}); err != nil {
-			logger.Error().Err(err).Msg("")
 		}
+		close(stopped)
 	}()
-
-	c := make(chan os.Signal, 1)
-	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C)
-	// SIGKILL, SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
-	signal.Notify(c, os.Interrupt)
-
-	// Block until we receive our signal.
-	<-c
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		srv.Stop()
+		return ctx.Err()
+	}
 }
 
 func (srv *GrpcServer) Serve(ln net.Listener) {
@@ -125,27 +195,66 @@ func (srv *GrpcServer) Serve(ln net.Listener) {
 }
 
 func (srv *GrpcServer) ServeWithPipe(ln net.Listener, pipe net.Listener) {
+	srv.ServeListeners(pipe, ln)
+}
+
+// ServeListeners serves grpc requests from pipe and all listeners in background, pipe can be nil.
+// Only the port of the first tcp listener is registered to service registry, the service is not registered
+// if there is no tcp listener.
+func (srv *GrpcServer) ServeListeners(pipe net.Listener, lns ...net.Listener) {
 	if srv.Server == nil {
 		return
 	}
 	framework.PrintBanner()
 	framework.PrintLock.Lock()
-	register.NewGrpc(srv.data)
-	reflection.Register(srv)
-	srv.printServices()
-	go func() {
-		if err := srv.Server.Serve(ln); err != nil {
-			logger.Error().Msgf("failed to serve: %v", err)
+	if port, ok := listener.TCPPort(lns); ok {
+		// registry reads the port from GDD_GRPC_PORT, it differs from the port listened on by GDD_GRPC_LISTEN or systemd
+		if uint64(port) != config.GetGrpcPort() {
+			config.GddGrpcPort.Write(strconv.Itoa(port))
 		}
-	}()
+		register.NewGrpc(srv.data)
+	} else {
+		logger.Warn().Msg("[go-doudou] grpc server has no tcp listener, skip registering to service registry")
+	}
+	srv.prepare()
+	for _, ln := range lns {
+		go func(ln net.Listener) {
+			if err := srv.Server.Serve(ln); err != nil {
+				logger.Error().Msgf("failed to serve: %v", err)
+			}
+		}(ln)
+		logger.Info().Msgf("Grpc server is listening at %v", ln.Addr())
+	}
 	if pipe != nil {
 		go func() {
-			if err := srv.Server.Serve(pipe); err != nil {
+			if err := srv.Server.Serve(plainListener{pipe}); err != nil {
 				logger.Error().Msgf("failed to serve: %v", err)
 			}
 		}()
 	}
-	logger.Info().Msgf("Grpc server is listening at %v", ln.Addr())
 	logger.Info().Msgf("Grpc server started in %s", time.Since(startAt))
 	framework.PrintLock.Unlock()
 }
+
+// prepare registers health and reflection services and prints registered services once
+func (srv *GrpcServer) prepare() {
+	srv.prepareOnce.Do(func() {
+		srv.registerHealthServer()
+		reflection.Register(srv)
+		srv.printServices()
+	})
+}
+
+// HTTPHandler returns handler serving grpc requests by grpc.Server.ServeHTTP, so that grpc is served on the
+// listeners of an http server with HTTP/2 enabled, see rest.WithGrpcServer. The server should not be served by
+// ServeListeners as well. Drain waits for calls served by the handler instead of stopping the server gracefully,
+// because grpc.Server.GracefulStop doesn't support grpc.Server.ServeHTTP.
+func (srv *GrpcServer) HTTPHandler() http.Handler {
+	srv.prepare()
+	srv.servingHTTP.Store(true)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.httpCalls.Add(1)
+		defer srv.httpCalls.Add(-1)
+		srv.Server.ServeHTTP(w, r)
+	})
+}
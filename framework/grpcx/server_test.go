@@ -1,11 +1,16 @@
 package grpcx
 
 import (
+	"context"
 	"net"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
@@ -112,3 +117,39 @@ func TestServeWithPipe(t *testing.T) {
 		emptyServer.ServeWithPipe(ln, pipe)
 	})
 }
+
+func TestGrpcServer_Drain(t *testing.T) {
+	assert.NoError(t, NewEmptyGrpcServer().Drain(context.Background()))
+
+	server := NewGrpcServer()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go server.Server.Serve(ln)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, server.Drain(ctx))
+}
+
+func TestGrpcServer_SetListenConfig(t *testing.T) {
+	t.Setenv(string(config.GddGrpcListen), "127.0.0.1:0")
+	t.Setenv(string(config.GddGrpcPort), config.GddGrpcPort.Load())
+	var controlled atomic.Bool
+	server := NewGrpcServer()
+	server.SetListenConfig(&net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			controlled.Store(true)
+			return nil
+		},
+	})
+	lc := lifecycle.New()
+	server.SetLifecycle(lc)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.Run()
+	}()
+	assert.Eventually(t, lc.Ready, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, controlled.Load(), "listeners are opened by the listen config")
+	lc.Shutdown()
+	<-done
+}
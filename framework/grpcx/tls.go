@@ -0,0 +1,61 @@
+package grpcx
+
+import (
+	"context"
+	"net"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// plainConn marks connections accepted from in-process pipe listener, they skip TLS handshake
+type plainConn struct {
+	net.Conn
+}
+
+type plainListener struct {
+	net.Listener
+}
+
+func (l plainListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return plainConn{conn}, nil
+}
+
+// serverCredentials does TLS handshake for network connections and no handshake for pipe connections
+type serverCredentials struct {
+	credentials.TransportCredentials
+}
+
+func (c serverCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	if _, ok := conn.(plainConn); ok {
+		return insecure.NewCredentials().ServerHandshake(conn)
+	}
+	return c.TransportCredentials.ServerHandshake(conn)
+}
+
+func (c serverCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return c.TransportCredentials.ClientHandshake(ctx, authority, conn)
+}
+
+func (c serverCredentials) Clone() credentials.TransportCredentials {
+	return serverCredentials{c.TransportCredentials.Clone()}
+}
+
+// withTLS prepends TLS transport credentials to server options if GDD_TLS_CERT_FILE and GDD_TLS_KEY_FILE are set,
+// credentials given by opt override it
+func withTLS(opt []grpc.ServerOption) ([]grpc.ServerOption, error) {
+	tlsConfig, err := tlsx.ServerConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		return opt, nil
+	}
+	return append([]grpc.ServerOption{grpc.Creds(serverCredentials{credentials.NewTLS(tlsConfig)})}, opt...), nil
+}
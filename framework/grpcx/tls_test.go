@@ -0,0 +1,43 @@
+package grpcx
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/credentials"
+)
+
+func TestServerCredentials(t *testing.T) {
+	creds := serverCredentials{credentials.NewTLS(&tls.Config{})}
+	server, client := net.Pipe()
+	defer client.Close()
+	conn, authInfo, err := creds.Clone().ServerHandshake(plainConn{server})
+	require.NoError(t, err)
+	assert.Equal(t, "insecure", authInfo.AuthType(), "pipe connections skip tls handshake")
+	assert.Equal(t, plainConn{server}, conn)
+
+	server, client = net.Pipe()
+	client.Close()
+	_, _, err = creds.ServerHandshake(server)
+	assert.Error(t, err, "network connections require tls handshake")
+	assert.Equal(t, "tls", creds.Info().SecurityProtocol)
+}
+
+func TestPlainListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := plainListener{ln}.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.IsType(t, plainConn{}, conn)
+}
@@ -0,0 +1,218 @@
+// Package health provides liveness and readiness checks of the process. Liveness reports whether the process
+// should be restarted, readiness reports whether the process can serve requests. Readiness is down until servers
+// start and after shutdown starts, or when any readiness checker fails. Built-in readiness checkers are registered
+// by database, cache and service registry packages, custom checkers can be added by Register and RegisterLiveness.
+// RestServer exposes the checks at /go-doudou/health/live and /go-doudou/health/ready, GrpcServer exposes them
+// by grpc.health.v1.Health service.
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
+)
+
+// Status is status of a check
+type Status string
+
+const (
+	StatusUp   Status = "UP"
+	StatusDown Status = "DOWN"
+)
+
+// HealthChecker checks health of a dependency, it returns nil if the dependency is healthy
+type HealthChecker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to HealthChecker
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f(ctx)
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Result is result of a HealthChecker
+type Result struct {
+	Status   Status `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// Report is result of a probe
+type Report struct {
+	Status Status            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Up reports whether status of the report is UP
+func (r Report) Up() bool {
+	return r.Status == StatusUp
+}
+
+type registry struct {
+	lock     sync.RWMutex
+	checkers map[string]HealthChecker
+}
+
+func newRegistry() *registry {
+	return &registry{
+		checkers: make(map[string]HealthChecker),
+	}
+}
+
+func (r *registry) set(name string, checker HealthChecker) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.checkers[name] = checker
+}
+
+func (r *registry) remove(name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.checkers, name)
+}
+
+func (r *registry) names() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	names := make([]string, 0, len(r.checkers))
+	for name := range r.checkers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// run runs all checkers concurrently, checkers which don't return before ctx is done are reported as DOWN
+func (r *registry) run(ctx context.Context, report *Report) {
+	r.lock.RLock()
+	checkers := make(map[string]HealthChecker, len(r.checkers))
+	for name, checker := range r.checkers {
+		checkers[name] = checker
+	}
+	r.lock.RUnlock()
+	if len(checkers) == 0 {
+		return
+	}
+	if report.Checks == nil {
+		report.Checks = make(map[string]Result, len(checkers))
+	}
+	var (
+		lock sync.Mutex
+		wg   sync.WaitGroup
+	)
+	for name, checker := range checkers {
+		wg.Add(1)
+		go func(name string, checker HealthChecker) {
+			defer wg.Done()
+			result := check(ctx, checker)
+			lock.Lock()
+			defer lock.Unlock()
+			report.Checks[name] = result
+			if result.Status != StatusUp {
+				report.Status = StatusDown
+			}
+		}(name, checker)
+	}
+	wg.Wait()
+}
+
+func check(ctx context.Context, checker HealthChecker) Result {
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- errors.Errorf("panic: %v", r)
+			}
+		}()
+		done <- checker.Check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	result := Result{
+		Status:   StatusUp,
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+var (
+	liveness  = newRegistry()
+	readiness = newRegistry()
+)
+
+// Register adds a readiness checker, checker registered with the same name is replaced
+func Register(name string, checker HealthChecker) {
+	readiness.set(name, checker)
+}
+
+// RegisterLiveness adds a liveness checker, checker registered with the same name is replaced. Only add checkers
+// whose failure can be fixed by restarting the process, failure of external dependencies should not fail liveness.
+func RegisterLiveness(name string, checker HealthChecker) {
+	liveness.set(name, checker)
+}
+
+// Unregister removes readiness checker and liveness checker of name
+func Unregister(name string) {
+	readiness.remove(name)
+	liveness.remove(name)
+}
+
+// Checkers returns names of registered readiness checkers in order
+func Checkers() []string {
+	return readiness.names()
+}
+
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, config.GddHealthCheckTimeout.LoadDurationOrDefault(config.DefaultGddHealthCheckTimeout))
+}
+
+// Live runs liveness checkers, the report is UP if all of them pass
+func Live(ctx context.Context) Report {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	report := Report{Status: StatusUp}
+	liveness.run(ctx, &report)
+	return report
+}
+
+// Ready runs readiness checkers for servers managed by lifecycle.Default(), see ReadyOf
+func Ready(ctx context.Context) Report {
+	return ReadyOf(ctx, lifecycle.Default())
+}
+
+// ReadyOf runs readiness checkers, the report is UP if servers managed by lc are started, shutdown of lc has not
+// started and all checkers pass
+func ReadyOf(ctx context.Context, lc *lifecycle.Lifecycle) Report {
+	if lc.ShuttingDown() {
+		return Report{
+			Status: StatusDown,
+			Checks: map[string]Result{"lifecycle": {Status: StatusDown, Error: "shutting down"}},
+		}
+	}
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	report := Report{Status: StatusUp}
+	if !lc.Ready() {
+		report.Status = StatusDown
+		report.Checks = map[string]Result{"lifecycle": {Status: StatusDown, Error: "not started"}}
+	}
+	readiness.run(ctx, &report)
+	return report
+}
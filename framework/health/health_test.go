@@ -0,0 +1,76 @@
+package health
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
+)
+
+func TestLive(t *testing.T) {
+	report := Live(context.Background())
+	assert.True(t, report.Up())
+	assert.Empty(t, report.Checks)
+
+	RegisterLiveness("deadlock", CheckerFunc(func(ctx context.Context) error {
+		return errors.New("deadlock detected")
+	}))
+	defer Unregister("deadlock")
+	report = Live(context.Background())
+	assert.False(t, report.Up())
+	assert.Equal(t, "deadlock detected", report.Checks["deadlock"].Error)
+}
+
+func TestReady(t *testing.T) {
+	t.Setenv("GDD_HEALTH_CHECK_TIMEOUT", "100ms")
+	lifecycle.SetReady(false)
+	report := Ready(context.Background())
+	assert.False(t, report.Up(), "not ready before servers start")
+	assert.Equal(t, "not started", report.Checks["lifecycle"].Error)
+
+	lifecycle.SetReady(true)
+	defer lifecycle.SetReady(false)
+	Register("db", CheckerFunc(func(ctx context.Context) error {
+		return nil
+	}))
+	defer Unregister("db")
+	report = Ready(context.Background())
+	assert.True(t, report.Up())
+	require.Contains(t, report.Checks, "db")
+	assert.Equal(t, StatusUp, report.Checks["db"].Status)
+
+	Register("slow", CheckerFunc(func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}))
+	Register("panic", CheckerFunc(func(ctx context.Context) error {
+		panic("boom")
+	}))
+	defer Unregister("slow")
+	defer Unregister("panic")
+	assert.Equal(t, []string{"db", "panic", "slow"}, Checkers())
+	start := time.Now()
+	report = Ready(context.Background())
+	assert.Less(t, time.Since(start), time.Second, "slow checker is timed out")
+	assert.False(t, report.Up())
+	assert.Equal(t, StatusUp, report.Checks["db"].Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["slow"].Error)
+	assert.Equal(t, "panic: boom", report.Checks["panic"].Error)
+}
+
+func TestReadyOf(t *testing.T) {
+	lc := lifecycle.New()
+	lifecycle.SetReady(true)
+	defer lifecycle.SetReady(false)
+	report := ReadyOf(context.Background(), lc)
+	assert.False(t, report.Up(), "readiness of the default lifecycle doesn't count")
+
+	lc.SetReady(true)
+	assert.True(t, ReadyOf(context.Background(), lc).Up())
+	lifecycle.SetReady(false)
+	assert.True(t, ReadyOf(context.Background(), lc).Up())
+}
@@ -0,0 +1,493 @@
+// Package idempotency makes retried requests safe. For routes annotated by @idempotent in svc.go, the response of
+// the first request having an Idempotency-Key header is stored in cache.CacheManager, requests having the same key
+// are replayed with the stored status, headers and body instead of being processed again. A duplicate arriving while
+// the first one is still in processing waits for it or gets 409 Conflict.
+//
+// Duplicates are blocked across instances only if a Locker is configured, Default uses RedisLocker if redis is in
+// GDD_CACHE_STORES. Without it, a duplicate is blocked only while the first request is in processing by the same
+// instance, stored responses are still replayed by all instances sharing the cache.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/cache"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/jwtauth"
+	"github.com/unionj-cloud/go-doudou/v2/framework/loglevel"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest/httprouter"
+	"github.com/unionj-cloud/toolkit/cast"
+	gocache "github.com/unionj-cloud/toolkit/gocache/lib/cache"
+	"github.com/unionj-cloud/toolkit/gocache/lib/store"
+	"github.com/unionj-cloud/toolkit/stringutils"
+)
+
+var logger = loglevel.Named("idempotency")
+
+const (
+	// HeaderIdempotencyKey is request header carrying client generated unique key of an operation
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed is set to true in replayed responses
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+	// Annotation enables the middleware for a route, e.g. @idempotent or @idempotent(1h) to override TTL
+	Annotation = "idempotent"
+)
+
+const (
+	keyPrefix    = "go-doudou:idempotency:"
+	lockSuffix   = ":lock"
+	maxKeyLength = 255
+)
+
+// pollInterval is how often a duplicate request checks whether the request in processing by another instance is done
+var pollInterval = 100 * time.Millisecond
+
+// headers not replayed
+var skippedHeaders = map[string]struct{}{
+	"Date":              {},
+	"Content-Length":    {},
+	"Connection":        {},
+	"Transfer-Encoding": {},
+}
+
+var (
+	errConflict   = errors.New("a request with the same Idempotency-Key is in processing")
+	errMismatch   = errors.New("Idempotency-Key is reused for a different request")
+	errKeyTooLong = errors.Errorf("Idempotency-Key must not be longer than %d characters", maxKeyLength)
+	errLock       = errors.New("failed to lock request with Idempotency-Key")
+)
+
+// Config configures Idempotency
+type Config struct {
+	// TTL is how long responses are stored, it is overridden by @idempotent(ttl)
+	TTL time.Duration
+	// LockTTL is how long a request in processing blocks duplicates at most
+	LockTTL time.Duration
+	// WaitTimeout is how long a duplicate waits for the request in processing, 0 means 409 Conflict immediately
+	WaitTimeout time.Duration
+	// MaxBodySize is max bytes of response body to be stored
+	MaxBodySize int
+	// MaxRequestBodySize is max bytes of request body read for fingerprinting
+	MaxRequestBodySize int64
+}
+
+// LoadConfig loads Config from GDD_IDEMPOTENCY_* environment variables
+func LoadConfig() Config {
+	return Config{
+		TTL:         config.GddIdempotencyTTL.LoadDurationOrDefault(config.DefaultGddIdempotencyTTL),
+		LockTTL:     config.GddIdempotencyLockTTL.LoadDurationOrDefault(config.DefaultGddIdempotencyLockTTL),
+		WaitTimeout: config.GddIdempotencyWaitTimeout.LoadDurationOrDefault(config.DefaultGddIdempotencyWaitTimeout),
+		MaxBodySize: cast.ToIntOrDefault(config.GddIdempotencyMaxBodySize.Load(), config.DefaultGddIdempotencyMaxBodySize),
+		MaxRequestBodySize: cast.ToInt64OrDefault(config.GddIdempotencyMaxRequestBodySize.Load(),
+			config.DefaultGddIdempotencyMaxRequestBodySize),
+	}
+}
+
+// record is stored in cache as json string, so that it works with any cache store
+type record struct {
+	Fingerprint string      `json:"fingerprint"`
+	StatusCode  int         `json:"statusCode,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// Idempotency stores and replays responses of routes annotated by @idempotent
+type Idempotency struct {
+	conf          Config
+	cache         gocache.CacheInterface[any]
+	annotations   func(operation string) []framework.Annotation
+	errorRenderer rest.ErrorRenderer
+	locker        Locker
+	lock          sync.Mutex
+	inflight      map[string]chan struct{}
+}
+
+type Option func(*Idempotency)
+
+// WithAnnotationStore looks up @idempotent from store instead of the one registered by framework.RegisterAnnotationStore
+func WithAnnotationStore(annotationStore framework.AnnotationStore) Option {
+	return func(i *Idempotency) {
+		i.annotations = func(operation string) []framework.Annotation {
+			return annotationStore[operation]
+		}
+	}
+}
+
+// WithErrorRenderer customizes how 400, 409 and 422 errors are written, default is rest.JSONErrorRenderer
+func WithErrorRenderer(renderer rest.ErrorRenderer) Option {
+	return func(i *Idempotency) {
+		i.errorRenderer = renderer
+	}
+}
+
+// WithLocker locks requests in processing by locker, so that duplicates are blocked across instances
+func WithLocker(locker Locker) Option {
+	return func(i *Idempotency) {
+		i.locker = locker
+	}
+}
+
+// New creates Idempotency storing responses in c. Duplicates in processing are blocked only within this instance
+// unless WithLocker is given.
+func New(conf Config, c gocache.CacheInterface[any], opts ...Option) (*Idempotency, error) {
+	if c == nil {
+		return nil, errors.Errorf("cache is required, set %s", config.GddCacheStores)
+	}
+	i := &Idempotency{
+		conf:          conf,
+		cache:         c,
+		annotations:   framework.GetAnnotations,
+		errorRenderer: rest.JSONErrorRenderer,
+		inflight:      make(map[string]chan struct{}),
+	}
+	for _, fn := range opts {
+		fn(i)
+	}
+	return i, nil
+}
+
+// ttl returns TTL of operation, ok is false if operation is not annotated by @idempotent
+func (i *Idempotency) ttl(operation string) (time.Duration, bool) {
+	for _, item := range i.annotations(operation) {
+		if item.Name != Annotation {
+			continue
+		}
+		if len(item.Params) > 0 {
+			if ttl, err := time.ParseDuration(item.Params[0]); err == nil {
+				return ttl, true
+			}
+			logger.Warn().Msgf("[go-doudou] invalid ttl %s of @%s on %s", item.Params[0], Annotation, operation)
+		}
+		return i.conf.TTL, true
+	}
+	return 0, false
+}
+
+func (i *Idempotency) load(ctx context.Context, key string) (*record, error) {
+	value, err := i.cache.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, &store.NotFound{}) {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	var data []byte
+	switch v := value.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return nil, errors.Errorf("unexpected idempotency record type %T", value)
+	}
+	var rec record
+	if err = json.Unmarshal(data, &rec); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &rec, nil
+}
+
+func (i *Idempotency) save(ctx context.Context, key string, rec record, ttl time.Duration) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return i.cache.Set(ctx, key, string(data), store.WithExpiration(ttl))
+}
+
+// acquire marks key in processing by this instance, it returns a channel closed when the owner is done if key
+// is already in processing
+func (i *Idempotency) acquire(key string) (<-chan struct{}, bool) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if ch, ok := i.inflight[key]; ok {
+		return ch, false
+	}
+	i.inflight[key] = make(chan struct{})
+	return nil, true
+}
+
+// tryLock locks key across instances by locker, it always succeeds without locker
+func (i *Idempotency) tryLock(ctx context.Context, key, token string) (bool, error) {
+	if i.locker == nil {
+		return true, nil
+	}
+	return i.locker.TryLock(ctx, key+lockSuffix, token, i.conf.LockTTL)
+}
+
+func (i *Idempotency) unlock(ctx context.Context, key, token string) {
+	if i.locker == nil {
+		return
+	}
+	if err := i.locker.Unlock(ctx, key+lockSuffix, token); err != nil {
+		logger.Error().Err(err).Msgf("[go-doudou] failed to unlock idempotency record %s", key)
+	}
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (i *Idempotency) release(key string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if ch, ok := i.inflight[key]; ok {
+		close(ch)
+		delete(i.inflight, key)
+	}
+}
+
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.RequestURI()))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheKey scopes key by route and by subject of verified claims if there is any
+func cacheKey(r *http.Request, operation, key string) string {
+	var sb strings.Builder
+	sb.WriteString(keyPrefix)
+	sb.WriteString(operation)
+	sb.WriteString(":")
+	if claims, ok := jwtauth.FromContext(r.Context()); ok {
+		sub, _ := claims.GetSubject()
+		sb.WriteString(sub)
+	}
+	sb.WriteString(":")
+	sb.WriteString(key)
+	return sb.String()
+}
+
+func (i *Idempotency) fail(w http.ResponseWriter, r *http.Request, err error, statusCode int) {
+	i.errorRenderer(w, r, rest.NewBizError(err, rest.WithStatusCode(statusCode)))
+}
+
+func replay(w http.ResponseWriter, rec *record) {
+	header := w.Header()
+	for k, v := range rec.Header {
+		if _, ok := skippedHeaders[k]; ok {
+			continue
+		}
+		header[k] = v
+	}
+	header.Set(HeaderIdempotentReplayed, "true")
+	w.WriteHeader(rec.StatusCode)
+	w.Write(rec.Body)
+}
+
+// Middleware replays stored response for requests having Idempotency-Key header to routes annotated by @idempotent,
+// other requests are passed through
+func (i *Idempotency) Middleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(HeaderIdempotencyKey)
+		if stringutils.IsEmpty(key) {
+			inner.ServeHTTP(w, r)
+			return
+		}
+		operation := httprouter.ParamsFromContext(r.Context()).MatchedRouteName()
+		ttl, ok := i.ttl(operation)
+		if !ok {
+			inner.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxKeyLength {
+			i.fail(w, r, errKeyTooLong, http.StatusBadRequest)
+			return
+		}
+		var body []byte
+		if r.Body != nil && r.Body != http.NoBody {
+			var err error
+			if body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, i.conf.MaxRequestBodySize)); err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					i.fail(w, r, errors.WithStack(err), http.StatusRequestEntityTooLarge)
+					return
+				}
+				i.fail(w, r, errors.WithStack(err), http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		fp := fingerprint(r, body)
+		ck := cacheKey(r, operation, key)
+		ctx := r.Context()
+		deadline := time.Now().Add(i.conf.WaitTimeout)
+		for {
+			rec, err := i.load(ctx, ck)
+			if err != nil {
+				logger.Error().Err(err).Msgf("[go-doudou] failed to load idempotency record %s, process request anyway", ck)
+				inner.ServeHTTP(w, r)
+				return
+			}
+			if rec != nil && rec.Fingerprint != fp {
+				i.fail(w, r, errMismatch, http.StatusUnprocessableEntity)
+				return
+			}
+			if rec != nil {
+				replay(w, rec)
+				return
+			}
+			// done is not nil if the request in processing is owned by this instance, otherwise poll the cache
+			done, acquired := i.acquire(ck)
+			if acquired {
+				token := newToken()
+				locked, err := i.tryLock(ctx, ck, token)
+				if err != nil {
+					// fail closed, the request may be in processing by another instance
+					i.release(ck)
+					logger.Error().Err(err).Msgf("[go-doudou] failed to lock idempotency record %s", ck)
+					i.fail(w, r, errLock, http.StatusServiceUnavailable)
+					return
+				}
+				if locked {
+					i.process(w, r, inner, ck, token, fp, ttl)
+					return
+				}
+				// in processing by another instance
+				i.release(ck)
+				done = nil
+			}
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				w.Header().Set("Retry-After", "1")
+				i.fail(w, r, errConflict, http.StatusConflict)
+				return
+			}
+			if done == nil {
+				remaining = min(pollInterval, remaining)
+			}
+			timer := time.NewTimer(remaining)
+			select {
+			case <-done:
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+			timer.Stop()
+		}
+	})
+}
+
+func (i *Idempotency) process(w http.ResponseWriter, r *http.Request, inner http.Handler, ck, token, fp string,
+	ttl time.Duration) {
+	defer i.release(ck)
+	ctx := context.WithoutCancel(r.Context())
+	defer i.unlock(ctx, ck, token)
+	// another instance may have finished between loading and locking
+	if rec, err := i.load(ctx, ck); err == nil && rec != nil && rec.Fingerprint == fp {
+		replay(w, rec)
+		return
+	}
+	before := w.Header().Clone()
+	var (
+		statusCode int
+		buf        bytes.Buffer
+		overflow   bool
+	)
+	capture := func(b []byte) {
+		if overflow {
+			return
+		}
+		if buf.Len()+len(b) > i.conf.MaxBodySize {
+			overflow = true
+			buf.Reset()
+			return
+		}
+		buf.Write(b)
+	}
+	var wrapped http.ResponseWriter
+	wrapped = httpsnoop.Wrap(w, httpsnoop.Hooks{
+		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return func(code int) {
+				if statusCode == 0 && code >= http.StatusOK {
+					statusCode = code
+				}
+				next(code)
+			}
+		},
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(b []byte) (int, error) {
+				n, err := next(b)
+				capture(b[:n])
+				return n, err
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				// copy through Write so that the body is captured
+				return io.Copy(struct{ io.Writer }{wrapped}, src)
+			}
+		},
+	})
+	defer func() {
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		// server errors and oversized responses are not stored, so that the request can be retried
+		if p := recover(); p != nil || statusCode >= http.StatusInternalServerError || overflow {
+			if p != nil {
+				panic(p)
+			}
+			return
+		}
+		rec := record{
+			Fingerprint: fp,
+			StatusCode:  statusCode,
+			Header:      rest.HandlerHeader(before, w.Header(), skippedHeaders),
+			Body:        buf.Bytes(),
+		}
+		if err := i.save(ctx, ck, rec, ttl); err != nil {
+			logger.Error().Err(err).Msgf("[go-doudou] failed to save idempotency record %s", ck)
+		}
+	}()
+	inner.ServeHTTP(wrapped, r)
+}
+
+var (
+	defaultOnce        sync.Once
+	defaultIdempotency *Idempotency
+)
+
+// Default returns Idempotency configured by GDD_IDEMPOTENCY_* environment variables and storing responses in
+// cache.CacheManager, requests are locked by RedisLocker if redis is in GDD_CACHE_STORES. It panics if
+// GDD_CACHE_STORES is not set.
+func Default() *Idempotency {
+	defaultOnce.Do(func() {
+		var opts []Option
+		if cache.RedisClient != nil {
+			opts = append(opts, WithLocker(NewRedisLocker(cache.RedisClient)))
+		}
+		var err error
+		if defaultIdempotency, err = New(LoadConfig(), cache.CacheManager, opts...); err != nil {
+			logger.Panic().Err(err).Msg("[go-doudou] failed to create idempotency middleware")
+		}
+	})
+	return defaultIdempotency
+}
+
+// Middleware stores and replays responses by Default, e.g.
+// srv.AddRoutes(httpsrv.Routes(handler), idempotency.Middleware)
+func Middleware(inner http.Handler) http.Handler {
+	return Default().Middleware(inner)
+}
@@ -0,0 +1,251 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	go_cache "github.com/patrickmn/go-cache"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	gocache "github.com/unionj-cloud/toolkit/gocache/lib/cache"
+	go_cache_store "github.com/unionj-cloud/toolkit/gocache/store/go_cache"
+)
+
+var annotationStore = framework.AnnotationStore{
+	"CreateOrder": {
+		{Name: "idempotent", Params: []string{"1h"}},
+	},
+	"Fail": {
+		{Name: "idempotent"},
+	},
+}
+
+type testServer struct {
+	*rest.RestServer
+	calls   int32
+	entered chan struct{}
+	proceed chan struct{}
+}
+
+func newTestServer(t *testing.T, conf Config, opts ...Option) *testServer {
+	c := gocache.New[any](go_cache_store.NewGoCache(go_cache.New(time.Hour, time.Minute)))
+	i, err := New(conf, c, append(opts, WithAnnotationStore(annotationStore))...)
+	require.NoError(t, err)
+	ts := &testServer{
+		RestServer: rest.NewRestServer(),
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&ts.calls, 1)
+		if ts.entered != nil {
+			ts.entered <- struct{}{}
+			<-ts.proceed
+		}
+		w.Header().Set("Location", "/order/1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(strings.Repeat("x", int(n))))
+	}
+	ts.AddRoutes([]rest.Route{
+		{Name: "CreateOrder", Method: http.MethodPost, Pattern: "/order", HandlerFunc: handler},
+		{Name: "CreateComment", Method: http.MethodPost, Pattern: "/comment", HandlerFunc: handler},
+		{
+			Name:    "Fail",
+			Method:  http.MethodPost,
+			Pattern: "/fail",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&ts.calls, 1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+		},
+	}, i.Middleware)
+	return ts
+}
+
+func (ts *testServer) do(path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(HeaderIdempotencyKey, key)
+	}
+	rec := httptest.NewRecorder()
+	ts.Handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func testConfig() Config {
+	return Config{
+		TTL:                time.Minute,
+		LockTTL:            time.Minute,
+		WaitTimeout:        time.Second,
+		MaxBodySize:        1 << 20,
+		MaxRequestBodySize: 1 << 20,
+	}
+}
+
+func TestMiddleware_Replay(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	first := ts.do("/order", "abc", `{"sku":"1"}`)
+	require.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, "x", first.Body.String())
+	assert.Empty(t, first.Header().Get(HeaderIdempotentReplayed))
+
+	second := ts.do("/order", "abc", `{"sku":"1"}`)
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, "x", second.Body.String())
+	assert.Equal(t, "/order/1", second.Header().Get("Location"))
+	assert.Equal(t, "true", second.Header().Get(HeaderIdempotentReplayed))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&ts.calls))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, ts.do("/order", "abc", `{"sku":"2"}`).Code)
+	assert.Equal(t, "xx", ts.do("/order", "def", `{"sku":"1"}`).Body.String(), "different key")
+	assert.Equal(t, "xxx", ts.do("/order", "", `{"sku":"1"}`).Body.String(), "no key")
+	assert.Equal(t, "xxxx", ts.do("/comment", "abc", `{"sku":"1"}`).Body.String(), "not annotated")
+	assert.Equal(t, "xxxxx", ts.do("/comment", "abc", `{"sku":"1"}`).Body.String(), "not annotated")
+	assert.Equal(t, http.StatusBadRequest, ts.do("/order", strings.Repeat("k", 256), "").Code)
+}
+
+func TestMiddleware_ServerError(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+
+	assert.Equal(t, http.StatusServiceUnavailable, ts.do("/fail", "abc", "").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, ts.do("/fail", "abc", "").Code)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&ts.calls), "server errors are not stored")
+}
+
+func TestMiddleware_Concurrent(t *testing.T) {
+	conf := testConfig()
+	conf.WaitTimeout = 0
+	ts := newTestServer(t, conf)
+	ts.entered = make(chan struct{})
+	ts.proceed = make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var first *httptest.ResponseRecorder
+	go func() {
+		defer wg.Done()
+		first = ts.do("/order", "abc", "")
+	}()
+	<-ts.entered
+	conflict := ts.do("/order", "abc", "")
+	assert.Equal(t, http.StatusConflict, conflict.Code)
+	assert.Equal(t, "1", conflict.Header().Get("Retry-After"))
+	close(ts.proceed)
+	wg.Wait()
+	assert.Equal(t, http.StatusCreated, first.Code)
+}
+
+func TestMiddleware_Wait(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	ts.entered = make(chan struct{})
+	ts.proceed = make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ts.do("/order", "abc", "")
+	}()
+	<-ts.entered
+	time.AfterFunc(50*time.Millisecond, func() {
+		close(ts.proceed)
+	})
+	rec := ts.do("/order", "abc", "")
+	wg.Wait()
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "x", rec.Body.String())
+	assert.Equal(t, "true", rec.Header().Get(HeaderIdempotentReplayed))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&ts.calls))
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(testConfig(), nil)
+	assert.Error(t, err)
+}
+
+func TestMiddleware_RequestTooLarge(t *testing.T) {
+	conf := testConfig()
+	conf.MaxRequestBodySize = 4
+	ts := newTestServer(t, conf)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, ts.do("/order", "abc", `{"sku":"1"}`).Code)
+	assert.EqualValues(t, 0, atomic.LoadInt32(&ts.calls))
+	assert.Equal(t, http.StatusCreated, ts.do("/order", "abc", "{}").Code)
+}
+
+func TestMiddleware_HandlerHeaderOnly(t *testing.T) {
+	ts := newTestServer(t, testConfig())
+	// outer middleware sets headers for each request before the handler
+	do := func(requestID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/order", nil)
+		req.Header.Set(HeaderIdempotencyKey, "abc")
+		rec := httptest.NewRecorder()
+		rec.Header().Set("X-Request-ID", requestID)
+		rec.Header().Set("Location", "outer")
+		ts.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	require.Equal(t, http.StatusCreated, do("1").Code)
+	second := do("2")
+	assert.Equal(t, "true", second.Header().Get(HeaderIdempotentReplayed))
+	assert.Equal(t, "2", second.Header().Get("X-Request-ID"), "outer headers are not replayed")
+	assert.Equal(t, "/order/1", second.Header().Get("Location"), "headers changed by the handler are replayed")
+}
+
+// memLocker simulates a lock shared by instances
+type memLocker struct {
+	mu    sync.Mutex
+	locks map[string]string
+	err   error
+}
+
+func (l *memLocker) TryLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return false, l.err
+	}
+	if _, ok := l.locks[key]; ok {
+		return false, nil
+	}
+	l.locks[key] = token
+	return true, nil
+}
+
+func (l *memLocker) Unlock(ctx context.Context, key, token string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locks[key] == token {
+		delete(l.locks, key)
+	}
+	return nil
+}
+
+func TestMiddleware_Locker(t *testing.T) {
+	conf := testConfig()
+	conf.WaitTimeout = 0
+	locker := &memLocker{locks: make(map[string]string)}
+	ts := newTestServer(t, conf, WithLocker(locker))
+
+	assert.Equal(t, http.StatusCreated, ts.do("/order", "abc", "").Code)
+	assert.Empty(t, locker.locks, "lock is released")
+
+	// another instance is processing the request
+	locker.locks[keyPrefix+"CreateOrder::def"+lockSuffix] = "other"
+	assert.Equal(t, http.StatusConflict, ts.do("/order", "def", "").Code)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&ts.calls))
+
+	locker.err = errors.New("redis is down")
+	assert.Equal(t, http.StatusServiceUnavailable, ts.do("/order", "ghi", "").Code, "fail closed")
+	assert.EqualValues(t, 1, atomic.LoadInt32(&ts.calls))
+	assert.Equal(t, "x", ts.do("/order", "abc", "").Body.String(), "stored responses are replayed without locking")
+}
@@ -0,0 +1,46 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// Locker locks requests in processing across instances. TryLock must set key atomically only if it is absent,
+// e.g. by redis SET NX, otherwise two instances may process the same request.
+type Locker interface {
+	// TryLock sets key to token with ttl if key is absent, it returns false if key is held by others
+	TryLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error)
+	// Unlock deletes key if it is still held by token
+	Unlock(ctx context.Context, key, token string) error
+}
+
+// unlockScript deletes the key only if its value is the token, so that a lock expired and taken by another
+// instance is not released
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisLocker locks by SET NX of redis
+type RedisLocker struct {
+	client redis.UniversalClient
+}
+
+// NewRedisLocker creates RedisLocker from client
+func NewRedisLocker(client redis.UniversalClient) *RedisLocker {
+	return &RedisLocker{client: client}
+}
+
+func (l *RedisLocker) TryLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	ok, err := l.client.SetNX(ctx, key, token, ttl).Result()
+	return ok, errors.WithStack(err)
+}
+
+func (l *RedisLocker) Unlock(ctx context.Context, key, token string) error {
+	return errors.WithStack(unlockScript.Run(ctx, l.client, []string{key}, token).Err())
+}
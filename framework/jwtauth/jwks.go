@@ -0,0 +1,271 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/toolkit/stringutils"
+	"golang.org/x/sync/singleflight"
+)
+
+// minRefreshInterval limits how often key set is fetched again because of unknown kid or failed fetching
+var minRefreshInterval = 10 * time.Second
+
+const maxKeySetSize = 1 << 20
+
+// jsonWebKey is a key of JSON Web Key Set defined by RFC 7517
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// verificationKey returns *rsa.PublicKey, *ecdsa.PublicKey or []byte according to kty
+func (k jsonWebKey) verificationKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if n.Sign() <= 0 || !e.IsInt64() || e.Int64() < 2 || e.Int64() > 1<<31-1 {
+			return nil, errors.Errorf("invalid rsa key %s", k.Kid)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("unsupported curve %s of key %s", k.Crv, k.Kid)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.Errorf("invalid ec key %s", k.Kid)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "oct":
+		key, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return key, nil
+	}
+	return nil, errors.Errorf("unsupported key type %s of key %s", k.Kty, k.Kid)
+}
+
+type keyEntry struct {
+	kid string
+	alg string
+	key interface{}
+}
+
+// keySet caches keys fetched from url, keys are fetched again when they expire or an unknown kid is met.
+// Keys are looked up under read lock, fetching runs outside the lock and is shared by concurrent lookups.
+type keySet struct {
+	url         string
+	issuer      string
+	client      *http.Client
+	ttl         time.Duration
+	lock        sync.RWMutex
+	keys        []keyEntry
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	lastErr     error
+	group       singleflight.Group
+}
+
+func (s *keySet) find(kid, alg string) (interface{}, bool) {
+	var matched []interface{}
+	for _, entry := range s.keys {
+		if stringutils.IsNotEmpty(kid) && entry.kid != kid {
+			continue
+		}
+		if stringutils.IsNotEmpty(entry.alg) && entry.alg != alg {
+			continue
+		}
+		matched = append(matched, entry.key)
+	}
+	// a token without kid is accepted only if there is no ambiguity
+	if len(matched) != 1 {
+		return nil, false
+	}
+	return matched[0], true
+}
+
+// lookup returns verification key by kid and alg from token header. An expired key set is refreshed in
+// background while its keys keep being used, lookups of unknown kid wait for refreshing.
+func (s *keySet) lookup(ctx context.Context, kid, alg string) (interface{}, error) {
+	s.lock.RLock()
+	key, found := s.find(kid, alg)
+	stale := s.keys == nil || time.Since(s.fetchedAt) > s.ttl
+	s.lock.RUnlock()
+	if found {
+		if stale {
+			// cancellation of the request being validated should not fail fetching shared by all requests
+			s.group.DoChan("refresh", func() (interface{}, error) {
+				return nil, s.tryRefresh(context.WithoutCancel(ctx))
+			})
+		}
+		return key, nil
+	}
+	select {
+	case <-s.group.DoChan("refresh", func() (interface{}, error) {
+		return nil, s.tryRefresh(context.WithoutCancel(ctx))
+	}):
+	case <-ctx.Done():
+		return nil, errors.WithStack(ctx.Err())
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if key, found = s.find(kid, alg); found {
+		return key, nil
+	}
+	if s.lastErr != nil && s.keys == nil {
+		return nil, s.lastErr
+	}
+	return nil, errors.Errorf("no key found for kid %q and alg %s", kid, alg)
+}
+
+// tryRefresh fetches key set unless the last attempt is within minRefreshInterval
+func (s *keySet) tryRefresh(ctx context.Context) error {
+	s.lock.Lock()
+	if time.Since(s.lastAttempt) < minRefreshInterval {
+		err := s.lastErr
+		s.lock.Unlock()
+		return err
+	}
+	s.lastAttempt = time.Now()
+	jwksUrl := s.url
+	s.lock.Unlock()
+
+	keys, jwksUrl, err := s.fetch(ctx, jwksUrl)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lastErr = err
+	if err != nil {
+		logger.Error().Err(err).Msgf("[go-doudou] failed to fetch jwks from %s", jwksUrl)
+		return err
+	}
+	s.url = jwksUrl
+	s.keys = keys
+	s.fetchedAt = time.Now()
+	return nil
+}
+
+// fetch reads keys from jwksUrl, it is discovered from issuer if empty
+func (s *keySet) fetch(ctx context.Context, jwksUrl string) ([]keyEntry, string, error) {
+	if stringutils.IsEmpty(jwksUrl) {
+		discovered, err := s.discover(ctx)
+		if err != nil {
+			return nil, jwksUrl, err
+		}
+		jwksUrl = discovered
+	}
+	data, err := s.read(ctx, jwksUrl)
+	if err != nil {
+		return nil, jwksUrl, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &set); err != nil {
+		return nil, jwksUrl, errors.Wrap(err, "invalid jwks")
+	}
+	keys := make([]keyEntry, 0, len(set.Keys))
+	for _, item := range set.Keys {
+		if item.Use == "enc" {
+			continue
+		}
+		key, err := item.verificationKey()
+		if err != nil {
+			logger.Warn().Err(err).Msg("[go-doudou] skip invalid json web key")
+			continue
+		}
+		keys = append(keys, keyEntry{kid: item.Kid, alg: item.Alg, key: key})
+	}
+	return keys, jwksUrl, nil
+}
+
+// discover finds jwks_uri from OpenID Provider Metadata of issuer
+func (s *keySet) discover(ctx context.Context) (string, error) {
+	data, err := s.read(ctx, strings.TrimSuffix(s.issuer, "/")+"/.well-known/openid-configuration")
+	if err != nil {
+		return "", err
+	}
+	var metadata struct {
+		JwksUri string `json:"jwks_uri"`
+	}
+	if err = json.Unmarshal(data, &metadata); err != nil {
+		return "", errors.Wrap(err, "invalid openid configuration")
+	}
+	if stringutils.IsEmpty(metadata.JwksUri) {
+		return "", errors.Errorf("no jwks_uri found in openid configuration of %s", s.issuer)
+	}
+	return metadata.JwksUri, nil
+}
+
+// read fetches http(s) url, or reads local file for other values
+func (s *keySet) read(ctx context.Context, location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		data, err := os.ReadFile(strings.TrimPrefix(location, "file://"))
+		return data, errors.WithStack(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("GET %s: %s", location, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxKeySetSize))
+	return data, errors.WithStack(err)
+}
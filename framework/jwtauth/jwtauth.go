@@ -0,0 +1,259 @@
+// Package jwtauth validates JWT bearer tokens of RESTful and gRPC requests. Tokens signed by HS algorithms are
+// verified by GDD_JWT_SECRET, tokens signed by RS, PS and ES algorithms are verified by JSON Web Key Set fetched
+// from GDD_JWT_JWKS_URL or discovered from OpenID Provider Metadata of GDD_JWT_ISSUER. Verified claims are put
+// into request context, services get them by FromContext.
+package jwtauth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_auth"
+	"github.com/unionj-cloud/go-doudou/v2/framework/loglevel"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"github.com/unionj-cloud/toolkit/stringutils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var logger = loglevel.Named("jwtauth")
+
+// ErrMissingToken is returned if request has no bearer token
+var ErrMissingToken = errors.New("missing bearer token")
+
+// Claims are verified claims of a token
+type Claims = jwt.MapClaims
+
+// Config configures Validator
+type Config struct {
+	// Issuer is expected iss claim, JWKS url is discovered from it if JwksUrl is empty
+	Issuer string
+	// Audience are accepted aud claims, tokens must have at least one of them if it is not empty
+	Audience []string
+	// JwksUrl is url or local file path of JSON Web Key Set
+	JwksUrl string
+	// JwksRefreshInterval is how long fetched JSON Web Key Set is cached
+	JwksRefreshInterval time.Duration
+	// Secret is shared secret of HS algorithms
+	Secret []byte
+	// Algorithms are accepted signing algorithms
+	Algorithms []string
+	// Leeway is allowed clock skew when validating exp, nbf and iat claims
+	Leeway time.Duration
+}
+
+func splitList(s string) []string {
+	var ret []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); stringutils.IsNotEmpty(item) {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+// LoadConfig loads Config from GDD_JWT_* environment variables
+func LoadConfig() Config {
+	return Config{
+		Issuer:              config.GddJWTIssuer.Load(),
+		Audience:            splitList(config.GddJWTAudience.Load()),
+		JwksUrl:             config.GddJWTJwksUrl.Load(),
+		JwksRefreshInterval: config.GddJWTJwksRefreshInterval.LoadDurationOrDefault(config.DefaultGddJWTJwksRefreshInterval),
+		Secret:              []byte(config.GddJWTSecret.Load()),
+		Algorithms:          splitList(config.GddJWTAlgorithms.LoadOrDefault(config.DefaultGddJWTAlgorithms)),
+		Leeway:              config.GddJWTLeeway.LoadDurationOrDefault(config.DefaultGddJWTLeeway),
+	}
+}
+
+// Validator validates bearer tokens, it implements grpcx_auth.Authorizer, e.g.
+// grpc.ChainUnaryInterceptor(grpcx_auth.UnaryServerInterceptor(jwtauth.Default()))
+type Validator struct {
+	conf          Config
+	parser        *jwt.Parser
+	keys          *keySet
+	client        *http.Client
+	errorRenderer rest.ErrorRenderer
+}
+
+var _ grpcx_auth.Authorizer = (*Validator)(nil)
+
+type ValidatorOption func(*Validator)
+
+// WithHTTPClient sets http client to fetch JSON Web Key Set and OpenID Provider Metadata
+func WithHTTPClient(client *http.Client) ValidatorOption {
+	return func(v *Validator) {
+		v.client = client
+	}
+}
+
+// WithErrorRenderer customizes how 401 Unauthorized errors are written by Middleware, default is rest.JSONErrorRenderer
+func WithErrorRenderer(renderer rest.ErrorRenderer) ValidatorOption {
+	return func(v *Validator) {
+		v.errorRenderer = renderer
+	}
+}
+
+// NewValidator creates a Validator, at least one of Secret, JwksUrl and Issuer is required
+func NewValidator(conf Config, opts ...ValidatorOption) (*Validator, error) {
+	if len(conf.Secret) == 0 && stringutils.IsEmpty(conf.JwksUrl) && stringutils.IsEmpty(conf.Issuer) {
+		return nil, errors.Errorf("one of %s, %s and %s is required", config.GddJWTSecret, config.GddJWTJwksUrl, config.GddJWTIssuer)
+	}
+	v := &Validator{
+		conf:          conf,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		errorRenderer: rest.JSONErrorRenderer,
+	}
+	for _, fn := range opts {
+		fn(v)
+	}
+	parserOptions := []jwt.ParserOption{
+		jwt.WithValidMethods(conf.Algorithms),
+		jwt.WithLeeway(conf.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if stringutils.IsNotEmpty(conf.Issuer) {
+		parserOptions = append(parserOptions, jwt.WithIssuer(conf.Issuer))
+	}
+	v.parser = jwt.NewParser(parserOptions...)
+	if stringutils.IsNotEmpty(conf.JwksUrl) || stringutils.IsNotEmpty(conf.Issuer) {
+		v.keys = &keySet{
+			url:    conf.JwksUrl,
+			issuer: conf.Issuer,
+			client: v.client,
+			ttl:    conf.JwksRefreshInterval,
+		}
+	}
+	return v, nil
+}
+
+func (v *Validator) keyFunc(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok && len(v.conf.Secret) > 0 {
+			return v.conf.Secret, nil
+		}
+		if v.keys == nil {
+			return nil, errors.Errorf("no key to verify %s signed token", token.Method.Alg())
+		}
+		kid, _ := token.Header["kid"].(string)
+		return v.keys.lookup(ctx, kid, token.Method.Alg())
+	}
+}
+
+// Validate verifies signature of tokenString and validates its claims
+func (v *Validator) Validate(ctx context.Context, tokenString string) (Claims, error) {
+	claims := make(Claims)
+	if _, err := v.parser.ParseWithClaims(tokenString, claims, v.keyFunc(ctx)); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(v.conf.Audience) > 0 {
+		aud, _ := claims.GetAudience()
+		var matched bool
+		for _, item := range aud {
+			for _, expected := range v.conf.Audience {
+				if item == expected {
+					matched = true
+					break
+				}
+			}
+		}
+		if !matched {
+			return nil, errors.WithStack(jwt.ErrTokenInvalidAudience)
+		}
+	}
+	return claims, nil
+}
+
+// bearerToken returns token from value of Authorization header or metadata
+func bearerToken(authorization string) (string, bool) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(authorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, stringutils.IsNotEmpty(token)
+}
+
+// Middleware validates bearer token of Authorization header and puts verified claims into request context,
+// requests without valid token are rejected with 401 Unauthorized
+func (v *Validator) Middleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r.Header.Get("Authorization"))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			v.errorRenderer(w, r, rest.NewBizError(ErrMissingToken, rest.WithStatusCode(http.StatusUnauthorized)))
+			return
+		}
+		claims, err := v.Validate(r.Context(), token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			v.errorRenderer(w, r, rest.NewBizError(errors.Cause(err), rest.WithStatusCode(http.StatusUnauthorized)))
+			return
+		}
+		inner.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+	})
+}
+
+// Authorize validates bearer token of authorization metadata and puts verified claims into context,
+// it returns codes.Unauthenticated error if there is no valid token
+func (v *Validator) Authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, value := range md.Get("authorization") {
+			if t, ok := bearerToken(value); ok {
+				token = t
+				break
+			}
+		}
+	}
+	if stringutils.IsEmpty(token) {
+		return nil, status.Error(codes.Unauthenticated, ErrMissingToken.Error())
+	}
+	claims, err := v.Validate(ctx, token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, errors.Cause(err).Error())
+	}
+	return NewContext(ctx, claims), nil
+}
+
+type claimsKey struct{}
+
+// NewContext returns a new context carrying claims
+func NewContext(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext returns verified claims put by Middleware or Authorize
+func FromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(Claims)
+	return claims, ok
+}
+
+var (
+	defaultOnce      sync.Once
+	defaultValidator *Validator
+)
+
+// Default returns Validator configured by GDD_JWT_* environment variables, it panics if the configuration is invalid
+func Default() *Validator {
+	defaultOnce.Do(func() {
+		var err error
+		if defaultValidator, err = NewValidator(LoadConfig()); err != nil {
+			logger.Panic().Err(err).Msg("[go-doudou] invalid jwt config")
+		}
+	})
+	return defaultValidator
+}
+
+// Middleware validates bearer tokens by Default validator. Pass it to AddRoutes to protect routes generated by
+// go-doudou svc http but not doc routes, e.g. srv.AddRoutes(httpsrv.Routes(handler), jwtauth.Middleware)
+func Middleware(inner http.Handler) http.Handler {
+	return Default().Middleware(inner)
+}
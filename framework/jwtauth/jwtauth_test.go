@@ -0,0 +1,310 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func encodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   encodeBigInt(key.N),
+		"e":   encodeBigInt(big.NewInt(int64(key.E))),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"crv": "P-256",
+		"x":   encodeBigInt(key.X),
+		"y":   encodeBigInt(key.Y),
+	}
+}
+
+func jwks(t *testing.T, keys ...map[string]string) []byte {
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	require.NoError(t, err)
+	return data
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	ret, err := token.SignedString(key)
+	require.NoError(t, err)
+	return ret
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": "alice",
+		"aud": "orders",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	}
+}
+
+func TestValidator_HS(t *testing.T) {
+	v, err := NewValidator(Config{Secret: []byte("secret"), Algorithms: []string{"HS256"}, Audience: []string{"orders"}})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	claims, err := v.Validate(ctx, sign(t, jwt.SigningMethodHS256, "", []byte("secret"), validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims["sub"])
+
+	_, err = v.Validate(ctx, sign(t, jwt.SigningMethodHS256, "", []byte("wrong"), validClaims()))
+	assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+
+	_, err = v.Validate(ctx, sign(t, jwt.SigningMethodHS512, "", []byte("secret"), validClaims()))
+	assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid, "algorithm is not accepted")
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, err = v.Validate(ctx, sign(t, jwt.SigningMethodHS256, "", []byte("secret"), expired))
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+
+	noExp := validClaims()
+	delete(noExp, "exp")
+	_, err = v.Validate(ctx, sign(t, jwt.SigningMethodHS256, "", []byte("secret"), noExp))
+	assert.ErrorIs(t, err, jwt.ErrTokenRequiredClaimMissing)
+
+	otherAud := validClaims()
+	otherAud["aud"] = []string{"payments", "users"}
+	_, err = v.Validate(ctx, sign(t, jwt.SigningMethodHS256, "", []byte("secret"), otherAud))
+	assert.ErrorIs(t, err, jwt.ErrTokenInvalidAudience)
+
+	_, err = NewValidator(Config{})
+	assert.Error(t, err)
+}
+
+func TestValidator_JwksFile(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(file, jwks(t, rsaJWK("rsa", rsaKey), ecJWK("ec", ecKey)), 0600))
+
+	v, err := NewValidator(loadTestConfig(t, file))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	claims, err := v.Validate(ctx, sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims["sub"])
+
+	_, err = v.Validate(ctx, sign(t, jwt.SigningMethodES256, "ec", ecKey, validClaims()))
+	require.NoError(t, err)
+
+	_, err = v.Validate(ctx, sign(t, jwt.SigningMethodRS384, "rsa", rsaKey, validClaims()))
+	assert.Error(t, err, "alg of jwk is RS256")
+
+	_, err = v.Validate(ctx, sign(t, jwt.SigningMethodES256, "", ecKey, validClaims()))
+	assert.NoError(t, err, "kid can be omitted if only one key matches alg")
+
+	_, err = v.Validate(ctx, sign(t, jwt.SigningMethodES256, "unknown", ecKey, validClaims()))
+	assert.Error(t, err)
+
+	_, err = v.Validate(ctx, sign(t, jwt.SigningMethodHS256, "", []byte("secret"), validClaims()))
+	assert.Error(t, err, "no secret is configured")
+}
+
+// loadTestConfig loads Config from GDD_JWT_* environment variables with file as JWKS url
+func loadTestConfig(t *testing.T, file string) Config {
+	t.Setenv("GDD_JWT_JWKS_URL", file)
+	t.Setenv("GDD_JWT_AUDIENCE", "orders, inventory")
+	t.Setenv("GDD_JWT_ALGORITHMS", "RS256,RS384,ES256,HS256")
+	return LoadConfig()
+}
+
+func TestValidator_OIDC(t *testing.T) {
+	interval := minRefreshInterval
+	minRefreshInterval = 0
+	defer func() {
+		minRefreshInterval = interval
+	}()
+	first, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	second, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	var keySet atomic.Value
+	keySet.Store(jwks(t, ecJWK("first", first)))
+	var fetched int32
+
+	var issuer string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/keys"})
+		case "/keys":
+			atomic.AddInt32(&fetched, 1)
+			w.Write(keySet.Load().([]byte))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	issuer = srv.URL
+
+	v, err := NewValidator(Config{
+		Issuer:              issuer,
+		JwksRefreshInterval: time.Hour,
+		Algorithms:          []string{"ES256"},
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+	claims := validClaims()
+	claims["iss"] = issuer
+
+	_, err = v.Validate(ctx, sign(t, jwt.SigningMethodES256, "first", first, claims))
+	require.NoError(t, err)
+	_, err = v.Validate(ctx, sign(t, jwt.SigningMethodES256, "first", first, claims))
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&fetched), "key set is cached")
+
+	otherIssuer := validClaims()
+	otherIssuer["iss"] = "https://evil.com"
+	_, err = v.Validate(ctx, sign(t, jwt.SigningMethodES256, "first", first, otherIssuer))
+	assert.ErrorIs(t, err, jwt.ErrTokenInvalidIssuer)
+
+	keySet.Store(jwks(t, ecJWK("first", first), ecJWK("second", second)))
+	_, err = v.Validate(ctx, sign(t, jwt.SigningMethodES256, "second", second, claims))
+	require.NoError(t, err, "unknown kid triggers refreshing")
+	assert.EqualValues(t, 2, atomic.LoadInt32(&fetched))
+}
+
+func TestKeySet_LookupDuringRefresh(t *testing.T) {
+	first, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	release := make(chan struct{})
+	var fetched int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetched, 1) > 1 {
+			<-release
+		}
+		w.Write(jwks(t, ecJWK("first", first)))
+	}))
+	defer srv.Close()
+	s := &keySet{url: srv.URL, client: srv.Client(), ttl: time.Hour}
+	ctx := context.Background()
+	_, err = s.lookup(ctx, "first", "ES256")
+	require.NoError(t, err)
+	// allow one more fetching within minRefreshInterval
+	s.lastAttempt = time.Time{}
+
+	// lookups of unknown kid share one blocked fetching, later ones are rate limited
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := s.lookup(ctx, "unknown", "ES256")
+			errs <- err
+		}()
+	}
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&fetched) == 2
+	}, time.Second, time.Millisecond)
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.lookup(ctx, "first", "ES256")
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("lookup of cached key is blocked by fetching")
+	}
+	close(release)
+	for i := 0; i < 3; i++ {
+		assert.Error(t, <-errs)
+	}
+	assert.EqualValues(t, 2, atomic.LoadInt32(&fetched))
+}
+
+func TestMiddleware(t *testing.T) {
+	v, err := NewValidator(Config{Secret: []byte("secret"), Algorithms: []string{"HS256"}})
+	require.NoError(t, err)
+	handler := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := FromContext(r.Context())
+		require.True(t, ok)
+		w.Write([]byte(claims["sub"].(string)))
+	}))
+	do := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("Bearer " + sign(t, jwt.SigningMethodHS256, "", []byte("secret"), validClaims()))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "alice", rec.Body.String())
+
+	rec = do("")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	assert.Contains(t, rec.Body.String(), ErrMissingToken.Error())
+
+	rec = do("Basic YWRtaW46YWRtaW4=")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = do("Bearer " + sign(t, jwt.SigningMethodHS256, "", []byte("wrong"), validClaims()))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Bearer error="invalid_token"`, rec.Header().Get("WWW-Authenticate"))
+}
+
+func TestAuthorize(t *testing.T) {
+	v, err := NewValidator(Config{Secret: []byte("secret"), Algorithms: []string{"HS256"}})
+	require.NoError(t, err)
+
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs("authorization", "bearer "+sign(t, jwt.SigningMethodHS256, "", []byte("secret"), validClaims())))
+	newCtx, err := v.Authorize(ctx, "/orders.Orders/Get")
+	require.NoError(t, err)
+	claims, ok := FromContext(newCtx)
+	require.True(t, ok)
+	sub, _ := claims.GetSubject()
+	assert.Equal(t, "alice", sub)
+
+	_, err = v.Authorize(context.Background(), "/orders.Orders/Get")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer invalid"))
+	_, err = v.Authorize(ctx, "/orders.Orders/Get")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
@@ -0,0 +1,327 @@
+// Package lifecycle coordinates graceful shutdown of servers and resources in one process. On SIGINT, SIGTERM or
+// SIGQUIT, or when Shutdown is called, it turns readiness off, deregisters all servers from service registry, waits
+// for pre-stop delay, drains in-flight requests of all servers concurrently, and then runs shutdown hooks ordered
+// by priority. RestServer and GrpcServer use the Default instance, so both servers embedded in one process are shut
+// down together.
+//
+// If GDD_UPGRADE_ENABLE is true, SIGHUP restarts the process gracefully: listening sockets of http and grpc servers
+// and memberlist are passed to a new process started from the same executable, which may have been replaced by a
+// new version, and this process is drained and exits once the new process is ready. The service stays registered
+// because the new process serves the same addresses.
+package lifecycle
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/loglevel"
+	"github.com/unionj-cloud/toolkit/cast"
+)
+
+var logger = loglevel.Named("lifecycle")
+
+// Priorities of built-in shutdown hooks, hooks with lower priority run first,
+// hooks with the same priority run in the order they are added
+const (
+	PriorityRegistry = 50
+	PriorityPlugin   = 100
+	PriorityCache    = 200
+	PriorityDB       = 300
+	PriorityTracer   = 400
+	PriorityLogger   = 1000
+)
+
+// Server is a server whose lifecycle is managed by Lifecycle
+type Server interface {
+	// Deregister removes the server from service registry
+	Deregister()
+	// Drain stops accepting new requests and waits for in-flight requests until ctx is done
+	Drain(ctx context.Context) error
+}
+
+type namedServer struct {
+	name   string
+	server Server
+}
+
+type hook struct {
+	name     string
+	priority int
+	fn       func(ctx context.Context) error
+}
+
+// Lifecycle manages readiness and graceful shutdown
+type Lifecycle struct {
+	lock         sync.Mutex
+	servers      []namedServer
+	hooks        []hook
+	ready        atomic.Bool
+	shuttingDown atomic.Bool
+	preStopDelay time.Duration
+	graceTimeout time.Duration
+	signals      []os.Signal
+	notifyOnce   sync.Once
+	shutdownOnce sync.Once
+	done         chan struct{}
+	exit         func(code int)
+
+	upgradeSignals []os.Signal
+	upgradeTimeout time.Duration
+	upgrading      atomic.Bool
+}
+
+type Option func(*Lifecycle)
+
+// WithPreStopDelay sets how long to wait after deregistration before draining, default is GDD_PRE_STOP_DELAY
+func WithPreStopDelay(delay time.Duration) Option {
+	return func(l *Lifecycle) {
+		l.preStopDelay = delay
+	}
+}
+
+// WithGraceTimeout sets timeout of draining and of running shutdown hooks respectively, process exits with code 1
+// if they don't finish in time. Default is GDD_GRACE_TIMEOUT
+func WithGraceTimeout(timeout time.Duration) Option {
+	return func(l *Lifecycle) {
+		l.graceTimeout = timeout
+	}
+}
+
+// WithSignals sets signals which trigger shutdown, default are SIGINT, SIGTERM and SIGQUIT
+func WithSignals(signals ...os.Signal) Option {
+	return func(l *Lifecycle) {
+		l.signals = signals
+	}
+}
+
+// WithUpgradeSignals sets signals which trigger graceful restart, default is SIGHUP if GDD_UPGRADE_ENABLE is true.
+// Graceful restart is disabled if no signal is given.
+func WithUpgradeSignals(signals ...os.Signal) Option {
+	return func(l *Lifecycle) {
+		l.upgradeSignals = signals
+	}
+}
+
+// WithUpgradeTimeout sets how long to wait for the new process to become ready on graceful restart,
+// default is GDD_UPGRADE_TIMEOUT
+func WithUpgradeTimeout(timeout time.Duration) Option {
+	return func(l *Lifecycle) {
+		l.upgradeTimeout = timeout
+	}
+}
+
+// New creates a Lifecycle instance
+func New(opts ...Option) *Lifecycle {
+	l := &Lifecycle{
+		preStopDelay:   config.GddPreStopDelay.LoadDurationOrDefault(config.DefaultGddPreStopDelay),
+		graceTimeout:   config.GddGraceTimeout.LoadDurationOrDefault(config.DefaultGddGraceTimeout),
+		signals:        []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT},
+		done:           make(chan struct{}),
+		exit:           os.Exit,
+		upgradeTimeout: config.GddUpgradeTimeout.LoadDurationOrDefault(config.DefaultGddUpgradeTimeout),
+	}
+	if cast.ToBoolOrDefault(config.GddUpgradeEnable.Load(), config.DefaultGddUpgradeEnable) {
+		l.upgradeSignals = []os.Signal{syscall.SIGHUP}
+	}
+	for _, fn := range opts {
+		fn(l)
+	}
+	return l
+}
+
+var defaultLifecycle = New()
+
+func init() {
+	defaultLifecycle.OnShutdown("logger", PriorityLogger, func(ctx context.Context) error {
+		config.Shutdown()
+		return nil
+	})
+}
+
+// Default returns the Lifecycle instance used by RestServer, GrpcServer and built-in components
+func Default() *Lifecycle {
+	return defaultLifecycle
+}
+
+// AddServer adds a server to be deregistered and drained on shutdown
+func (l *Lifecycle) AddServer(name string, server Server) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for _, item := range l.servers {
+		if item.server == server {
+			return
+		}
+	}
+	l.servers = append(l.servers, namedServer{name: name, server: server})
+}
+
+// OnShutdown adds a hook to be run after all servers are drained
+func (l *Lifecycle) OnShutdown(name string, priority int, fn func(ctx context.Context) error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.hooks = append(l.hooks, hook{name: name, priority: priority, fn: fn})
+}
+
+// SetReady sets readiness of the process, it is ignored after shutdown starts. A process started by graceful
+// restart tells its parent that it is ready once it is ready and has taken over all sockets from the parent.
+func (l *Lifecycle) SetReady(ready bool) {
+	if l.shuttingDown.Load() {
+		return
+	}
+	l.ready.Store(ready)
+	if ready {
+		notifyParent()
+	}
+}
+
+// Ready reports whether the process is ready to serve requests
+func (l *Lifecycle) Ready() bool {
+	return l.ready.Load()
+}
+
+// ShuttingDown reports whether shutdown has started
+func (l *Lifecycle) ShuttingDown() bool {
+	return l.shuttingDown.Load()
+}
+
+// Done returns a channel which is closed when shutdown finishes
+func (l *Lifecycle) Done() <-chan struct{} {
+	return l.done
+}
+
+// Wait listens to signals and blocks until shutdown finishes. It is safe to call Wait from multiple goroutines.
+func (l *Lifecycle) Wait() {
+	l.notify()
+	<-l.done
+}
+
+func (l *Lifecycle) notify() {
+	l.notifyOnce.Do(func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, l.signals...)
+		u := make(chan os.Signal, 1)
+		if len(l.upgradeSignals) > 0 {
+			signal.Notify(u, l.upgradeSignals...)
+		}
+		go func() {
+			defer signal.Stop(c)
+			defer signal.Stop(u)
+			for {
+				select {
+				case sig := <-c:
+					logger.Info().Msgf("[go-doudou] received signal %s", sig)
+					l.Shutdown()
+					return
+				case sig := <-u:
+					logger.Info().Msgf("[go-doudou] received signal %s, restarting gracefully", sig)
+					go func() {
+						if err := l.Upgrade(); err != nil {
+							logger.Error().Err(err).Msg("[go-doudou] graceful restart failed, keep serving")
+						}
+					}()
+				case <-l.done:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// Shutdown runs the shutdown process once and blocks until it finishes
+func (l *Lifecycle) Shutdown() {
+	l.shutdownOnce.Do(func() {
+		l.shutdown(true)
+	})
+	<-l.done
+}
+
+// Handover runs the shutdown process once like Shutdown, except that servers are not deregistered and pre-stop
+// delay is skipped, because another process has taken over the listening sockets and serves the same addresses
+func (l *Lifecycle) Handover() {
+	l.shutdownOnce.Do(func() {
+		l.shutdown(false)
+	})
+	<-l.done
+}
+
+func (l *Lifecycle) shutdown(deregister bool) {
+	defer close(l.done)
+	l.shuttingDown.Store(true)
+	l.ready.Store(false)
+	l.lock.Lock()
+	servers := append([]namedServer(nil), l.servers...)
+	hooks := append([]hook(nil), l.hooks...)
+	l.lock.Unlock()
+
+	preStopDelay := l.preStopDelay
+	if deregister {
+		logger.Info().Msgf("[go-doudou] gracefully shutting down, pre-stop delay %s, grace timeout %s", preStopDelay, l.graceTimeout)
+	} else {
+		preStopDelay = 0
+		logger.Info().Msgf("[go-doudou] handing over to new process, grace timeout %s", l.graceTimeout)
+	}
+	timer := time.AfterFunc(preStopDelay+2*l.graceTimeout, func() {
+		logger.Error().Msg("[go-doudou] graceful shutdown timed out")
+		config.Shutdown()
+		l.exit(1)
+	})
+	defer timer.Stop()
+
+	if deregister {
+		for _, item := range servers {
+			item.server.Deregister()
+		}
+		if preStopDelay > 0 {
+			time.Sleep(preStopDelay)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.graceTimeout)
+	var wg sync.WaitGroup
+	for _, item := range servers {
+		wg.Add(1)
+		go func(item namedServer) {
+			defer wg.Done()
+			if err := item.server.Drain(ctx); err != nil {
+				logger.Error().Err(err).Msgf("[go-doudou] failed to drain %s server", item.name)
+				return
+			}
+			logger.Info().Msgf("[go-doudou] %s server is drained", item.name)
+		}(item)
+	}
+	wg.Wait()
+	cancel()
+
+	sort.SliceStable(hooks, func(i, j int) bool {
+		return hooks[i].priority < hooks[j].priority
+	})
+	ctx, cancel = context.WithTimeout(context.Background(), l.graceTimeout)
+	defer cancel()
+	for _, item := range hooks {
+		if err := item.fn(ctx); err != nil {
+			logger.Error().Err(err).Msgf("[go-doudou] shutdown hook %s failed", item.name)
+		}
+	}
+}
+
+// SetReady sets readiness of the Default instance
+func SetReady(ready bool) {
+	defaultLifecycle.SetReady(ready)
+}
+
+// Ready reports readiness of the Default instance
+func Ready() bool {
+	return defaultLifecycle.Ready()
+}
+
+// OnShutdown adds a hook to the Default instance
+func OnShutdown(name string, priority int, fn func(ctx context.Context) error) {
+	defaultLifecycle.OnShutdown(name, priority, fn)
+}
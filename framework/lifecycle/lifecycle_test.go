@@ -0,0 +1,144 @@
+package lifecycle
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) get() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+type mockServer struct {
+	name  string
+	rec   *recorder
+	block bool
+}
+
+func (m *mockServer) Deregister() {
+	m.rec.add("deregister " + m.name)
+}
+
+func (m *mockServer) Drain(ctx context.Context) error {
+	m.rec.add("drain " + m.name)
+	if m.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+
+func TestLifecycle_Shutdown(t *testing.T) {
+	rec := &recorder{}
+	lc := New(WithPreStopDelay(50*time.Millisecond), WithGraceTimeout(time.Second))
+	server := &mockServer{name: "http", rec: rec}
+	lc.AddServer("http", server)
+	lc.AddServer("http", server)
+	lc.OnShutdown("db", PriorityDB, func(ctx context.Context) error {
+		rec.add("db")
+		return nil
+	})
+	lc.OnShutdown("plugin", PriorityPlugin, func(ctx context.Context) error {
+		rec.add("plugin")
+		return assert.AnError
+	})
+	lc.OnShutdown("cache", PriorityCache, func(ctx context.Context) error {
+		rec.add("cache")
+		return nil
+	})
+	lc.SetReady(true)
+	assert.True(t, lc.Ready())
+
+	start := time.Now()
+	lc.Shutdown()
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond, "waits for pre-stop delay")
+	assert.Equal(t, []string{"deregister http", "drain http", "plugin", "cache", "db"}, rec.get())
+	assert.False(t, lc.Ready())
+	assert.True(t, lc.ShuttingDown())
+	lc.SetReady(true)
+	assert.False(t, lc.Ready(), "readiness cannot be turned on after shutdown starts")
+
+	lc.Shutdown()
+	assert.Len(t, rec.get(), 5, "shutdown runs only once")
+	select {
+	case <-lc.Done():
+	default:
+		t.Fatal("done channel should be closed")
+	}
+}
+
+func TestLifecycle_DrainTimeout(t *testing.T) {
+	rec := &recorder{}
+	lc := New(WithGraceTimeout(50 * time.Millisecond))
+	lc.AddServer("grpc", &mockServer{name: "grpc", rec: rec, block: true})
+	lc.AddServer("http", &mockServer{name: "http", rec: rec})
+	lc.OnShutdown("db", PriorityDB, func(ctx context.Context) error {
+		rec.add("db")
+		return nil
+	})
+	lc.Shutdown()
+	events := rec.get()
+	require.Len(t, events, 5)
+	assert.ElementsMatch(t, []string{"deregister grpc", "deregister http"}, events[:2])
+	assert.ElementsMatch(t, []string{"drain grpc", "drain http"}, events[2:4])
+	assert.Equal(t, "db", events[4], "hooks run after drain times out")
+}
+
+func TestLifecycle_Exit(t *testing.T) {
+	exited := make(chan int, 1)
+	lc := New(WithGraceTimeout(20 * time.Millisecond))
+	lc.exit = func(code int) {
+		exited <- code
+	}
+	release := make(chan struct{})
+	defer close(release)
+	lc.OnShutdown("stuck", PriorityPlugin, func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	go lc.Shutdown()
+	select {
+	case code := <-exited:
+		assert.Equal(t, 1, code)
+	case <-time.After(time.Second):
+		t.Fatal("process should exit when shutdown times out")
+	}
+}
+
+func TestLifecycle_Wait(t *testing.T) {
+	rec := &recorder{}
+	lc := New(WithSignals(syscall.SIGUSR1), WithGraceTimeout(time.Second))
+	lc.AddServer("http", &mockServer{name: "http", rec: rec})
+	lc.notify()
+	waited := make(chan struct{})
+	go func() {
+		lc.Wait()
+		close(waited)
+	}()
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+	select {
+	case <-waited:
+	case <-time.After(2 * time.Second):
+		t.Fatal("wait should return after signal")
+	}
+	assert.Equal(t, []string{"deregister http", "drain http"}, rec.get())
+}
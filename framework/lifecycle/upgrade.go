@@ -0,0 +1,196 @@
+package lifecycle
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/listener"
+	"github.com/unionj-cloud/toolkit/stringutils"
+)
+
+const (
+	// envUpgradeReadyFd is file descriptor which the new process writes to once it is ready on graceful restart
+	envUpgradeReadyFd = "GDD_UPGRADE_READY_FD"
+	// envUpgradeHandoverFd is file descriptor which the new process reads until EOF, the parent process closes
+	// the other end once it has handed over or exited
+	envUpgradeHandoverFd = "GDD_UPGRADE_HANDOVER_FD"
+)
+
+// ErrUpgradeInProgress is returned if Upgrade is called when another one has not finished
+var ErrUpgradeInProgress = errors.New("graceful restart is in progress")
+
+// Upgrade restarts the process gracefully. It starts a new process from the executable of this process with the
+// same arguments, passes sockets opened by package listener to it, and waits until it is ready. Then this process
+// hands over by draining all servers, and Wait returns. The new process is killed if it is not ready within the
+// upgrade timeout, and this process keeps serving. Note that the new process may have accepted connections on the
+// shared listeners before it is killed, because its servers start serving as soon as they take over their sockets,
+// and these connections are reset. Components which must not run in both processes at once, e.g. memberlist
+// gossiping under the same node name, wait for HandedOver in the new process.
+func (l *Lifecycle) Upgrade() error {
+	if l.shuttingDown.Load() {
+		return errors.New("process is shutting down")
+	}
+	if !l.upgrading.CompareAndSwap(false, true) {
+		return ErrUpgradeInProgress
+	}
+	defer l.upgrading.Store(false)
+
+	files, env, err := listener.Inheritable()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	r, w, err := os.Pipe()
+	if err != nil {
+		return errors.Wrap(err, "failed to create readiness pipe")
+	}
+	defer r.Close()
+	hr, hw, err := os.Pipe()
+	if err != nil {
+		w.Close()
+		return errors.Wrap(err, "failed to create handover pipe")
+	}
+	// closing the write end tells the new process that this process has handed over, or gave up the upgrade
+	// in which case the new process is killed
+	defer hw.Close()
+	exe, err := os.Executable()
+	if err != nil {
+		w.Close()
+		hr.Close()
+		return errors.Wrap(err, "failed to find executable")
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	// extra files start from fd 3, the readiness and handover pipes follow the sockets
+	cmd.ExtraFiles = append(append([]*os.File(nil), files...), w, hr)
+	cmd.Env = append(upgradeEnviron(os.Environ()), env...)
+	cmd.Env = append(cmd.Env,
+		envUpgradeReadyFd+"="+strconv.Itoa(3+len(files)),
+		envUpgradeHandoverFd+"="+strconv.Itoa(4+len(files)))
+	err = cmd.Start()
+	w.Close()
+	hr.Close()
+	if err != nil {
+		return errors.Wrap(err, "failed to start new process")
+	}
+	logger.Info().Msgf("[go-doudou] started new process %d with %d sockets, waiting for it to be ready", cmd.Process.Pid, len(files))
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	ready := make(chan error, 1)
+	go func() {
+		// the pipe is closed without any byte written if the new process exits
+		_, err := r.Read(make([]byte, 1))
+		ready <- err
+	}()
+	timer := time.NewTimer(l.upgradeTimeout)
+	defer timer.Stop()
+	select {
+	case err = <-ready:
+		if err != nil {
+			cmd.Process.Kill()
+			return errors.Errorf("new process %d exited before it is ready: %v", cmd.Process.Pid, <-exited)
+		}
+	case err = <-exited:
+		return errors.Errorf("new process %d exited before it is ready: %v", cmd.Process.Pid, err)
+	case <-timer.C:
+		cmd.Process.Kill()
+		return errors.Errorf("new process %d is not ready in %s", cmd.Process.Pid, l.upgradeTimeout)
+	}
+	logger.Info().Msgf("[go-doudou] new process %d is ready, handing over", cmd.Process.Pid)
+	l.Handover()
+	return nil
+}
+
+// upgradeEnviron removes variables describing sockets passed to this process
+func upgradeEnviron(environ []string) []string {
+	var result []string
+	for _, item := range environ {
+		key := item[:strings.IndexByte(item+"=", '=')]
+		switch key {
+		case "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES", listener.EnvUpgradeFds, listener.EnvUpgradeFdNames, envUpgradeReadyFd,
+			envUpgradeHandoverFd:
+			continue
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+var notifyMu sync.Mutex
+
+// notifyParent tells the parent process that this process is ready on graceful restart. It does nothing if this
+// process is not started by graceful restart, or it has not taken over all sockets passed by the parent yet.
+func notifyParent() {
+	notifyMu.Lock()
+	defer notifyMu.Unlock()
+	value := os.Getenv(envUpgradeReadyFd)
+	if stringutils.IsEmpty(value) || listener.Pending() > 0 {
+		return
+	}
+	os.Unsetenv(envUpgradeReadyFd)
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		logger.Error().Err(err).Msgf("[go-doudou] invalid %s %s", envUpgradeReadyFd, value)
+		return
+	}
+	f := os.NewFile(uintptr(fd), "upgrade-ready")
+	defer f.Close()
+	if _, err = f.Write([]byte{1}); err != nil {
+		logger.Error().Err(err).Msg("[go-doudou] failed to tell parent process that this process is ready")
+	}
+}
+
+var (
+	handedOverOnce sync.Once
+	handedOver     <-chan struct{}
+)
+
+// HandedOver returns a channel which is closed once the parent process has handed over on graceful restart, that
+// is it has drained its servers and run its shutdown hooks, or it has exited. The channel is closed already if
+// this process is not started by graceful restart.
+func HandedOver() <-chan struct{} {
+	handedOverOnce.Do(func() {
+		value := os.Getenv(envUpgradeHandoverFd)
+		os.Unsetenv(envUpgradeHandoverFd)
+		if stringutils.IsEmpty(value) {
+			handedOver = watchHandover(nil)
+			return
+		}
+		fd, err := strconv.Atoi(value)
+		if err != nil {
+			logger.Error().Err(err).Msgf("[go-doudou] invalid %s %s", envUpgradeHandoverFd, value)
+			handedOver = watchHandover(nil)
+			return
+		}
+		handedOver = watchHandover(os.NewFile(uintptr(fd), "upgrade-handover"))
+	})
+	return handedOver
+}
+
+// watchHandover returns a channel which is closed once f reaches EOF, it is closed at once if f is nil
+func watchHandover(f *os.File) <-chan struct{} {
+	done := make(chan struct{})
+	if f == nil {
+		close(done)
+		return done
+	}
+	go func() {
+		defer close(done)
+		defer f.Close()
+		io.Copy(io.Discard, f)
+	}()
+	return done
+}
@@ -0,0 +1,115 @@
+package lifecycle
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/listener"
+)
+
+const (
+	envUpgradeTestAddr = "GDD_UPGRADE_TEST_ADDR"
+	envUpgradeTestExit = "GDD_UPGRADE_TEST_EXIT"
+)
+
+// TestUpgradeHelper is the new process started by TestLifecycle_Upgrade
+func TestUpgradeHelper(t *testing.T) {
+	if os.Getenv(envUpgradeReadyFd) == "" {
+		t.Skip("run by TestLifecycle_Upgrade")
+	}
+	if os.Getenv(envUpgradeTestExit) != "" {
+		os.Exit(1)
+	}
+	addrs, err := listener.ParseAddresses(os.Getenv(envUpgradeTestAddr))
+	require.NoError(t, err)
+	lns, err := listener.Listen(context.Background(), nil, addrs)
+	require.NoError(t, err)
+	served := make(chan struct{})
+	go http.Serve(lns[0], http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strconv.Itoa(os.Getpid())))
+		close(served)
+	}))
+	New().SetReady(true)
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+	}
+}
+
+func TestLifecycle_Upgrade(t *testing.T) {
+	addrs, err := listener.ParseAddresses("tcp://127.0.0.1:0")
+	require.NoError(t, err)
+	lns, err := listener.Listen(context.Background(), nil, addrs)
+	require.NoError(t, err)
+	ln := lns[0]
+	defer ln.Close()
+	t.Setenv(envUpgradeTestAddr, "tcp://"+ln.Addr().String())
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^TestUpgradeHelper$"}
+	defer func() {
+		os.Args = args
+	}()
+
+	rec := &recorder{}
+	lc := New(WithUpgradeTimeout(5*time.Second), WithPreStopDelay(time.Minute))
+	lc.AddServer("http", &mockServer{name: "http", rec: rec})
+	require.NoError(t, lc.Upgrade())
+	assert.Equal(t, []string{"drain http"}, rec.get(), "servers are drained without deregistering")
+	select {
+	case <-lc.Done():
+	default:
+		t.Fatal("done channel should be closed after handover")
+	}
+	ln.Close()
+
+	resp, err := http.Get("http://" + ln.Addr().String())
+	require.NoError(t, err, "the new process serves on the passed socket")
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.NotEqual(t, strconv.Itoa(os.Getpid()), string(body))
+}
+
+func TestLifecycle_UpgradeExited(t *testing.T) {
+	t.Setenv(envUpgradeTestExit, "1")
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^TestUpgradeHelper$"}
+	defer func() {
+		os.Args = args
+	}()
+	lc := New(WithUpgradeTimeout(5 * time.Second))
+	err := lc.Upgrade()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exited before it is ready")
+	assert.False(t, lc.ShuttingDown(), "this process keeps serving")
+}
+
+func TestWatchHandover(t *testing.T) {
+	select {
+	case <-watchHandover(nil):
+	default:
+		t.Fatal("channel should be closed if this process is not started by graceful restart")
+	}
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	done := watchHandover(r)
+	select {
+	case <-done:
+		t.Fatal("channel should not be closed before the parent process hands over")
+	case <-time.After(50 * time.Millisecond):
+	}
+	w.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("channel should be closed once the parent process closes the pipe")
+	}
+}
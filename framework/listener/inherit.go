@@ -0,0 +1,199 @@
+package listener
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/toolkit/stringutils"
+)
+
+const (
+	// EnvUpgradeFds is number of sockets passed by the parent process on graceful restart
+	EnvUpgradeFds = "GDD_UPGRADE_FDS"
+	// EnvUpgradeFdNames is comma separated names of sockets passed by the parent process on graceful restart
+	EnvUpgradeFdNames = "GDD_UPGRADE_FDNAMES"
+)
+
+// socket is a listener or a packet conn with the name it is looked up by
+type socket struct {
+	name string
+	ln   net.Listener
+	pc   net.PacketConn
+}
+
+func (s socket) file() (*os.File, error) {
+	var conn interface{} = s.ln
+	if s.pc != nil {
+		conn = s.pc
+	}
+	if ul, ok := conn.(*net.UnixListener); ok {
+		// socket file is kept for the new process when this process closes the listener
+		ul.SetUnlinkOnClose(false)
+	}
+	fc, ok := conn.(interface {
+		File() (*os.File, error)
+	})
+	if !ok {
+		return nil, errors.Errorf("socket %s can't be passed to other processes", s.name)
+	}
+	f, err := fc.File()
+	return f, errors.Wrapf(err, "failed to get file of socket %s", s.name)
+}
+
+var (
+	inheritOnce sync.Once
+	inheritMu   sync.Mutex
+	inherited   []socket
+	inheritErr  error
+	active      []socket
+)
+
+// loadInherited takes over sockets passed by systemd or by the parent process on graceful restart, environment
+// variables describing them are unset so that they are not passed to child processes
+func loadInherited() {
+	inheritOnce.Do(func() {
+		n, names, source := inheritedFds()
+		for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES", EnvUpgradeFds, EnvUpgradeFdNames} {
+			os.Unsetenv(key)
+		}
+		for i := 0; i < n; i++ {
+			name := "unknown"
+			if i < len(names) && stringutils.IsNotEmpty(names[i]) {
+				name = names[i]
+			}
+			f := os.NewFile(uintptr(listenFdsStart+i), name)
+			s, err := fileSocket(f, name)
+			f.Close()
+			if err != nil {
+				inheritErr = errors.Wrapf(err, "failed to use socket %s passed by %s", name, source)
+				return
+			}
+			inherited = append(inherited, s)
+		}
+	})
+}
+
+// inheritedFds returns number and names of sockets passed by systemd or by the parent process
+func inheritedFds() (int, []string, string) {
+	if value := os.Getenv(EnvUpgradeFds); stringutils.IsNotEmpty(value) {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, nil, ""
+		}
+		return n, strings.Split(os.Getenv(EnvUpgradeFdNames), ","), "parent process"
+	}
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return 0, nil, ""
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return 0, nil, ""
+	}
+	return n, strings.Split(os.Getenv("LISTEN_FDNAMES"), ":"), "systemd"
+}
+
+// fileSocket creates a listener or a packet conn from f, the file descriptor is duplicated with
+// close-on-exec flag so f should be closed
+func fileSocket(f *os.File, name string) (socket, error) {
+	if ln, err := net.FileListener(f); err == nil {
+		return socket{name: name, ln: ln}, nil
+	}
+	pc, err := net.FilePacketConn(f)
+	if err != nil {
+		return socket{}, err
+	}
+	return socket{name: name, pc: pc}, nil
+}
+
+// takeInherited removes the first inherited socket matched by fn from the pool and returns it
+func takeInherited(fn func(s socket) bool) (socket, bool) {
+	loadInherited()
+	inheritMu.Lock()
+	defer inheritMu.Unlock()
+	for i, s := range inherited {
+		if fn(s) {
+			inherited = append(inherited[:i], inherited[i+1:]...)
+			return s, true
+		}
+	}
+	return socket{}, false
+}
+
+// addActive records sockets in use, they are passed to the new process on graceful restart
+func addActive(s socket) {
+	inheritMu.Lock()
+	defer inheritMu.Unlock()
+	active = append(active, s)
+}
+
+// Inherited returns sockets passed by systemd whose FileDescriptorName is name, or all of them if name is empty.
+// A socket is returned only once, so http and grpc servers can't take the same socket.
+func Inherited(name string) ([]net.Listener, error) {
+	loadInherited()
+	if inheritErr != nil {
+		return nil, inheritErr
+	}
+	var lns []net.Listener
+	for {
+		s, ok := takeInherited(func(s socket) bool {
+			return s.ln != nil && (stringutils.IsEmpty(name) || s.name == name)
+		})
+		if !ok {
+			break
+		}
+		addActive(s)
+		lns = append(lns, s.ln)
+	}
+	if len(lns) == 0 {
+		return nil, errors.Errorf("no socket named %q passed by systemd", name)
+	}
+	return lns, nil
+}
+
+// Pending returns number of inherited sockets which have not been taken over yet
+func Pending() int {
+	loadInherited()
+	inheritMu.Lock()
+	defer inheritMu.Unlock()
+	return len(inherited)
+}
+
+// Inheritable returns duplicated files of sockets opened by Listen and ListenPacket which are not closed yet, and environment variables
+// describing them to a new process started with the files as extra files from fd 3. The new process takes them
+// over by Listen and ListenPacket with the same addresses. Files should be closed once the process is started.
+func Inheritable() ([]*os.File, []string, error) {
+	inheritMu.Lock()
+	defer inheritMu.Unlock()
+	var (
+		files []*os.File
+		names []string
+		open  []socket
+	)
+	for _, s := range active {
+		f, err := s.file()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				// sockets closed by servers are forgotten
+				continue
+			}
+			for _, item := range files {
+				item.Close()
+			}
+			return nil, nil, err
+		}
+		files = append(files, f)
+		names = append(names, s.name)
+		open = append(open, s)
+	}
+	active = open
+	env := []string{
+		EnvUpgradeFds + "=" + strconv.Itoa(len(files)),
+		EnvUpgradeFdNames + "=" + strings.Join(names, ","),
+	}
+	return files, env, nil
+}
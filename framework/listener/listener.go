@@ -0,0 +1,284 @@
+// Package listener creates listeners of http and grpc servers from addresses in GDD_LISTEN and GDD_GRPC_LISTEN.
+// An address is one of
+//
+//	:6060, tcp://:6060, tcp4://0.0.0.0:6060 or tcp6://[::1]:6060 for tcp sockets
+//	unix:///run/app/http.sock?mode=0660 for unix domain sockets with optional file permissions
+//	systemd:// or systemd://http for sockets passed by systemd socket activation, all of them or those whose
+//	FileDescriptorName is http
+//
+// Sockets passed by systemd through LISTEN_FDS are also reused by tcp and unix addresses bound to the same
+// address, so a service keeps working whether or not it is socket activated. Sockets in use are passed to the
+// new process on graceful restart in the same way, see Inheritable. SO_REUSEPORT is set on tcp sockets if
+// GDD_REUSEPORT is true, or by passing ReusePort() to rest.WithListenConfig or grpcx.GrpcServer.SetListenConfig.
+package listener
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/toolkit/cast"
+	"github.com/unionj-cloud/toolkit/stringutils"
+)
+
+// NetworkSystemd is network of addresses selecting sockets passed by systemd
+const NetworkSystemd = "systemd"
+
+// listenFdsStart is the first file descriptor passed by systemd
+var listenFdsStart = 3
+
+// Address is a parsed listen address
+type Address struct {
+	// Network is one of tcp, tcp4, tcp6, unix and systemd
+	Network string
+	// Address is host:port for tcp, socket path for unix and FileDescriptorName for systemd
+	Address string
+	// Mode is file permissions of unix socket, zero keeps permissions decided by umask
+	Mode os.FileMode
+}
+
+// String returns address in the format accepted by ParseAddress
+func (a Address) String() string {
+	s := a.Network + "://" + a.Address
+	if a.Mode != 0 {
+		s += "?mode=" + strconv.FormatUint(uint64(a.Mode), 8)
+	}
+	return s
+}
+
+// ParseAddress parses a listen address, addresses without scheme are tcp addresses
+func ParseAddress(value string) (Address, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "://") {
+		if stringutils.IsEmpty(value) {
+			return Address{}, errors.New("empty listen address")
+		}
+		return Address{Network: "tcp", Address: value}, nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return Address{}, errors.Wrapf(err, "invalid listen address %s", value)
+	}
+	a := Address{Network: strings.ToLower(u.Scheme)}
+	switch a.Network {
+	case "tcp", "tcp4", "tcp6":
+		a.Address = u.Host
+		if _, _, err = net.SplitHostPort(a.Address); err != nil {
+			return Address{}, errors.Wrapf(err, "invalid listen address %s", value)
+		}
+	case "unix":
+		a.Address = u.Host + u.Path
+		if stringutils.IsEmpty(a.Address) {
+			return Address{}, errors.Errorf("no socket path in listen address %s", value)
+		}
+		if mode := u.Query().Get("mode"); stringutils.IsNotEmpty(mode) {
+			m, err := strconv.ParseUint(mode, 8, 32)
+			if err != nil {
+				return Address{}, errors.Wrapf(err, "invalid mode of listen address %s", value)
+			}
+			a.Mode = os.FileMode(m)
+		}
+	case NetworkSystemd:
+		a.Address = u.Host
+	default:
+		return Address{}, errors.Errorf("unsupported network %s of listen address %s", u.Scheme, value)
+	}
+	return a, nil
+}
+
+// ParseAddresses parses comma separated listen addresses
+func ParseAddresses(value string) ([]Address, error) {
+	var addrs []Address
+	for _, item := range strings.Split(value, ",") {
+		if stringutils.IsEmpty(strings.TrimSpace(item)) {
+			continue
+		}
+		a, err := ParseAddress(item)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, a)
+	}
+	if len(addrs) == 0 {
+		return nil, errors.Errorf("no listen address in %s", value)
+	}
+	return addrs, nil
+}
+
+// ListenConfig returns lc, or ReusePort() if lc is nil and GDD_REUSEPORT is true
+func ListenConfig(lc *net.ListenConfig) *net.ListenConfig {
+	if lc != nil {
+		return lc
+	}
+	if cast.ToBoolOrDefault(config.GddReusePort.Load(), config.DefaultGddReusePort) {
+		return ReusePort()
+	}
+	return &net.ListenConfig{}
+}
+
+// ReusePort returns ListenConfig setting SO_REUSEPORT on tcp sockets, so that several processes can listen
+// on the same port and the kernel balances connections between them, e.g. rest.WithListenConfig(listener.ReusePort())
+func ReusePort() *net.ListenConfig {
+	return &net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			if !strings.HasPrefix(network, "tcp") {
+				return nil
+			}
+			var serr error
+			if err := c.Control(func(fd uintptr) {
+				serr = setReusePort(fd)
+			}); err != nil {
+				return err
+			}
+			return errors.Wrap(serr, "failed to set SO_REUSEPORT")
+		},
+	}
+}
+
+// Listen listens on all addresses by lc. Sockets passed by systemd are used for systemd addresses and for tcp
+// and unix addresses bound to the same address. Listeners opened already are closed if any address fails.
+func Listen(ctx context.Context, lc *net.ListenConfig, addrs []Address) ([]net.Listener, error) {
+	if lc == nil {
+		lc = &net.ListenConfig{}
+	}
+	var lns []net.Listener
+	for _, a := range addrs {
+		found, err := listen(ctx, lc, a)
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return nil, err
+		}
+		lns = append(lns, found...)
+	}
+	return lns, nil
+}
+
+func listen(ctx context.Context, lc *net.ListenConfig, a Address) ([]net.Listener, error) {
+	if a.Network == NetworkSystemd {
+		return Inherited(a.Address)
+	}
+	if s, ok := takeInherited(func(s socket) bool {
+		return s.ln != nil && (s.name == a.String() || sameAddress(s.ln.Addr(), a))
+	}); ok {
+		addActive(socket{name: a.String(), ln: s.ln})
+		return []net.Listener{s.ln}, nil
+	}
+	if a.Network == "unix" {
+		if err := removeStaleSocket(a.Address); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := lc.Listen(ctx, a.Network, a.Address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen on %s", a)
+	}
+	if a.Network == "unix" && a.Mode != 0 {
+		if err = os.Chmod(a.Address, a.Mode); err != nil {
+			ln.Close()
+			return nil, errors.Wrapf(err, "failed to change mode of %s", a.Address)
+		}
+	}
+	addActive(socket{name: a.String(), ln: ln})
+	return []net.Listener{ln}, nil
+}
+
+// ListenPacket listens on udp address by lc like Listen, e.g. ListenPacket(ctx, nil, "udp", ":7946")
+func ListenPacket(ctx context.Context, lc *net.ListenConfig, network, address string) (net.PacketConn, error) {
+	if lc == nil {
+		lc = &net.ListenConfig{}
+	}
+	a := Address{Network: network, Address: address}
+	if s, ok := takeInherited(func(s socket) bool {
+		return s.pc != nil && (s.name == a.String() || sameAddress(s.pc.LocalAddr(), a))
+	}); ok {
+		addActive(socket{name: a.String(), pc: s.pc})
+		return s.pc, nil
+	}
+	pc, err := lc.ListenPacket(ctx, network, address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen on %s", a)
+	}
+	addActive(socket{name: a.String(), pc: pc})
+	return pc, nil
+}
+
+// removeStaleSocket removes socket file left by a process which didn't close its listener,
+// a socket which is still accepting connections is kept
+func removeStaleSocket(path string) error {
+	if strings.HasPrefix(path, "@") {
+		return nil
+	}
+	fi, err := os.Lstat(path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return errors.Errorf("unix socket %s is in use", path)
+	}
+	return errors.Wrapf(os.Remove(path), "failed to remove stale unix socket %s", path)
+}
+
+// sameAddress reports whether addr is bound to address a
+func sameAddress(addr net.Addr, a Address) bool {
+	var (
+		ip   net.IP
+		port int
+	)
+	switch x := addr.(type) {
+	case *net.UnixAddr:
+		return a.Network == "unix" && x.Name == a.Address
+	case *net.TCPAddr:
+		if !strings.HasPrefix(a.Network, "tcp") {
+			return false
+		}
+		ip, port = x.IP, x.Port
+	case *net.UDPAddr:
+		if !strings.HasPrefix(a.Network, "udp") {
+			return false
+		}
+		ip, port = x.IP, x.Port
+	default:
+		return false
+	}
+	host, p, err := net.SplitHostPort(a.Address)
+	if err != nil {
+		return false
+	}
+	want, err := net.LookupPort(a.Network, p)
+	if err != nil || want == 0 || want != port {
+		return false
+	}
+	wantIP := net.ParseIP(host)
+	if wantIP == nil && stringutils.IsNotEmpty(host) {
+		resolved, err := net.ResolveIPAddr("ip", host)
+		if err != nil {
+			return false
+		}
+		wantIP = resolved.IP
+	}
+	if len(wantIP) == 0 || wantIP.IsUnspecified() {
+		return len(ip) == 0 || ip.IsUnspecified()
+	}
+	return wantIP.Equal(ip)
+}
+
+// TCPPort returns port of the first tcp listener, it is the only address registered to service registry
+// because clients from other hosts can't connect to unix sockets
+func TCPPort(lns []net.Listener) (int, bool) {
+	for _, ln := range lns {
+		if addr, ok := ln.Addr().(*net.TCPAddr); ok {
+			return addr.Port, true
+		}
+	}
+	return 0, false
+}
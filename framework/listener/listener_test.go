@@ -0,0 +1,163 @@
+package listener
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAddress(t *testing.T) {
+	cases := []struct {
+		value string
+		want  Address
+	}{
+		{":6060", Address{Network: "tcp", Address: ":6060"}},
+		{"tcp://0.0.0.0:6060", Address{Network: "tcp", Address: "0.0.0.0:6060"}},
+		{"tcp6://[::1]:6060", Address{Network: "tcp6", Address: "[::1]:6060"}},
+		{"unix:///run/app/http.sock?mode=0660", Address{Network: "unix", Address: "/run/app/http.sock", Mode: 0660}},
+		{"unix://http.sock", Address{Network: "unix", Address: "http.sock"}},
+		{"systemd://http", Address{Network: NetworkSystemd, Address: "http"}},
+		{"systemd://", Address{Network: NetworkSystemd}},
+	}
+	for _, c := range cases {
+		a, err := ParseAddress(c.value)
+		require.NoError(t, err, c.value)
+		assert.Equal(t, c.want, a, c.value)
+	}
+	for _, value := range []string{"udp://:53", "tcp://localhost", "unix://", "unix:///a.sock?mode=rw", " "} {
+		_, err := ParseAddress(value)
+		assert.Error(t, err, value)
+	}
+	addrs, err := ParseAddresses(":6060, unix:///run/app/http.sock,")
+	require.NoError(t, err)
+	assert.Len(t, addrs, 2)
+	assert.Equal(t, "unix:///run/app/http.sock?mode=660", Address{Network: "unix", Address: "/run/app/http.sock", Mode: 0660}.String())
+}
+
+func TestListen(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "http.sock")
+	addrs, err := ParseAddresses("unix://" + sock + "?mode=0600,tcp://127.0.0.1:0")
+	require.NoError(t, err)
+	lns, err := Listen(context.Background(), nil, addrs)
+	require.NoError(t, err)
+	require.Len(t, lns, 2)
+	fi, err := os.Stat(sock)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	port, ok := TCPPort(lns)
+	assert.True(t, ok)
+	assert.Equal(t, lns[1].Addr().(*net.TCPAddr).Port, port)
+	_, ok = TCPPort(lns[:1])
+	assert.False(t, ok, "unix sockets are not registered")
+
+	_, err = Listen(context.Background(), nil, addrs[:1])
+	assert.Error(t, err, "socket in use is kept")
+	for _, ln := range lns {
+		ln.Close()
+	}
+
+	// socket file left by a killed process
+	stale, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	lns, err = Listen(context.Background(), nil, addrs[:1])
+	require.NoError(t, err)
+	lns[0].Close()
+}
+
+func TestReusePort(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_REUSEPORT semantics differ by os")
+	}
+	ln1, err := ReusePort().Listen(context.Background(), "tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln1.Close()
+	ln2, err := ReusePort().Listen(context.Background(), "tcp", ln1.Addr().String())
+	require.NoError(t, err)
+	ln2.Close()
+
+	t.Setenv("GDD_REUSEPORT", "true")
+	assert.NotNil(t, ListenConfig(nil).Control)
+	t.Setenv("GDD_REUSEPORT", "false")
+	assert.Nil(t, ListenConfig(nil).Control)
+}
+
+func TestInherited(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	// the duplicated file descriptor is closed by loadInherited like those passed by systemd
+	f, err := ln.(*net.TCPListener).File()
+	require.NoError(t, err)
+
+	inheritOnce = sync.Once{}
+	prev := listenFdsStart
+	listenFdsStart = int(f.Fd())
+	defer func() {
+		listenFdsStart = prev
+	}()
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "http")
+
+	_, err = Inherited("grpc")
+	assert.Error(t, err)
+	assert.Empty(t, os.Getenv("LISTEN_FDS"), "environment variables are not passed to child processes")
+	addrs, err := ParseAddresses("tcp://" + ln.Addr().String())
+	require.NoError(t, err)
+	lns, err := Listen(context.Background(), nil, addrs)
+	require.NoError(t, err, "inherited socket bound to the same address is used instead of listening again")
+	assert.Equal(t, ln.Addr().String(), lns[0].Addr().String())
+	lns[0].Close()
+	_, err = Inherited("http")
+	assert.Error(t, err, "a socket is returned only once")
+}
+
+func TestInheritable(t *testing.T) {
+	inheritMu.Lock()
+	prev := active
+	active = nil
+	inheritMu.Unlock()
+	defer func() {
+		inheritMu.Lock()
+		active = prev
+		inheritMu.Unlock()
+	}()
+
+	addrs, err := ParseAddresses("tcp://127.0.0.1:0")
+	require.NoError(t, err)
+	lns, err := Listen(context.Background(), nil, addrs)
+	require.NoError(t, err)
+	defer lns[0].Close()
+	pc, err := ListenPacket(context.Background(), nil, "udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+
+	files, env, err := Inheritable()
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, []string{EnvUpgradeFds + "=2", EnvUpgradeFdNames + "=tcp://127.0.0.1:0,udp://127.0.0.1:0"}, env)
+	for i, f := range files {
+		s, err := fileSocket(f, "test")
+		f.Close()
+		require.NoError(t, err)
+		if i == 0 {
+			require.NotNil(t, s.ln)
+			assert.True(t, sameAddress(s.ln.Addr(), Address{Network: "tcp", Address: lns[0].Addr().String()}))
+			s.ln.Close()
+		} else {
+			require.NotNil(t, s.pc)
+			assert.True(t, sameAddress(s.pc.LocalAddr(), Address{Network: "udp", Address: pc.LocalAddr().String()}))
+			s.pc.Close()
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package listener
+
+import (
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+func setReusePort(fd uintptr) error {
+	return errors.Errorf("SO_REUSEPORT is not supported on %s", runtime.GOOS)
+}
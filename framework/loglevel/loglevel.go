@@ -0,0 +1,115 @@
+// Package loglevel changes levels of zerolog loggers at runtime. The root logger is zlogger.Logger, its level is
+// initialised from GDD_LOG_LEVEL. Components create named loggers by Named, levels of which can be changed
+// independently, e.g. to debug a single component without flooding logs. Framework packages log by loggers named
+// after them:
+//
+//	rest, grpcx, grpcx.deadline, registry, registry.{etcd,nacos,zk,memberlist}, lifecycle, tlsx, tracing,
+//	metrics, jwtauth, idempotency, httpratelimit, concurrencylimit
+//
+// zerolog global level is kept at the lowest level of all loggers, and each logger discards events below its own
+// level by a hook.
+package loglevel
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	logger "github.com/unionj-cloud/toolkit/zlogger"
+)
+
+// Root is name of zlogger.Logger
+const Root = "root"
+
+// ErrUnknownLogger is returned when setting level of a logger which does not exist
+var ErrUnknownLogger = errors.New("unknown logger")
+
+// levelHook discards events below level
+type levelHook struct {
+	level *atomic.Int32
+}
+
+func (h levelHook) Run(e *zerolog.Event, level zerolog.Level, _ string) {
+	if level != zerolog.NoLevel && level < zerolog.Level(h.level.Load()) {
+		e.Discard()
+	}
+}
+
+var (
+	mu     sync.Mutex
+	levels = make(map[string]*atomic.Int32)
+	// base is zlogger.Logger before the root hook is installed, named loggers are derived from it so that
+	// they are not filtered by the root level
+	base zerolog.Logger
+)
+
+func init() {
+	level, err := zerolog.ParseLevel(config.GddLogLevel.LoadOrDefault(config.DefaultGddLogLevel))
+	if err != nil {
+		level = zerolog.InfoLevel
+	}
+	root := new(atomic.Int32)
+	root.Store(int32(level))
+	levels[Root] = root
+	base = logger.Logger.Level(zerolog.TraceLevel)
+	logger.Logger = base.Hook(levelHook{level: root})
+	zerolog.SetGlobalLevel(level)
+}
+
+// Named returns logger of component name with field logger=name, its level is the root level at first
+func Named(name string) zerolog.Logger {
+	mu.Lock()
+	defer mu.Unlock()
+	level, ok := levels[name]
+	if !ok {
+		level = new(atomic.Int32)
+		level.Store(levels[Root].Load())
+		levels[name] = level
+	}
+	return base.With().Str("logger", name).Logger().Hook(levelHook{level: level})
+}
+
+// SetLevel changes level of logger name, Root for zlogger.Logger
+func SetLevel(name string, level zerolog.Level) error {
+	mu.Lock()
+	defer mu.Unlock()
+	l, ok := levels[name]
+	if !ok {
+		return errors.Wrap(ErrUnknownLogger, name)
+	}
+	l.Store(int32(level))
+	lowest := level
+	for _, item := range levels {
+		if current := zerolog.Level(item.Load()); current < lowest {
+			lowest = current
+		}
+	}
+	zerolog.SetGlobalLevel(lowest)
+	return nil
+}
+
+// Level returns level of logger name
+func Level(name string) (zerolog.Level, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	l, ok := levels[name]
+	if !ok {
+		return zerolog.NoLevel, false
+	}
+	return zerolog.Level(l.Load()), true
+}
+
+// Names returns names of all loggers sorted
+func Names() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	names := make([]string, 0, len(levels))
+	for name := range levels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
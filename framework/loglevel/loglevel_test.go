@@ -0,0 +1,41 @@
+package loglevel
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetLevel(t *testing.T) {
+	var buf bytes.Buffer
+	original := base
+	base = zerolog.New(&buf)
+	defer func() {
+		base = original
+	}()
+	defer SetLevel(Root, zerolog.InfoLevel)
+	require.NoError(t, SetLevel(Root, zerolog.InfoLevel))
+	first := Named("first")
+	second := Named("second")
+	level, ok := Level("first")
+	require.True(t, ok)
+	assert.Equal(t, zerolog.InfoLevel, level, "named loggers start at root level")
+	assert.Contains(t, Names(), Root)
+
+	first.Debug().Msg("hidden")
+	assert.Empty(t, buf.String())
+	require.NoError(t, SetLevel("first", zerolog.DebugLevel))
+	assert.Equal(t, zerolog.DebugLevel, zerolog.GlobalLevel())
+	first.Debug().Msg("shown")
+	second.Debug().Msg("hidden")
+	assert.Contains(t, buf.String(), `"logger":"first"`)
+	assert.NotContains(t, buf.String(), "hidden")
+
+	require.NoError(t, SetLevel("first", zerolog.WarnLevel))
+	assert.Equal(t, zerolog.InfoLevel, zerolog.GlobalLevel())
+	assert.True(t, errors.Is(SetLevel("unknown", zerolog.DebugLevel), ErrUnknownLogger))
+}
@@ -0,0 +1,120 @@
+// Package metrics holds helpers shared by RED (rate, errors, duration) metrics of http routes and grpc methods.
+// Metrics are collected when GDD_METRICS_ENABLE is true, which is the default, and duration histograms use
+// buckets from GDD_METRICS_BUCKETS. Observations carry trace id of the sampled span in context as exemplar,
+// so that dashboards can jump from a slow bucket to the trace.
+//
+// Http metrics are served at /go-doudou/prometheus behind basic auth of manage routes, GDD_METRICS_PUBLIC=true
+// serves it without credentials. Series of earlier releases are replaced:
+//
+//	go_doudou_http_request_count{path,method,status}     -> go_doudou_http_requests_total{route,method,status}
+//	go_doudou_http_response_time_seconds{path,method}    -> go_doudou_http_request_duration_seconds{route,method,status}
+//
+// where route is the matched route template instead of raw url path, and status is the status class like 2xx
+// instead of the code. GDD_METRICS_LEGACY=true keeps recording the old series while dashboards are migrated.
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/loglevel"
+	"github.com/unionj-cloud/toolkit/cast"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var logger = loglevel.Named("metrics")
+
+// ExemplarTraceID is label name of trace id in exemplars
+const ExemplarTraceID = "trace_id"
+
+// Enabled reports whether metrics should be collected
+func Enabled() bool {
+	return cast.ToBoolOrDefault(config.GddMetricsEnable.Load(), config.DefaultGddMetricsEnable)
+}
+
+// Public reports whether metrics are served without basic auth
+func Public() bool {
+	return cast.ToBoolOrDefault(config.GddMetricsPublic.Load(), config.DefaultGddMetricsPublic)
+}
+
+// Legacy reports whether http series of earlier releases are recorded as well
+func Legacy() bool {
+	return cast.ToBoolOrDefault(config.GddMetricsLegacy.Load(), config.DefaultGddMetricsLegacy)
+}
+
+// ParseBuckets parses comma separated buckets in seconds, they must be positive and increasing
+func ParseBuckets(value string) ([]float64, error) {
+	var buckets []float64
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		b, err := strconv.ParseFloat(item, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid bucket %s", item)
+		}
+		if b <= 0 || (len(buckets) > 0 && b <= buckets[len(buckets)-1]) {
+			return nil, errors.Errorf("buckets must be positive and increasing: %s", value)
+		}
+		buckets = append(buckets, b)
+	}
+	if len(buckets) == 0 {
+		return nil, errors.Errorf("no bucket in %s", value)
+	}
+	return buckets, nil
+}
+
+// Buckets returns buckets of duration histograms from GDD_METRICS_BUCKETS, invalid value falls back to default
+func Buckets() []float64 {
+	value := config.GddMetricsBuckets.LoadOrDefault(config.DefaultGddMetricsBuckets)
+	buckets, err := ParseBuckets(value)
+	if err != nil {
+		logger.Warn().Err(err).Msgf("[go-doudou] invalid %s, use default %s", config.GddMetricsBuckets, config.DefaultGddMetricsBuckets)
+		buckets, _ = ParseBuckets(config.DefaultGddMetricsBuckets)
+	}
+	return buckets
+}
+
+// Exemplar returns exemplar labels carrying trace id of the sampled span in ctx, it is nil if there is none
+func Exemplar(ctx context.Context) prometheus.Labels {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() || !sc.IsSampled() {
+		return nil
+	}
+	return prometheus.Labels{ExemplarTraceID: sc.TraceID().String()}
+}
+
+// Observe observes v by o with exemplar from ctx if o supports exemplars
+func Observe(o prometheus.Observer, v float64, ctx context.Context) {
+	if labels := Exemplar(ctx); labels != nil {
+		if eo, ok := o.(prometheus.ExemplarObserver); ok {
+			eo.ObserveWithExemplar(v, labels)
+			return
+		}
+	}
+	o.Observe(v)
+}
+
+// Inc increments c with exemplar from ctx if c supports exemplars
+func Inc(c prometheus.Counter, ctx context.Context) {
+	if labels := Exemplar(ctx); labels != nil {
+		if ea, ok := c.(prometheus.ExemplarAdder); ok {
+			ea.AddWithExemplar(1, labels)
+			return
+		}
+	}
+	c.Inc()
+}
+
+// StatusClass returns class of http status code, e.g. 2xx
+func StatusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestParseBuckets(t *testing.T) {
+	buckets, err := ParseBuckets(" 0.1, 0.5,1 ,")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.1, 0.5, 1}, buckets)
+	_, err = ParseBuckets("0.5,0.1")
+	assert.Error(t, err)
+	_, err = ParseBuckets("fast")
+	assert.Error(t, err)
+	_, err = ParseBuckets("")
+	assert.Error(t, err)
+}
+
+func TestBuckets(t *testing.T) {
+	t.Setenv("GDD_METRICS_BUCKETS", "1,2")
+	assert.Equal(t, []float64{1, 2}, Buckets())
+	t.Setenv("GDD_METRICS_BUCKETS", "2,1")
+	assert.Len(t, Buckets(), 11, "invalid buckets fall back to default")
+}
+
+func TestExemplar(t *testing.T) {
+	assert.Nil(t, Exemplar(context.Background()))
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{1},
+	})
+	assert.Nil(t, Exemplar(trace.ContextWithSpanContext(context.Background(), sc)), "span is not sampled")
+	sc = sc.WithTraceFlags(trace.FlagsSampled)
+	labels := Exemplar(trace.ContextWithSpanContext(context.Background(), sc))
+	assert.Equal(t, sc.TraceID().String(), labels[ExemplarTraceID])
+}
+
+func TestStatusClass(t *testing.T) {
+	assert.Equal(t, "2xx", StatusClass(204))
+	assert.Equal(t, "5xx", StatusClass(503))
+	assert.Equal(t, "unknown", StatusClass(0))
+}
@@ -1,8 +1,11 @@
 package plugin
 
 import (
+	"context"
+
 	"github.com/elliotchance/orderedmap/v2"
 	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
 	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
 	"github.com/unionj-cloud/toolkit/pipeconn"
 )
@@ -16,7 +19,17 @@ type ServicePlugin interface {
 	GoDoudouServicePlugin()
 }
 
+// RegisterServicePlugin registers plugin, its Close method is called on shutdown after servers are drained
 func RegisterServicePlugin(plugin ServicePlugin) {
+	if _, ok := servicePlugins.Get(plugin.GetName()); !ok {
+		name := plugin.GetName()
+		lifecycle.OnShutdown("plugin "+name, lifecycle.PriorityPlugin, func(ctx context.Context) error {
+			if value, ok := servicePlugins.Get(name); ok {
+				value.Close()
+			}
+			return nil
+		})
+	}
 	servicePlugins.Set(plugin.GetName(), plugin)
 }
 
@@ -0,0 +1,378 @@
+// Package httpratelimit limits requests to RestServer routes, the counterpart of grpcx_ratelimit for RESTful services.
+// Requests are limited by a KeyFunc like client ip or subject of verified claims, limits of routes come from
+// GDD_RATELIMIT_ROUTES or @ratelimit annotations like @ratelimit(10-S-20) in svc.go, other routes fall back to
+// GDD_RATELIMIT_DEFAULT. Responses have RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers, rejected
+// requests get 429 Too Many Requests with Retry-After header.
+package httpratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/jwtauth"
+	"github.com/unionj-cloud/go-doudou/v2/framework/loglevel"
+	"github.com/unionj-cloud/go-doudou/v2/framework/ratelimit"
+	"github.com/unionj-cloud/go-doudou/v2/framework/ratelimit/memrate"
+	"github.com/unionj-cloud/go-doudou/v2/framework/ratelimit/redisrate"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest/httprouter"
+	"github.com/unionj-cloud/toolkit/cast"
+	"github.com/unionj-cloud/toolkit/stringutils"
+)
+
+var logger = loglevel.Named("httpratelimit")
+
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRetryAfter         = "Retry-After"
+	// Annotation sets limit of a route in format of ratelimit.Parse, e.g. @ratelimit(10-S-20)
+	Annotation = "ratelimit"
+)
+
+// ErrLimitExceeded is rendered with 429 Too Many Requests
+var ErrLimitExceeded = errors.New("rate limit exceeded, please retry later")
+
+// Result is the outcome of taking one token from a bucket
+type Result struct {
+	Limit   ratelimit.Limit
+	Allowed bool
+	// Remaining is the number of requests allowed immediately after this one
+	Remaining int
+	// RetryAfter is how long to wait before next request is allowed, it is 0 if Allowed is true
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+}
+
+// Store keeps buckets of keys
+type Store interface {
+	Allow(ctx context.Context, key string, limit ratelimit.Limit) (Result, error)
+}
+
+type limitKey struct{}
+
+type memoryStore struct {
+	store *memrate.MemoryStore
+}
+
+// NewMemoryStore keeps buckets of at most maxKeys keys in memory, least recently used ones are evicted
+func NewMemoryStore(maxKeys int) Store {
+	return &memoryStore{
+		store: memrate.NewMemoryStore(func(ctx context.Context, store *memrate.MemoryStore, key string) ratelimit.Limiter {
+			limit := ctx.Value(limitKey{}).(ratelimit.Limit)
+			// a bucket idle for longer than refilling it is the same as a new one
+			idle := time.Duration(float64(limit.Burst) / perSecond(limit) * float64(time.Second))
+			return memrate.NewLimiterLimit(limit, memrate.WithTimer(max(idle, time.Minute), func() {
+				store.DeleteKey(key)
+			}))
+		}, memrate.WithMaxKeys(maxKeys)),
+	}
+}
+
+func perSecond(limit ratelimit.Limit) float64 {
+	return limit.Rate / limit.Period.Seconds()
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func (m *memoryStore) Allow(ctx context.Context, key string, limit ratelimit.Limit) (Result, error) {
+	lim := m.store.GetLimiterCtx(context.WithValue(ctx, limitKey{}, limit), key).(*memrate.Limiter)
+	now := time.Now()
+	ret := Result{
+		Limit:   limit,
+		Allowed: lim.AllowN(now, 1),
+	}
+	tokens := lim.TokensAt(now)
+	rate := perSecond(limit)
+	ret.Remaining = int(math.Max(tokens, 0))
+	ret.ResetAfter = seconds((float64(limit.Burst) - tokens) / rate)
+	if !ret.Allowed {
+		ret.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return ret, nil
+}
+
+type redisStore struct {
+	rdb redisrate.Rediser
+}
+
+// NewRedisStore keeps buckets in redis by GCRA algorithm, so that limits are shared by all instances
+func NewRedisStore(rdb redisrate.Rediser) Store {
+	return &redisStore{rdb: rdb}
+}
+
+func (s *redisStore) Allow(ctx context.Context, key string, limit ratelimit.Limit) (Result, error) {
+	res, err := redisrate.NewGcraLimiterLimit(s.rdb, key, limit).(*redisrate.GcraLimiter).AllowN(ctx, 1)
+	if err != nil {
+		return Result{}, errors.WithStack(err)
+	}
+	ret := Result{
+		Limit:      limit,
+		Allowed:    res.Allowed > 0,
+		Remaining:  res.Remaining,
+		ResetAfter: res.ResetAfter,
+	}
+	if !ret.Allowed {
+		ret.RetryAfter = res.RetryAfter
+	}
+	return ret, nil
+}
+
+// KeyFunc returns what a request is limited by, requests with empty key are not limited
+type KeyFunc func(r *http.Request) string
+
+// ClientIP limits requests by client ip. RestServer applies handlers.ProxyHeaders before route middlewares,
+// so RemoteAddr has been replaced by X-Forwarded-For or X-Real-IP header set by proxies.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Subject limits requests by subject of claims put by jwtauth middleware
+func Subject(r *http.Request) string {
+	claims, ok := jwtauth.FromContext(r.Context())
+	if !ok {
+		return ""
+	}
+	sub, _ := claims.GetSubject()
+	return sub
+}
+
+// RouteName limits requests by matched route, so that all clients share the same bucket of a route
+func RouteName(r *http.Request) string {
+	return httprouter.ParamsFromContext(r.Context()).MatchedRouteName()
+}
+
+// Header limits requests by value of header name, e.g. X-Api-Key
+func Header(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// ParseKey returns KeyFunc by name, one of ip, subject, route and header:{name}
+func ParseKey(name string) (KeyFunc, error) {
+	switch {
+	case name == "ip":
+		return ClientIP, nil
+	case name == "subject":
+		return Subject, nil
+	case name == "route":
+		return RouteName, nil
+	case strings.HasPrefix(name, "header:") && len(name) > len("header:"):
+		return Header(strings.TrimPrefix(name, "header:")), nil
+	default:
+		return nil, errors.Errorf("unknown rate limit key %s", name)
+	}
+}
+
+// Config configures RateLimiter
+type Config struct {
+	// Default is limit of routes without their own limit, zero value means they are not limited
+	Default ratelimit.Limit
+	// Routes are limits of routes keyed by route name, they take precedence over @ratelimit annotations
+	Routes map[string]ratelimit.Limit
+	// Key is what requests are limited by, default is ClientIP
+	Key KeyFunc
+	// MaxKeys is max number of keys kept by default memory store
+	MaxKeys int
+}
+
+// LoadConfig loads Config from GDD_RATELIMIT_* environment variables
+func LoadConfig() (Config, error) {
+	conf := Config{
+		Routes:  make(map[string]ratelimit.Limit),
+		MaxKeys: cast.ToIntOrDefault(config.GddRateLimitMaxKeys.Load(), config.DefaultGddRateLimitMaxKeys),
+	}
+	var err error
+	if value := config.GddRateLimitDefault.Load(); stringutils.IsNotEmpty(value) {
+		if conf.Default, err = ratelimit.Parse(value); err != nil {
+			return conf, errors.Wrapf(err, "invalid %s", config.GddRateLimitDefault)
+		}
+	}
+	for _, item := range strings.Split(config.GddRateLimitRoutes.Load(), ",") {
+		if item = strings.TrimSpace(item); stringutils.IsEmpty(item) {
+			continue
+		}
+		route, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return conf, errors.Errorf("invalid %s: %s", config.GddRateLimitRoutes, item)
+		}
+		limit, err := ratelimit.Parse(strings.TrimSpace(value))
+		if err != nil {
+			return conf, errors.Wrapf(err, "invalid %s", config.GddRateLimitRoutes)
+		}
+		conf.Routes[strings.TrimSpace(route)] = limit
+	}
+	if conf.Key, err = ParseKey(config.GddRateLimitKey.LoadOrDefault(config.DefaultGddRateLimitKey)); err != nil {
+		return conf, errors.Wrapf(err, "invalid %s", config.GddRateLimitKey)
+	}
+	return conf, nil
+}
+
+// RateLimiter limits requests to RestServer routes
+type RateLimiter struct {
+	conf          Config
+	store         Store
+	annotations   func(operation string) []framework.Annotation
+	errorRenderer rest.ErrorRenderer
+	// parsed limits of @ratelimit annotations keyed by route name
+	parsed sync.Map
+}
+
+type Option func(*RateLimiter)
+
+// WithStore replaces default memory store, e.g. WithStore(NewRedisStore(rdb)) shares limits among instances
+func WithStore(store Store) Option {
+	return func(rl *RateLimiter) {
+		rl.store = store
+	}
+}
+
+// WithAnnotationStore looks up @ratelimit from store instead of the one registered by framework.RegisterAnnotationStore
+func WithAnnotationStore(annotationStore framework.AnnotationStore) Option {
+	return func(rl *RateLimiter) {
+		rl.annotations = func(operation string) []framework.Annotation {
+			return annotationStore[operation]
+		}
+	}
+}
+
+// WithErrorRenderer customizes how 429 errors are written, default is rest.JSONErrorRenderer
+func WithErrorRenderer(renderer rest.ErrorRenderer) Option {
+	return func(rl *RateLimiter) {
+		rl.errorRenderer = renderer
+	}
+}
+
+// New creates a RateLimiter
+func New(conf Config, opts ...Option) *RateLimiter {
+	if conf.Key == nil {
+		conf.Key = ClientIP
+	}
+	if conf.MaxKeys <= 0 {
+		conf.MaxKeys = config.DefaultGddRateLimitMaxKeys
+	}
+	rl := &RateLimiter{
+		conf:          conf,
+		annotations:   framework.GetAnnotations,
+		errorRenderer: rest.JSONErrorRenderer,
+	}
+	for _, fn := range opts {
+		fn(rl)
+	}
+	if rl.store == nil {
+		rl.store = NewMemoryStore(conf.MaxKeys)
+	}
+	return rl
+}
+
+// limit returns limit of operation, own is true if it is not the default limit
+func (rl *RateLimiter) limit(operation string) (limit ratelimit.Limit, own bool) {
+	if limit, ok := rl.conf.Routes[operation]; ok {
+		return limit, true
+	}
+	if value, ok := rl.parsed.Load(operation); ok {
+		limit = value.(ratelimit.Limit)
+	} else {
+		for _, item := range rl.annotations(operation) {
+			if item.Name != Annotation || len(item.Params) == 0 {
+				continue
+			}
+			var err error
+			if limit, err = ratelimit.Parse(item.Params[0]); err != nil {
+				logger.Warn().Err(err).Msgf("[go-doudou] invalid @%s on %s", Annotation, operation)
+			}
+			break
+		}
+		rl.parsed.Store(operation, limit)
+	}
+	if limit.Rate > 0 {
+		return limit, true
+	}
+	return rl.conf.Default, false
+}
+
+func setHeaders(w http.ResponseWriter, res Result) {
+	header := w.Header()
+	header.Set(HeaderRateLimitLimit, strconv.Itoa(res.Limit.Burst))
+	header.Set(HeaderRateLimitRemaining, strconv.Itoa(res.Remaining))
+	header.Set(HeaderRateLimitReset, strconv.Itoa(int(math.Ceil(res.ResetAfter.Seconds()))))
+	if !res.Allowed {
+		header.Set(HeaderRetryAfter, strconv.Itoa(max(int(math.Ceil(res.RetryAfter.Seconds())), 1)))
+	}
+}
+
+// Middleware rejects requests exceeding limit of matched route with 429 Too Many Requests. Requests are allowed
+// if the store fails, so that an unavailable redis doesn't take the service down.
+func (rl *RateLimiter) Middleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operation := httprouter.ParamsFromContext(r.Context()).MatchedRouteName()
+		limit, own := rl.limit(operation)
+		if limit.Rate <= 0 {
+			inner.ServeHTTP(w, r)
+			return
+		}
+		key := rl.conf.Key(r)
+		if stringutils.IsEmpty(key) {
+			inner.ServeHTTP(w, r)
+			return
+		}
+		// routes having their own limit have their own buckets, other routes share buckets of default limit
+		if own {
+			key = operation + ":" + key
+		}
+		key = "http:" + key
+		res, err := rl.store.Allow(r.Context(), key, limit)
+		if err != nil {
+			logger.Error().Err(err).Msgf("[go-doudou] failed to limit %s, request is allowed", key)
+			inner.ServeHTTP(w, r)
+			return
+		}
+		setHeaders(w, res)
+		if !res.Allowed {
+			rl.errorRenderer(w, r, rest.NewBizError(ErrLimitExceeded, rest.WithStatusCode(http.StatusTooManyRequests)))
+			return
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
+
+var (
+	defaultOnce        sync.Once
+	defaultRateLimiter *RateLimiter
+)
+
+// Default returns RateLimiter configured by GDD_RATELIMIT_* environment variables with memory store,
+// it panics if the configuration is invalid
+func Default() *RateLimiter {
+	defaultOnce.Do(func() {
+		conf, err := LoadConfig()
+		if err != nil {
+			logger.Panic().Err(err).Msg("[go-doudou] invalid rate limit config")
+		}
+		defaultRateLimiter = New(conf)
+	})
+	return defaultRateLimiter
+}
+
+// Middleware limits requests by Default, e.g. srv.AddRoutes(httpsrv.Routes(handler), httpratelimit.Middleware)
+func Middleware(inner http.Handler) http.Handler {
+	return Default().Middleware(inner)
+}
@@ -0,0 +1,120 @@
+package httpratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/ratelimit"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+)
+
+func newTestServer(rl *RateLimiter) *rest.RestServer {
+	srv := rest.NewRestServer()
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("go-doudou"))
+	}
+	srv.AddRoutes([]rest.Route{
+		{Name: "GetUser", Method: http.MethodGet, Pattern: "/user", HandlerFunc: ok},
+		{Name: "GetOrder", Method: http.MethodGet, Pattern: "/order", HandlerFunc: ok},
+		{Name: "GetStock", Method: http.MethodGet, Pattern: "/stock", HandlerFunc: ok},
+		{Name: "Health", Method: http.MethodGet, Pattern: "/health", HandlerFunc: ok},
+	}, rl.Middleware)
+	return srv
+}
+
+func do(srv *rest.RestServer, target, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("X-Forwarded-For", ip)
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	rl := New(Config{
+		Default: ratelimit.PerMinuteBurst(2, 2),
+		Routes: map[string]ratelimit.Limit{
+			"GetOrder": ratelimit.PerSecondBurst(1, 3),
+		},
+	}, WithAnnotationStore(framework.AnnotationStore{
+		"GetUser":  {{Name: "ratelimit", Params: []string{"1-M"}}},
+		"GetOrder": {{Name: "ratelimit", Params: []string{"1-M"}}},
+	}))
+	srv := newTestServer(rl)
+
+	rec := do(srv, "/user", "10.0.0.1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, "0", rec.Header().Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "60", rec.Header().Get(HeaderRateLimitReset))
+
+	rec = do(srv, "/user", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get(HeaderRetryAfter))
+	assert.Contains(t, rec.Body.String(), ErrLimitExceeded.Error())
+	assert.Equal(t, http.StatusOK, do(srv, "/user", "10.0.0.2").Code, "different client")
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, do(srv, "/order", "10.0.0.1").Code, "config takes precedence over annotation")
+	}
+	assert.Equal(t, http.StatusTooManyRequests, do(srv, "/order", "10.0.0.1").Code)
+
+	assert.Equal(t, http.StatusOK, do(srv, "/stock", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusOK, do(srv, "/health", "10.0.0.1").Code)
+	rec = do(srv, "/stock", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, "routes without own limit share the default bucket")
+	assert.Equal(t, "30", rec.Header().Get(HeaderRetryAfter))
+}
+
+func TestMiddleware_NoLimit(t *testing.T) {
+	srv := newTestServer(New(Config{Key: Header("X-Api-Key")}))
+	for i := 0; i < 10; i++ {
+		rec := do(srv, "/user", "10.0.0.1")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get(HeaderRateLimitLimit))
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("GDD_RATELIMIT_DEFAULT", "100-S-200")
+	t.Setenv("GDD_RATELIMIT_ROUTES", "GetUser=10-M, SignUp = 5-H-10")
+	t.Setenv("GDD_RATELIMIT_KEY", "header:X-Api-Key")
+	conf, err := LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, ratelimit.PerSecondBurst(100, 200), conf.Default)
+	assert.Equal(t, map[string]ratelimit.Limit{
+		"GetUser": ratelimit.PerMinute(10),
+		"SignUp":  ratelimit.PerHourBurst(5, 10),
+	}, conf.Routes)
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.Header.Set("X-Api-Key", "abc")
+	assert.Equal(t, "abc", conf.Key(req))
+
+	t.Setenv("GDD_RATELIMIT_KEY", "cookie")
+	_, err = LoadConfig()
+	assert.Error(t, err)
+	t.Setenv("GDD_RATELIMIT_ROUTES", "GetUser")
+	_, err = LoadConfig()
+	assert.Error(t, err)
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore(10)
+	ctx := context.Background()
+	limit := ratelimit.PerSecondBurst(10, 2)
+	res, err := store.Allow(ctx, "a", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+	res, _ = store.Allow(ctx, "a", limit)
+	assert.True(t, res.Allowed)
+	res, _ = store.Allow(ctx, "a", limit)
+	assert.False(t, res.Allowed)
+	assert.InDelta(t, 100*time.Millisecond, res.RetryAfter, float64(10*time.Millisecond))
+}
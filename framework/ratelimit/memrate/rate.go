@@ -85,6 +85,19 @@ func (lim *Limiter) Burst() int {
 	return lim.burst
 }
 
+// TokensAt returns the number of tokens available at time t.
+func (lim *Limiter) TokensAt(t time.Time) float64 {
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+	_, _, tokens := lim.advance(t)
+	return tokens
+}
+
+// Tokens returns the number of tokens available now.
+func (lim *Limiter) Tokens() float64 {
+	return lim.TokensAt(time.Now())
+}
+
 type LimiterOption func(*Limiter)
 
 func WithTimer(timeout time.Duration, fn func()) LimiterOption {
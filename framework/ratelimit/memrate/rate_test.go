@@ -121,6 +121,23 @@ func TestLimiterBurst3(t *testing.T) {
 	})
 }
 
+func TestLimiterTokensAt(t *testing.T) {
+	lim := NewLimiter(10, 3)
+	if tokens := lim.TokensAt(t0); tokens != 3 {
+		t.Errorf("lim.TokensAt(t0) = %v want 3", tokens)
+	}
+	lim.AllowN(t0, 3)
+	if tokens := lim.TokensAt(t0); tokens != 0 {
+		t.Errorf("lim.TokensAt(t0) = %v want 0", tokens)
+	}
+	if tokens := lim.TokensAt(t2); math.Abs(tokens-2) > 1e-9 {
+		t.Errorf("lim.TokensAt(t2) = %v want 2", tokens)
+	}
+	if tokens := lim.TokensAt(t9); tokens != 3 {
+		t.Errorf("lim.TokensAt(t9) = %v want 3", tokens)
+	}
+}
+
 func TestLimiterJumpBackwards(t *testing.T) {
 	run(t, NewLimiter(10, 3), []allow{
 		{t1, 1, true}, // start at t1
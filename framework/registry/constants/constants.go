@@ -13,3 +13,10 @@ const (
 	GRPC_TYPE ServiceType = "grpc"
 	REST_TYPE ServiceType = "rest"
 )
+
+const (
+	// PROTOCOL_META is metadata key of registered address which serves rest and grpc on one port
+	PROTOCOL_META = "protocol"
+	// MUX_PROTOCOL is value of PROTOCOL_META, grpc clients resolve such address by the rest service name
+	MUX_PROTOCOL = "rest,grpc"
+)
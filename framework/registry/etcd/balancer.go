@@ -3,8 +3,6 @@ package etcd
 import (
 	"sync"
 
-	"github.com/unionj-cloud/toolkit/zlogger"
-
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
 )
@@ -22,7 +20,7 @@ func init() {
 type wPickerBuilder struct{}
 
 func (*wPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
-	zlogger.Debug().Msgf("[go-doudou] etcd_weight_balancer Picker: Build called with info: %v", info)
+	logger.Debug().Msgf("[go-doudou] etcd_weight_balancer Picker: Build called with info: %v", info)
 	if len(info.ReadySCs) == 0 {
 		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
 	}
@@ -30,7 +28,7 @@ func (*wPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
 	for sc, v := range info.ReadySCs {
 		weight := 1
 		if metadata, ok := v.Address.Metadata.(map[string]interface{}); !ok {
-			zlogger.Error().Msg("[go-doudou] etcd endpoint metadata is not map[string]string type")
+			logger.Error().Msg("[go-doudou] etcd endpoint metadata is not map[string]string type")
 		} else {
 			weight = int(metadata["weight"].(float64))
 		}
@@ -11,21 +11,28 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/unionj-cloud/go-doudou/v2/framework/buildinfo"
 	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_deadline"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_metrics"
+	"github.com/unionj-cloud/go-doudou/v2/framework/loglevel"
 	cons "github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/utils"
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
 	"github.com/unionj-cloud/toolkit/cast"
 	"github.com/unionj-cloud/toolkit/constants"
 	"github.com/unionj-cloud/toolkit/stringutils"
-	"github.com/unionj-cloud/toolkit/zlogger"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/naming/endpoints"
 	"go.etcd.io/etcd/client/v3/naming/resolver"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 )
 
+var logger = loglevel.Named("registry.etcd")
+
 var onceEtcd sync.Once
 var EtcdCli *clientv3.Client
 var restLease clientv3.LeaseID
@@ -35,7 +42,7 @@ var providers = map[string]interfaces.IServiceProvider{}
 func InitEtcdCli() {
 	etcdEndpoints := config.GddEtcdEndpoints.LoadOrDefault(config.DefaultGddEtcdEndpoints)
 	if stringutils.IsEmpty(etcdEndpoints) {
-		zlogger.Panic().Msg("[go-doudou] env GDD_ETCD_ENDPOINTS is not set")
+		logger.Panic().Msg("[go-doudou] env GDD_ETCD_ENDPOINTS is not set")
 	}
 	endpoints := strings.Split(etcdEndpoints, ",")
 	var err error
@@ -43,7 +50,7 @@ func InitEtcdCli() {
 		Endpoints:   endpoints,
 		DialTimeout: 5 * time.Second,
 	}); err != nil {
-		zlogger.Panic().Err(err).Msg("[go-doudou] register to etcd failed")
+		logger.Panic().Err(err).Msg("[go-doudou] register to etcd failed")
 	}
 }
 
@@ -55,14 +62,14 @@ func getLeaseID() clientv3.LeaseID {
 	leaseStr := config.GddEtcdLease.Load()
 	if stringutils.IsNotEmpty(leaseStr) {
 		if value, err := cast.ToInt64E(leaseStr); err != nil {
-			zlogger.Error().Err(err).Msgf("[go-doudou] cast %s to int failed", leaseStr)
+			logger.Error().Err(err).Msgf("[go-doudou] cast %s to int failed", leaseStr)
 		} else {
 			lease = value
 		}
 	}
 	leaseResp, err := EtcdCli.Grant(tctx, lease)
 	if err != nil {
-		zlogger.Panic().Err(err).Msgf("[go-doudou] get etcd lease ID failed")
+		logger.Panic().Err(err).Msgf("[go-doudou] get etcd lease ID failed")
 	}
 	return leaseResp.ID
 }
@@ -70,7 +77,7 @@ func getLeaseID() clientv3.LeaseID {
 func registerService(service string, port uint64, lease clientv3.LeaseID, userData ...map[string]interface{}) {
 	em, err := endpoints.NewManager(EtcdCli, service)
 	if err != nil {
-		zlogger.Panic().Err(err).Msgf("[go-doudou] register %s to etcd failed", service)
+		logger.Panic().Err(err).Msgf("[go-doudou] register %s to etcd failed", service)
 	}
 	host := utils.GetRegisterHost()
 	addr := host + ":" + strconv.Itoa(int(port))
@@ -79,16 +86,16 @@ func registerService(service string, port uint64, lease clientv3.LeaseID, userDa
 	tctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if err = em.AddEndpoint(tctx, service+"/"+addr, endpoints.Endpoint{Addr: addr, Metadata: metadata}, clientv3.WithLease(lease)); err != nil {
-		zlogger.Panic().Err(err).Msgf("[go-doudou] register %s to etcd failed", service)
+		logger.Panic().Err(err).Msgf("[go-doudou] register %s to etcd failed", service)
 	}
 	// set keep-alive logic
 	leaseRespChan, err := EtcdCli.KeepAlive(context.Background(), lease)
 	if err != nil {
-		zlogger.Panic().Err(err).Msgf("[go-doudou] register %s to etcd failed", service)
+		logger.Panic().Err(err).Msgf("[go-doudou] register %s to etcd failed", service)
 	}
 	go func() {
 		for leaseKeepResp := range leaseRespChan {
-			zlogger.Debug().Msgf("[go-doudou] %#v", *leaseKeepResp)
+			logger.Debug().Msgf("[go-doudou] %#v", *leaseKeepResp)
 		}
 	}()
 }
@@ -113,6 +120,9 @@ func populateMeta(meta map[string]interface{}, isGrpc bool, userData ...map[stri
 	meta["registerAt"] = time.Now().Local().Format(constants.FORMAT8)
 	meta["goVer"] = runtime.Version()
 	meta["weight"] = weight
+	if version := config.GddServiceVersion.Load(); stringutils.IsNotEmpty(version) {
+		meta["version"] = version
+	}
 	if stringutils.IsNotEmpty(buildinfo.GddVer) {
 		meta["gddVer"] = buildinfo.GddVer
 	}
@@ -125,6 +135,9 @@ func populateMeta(meta map[string]interface{}, isGrpc bool, userData ...map[stri
 	if stringutils.IsNotEmpty(rr) && !isGrpc {
 		meta["rootPath"] = rr
 	}
+	if !isGrpc {
+		meta["scheme"] = tlsx.Scheme()
+	}
 	for _, item := range userData {
 		for k, v := range item {
 			meta[k] = fmt.Sprint(v)
@@ -140,7 +153,13 @@ func NewRest(data ...map[string]interface{}) {
 	httpPort := config.GetPort()
 	restLease = getLeaseID()
 	registerService(service, httpPort, restLease, data...)
-	zlogger.Info().Msgf("[go-doudou] %s registered to etcd successfully", service)
+	logger.Info().Msgf("[go-doudou] %s registered to etcd successfully", service)
+}
+
+// NewMux registers the rest service which serves grpc on the same port as well, the address is flagged by
+// constants.PROTOCOL_META metadata and grpc clients resolve it by the rest service name
+func NewMux(data ...map[string]interface{}) {
+	NewRest(append(data, map[string]interface{}{cons.PROTOCOL_META: cons.MUX_PROTOCOL})...)
 }
 
 func NewGrpc(data ...map[string]interface{}) {
@@ -151,7 +170,7 @@ func NewGrpc(data ...map[string]interface{}) {
 	grpcPort := config.GetGrpcPort()
 	grpcLease = getLeaseID()
 	registerService(service, grpcPort, grpcLease, data...)
-	zlogger.Info().Msgf("[go-doudou] %s registered to etcd successfully", service)
+	logger.Info().Msgf("[go-doudou] %s registered to etcd successfully", service)
 }
 
 func ShutdownRest() {
@@ -159,17 +178,17 @@ func ShutdownRest() {
 		service := config.GetServiceName() + "_" + string(cons.REST_TYPE)
 		em, err := endpoints.NewManager(EtcdCli, service)
 		if err != nil {
-			zlogger.Error().Err(err).Msgf("[go-doudou] failed to deregister %s from etcd", service)
+			logger.Error().Err(err).Msgf("[go-doudou] failed to deregister %s from etcd", service)
 			return
 		}
 		addr := utils.GetRegisterHost() + ":" + strconv.Itoa(int(config.GetPort()))
 		tctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 		if err = em.DeleteEndpoint(tctx, service+"/"+addr); err != nil {
-			zlogger.Error().Err(err).Msgf("[go-doudou] failed to deregister %s from etcd", service)
+			logger.Error().Err(err).Msgf("[go-doudou] failed to deregister %s from etcd", service)
 			return
 		}
-		zlogger.Info().Msgf("[go-doudou] deregistered %s from etcd successfully", service)
+		logger.Info().Msgf("[go-doudou] deregistered %s from etcd successfully", service)
 	}
 }
 
@@ -178,20 +197,29 @@ func ShutdownGrpc() {
 		service := config.GetServiceName() + "_" + string(cons.GRPC_TYPE)
 		em, err := endpoints.NewManager(EtcdCli, service)
 		if err != nil {
-			zlogger.Error().Err(err).Msgf("[go-doudou] failed to deregister %s from etcd", service)
+			logger.Error().Err(err).Msgf("[go-doudou] failed to deregister %s from etcd", service)
 			return
 		}
 		addr := utils.GetRegisterHost() + ":" + strconv.Itoa(int(config.GetGrpcPort()))
 		tctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 		if err = em.DeleteEndpoint(tctx, service+"/"+addr); err != nil {
-			zlogger.Error().Err(err).Msgf("[go-doudou] failed to deregister %s from etcd", service)
+			logger.Error().Err(err).Msgf("[go-doudou] failed to deregister %s from etcd", service)
 			return
 		}
-		zlogger.Info().Msgf("[go-doudou] deregistered %s from etcd successfully", service)
+		logger.Info().Msgf("[go-doudou] deregistered %s from etcd successfully", service)
 	}
 }
 
+// HealthCheck checks connectivity to etcd cluster by a quorum read
+func HealthCheck(ctx context.Context) error {
+	if EtcdCli == nil {
+		return errors.New("etcd client is not initialised")
+	}
+	_, err := EtcdCli.Get(ctx, config.GetServiceName(), clientv3.WithCountOnly())
+	return err
+}
+
 var shutdownOnce sync.Once
 
 func CloseEtcdClient() {
@@ -202,7 +230,7 @@ func CloseEtcdClient() {
 			}
 			EtcdCli.Close()
 			EtcdCli = nil
-			zlogger.Info().Msg("[go-doudou] etcd client closed")
+			logger.Info().Msg("[go-doudou] etcd client closed")
 		}
 	})
 }
@@ -217,11 +245,24 @@ type RRServiceProvider struct {
 	ctx      context.Context
 	cancel   context.CancelFunc
 	curState atomic.Value
+	version  string
+}
+
+// ServiceProviderOption configures RRServiceProvider
+type ServiceProviderOption func(*RRServiceProvider)
+
+// WithVersion makes service provider only select endpoints whose version metadata equals to version
+func WithVersion(version string) ServiceProviderOption {
+	return func(r *RRServiceProvider) {
+		r.version = version
+	}
 }
 
 type address struct {
+	scheme        string
 	addr          string
 	rootPath      string
+	version       string
 	weight        int
 	currentWeight int
 }
@@ -249,6 +290,15 @@ func (r *RRServiceProvider) watch() {
 			}
 
 			addrs := convertToAddress(allUps)
+			if stringutils.IsNotEmpty(r.version) {
+				filtered := make([]*address, 0, len(addrs))
+				for _, addr := range addrs {
+					if addr.version == r.version {
+						filtered = append(filtered, addr)
+					}
+				}
+				addrs = filtered
+			}
 			r.curState.Store(state{addresses: addrs})
 		}
 	}
@@ -263,16 +313,23 @@ func (r *RRServiceProvider) Close() {
 func convertToAddress(ups map[string]*endpoints.Update) (addrs []*address) {
 	for _, up := range ups {
 		weight := 1
-		var rootPath string
+		var rootPath, version string
+		scheme := "http"
 		if metadata, ok := up.Endpoint.Metadata.(map[string]interface{}); !ok {
-			zlogger.Error().Msg("[go-doudou] etcd endpoint metadata is not map[string]string type")
+			logger.Error().Msg("[go-doudou] etcd endpoint metadata is not map[string]string type")
 		} else {
 			weight = int(metadata["weight"].(float64))
 			rootPath = metadata["rootPath"].(string)
+			version, _ = metadata["version"].(string)
+			if value, _ := metadata["scheme"].(string); stringutils.IsNotEmpty(value) {
+				scheme = value
+			}
 		}
 		addr := &address{
+			scheme:   scheme,
 			addr:     up.Endpoint.Addr,
 			rootPath: rootPath,
+			version:  version,
 			weight:   weight,
 		}
 		addrs = append(addrs, addr)
@@ -289,7 +346,7 @@ func (n *RRServiceProvider) SelectServer() string {
 	}
 	instances := n.curState.Load().(state).addresses
 	if len(instances) == 0 {
-		zlogger.Error().Msgf("[go-doudou] %s server not found", n.target)
+		logger.Error().Msgf("[go-doudou] %s server not found", n.target)
 		return ""
 	}
 	sort.SliceStable(instances, func(i, j int) bool {
@@ -298,11 +355,11 @@ func (n *RRServiceProvider) SelectServer() string {
 	next := int(atomic.AddUint64(&n.current, uint64(1)) % uint64(len(instances)))
 	n.current = uint64(next)
 	selected := instances[next]
-	return fmt.Sprintf("http://%s%s", selected.addr, selected.rootPath)
+	return fmt.Sprintf("%s://%s%s", selected.scheme, selected.addr, selected.rootPath)
 }
 
 // NewRRServiceProvider creates new RRServiceProvider instance
-func NewRRServiceProvider(serviceName string) *RRServiceProvider {
+func NewRRServiceProvider(serviceName string, opts ...ServiceProviderOption) *RRServiceProvider {
 	onceEtcd.Do(func() {
 		InitEtcdCli()
 	})
@@ -310,17 +367,24 @@ func NewRRServiceProvider(serviceName string) *RRServiceProvider {
 		c:      EtcdCli,
 		target: serviceName,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
 	r.ctx, r.cancel = context.WithCancel(context.Background())
 	defer func() {
-		providers[serviceName] = r
+		key := serviceName
+		if stringutils.IsNotEmpty(r.version) {
+			key += "@" + r.version
+		}
+		providers[key] = r
 	}()
 	em, err := endpoints.NewManager(r.c, r.target)
 	if err != nil {
-		zlogger.Panic().Err(err).Msg("[go-doudou] failed to create endpoint manager")
+		logger.Panic().Err(err).Msg("[go-doudou] failed to create endpoint manager")
 	}
 	r.wch, err = em.NewWatchChannel(r.ctx)
 	if err != nil {
-		zlogger.Panic().Err(err).Msg("[go-doudou] failed to create watch channel")
+		logger.Panic().Err(err).Msg("[go-doudou] failed to create watch channel")
 	}
 	go r.watch()
 	return r
@@ -340,7 +404,7 @@ func (n *SWRRServiceProvider) SelectServer() string {
 	}
 	instances := n.curState.Load().(state).addresses
 	if len(instances) == 0 {
-		zlogger.Error().Msgf("[go-doudou] %s server not found", n.target)
+		logger.Error().Msgf("[go-doudou] %s server not found", n.target)
 		return ""
 	}
 	var selected *address
@@ -354,13 +418,13 @@ func (n *SWRRServiceProvider) SelectServer() string {
 		}
 	}
 	selected.currentWeight -= total
-	return fmt.Sprintf("http://%s%s", selected.addr, selected.rootPath)
+	return fmt.Sprintf("%s://%s%s", selected.scheme, selected.addr, selected.rootPath)
 }
 
 // NewSWRRServiceProvider creates new SWRRServiceProvider instance
-func NewSWRRServiceProvider(serviceName string) *SWRRServiceProvider {
+func NewSWRRServiceProvider(serviceName string, opts ...ServiceProviderOption) *SWRRServiceProvider {
 	return &SWRRServiceProvider{
-		RRServiceProvider: NewRRServiceProvider(serviceName),
+		RRServiceProvider: NewRRServiceProvider(serviceName, opts...),
 	}
 }
 
@@ -378,19 +442,27 @@ func NewGrpcClientConn(service string, lb string, dialOptions ...grpc.DialOption
 	})
 	etcdResolver, err := resolver.NewBuilder(EtcdCli)
 	if err != nil {
-		zlogger.Panic().Err(err).Msg("[go-doudou] failed to create etcd resolver")
+		logger.Panic().Err(err).Msg("[go-doudou] failed to create etcd resolver")
+	}
+	tlsOptions, err := tlsx.GrpcDialOptions()
+	if err != nil {
+		logger.Panic().Err(err).Msg("[go-doudou] invalid tls config")
 	}
+	dialOptions = append(tlsOptions, dialOptions...)
 	dialOptions = append(dialOptions,
 		grpc.WithBlock(),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
 		grpc.WithResolvers(etcdResolver),
 		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`),
 	)
+	dialOptions = append(dialOptions, grpcx_metrics.DialOptions()...)
+	dialOptions = append(dialOptions, grpcx_deadline.DialOptions()...)
 	serverAddr := fmt.Sprintf("etcd:///%s", service)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	grpcConn, err := grpc.DialContext(ctx, serverAddr, dialOptions...)
 	if err != nil {
-		zlogger.Panic().Err(err).Msgf("[go-doudou] failed to connect to server %s", serverAddr)
+		logger.Panic().Err(err).Msgf("[go-doudou] failed to connect to server %s", serverAddr)
 	}
 	return grpcConn
 }
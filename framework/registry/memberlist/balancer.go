@@ -3,8 +3,6 @@ package memberlist
 import (
 	"sync"
 
-	"github.com/unionj-cloud/toolkit/zlogger"
-
 	"google.golang.org/grpc/balancer"
 	balancerbase "google.golang.org/grpc/balancer/base"
 )
@@ -22,7 +20,7 @@ func init() {
 type wPickerBuilder struct{}
 
 func (*wPickerBuilder) Build(info balancerbase.PickerBuildInfo) balancer.Picker {
-	zlogger.Debug().Msgf("[go-doudou] memberlist_weight_balancer Picker: Build called with info: %v", info)
+	logger.Debug().Msgf("[go-doudou] memberlist_weight_balancer Picker: Build called with info: %v", info)
 	if len(info.ReadySCs) == 0 {
 		return balancerbase.NewErrPicker(balancer.ErrNoSubConnAvailable)
 	}
@@ -9,7 +9,6 @@ import (
 	"github.com/hashicorp/go-msgpack/codec"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
 	"github.com/unionj-cloud/toolkit/memberlist"
-	logger "github.com/unionj-cloud/toolkit/zlogger"
 )
 
 type Service struct {
@@ -19,6 +18,19 @@ type Service struct {
 	RouteRootPath string                 `json:"routeRootPath"`
 	Type          constants.ServiceType  `json:"type"`
 	Data          map[string]interface{} `json:"data,omitempty"`
+	Scheme        string                 `json:"scheme,omitempty"`
+	// Protocol is constants.MUX_PROTOCOL if the rest service serves grpc on the same port
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// ServesGrpc reports whether grpc clients can connect to the service
+func (receiver *Service) ServesGrpc() bool {
+	return receiver.Type == constants.GRPC_TYPE || receiver.Protocol == constants.MUX_PROTOCOL
+}
+
+// Addr returns host:port of the service
+func (receiver *Service) Addr() string {
+	return fmt.Sprintf("%s:%d", receiver.Host, receiver.Port)
 }
 
 func (receiver *Service) BaseUrl() string {
@@ -27,7 +39,11 @@ func (receiver *Service) BaseUrl() string {
 	}
 	switch receiver.Type {
 	case constants.REST_TYPE:
-		return fmt.Sprintf("http://%s:%d%s", receiver.Host, receiver.Port, receiver.RouteRootPath)
+		scheme := receiver.Scheme
+		if scheme == "" {
+			scheme = "http"
+		}
+		return fmt.Sprintf("%s://%s:%d%s", scheme, receiver.Host, receiver.Port, receiver.RouteRootPath)
 	case constants.GRPC_TYPE:
 		return fmt.Sprintf("%s:%d", receiver.Host, receiver.Port)
 	}
@@ -42,6 +58,7 @@ type NodeMeta struct {
 	BuildUser  string     `json:"buildUser"`
 	BuildTime  string     `json:"buildTime"`
 	Weight     int        `json:"weight"`
+	Version    string     `json:"version,omitempty"`
 }
 
 type delegate struct {
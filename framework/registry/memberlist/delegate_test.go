@@ -6,6 +6,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
 	"github.com/unionj-cloud/toolkit/memberlist"
 )
 
@@ -206,3 +207,14 @@ func Test_delegate_MergeRemoteState(t *testing.T) {
 	d := delegate{}
 	d.MergeRemoteState(nil, false)
 }
+
+func TestService_ServesGrpc(t *testing.T) {
+	rest := Service{Name: "seed_rest", Host: "10.0.0.1", Port: 6060, Type: constants.REST_TYPE}
+	assert.False(t, rest.ServesGrpc())
+	rest.Protocol = constants.MUX_PROTOCOL
+	assert.True(t, rest.ServesGrpc(), "rest service serving grpc on the same port")
+	assert.Equal(t, "10.0.0.1:6060", rest.Addr())
+	assert.Equal(t, "http://10.0.0.1:6060", rest.BaseUrl())
+	grpcService := Service{Name: "seed_grpc", Type: constants.GRPC_TYPE}
+	assert.True(t, grpcService.ServesGrpc())
+}
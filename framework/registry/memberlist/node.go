@@ -2,6 +2,7 @@ package memberlist
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -18,14 +19,18 @@ import (
 	"github.com/unionj-cloud/go-doudou/v2/framework/buildinfo"
 	"github.com/unionj-cloud/go-doudou/v2/framework/config"
 	"github.com/unionj-cloud/go-doudou/v2/framework/configmgr"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
+	"github.com/unionj-cloud/go-doudou/v2/framework/loglevel"
 	cons "github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
 	"github.com/unionj-cloud/toolkit/cast"
 	"github.com/unionj-cloud/toolkit/constants"
 	"github.com/unionj-cloud/toolkit/memberlist"
 	"github.com/unionj-cloud/toolkit/stringutils"
-	logger "github.com/unionj-cloud/toolkit/zlogger"
 )
 
+var logger = loglevel.Named("registry.memberlist")
+
 var mlist memberlist.IMemberlist
 var mconf *memberlist.Config
 var BroadcastQueue *memberlist.TransmitLimitedQueue
@@ -33,6 +38,14 @@ var events = &eventDelegate{}
 var shutdownOnce sync.Once
 var delegator *delegate
 
+// startMu guards creating memberlist after the parent process hands over on graceful restart against
+// registering services and shutdown
+var startMu sync.Mutex
+
+// pending is the transport waiting for the parent process to hand over, memberlist is created on it then
+var pending *socketTransport
+var stopped bool
+
 func assertMlistNotNil() {
 	if mlist == nil {
 		panic("create memberlist first")
@@ -74,22 +87,72 @@ func init() {
 			BuildUser:  buildinfo.BuildUser,
 			BuildTime:  buildTime,
 			Weight:     weight,
+			Version:    config.GddServiceVersion.LoadOrDefault(config.DefaultGddServiceVersion),
 		},
 		queue: queue,
 	}
 	mconf.Delegate = delegator
 	mconf.Events = events
+	registerConfigListener(mconf)
+	if cast.ToBoolOrDefault(config.GddUpgradeEnable.Load(), config.DefaultGddUpgradeEnable) {
+		// memberlist sockets are passed to the new process on graceful restart
+		t, err := newSocketTransport(mconf.BindAddr, mconf.BindPort)
+		if err != nil {
+			panic(errors.Wrap(err, "[go-doudou] Failed to create memberlist transport"))
+		}
+		mconf.Transport = t
+		// the parent process leaves gossip to the new process once its servers are drained
+		lifecycle.OnShutdown("memberlist", lifecycle.PriorityRegistry, func(ctx context.Context) error {
+			Shutdown()
+			return nil
+		})
+		select {
+		case <-lifecycle.HandedOver():
+		default:
+			// the parent process gossips under the same node name on the same sockets until it hands over
+			pending = t
+			go startAfterHandover(lifecycle.HandedOver())
+			return
+		}
+		t.listen()
+	}
+	if err := start(); err != nil {
+		panic(err)
+	}
+}
+
+// start creates memberlist and joins the cluster
+func start() error {
 	var err error
 	if mlist, err = createMemberlist(mconf); err != nil {
-		panic(errors.Wrap(err, "[go-doudou] Failed to create memberlist"))
+		return errors.Wrap(err, "[go-doudou] Failed to create memberlist")
 	}
 	if err = join(); err != nil {
 		mlist.Shutdown()
-		panic(errors.Wrap(err, "[go-doudou] Node register failed"))
+		return errors.Wrap(err, "[go-doudou] Node register failed")
 	}
 	local := mlist.LocalNode()
 	logger.Info().Msgf("memberlist created. local node is Node %s, memberlist port %s", local.Name, fmt.Sprint(local.Port))
-	registerConfigListener(mconf)
+	return nil
+}
+
+// startAfterHandover creates memberlist on the pending transport once handedOver is closed. Services registered
+// before are announced in meta of the local node.
+func startAfterHandover(handedOver <-chan struct{}) {
+	<-handedOver
+	startMu.Lock()
+	defer startMu.Unlock()
+	if stopped {
+		return
+	}
+	t := pending
+	pending = nil
+	t.listen()
+	if err := start(); err != nil {
+		mlist = nil
+		t.Shutdown()
+		logger.Error().Err(err).Msg("[go-doudou] failed to start memberlist after parent process handed over")
+	}
 }
 
 func seeds(seedstr string) []string {
@@ -143,6 +206,22 @@ func AllNodes() ([]*memberlist.Node, error) {
 	return nodes, nil
 }
 
+// HasService checks whether there is any alive node supplying service specified by name
+func HasService(name string) bool {
+	if mlist == nil {
+		return false
+	}
+	for _, node := range mlist.Members() {
+		meta, _ := ParseMeta(node)
+		for _, service := range meta.Services {
+			if service.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func ParseMeta(node *memberlist.Node) (NodeMeta, error) {
 	var mm NodeMeta
 	if len(node.Meta) > 0 {
@@ -182,7 +261,7 @@ func newConf() *memberlist.Config {
 	if disable {
 		lf.Writer = ioutil.Discard
 	} else {
-		lf.Writer = logger.Logger
+		lf.Writer = logger
 	}
 	cfg.LogOutput = lf
 	setGddMemDeadTimeout(cfg)
@@ -264,7 +343,18 @@ func retransmitMultGetter() int {
 }
 
 func NewRest(data ...map[string]interface{}) {
-	assertMlistNotNil()
+	newRest("", data...)
+}
+
+// NewMux registers the rest service which serves grpc on the same port as well, grpc clients resolve it by
+// the rest service name, e.g. memberlist:///cloud.unionj.Foo_rest
+func NewMux(data ...map[string]interface{}) {
+	newRest(cons.MUX_PROTOCOL, data...)
+}
+
+func newRest(protocol string, data ...map[string]interface{}) {
+	startMu.Lock()
+	defer startMu.Unlock()
 	service := config.GetServiceName() + "_" + string(cons.REST_TYPE)
 	httpPort := config.GetPort()
 	rr := config.DefaultGddRouteRootPath
@@ -273,28 +363,31 @@ func NewRest(data ...map[string]interface{}) {
 	}
 	si := Service{
 		Name:          service,
-		Host:          mlist.AdvertiseAddr(),
+		Host:          advertiseAddr(),
 		Port:          int(httpPort),
 		RouteRootPath: rr,
 		Type:          cons.REST_TYPE,
+		Scheme:        tlsx.Scheme(),
+		Protocol:      protocol,
 	}
 	if len(data) > 0 {
 		si.Data = data[0]
 	}
 	delegator.AddService(si)
-	if err := mlist.UpdateNode(mlist.Config().TCPTimeout); err != nil {
+	if err := updateNode(); err != nil {
 		panic(errors.Wrapf(err, "[go-doudou] failed to register %s service to memberlist", service))
 	}
 	logger.Info().Msgf("[go-doudou] registered %s service to memberlist successfully", service)
 }
 
 func NewGrpc(data ...map[string]interface{}) {
-	assertMlistNotNil()
+	startMu.Lock()
+	defer startMu.Unlock()
 	service := config.GetServiceName() + "_" + string(cons.GRPC_TYPE)
 	grpcPort := config.GetGrpcPort()
 	si := Service{
 		Name: service,
-		Host: mlist.AdvertiseAddr(),
+		Host: advertiseAddr(),
 		Port: int(grpcPort),
 		Type: cons.GRPC_TYPE,
 	}
@@ -302,12 +395,34 @@ func NewGrpc(data ...map[string]interface{}) {
 		si.Data = data[0]
 	}
 	delegator.AddService(si)
-	if err := mlist.UpdateNode(mlist.Config().TCPTimeout); err != nil {
+	if err := updateNode(); err != nil {
 		panic(errors.Wrapf(err, "[go-doudou] failed to register %s service to memberlist", service))
 	}
 	logger.Info().Msgf("[go-doudou] registered %s service to memberlist successfully", service)
 }
 
+// advertiseAddr returns address of the local node, it is resolved by the pending transport before memberlist is
+// created
+func advertiseAddr() string {
+	if mlist == nil && pending != nil {
+		ip, _, err := pending.FinalAdvertiseAddr(mconf.AdvertiseAddr, mconf.AdvertisePort)
+		if err != nil {
+			panic(errors.Wrap(err, "[go-doudou] failed to resolve memberlist advertise address"))
+		}
+		return ip.String()
+	}
+	assertMlistNotNil()
+	return mlist.AdvertiseAddr()
+}
+
+// updateNode broadcasts meta of the local node, it is skipped before memberlist is created
+func updateNode() error {
+	if mlist == nil && pending != nil {
+		return nil
+	}
+	return mlist.UpdateNode(mlist.Config().TCPTimeout)
+}
+
 type memConfigListener struct {
 	configmgr.BaseApolloListener
 	memConf *memberlist.Config
@@ -324,10 +439,10 @@ func (c *memConfigListener) OnChange(event *storage.ChangeEvent) {
 		upperKey := strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
 		if strings.HasPrefix(upperKey, "GDD_MEM_") {
 			if value.ChangeType == storage.DELETED {
-				_ = os.Unsetenv(upperKey)
+				_ = config.UnsetRemote(upperKey)
 				continue
 			}
-			_ = os.Setenv(upperKey, fmt.Sprint(value.NewValue))
+			_ = config.SetRemote(upperKey, fmt.Sprint(value.NewValue))
 		}
 	}
 	setGddMemDeadTimeout(c.memConf)
@@ -386,6 +501,13 @@ func registerConfigListener(memConf *memberlist.Config) {
 
 func Shutdown() {
 	shutdownOnce.Do(func() {
+		startMu.Lock()
+		defer startMu.Unlock()
+		stopped = true
+		if pending != nil {
+			pending.Shutdown()
+			pending = nil
+		}
 		if mlist != nil {
 			_ = mlist.Shutdown()
 			mlist = nil
@@ -411,6 +533,21 @@ func RegisterServiceProvider(sp IMemberlistServiceProvider) {
 	events.ServiceProviders = append(events.ServiceProviders, sp)
 }
 
+// HealthCheck checks whether local node is alive in memberlist cluster
+func HealthCheck(ctx context.Context) error {
+	if mlist == nil {
+		if pending != nil {
+			// the parent process is still alive in the cluster under the same node name
+			return nil
+		}
+		return errors.New("memberlist is not initialised")
+	}
+	if node := mlist.LocalNode(); node == nil || node.State != memberlist.StateAlive {
+		return errors.New("local node is not alive")
+	}
+	return nil
+}
+
 func LocalNode() *memberlist.Node {
 	assertMlistNotNil()
 	return mlist.LocalNode()
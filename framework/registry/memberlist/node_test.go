@@ -0,0 +1,94 @@
+package memberlist
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/toolkit/memberlist"
+)
+
+type fakeMemberlist struct {
+	memberlist.IMemberlist
+	shutdown bool
+}
+
+func (m *fakeMemberlist) LocalNode() *memberlist.Node {
+	return &memberlist.Node{Name: "test", State: memberlist.StateAlive}
+}
+
+func (m *fakeMemberlist) Shutdown() error {
+	m.shutdown = true
+	return nil
+}
+
+// setupPending simulates the new process of graceful restart whose parent process has not handed over yet
+func setupPending(t *testing.T) (*socketTransport, chan struct{}) {
+	tr, err := newSocketTransport("127.0.0.1", 0)
+	require.NoError(t, err)
+	conf, create := mconf, createMemberlist
+	t.Cleanup(func() {
+		tr.Shutdown()
+		mconf, createMemberlist = conf, create
+		mlist, pending, stopped, shutdownOnce = nil, nil, false, sync.Once{}
+	})
+	mconf = memberlist.DefaultLANConfig()
+	mconf.Transport = tr
+	pending = tr
+	created := make(chan struct{})
+	createMemberlist = func(conf *memberlist.Config) (memberlist.IMemberlist, error) {
+		close(created)
+		return &fakeMemberlist{}, nil
+	}
+	return tr, created
+}
+
+func TestStartAfterHandover(t *testing.T) {
+	_, created := setupPending(t)
+	handedOver := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		startAfterHandover(handedOver)
+		close(started)
+	}()
+
+	select {
+	case <-created:
+		t.Fatal("memberlist should not be created before the parent process hands over")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Equal(t, "127.0.0.1", advertiseAddr())
+	assert.NoError(t, updateNode(), "meta is announced once memberlist is created")
+	assert.NoError(t, HealthCheck(context.Background()), "the parent process is still in the cluster")
+
+	close(handedOver)
+	<-started
+	<-created
+	require.NotNil(t, mlist)
+	assert.Nil(t, pending)
+	assert.NoError(t, HealthCheck(context.Background()))
+
+	m := mlist.(*fakeMemberlist)
+	Shutdown()
+	assert.True(t, m.shutdown)
+}
+
+func TestStartAfterHandover_Shutdown(t *testing.T) {
+	tr, created := setupPending(t)
+	Shutdown()
+	assert.Nil(t, pending)
+	assert.True(t, tr.shutdown.Load(), "sockets are closed")
+
+	handedOver := make(chan struct{})
+	close(handedOver)
+	startAfterHandover(handedOver)
+	select {
+	case <-created:
+		t.Fatal("memberlist should not be created after shutdown")
+	default:
+	}
+	assert.Nil(t, mlist)
+}
@@ -48,6 +48,7 @@ func (b *builder) Build(target gresolver.Target, cc gresolver.ClientConn, opts g
 	r := &resolver{
 		base: base{
 			name:    name,
+			grpc:    true,
 			nodeMap: make(map[string]*server),
 		},
 		cc: cc,
@@ -7,9 +7,12 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_deadline"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_metrics"
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
 	"github.com/unionj-cloud/toolkit/memberlist"
 	"github.com/unionj-cloud/toolkit/stringutils"
-	logger "github.com/unionj-cloud/toolkit/zlogger"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 )
 
@@ -34,13 +37,26 @@ func (s *server) Weight() int {
 
 type base struct {
 	name    string
+	version string
+	// grpc is true for grpc resolvers, they only take services which serve grpc
+	grpc    bool
 	nodes   []*server
 	nodeMap map[string]*server
 }
 
+// ServiceProviderOption configures service provider
+type ServiceProviderOption func(*base)
+
+// WithVersion makes service provider only select nodes whose version meta equals to version
+func WithVersion(version string) ServiceProviderOption {
+	return func(b *base) {
+		b.version = version
+	}
+}
+
 func (m *base) GetService(meta NodeMeta) Service {
 	for _, service := range meta.Services {
-		if service.Name == m.name {
+		if service.Name == m.name && (!m.grpc || service.ServesGrpc()) {
 			return service
 		}
 	}
@@ -54,7 +70,13 @@ func (m *base) AddNode(node *memberlist.Node) {
 	if stringutils.IsEmpty(service.Name) {
 		return
 	}
+	if stringutils.IsNotEmpty(m.version) && meta.Version != m.version {
+		return
+	}
 	baseUrl := service.BaseUrl()
+	if m.grpc {
+		baseUrl = service.Addr()
+	}
 	weight := meta.Weight
 	if s, exists := m.nodeMap[node.Name]; !exists {
 		s = &server{
@@ -161,13 +183,16 @@ func (m *RRServiceProvider) Close() {
 }
 
 // NewRRServiceProvider create an RRServiceProvider instance
-func NewRRServiceProvider(name string) *RRServiceProvider {
+func NewRRServiceProvider(name string, opts ...ServiceProviderOption) *RRServiceProvider {
 	sp := &RRServiceProvider{
 		base: base{
 			name:    name,
 			nodeMap: make(map[string]*server),
 		},
 	}
+	for _, opt := range opts {
+		opt(&sp.base)
+	}
 	RegisterServiceProvider(sp)
 	return sp
 }
@@ -227,13 +252,16 @@ func (m *SWRRServiceProvider) Close() {
 }
 
 // NewSWRRServiceProvider create an SWRRServiceProvider instance
-func NewSWRRServiceProvider(name string) *SWRRServiceProvider {
+func NewSWRRServiceProvider(name string, opts ...ServiceProviderOption) *SWRRServiceProvider {
 	sp := &SWRRServiceProvider{
 		base: base{
 			name:    name,
 			nodeMap: make(map[string]*server),
 		},
 	}
+	for _, opt := range opts {
+		opt(&sp.base)
+	}
 	RegisterServiceProvider(sp)
 	return sp
 }
@@ -248,7 +276,14 @@ func NewRRGrpcClientConn(service string, dialOptions ...grpc.DialOption) *grpc.C
 
 func NewGrpcClientConn(service string, lb string, dialOptions ...grpc.DialOption) *grpc.ClientConn {
 	serverAddr := fmt.Sprintf(schemeName+"://%s/", service)
-	dialOptions = append(dialOptions, grpc.WithBlock(), grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`))
+	tlsOptions, err := tlsx.GrpcDialOptions()
+	if err != nil {
+		logger.Panic().Err(err).Msg("[go-doudou] invalid tls config")
+	}
+	dialOptions = append(tlsOptions, dialOptions...)
+	dialOptions = append(dialOptions, grpc.WithBlock(), grpc.WithStatsHandler(otelgrpc.NewClientHandler()), grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`))
+	dialOptions = append(dialOptions, grpcx_metrics.DialOptions()...)
+	dialOptions = append(dialOptions, grpcx_deadline.DialOptions()...)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	grpcConn, err := grpc.DialContext(ctx, serverAddr, dialOptions...)
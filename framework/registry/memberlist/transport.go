@@ -0,0 +1,213 @@
+package memberlist
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/listener"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/utils"
+	"github.com/unionj-cloud/toolkit/memberlist"
+)
+
+const (
+	// udpPacketBufSize is size of buffer for one incoming packet
+	udpPacketBufSize = 65536
+	// udpRecvBufSize is size of udp receive window to try at first
+	udpRecvBufSize = 2 * 1024 * 1024
+)
+
+// socketTransport is memberlist.NodeAwareTransport over tcp and udp sockets opened by package listener, so that
+// they are passed to the new process on graceful restart and the memberlist port keeps being served. It works like
+// memberlist.NetTransport bound to one address.
+type socketTransport struct {
+	bindAddr string
+	tcp      net.Listener
+	udp      net.PacketConn
+	packetCh chan *memberlist.Packet
+	streamCh chan net.Conn
+	shutdown atomic.Bool
+	wg       sync.WaitGroup
+}
+
+var _ memberlist.NodeAwareTransport = (*socketTransport)(nil)
+
+// newSocketTransport listens on tcp and udp port of bindAddr, or takes over sockets passed by the parent process.
+// The sockets are not read until listen is called.
+func newSocketTransport(bindAddr string, port int) (*socketTransport, error) {
+	ctx := context.Background()
+	lns, err := listener.Listen(ctx, nil, []listener.Address{{
+		Network: "tcp",
+		Address: net.JoinHostPort(bindAddr, strconv.Itoa(port)),
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if port == 0 {
+		port = lns[0].Addr().(*net.TCPAddr).Port
+	}
+	pc, err := listener.ListenPacket(ctx, nil, "udp", net.JoinHostPort(bindAddr, strconv.Itoa(port)))
+	if err != nil {
+		lns[0].Close()
+		return nil, err
+	}
+	if conn, ok := pc.(*net.UDPConn); ok {
+		setUDPRecvBuf(conn)
+	}
+	t := &socketTransport{
+		bindAddr: bindAddr,
+		tcp:      lns[0],
+		udp:      pc,
+		packetCh: make(chan *memberlist.Packet),
+		streamCh: make(chan net.Conn),
+	}
+	return t, nil
+}
+
+// listen starts reading the sockets, it should be called once before memberlist is created on t
+func (t *socketTransport) listen() {
+	t.wg.Add(2)
+	go t.tcpListen()
+	go t.udpListen()
+}
+
+// setUDPRecvBuf halves the receive window until it is accepted
+func setUDPRecvBuf(conn *net.UDPConn) {
+	for size := udpRecvBufSize; size > 0; size /= 2 {
+		if err := conn.SetReadBuffer(size); err == nil {
+			return
+		}
+	}
+}
+
+// Port returns port listened on
+func (t *socketTransport) Port() int {
+	return t.tcp.Addr().(*net.TCPAddr).Port
+}
+
+// FinalAdvertiseAddr implements memberlist.Transport
+func (t *socketTransport) FinalAdvertiseAddr(ip string, port int) (net.IP, int, error) {
+	if port == 0 {
+		port = t.Port()
+	}
+	if ip != "" {
+		advertiseAddr := net.ParseIP(ip)
+		if advertiseAddr == nil {
+			return nil, 0, errors.Errorf("failed to parse advertise address %q", ip)
+		}
+		if ip4 := advertiseAddr.To4(); ip4 != nil {
+			advertiseAddr = ip4
+		}
+		return advertiseAddr, port, nil
+	}
+	if bindIP := net.ParseIP(t.bindAddr); bindIP != nil && !bindIP.IsUnspecified() {
+		return bindIP, port, nil
+	}
+	privateIP, err := utils.GetPrivateIP()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to get interface addresses")
+	}
+	if privateIP == "" {
+		return nil, 0, errors.New("no private IP address found, and explicit IP not provided")
+	}
+	return net.ParseIP(privateIP), port, nil
+}
+
+// WriteTo implements memberlist.Transport
+func (t *socketTransport) WriteTo(b []byte, addr string) (time.Time, error) {
+	return t.WriteToAddress(b, memberlist.Address{Addr: addr})
+}
+
+// WriteToAddress implements memberlist.NodeAwareTransport
+func (t *socketTransport) WriteToAddress(b []byte, a memberlist.Address) (time.Time, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", a.Addr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	_, err = t.udp.WriteTo(b, udpAddr)
+	return time.Now(), err
+}
+
+// PacketCh implements memberlist.Transport
+func (t *socketTransport) PacketCh() <-chan *memberlist.Packet {
+	return t.packetCh
+}
+
+// DialTimeout implements memberlist.Transport
+func (t *socketTransport) DialTimeout(addr string, timeout time.Duration) (net.Conn, error) {
+	return t.DialAddressTimeout(memberlist.Address{Addr: addr}, timeout)
+}
+
+// DialAddressTimeout implements memberlist.NodeAwareTransport
+func (t *socketTransport) DialAddressTimeout(a memberlist.Address, timeout time.Duration) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	return dialer.Dial("tcp", a.Addr)
+}
+
+// StreamCh implements memberlist.Transport
+func (t *socketTransport) StreamCh() <-chan net.Conn {
+	return t.streamCh
+}
+
+// Shutdown implements memberlist.Transport
+func (t *socketTransport) Shutdown() error {
+	t.shutdown.Store(true)
+	t.tcp.Close()
+	t.udp.Close()
+	t.wg.Wait()
+	return nil
+}
+
+func (t *socketTransport) tcpListen() {
+	defer t.wg.Done()
+	const maxDelay = time.Second
+	var delay time.Duration
+	for {
+		conn, err := t.tcp.Accept()
+		if err != nil {
+			if t.shutdown.Load() {
+				return
+			}
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay *= 2; delay > maxDelay {
+				delay = maxDelay
+			}
+			logger.Error().Err(err).Msg("[go-doudou] memberlist: error accepting tcp connection")
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+		t.streamCh <- conn
+	}
+}
+
+func (t *socketTransport) udpListen() {
+	defer t.wg.Done()
+	for {
+		buf := make([]byte, udpPacketBufSize)
+		n, addr, err := t.udp.ReadFrom(buf)
+		ts := time.Now()
+		if err != nil {
+			if t.shutdown.Load() {
+				return
+			}
+			logger.Error().Err(err).Msg("[go-doudou] memberlist: error reading udp packet")
+			continue
+		}
+		if n < 1 {
+			logger.Error().Msg(fmt.Sprintf("[go-doudou] memberlist: udp packet too short (%d bytes) %s", n, memberlist.LogAddress(addr)))
+			continue
+		}
+		t.packetCh <- &memberlist.Packet{
+			Buf:       buf[:n],
+			From:      addr,
+			Timestamp: ts,
+		}
+	}
+}
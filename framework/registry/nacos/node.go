@@ -3,6 +3,7 @@ package nacos
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"runtime"
 	"sort"
 	"strconv"
@@ -14,19 +15,25 @@ import (
 	"github.com/unionj-cloud/go-doudou/v2/framework/buildinfo"
 	"github.com/unionj-cloud/go-doudou/v2/framework/config"
 	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/grpc_resolver_nacos"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_deadline"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_metrics"
+	"github.com/unionj-cloud/go-doudou/v2/framework/loglevel"
 	cons "github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/utils"
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
 	"github.com/unionj-cloud/toolkit/cast"
 	"github.com/unionj-cloud/toolkit/constants"
 	"github.com/unionj-cloud/toolkit/stringutils"
-	logger "github.com/unionj-cloud/toolkit/zlogger"
 	"github.com/wubin1989/nacos-sdk-go/v2/clients"
 	"github.com/wubin1989/nacos-sdk-go/v2/clients/naming_client"
 	"github.com/wubin1989/nacos-sdk-go/v2/model"
 	"github.com/wubin1989/nacos-sdk-go/v2/vo"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 )
 
+var logger = loglevel.Named("registry.nacos")
+
 var NamingClient naming_client.INamingClient
 var onceNacos sync.Once
 var NewNamingClient = clients.NewNamingClient
@@ -69,7 +76,11 @@ func NewRest(data ...map[string]interface{}) {
 	metadata["buildUser"] = buildinfo.BuildUser
 	metadata["buildTime"] = buildTime
 	metadata["weight"] = strconv.Itoa(weight)
+	if version := config.GddServiceVersion.Load(); stringutils.IsNotEmpty(version) {
+		metadata["version"] = version
+	}
 	metadata["rootPath"] = rr
+	metadata["scheme"] = tlsx.Scheme()
 	for _, item := range data {
 		for k, v := range item {
 			metadata[k] = fmt.Sprint(v)
@@ -95,6 +106,12 @@ func NewRest(data ...map[string]interface{}) {
 	}
 }
 
+// NewMux registers the rest service which serves grpc on the same port as well, the address is flagged by
+// constants.PROTOCOL_META metadata and grpc clients resolve it by the rest service name
+func NewMux(data ...map[string]interface{}) {
+	NewRest(append(data, map[string]interface{}{cons.PROTOCOL_META: cons.MUX_PROTOCOL})...)
+}
+
 func NewGrpc(data ...map[string]interface{}) {
 	onceNacos.Do(func() {
 		InitialiseNacosNamingClient()
@@ -121,6 +138,9 @@ func NewGrpc(data ...map[string]interface{}) {
 	metadata["buildUser"] = buildinfo.BuildUser
 	metadata["buildTime"] = buildTime
 	metadata["weight"] = strconv.Itoa(weight)
+	if version := config.GddServiceVersion.Load(); stringutils.IsNotEmpty(version) {
+		metadata["version"] = version
+	}
 	for _, item := range data {
 		for k, v := range item {
 			metadata[k] = fmt.Sprint(v)
@@ -192,6 +212,18 @@ func ShutdownGrpc() {
 	}
 }
 
+// HealthCheck checks connectivity to nacos server by querying one page of services
+func HealthCheck(ctx context.Context) error {
+	if NamingClient == nil {
+		return errors.New("nacos naming client is not initialised")
+	}
+	_, err := NamingClient.GetAllServicesInfo(vo.GetAllServiceInfoParam{
+		PageNo:   1,
+		PageSize: 1,
+	})
+	return err
+}
+
 var shutdownOnce sync.Once
 
 func CloseNamingClient() {
@@ -208,6 +240,7 @@ type nacosBase struct {
 	clusters     []string //optional,default:DEFAULT
 	serviceName  string   //required
 	groupName    string   //optional,default:DEFAULT_GROUP
+	version      string   //optional, only select instances whose version metadata equals to it
 	lock         sync.Mutex
 	namingClient naming_client.INamingClient
 }
@@ -224,10 +257,35 @@ func (b *nacosBase) SetNamingClient(namingClient naming_client.INamingClient) {
 	b.namingClient = namingClient
 }
 
+func (b *nacosBase) SetVersion(version string) {
+	b.version = version
+}
+
+// selectInstances returns healthy instances filtered by version metadata if version is specified
+func (b *nacosBase) selectInstances() ([]model.Instance, error) {
+	instances, err := b.namingClient.SelectInstances(vo.SelectInstancesParam{
+		Clusters:    b.clusters,
+		ServiceName: b.serviceName,
+		GroupName:   b.groupName,
+		HealthyOnly: true,
+	})
+	if err != nil || stringutils.IsEmpty(b.version) {
+		return instances, err
+	}
+	filtered := make([]model.Instance, 0, len(instances))
+	for _, item := range instances {
+		if item.Metadata["version"] == b.version {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered, nil
+}
+
 type INacosServiceProvider interface {
 	SetClusters(clusters []string)
 	SetGroupName(groupName string)
 	SetNamingClient(namingClient naming_client.INamingClient)
+	SetVersion(version string)
 }
 
 type NacosProviderOption func(INacosServiceProvider)
@@ -250,6 +308,13 @@ func WithNacosNamingClient(namingClient naming_client.INamingClient) NacosProvid
 	}
 }
 
+// WithNacosVersion makes service provider only select instances whose version metadata equals to version
+func WithNacosVersion(version string) NacosProviderOption {
+	return func(provider INacosServiceProvider) {
+		provider.SetVersion(version)
+	}
+}
+
 type instance []model.Instance
 
 func (a instance) Len() int {
@@ -278,12 +343,7 @@ func (n *RRServiceProvider) SelectServer() string {
 		logger.Error().Msg("[go-doudou] nacos discovery client has not been initialized")
 		return ""
 	}
-	instances, err := n.namingClient.SelectInstances(vo.SelectInstancesParam{
-		Clusters:    n.clusters,
-		ServiceName: n.serviceName,
-		GroupName:   n.groupName,
-		HealthyOnly: true,
-	})
+	instances, err := n.selectInstances()
 	if err != nil {
 		logger.Error().Err(err).Msgf("[go-doudou] %s server not found", n.serviceName)
 		return ""
@@ -296,7 +356,7 @@ func (n *RRServiceProvider) SelectServer() string {
 	next := int(atomic.AddUint64(&n.current, uint64(1)) % uint64(len(instances)))
 	n.current = uint64(next)
 	selected := instances[next]
-	return fmt.Sprintf("http://%s:%d%s", selected.Ip, selected.Port, selected.Metadata["rootPath"])
+	return baseUrl(selected)
 }
 
 func (n *RRServiceProvider) Close() {
@@ -332,6 +392,15 @@ func (n *WRRServiceProvider) SelectServer() string {
 		logger.Error().Msg("[go-doudou] nacos discovery client has not been initialized")
 		return ""
 	}
+	if stringutils.IsNotEmpty(n.version) {
+		instances, err := n.selectInstances()
+		if err != nil || len(instances) == 0 {
+			logger.Error().Err(err).Msgf("[go-doudou] %s server of version %s not found", n.serviceName, n.version)
+			return ""
+		}
+		selected := pickWeighted(instances)
+		return baseUrl(selected)
+	}
 	instance, err := n.namingClient.SelectOneHealthyInstance(vo.SelectOneHealthInstanceParam{
 		Clusters:    n.clusters,
 		ServiceName: n.serviceName,
@@ -341,12 +410,40 @@ func (n *WRRServiceProvider) SelectServer() string {
 		logger.Error().Err(err).Msgf("[go-doudou] %s server not found", n.serviceName)
 		return ""
 	}
-	return fmt.Sprintf("http://%s:%d%s", instance.Ip, instance.Port, instance.Metadata["rootPath"])
+	return baseUrl(*instance)
 }
 
 func (n *WRRServiceProvider) Close() {
 }
 
+// baseUrl returns base url of instance, scheme is http if not registered
+func baseUrl(instance model.Instance) string {
+	scheme := instance.Metadata["scheme"]
+	if stringutils.IsEmpty(scheme) {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s:%d%s", scheme, instance.Ip, instance.Port, instance.Metadata["rootPath"])
+}
+
+// pickWeighted randomly picks an instance by weight like SelectOneHealthyInstance does
+func pickWeighted(instances []model.Instance) model.Instance {
+	var total float64
+	for _, item := range instances {
+		total += item.Weight
+	}
+	if total <= 0 {
+		return instances[rand.Intn(len(instances))]
+	}
+	r := rand.Float64() * total
+	for _, item := range instances {
+		r -= item.Weight
+		if r < 0 {
+			return item
+		}
+	}
+	return instances[len(instances)-1]
+}
+
 // NewWRRServiceProvider creates new ServiceProvider instance
 func NewWRRServiceProvider(serviceName string, opts ...NacosProviderOption) *WRRServiceProvider {
 	onceNacos.Do(func() {
@@ -390,7 +487,14 @@ func NewGrpcClientConn(config NacosConfig, lb string, dialOptions ...grpc.DialOp
 		NacosClient: NamingClient,
 	})
 	serverAddr := fmt.Sprintf("nacos://%s/", config.ServiceName)
-	dialOptions = append(dialOptions, grpc.WithBlock(), grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`))
+	tlsOptions, err := tlsx.GrpcDialOptions()
+	if err != nil {
+		logger.Panic().Err(err).Msg("[go-doudou] invalid tls config")
+	}
+	dialOptions = append(tlsOptions, dialOptions...)
+	dialOptions = append(dialOptions, grpc.WithBlock(), grpc.WithStatsHandler(otelgrpc.NewClientHandler()), grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`))
+	dialOptions = append(dialOptions, grpcx_metrics.DialOptions()...)
+	dialOptions = append(dialOptions, grpcx_deadline.DialOptions()...)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	grpcConn, err := grpc.DialContext(ctx, serverAddr, dialOptions...)
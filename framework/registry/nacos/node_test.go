@@ -65,6 +65,39 @@ func TestNewRest(t *testing.T) {
 	})
 }
 
+func TestNewMux(t *testing.T) {
+	setup()
+	_ = config.GddNacosRegisterHost.Write("seed")
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var param vo.RegisterInstanceParam
+	namingClient := mock.NewMockINamingClient(ctrl)
+	namingClient.
+		EXPECT().
+		RegisterInstance(gomock.Any()).
+		DoAndReturn(func(p vo.RegisterInstanceParam) (bool, error) {
+			param = p
+			return true, nil
+		})
+	nacos.NewNamingClient = func(param vo.NacosClientParam) (iClient naming_client.INamingClient, err error) {
+		return namingClient, nil
+	}
+	prev := nacos.NamingClient
+	nacos.NamingClient = namingClient
+	defer func() {
+		nacos.NamingClient = prev
+	}()
+
+	nacos.NewMux(map[string]interface{}{
+		"foo": "bar",
+	})
+	require.Equal(t, "seed_rest", param.ServiceName, "only the rest service is registered")
+	require.Equal(t, uint64(8088), param.Port)
+	require.Equal(t, "rest,grpc", param.Metadata["protocol"])
+	require.Equal(t, "bar", param.Metadata["foo"])
+}
+
 func TestNewRest2(t *testing.T) {
 	Convey("Should not have error", t, func() {
 		setup()
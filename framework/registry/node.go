@@ -2,20 +2,40 @@ package registry
 
 import (
 	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/health"
+	"github.com/unionj-cloud/go-doudou/v2/framework/loglevel"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/etcd"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/memberlist"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/nacos"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/zk"
-	logger "github.com/unionj-cloud/toolkit/zlogger"
 )
 
+var logger = loglevel.Named("registry")
+
 type IServiceProvider interface {
 	SelectServer() string
 	Close()
 }
 
+// registerHealthCheckers registers readiness checker of each service discovery client
+func registerHealthCheckers() {
+	for mode, _ := range config.ServiceDiscoveryMap() {
+		switch mode {
+		case constants.SD_NACOS:
+			health.Register("registry.nacos", health.CheckerFunc(nacos.HealthCheck))
+		case constants.SD_ETCD:
+			health.Register("registry.etcd", health.CheckerFunc(etcd.HealthCheck))
+		case constants.SD_MEMBERLIST:
+			health.Register("registry.memberlist", health.CheckerFunc(memberlist.HealthCheck))
+		case constants.SD_ZK:
+			health.Register("registry.zk", health.CheckerFunc(zk.HealthCheck))
+		}
+	}
+}
+
 func NewRest(data ...map[string]interface{}) {
+	registerHealthCheckers()
 	for mode, _ := range config.ServiceDiscoveryMap() {
 		switch mode {
 		case constants.SD_NACOS:
@@ -32,7 +52,29 @@ func NewRest(data ...map[string]interface{}) {
 	}
 }
 
+// NewMux registers the service serving rest and grpc on one port to each service registry, only one rest record
+// flagged by constants.PROTOCOL_META is registered, grpc clients resolve it by the rest service name.
+// It is deregistered by ShutdownRest.
+func NewMux(data ...map[string]interface{}) {
+	registerHealthCheckers()
+	for mode, _ := range config.ServiceDiscoveryMap() {
+		switch mode {
+		case constants.SD_NACOS:
+			nacos.NewMux(data...)
+		case constants.SD_ETCD:
+			etcd.NewMux(data...)
+		case constants.SD_MEMBERLIST:
+			memberlist.NewMux(data...)
+		case constants.SD_ZK:
+			zk.NewMux(data...)
+		default:
+			logger.Warn().Msgf("[go-doudou] unknown service discovery mode: %s", mode)
+		}
+	}
+}
+
 func NewGrpc(data ...map[string]interface{}) {
+	registerHealthCheckers()
 	for mode, _ := range config.ServiceDiscoveryMap() {
 		switch mode {
 		case constants.SD_NACOS:
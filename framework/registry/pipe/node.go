@@ -7,6 +7,7 @@ import (
 
 	"github.com/unionj-cloud/toolkit/pipeconn"
 	"github.com/unionj-cloud/toolkit/zlogger"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
@@ -16,6 +17,7 @@ func NewGrpcClientConn(dialCtx pipeconn.DialContextFunc) *grpc.ClientConn {
 	defer cancel()
 	grpcConn, err := grpc.DialContext(ctx, "pipe",
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
 		grpc.WithContextDialer(func(c context.Context, _ string) (net.Conn, error) {
 			return dialCtx(c)
 		}),
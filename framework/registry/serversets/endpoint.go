@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bytedance/sonic"
@@ -32,6 +33,7 @@ type Endpoint struct {
 	key   string
 	ping  func() error
 	alive bool
+	conn  atomic.Pointer[zk.Conn]
 }
 
 // RegisterEndpoint registers a host and port as alive. It creates the appropriate
@@ -56,6 +58,7 @@ func (ss *ServerSet) RegisterEndpoint(host string, port int, ping func() error)
 	if err != nil {
 		return nil, err
 	}
+	endpoint.conn.Store(connection)
 
 	err = endpoint.update(connection)
 	if err != nil {
@@ -70,10 +73,12 @@ func (ss *ServerSet) RegisterEndpoint(host string, port int, ping func() error)
 			select {
 			case event := <-sessionEvents:
 				if event.Type == zk.EventSession && event.State == zk.StateExpired {
+					endpoint.conn.Store(nil)
 					connection.Close()
 					connection = nil
 				}
 			case <-endpoint.done:
+				endpoint.conn.Store(nil)
 				connection.Close()
 				return
 			}
@@ -83,6 +88,7 @@ func (ss *ServerSet) RegisterEndpoint(host string, port int, ping func() error)
 				if err != nil {
 					panic(fmt.Errorf("unable to reconnect to zookeeper after session expired: %v", err))
 				}
+				endpoint.conn.Store(connection)
 
 				err = endpoint.update(connection)
 				if err != nil {
@@ -139,6 +145,7 @@ func (ss *ServerSet) RegisterEndpointWithMeta(host string, port int, ping func()
 	if err != nil {
 		return nil, err
 	}
+	endpoint.conn.Store(connection)
 
 	err = endpoint.updateWithMeta(connection, meta)
 	if err != nil {
@@ -153,10 +160,12 @@ func (ss *ServerSet) RegisterEndpointWithMeta(host string, port int, ping func()
 			select {
 			case event := <-sessionEvents:
 				if event.Type == zk.EventSession && event.State == zk.StateExpired {
+					endpoint.conn.Store(nil)
 					connection.Close()
 					connection = nil
 				}
 			case <-endpoint.done:
+				endpoint.conn.Store(nil)
 				connection.Close()
 				return
 			}
@@ -166,6 +175,7 @@ func (ss *ServerSet) RegisterEndpointWithMeta(host string, port int, ping func()
 				if err != nil {
 					panic(fmt.Errorf("unable to reconnect to zookeeper after session expired: %v", err))
 				}
+				endpoint.conn.Store(connection)
 
 				err = endpoint.updateWithMeta(connection, meta)
 				if err != nil {
@@ -202,6 +212,12 @@ func (ss *ServerSet) RegisterEndpointWithMeta(host string, port int, ping func()
 	return endpoint, nil
 }
 
+// Connected reports whether the endpoint has a live session with Zookeeper
+func (ep *Endpoint) Connected() bool {
+	conn := ep.conn.Load()
+	return conn != nil && conn.State() == zk.StateHasSession
+}
+
 // Close blocks until the client connection to Zookeeper is closed.
 // If already called, will simply return, even if in the process of closing.
 func (ep *Endpoint) Close() {
@@ -13,22 +13,29 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/unionj-cloud/toolkit/cast"
 	"github.com/unionj-cloud/toolkit/constants"
 	"github.com/unionj-cloud/toolkit/errorx"
 	"github.com/unionj-cloud/toolkit/stringutils"
-	"github.com/unionj-cloud/toolkit/zlogger"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 
 	"github.com/unionj-cloud/go-doudou/v2/framework/buildinfo"
 	"github.com/unionj-cloud/go-doudou/v2/framework/config"
 	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/grpc_resolver_zk"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_deadline"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_metrics"
+	"github.com/unionj-cloud/go-doudou/v2/framework/loglevel"
 	cons "github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/serversets"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/utils"
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
 )
 
+var logger = loglevel.Named("registry.zk")
+
 var restEndpoint *serversets.Endpoint
 var grpcEndpoint *serversets.Endpoint
 var providers = map[string]interfaces.IServiceProvider{}
@@ -36,7 +43,7 @@ var providers = map[string]interfaces.IServiceProvider{}
 func newServerSet(service string) *serversets.ServerSet {
 	zkServers := config.GddZkServers.LoadOrDefault(config.DefaultGddZkServers)
 	if stringutils.IsEmpty(zkServers) {
-		zlogger.Panic().Msg("[go-doudou] env GDD_ZK_SERVERS is not set")
+		logger.Panic().Msg("[go-doudou] env GDD_ZK_SERVERS is not set")
 	}
 	zookeepers := strings.Split(zkServers, ",")
 	environment := os.Getenv("GDD_ENV")
@@ -61,7 +68,7 @@ func registerService(service string, port uint64, scheme string, userData ...map
 		nil,
 		metadata)
 	if err != nil {
-		zlogger.Panic().Err(err).Msgf("[go-doudou] register %s to zookeeper failed", service)
+		logger.Panic().Err(err).Msgf("[go-doudou] register %s to zookeeper failed", service)
 	}
 	return endpoint
 }
@@ -106,22 +113,28 @@ func populateMeta(meta map[string]interface{}, userData ...map[string]interface{
 func NewRest(data ...map[string]interface{}) {
 	service := config.GetServiceName() + "_" + string(cons.REST_TYPE)
 	httpPort := config.GetPort()
-	restEndpoint = registerService(service, httpPort, "http", data...)
-	zlogger.Info().Msgf("[go-doudou] %s registered to zookeeper successfully", service)
+	restEndpoint = registerService(service, httpPort, tlsx.Scheme(), data...)
+	logger.Info().Msgf("[go-doudou] %s registered to zookeeper successfully", service)
+}
+
+// NewMux registers the rest service which serves grpc on the same port as well, the address is flagged by
+// constants.PROTOCOL_META metadata and grpc clients resolve it by the rest service name
+func NewMux(data ...map[string]interface{}) {
+	NewRest(append(data, map[string]interface{}{cons.PROTOCOL_META: cons.MUX_PROTOCOL})...)
 }
 
 func NewGrpc(data ...map[string]interface{}) {
 	service := config.GetServiceName() + "_" + string(cons.GRPC_TYPE)
 	grpcPort := config.GetGrpcPort()
 	grpcEndpoint = registerService(service, grpcPort, "grpc", data...)
-	zlogger.Info().Msgf("[go-doudou] %s registered to zookeeper successfully", service)
+	logger.Info().Msgf("[go-doudou] %s registered to zookeeper successfully", service)
 }
 
 func ShutdownRest() {
 	if restEndpoint != nil {
 		service := config.GetServiceName() + "_" + string(cons.REST_TYPE)
 		restEndpoint.Close()
-		zlogger.Info().Msgf("[go-doudou] deregistered %s from zookeeper successfully", service)
+		logger.Info().Msgf("[go-doudou] deregistered %s from zookeeper successfully", service)
 	}
 }
 
@@ -129,8 +142,18 @@ func ShutdownGrpc() {
 	if grpcEndpoint != nil {
 		service := config.GetServiceName() + "_" + string(cons.GRPC_TYPE)
 		grpcEndpoint.Close()
-		zlogger.Info().Msgf("[go-doudou] deregistered %s from zookeeper successfully", service)
+		logger.Info().Msgf("[go-doudou] deregistered %s from zookeeper successfully", service)
+	}
+}
+
+// HealthCheck checks whether registered endpoints have live sessions with zookeeper
+func HealthCheck(ctx context.Context) error {
+	for _, endpoint := range []*serversets.Endpoint{restEndpoint, grpcEndpoint} {
+		if endpoint != nil && !endpoint.Connected() {
+			return errors.New("zookeeper session is lost")
+		}
 	}
+	return nil
 }
 
 // A Watcher represents how a serverset.Watch is used so it can be stubbed out for tests.
@@ -151,6 +174,7 @@ type RRServiceProvider struct {
 }
 
 type address struct {
+	scheme        string
 	addr          string
 	rootPath      string
 	weight        int
@@ -194,7 +218,12 @@ func (r *RRServiceProvider) convertToAddress(ups []string) (addrs []*address) {
 		if group != r.target.Group || version != r.target.Version {
 			continue
 		}
+		scheme := u.Scheme
+		if stringutils.IsEmpty(scheme) {
+			scheme = "http"
+		}
 		addr := &address{
+			scheme:   scheme,
 			addr:     u.Host,
 			rootPath: rootPath,
 			weight:   weight,
@@ -213,7 +242,7 @@ func (n *RRServiceProvider) SelectServer() string {
 	}
 	instances := n.curState.Load().(state).addresses
 	if len(instances) == 0 {
-		zlogger.Error().Msgf("[go-doudou] %s server not found", n.target)
+		logger.Error().Msgf("[go-doudou] %s server not found", n.target)
 		return ""
 	}
 	sort.SliceStable(instances, func(i, j int) bool {
@@ -222,7 +251,7 @@ func (n *RRServiceProvider) SelectServer() string {
 	next := int(atomic.AddUint64(&n.current, uint64(1)) % uint64(len(instances)))
 	n.current = uint64(next)
 	selected := instances[next]
-	return fmt.Sprintf("http://%s%s", selected.addr, selected.rootPath)
+	return fmt.Sprintf("%s://%s%s", selected.scheme, selected.addr, selected.rootPath)
 }
 
 func (r *RRServiceProvider) Close() {
@@ -270,7 +299,7 @@ func (n *SWRRServiceProvider) SelectServer() string {
 	}
 	instances := n.curState.Load().(state).addresses
 	if len(instances) == 0 {
-		zlogger.Error().Msgf("[go-doudou] %s server not found", n.target)
+		logger.Error().Msgf("[go-doudou] %s server not found", n.target)
 		return ""
 	}
 	var selected *address
@@ -284,7 +313,7 @@ func (n *SWRRServiceProvider) SelectServer() string {
 		}
 	}
 	selected.currentWeight -= total
-	return fmt.Sprintf("http://%s%s", selected.addr, selected.rootPath)
+	return fmt.Sprintf("%s://%s%s", selected.scheme, selected.addr, selected.rootPath)
 }
 
 // NewSWRRServiceProvider creates new SWRRServiceProvider instance
@@ -318,12 +347,19 @@ func NewGrpcClientConn(conf ServiceConfig, lb string, dialOptions ...grpc.DialOp
 		Version:     conf.Version,
 	})
 	serverAddr := fmt.Sprintf("zk://%s/", conf.Name)
-	dialOptions = append(dialOptions, grpc.WithBlock(), grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`))
+	tlsOptions, err := tlsx.GrpcDialOptions()
+	if err != nil {
+		logger.Panic().Err(err).Msg("[go-doudou] invalid tls config")
+	}
+	dialOptions = append(tlsOptions, dialOptions...)
+	dialOptions = append(dialOptions, grpc.WithBlock(), grpc.WithStatsHandler(otelgrpc.NewClientHandler()), grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`))
+	dialOptions = append(dialOptions, grpcx_metrics.DialOptions()...)
+	dialOptions = append(dialOptions, grpcx_deadline.DialOptions()...)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	grpcConn, err := grpc.DialContext(ctx, serverAddr, dialOptions...)
 	if err != nil {
-		zlogger.Panic().Err(err).Msgf("[go-doudou] failed to connect to server %s", serverAddr)
+		logger.Panic().Err(err).Msgf("[go-doudou] failed to connect to server %s", serverAddr)
 	}
 	return grpcConn
 }
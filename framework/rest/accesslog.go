@@ -0,0 +1,339 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ascarter/requestid"
+	"github.com/felixge/httpsnoop"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/toolkit/cast"
+	"github.com/unionj-cloud/toolkit/stringutils"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const redactedValue = "***"
+
+// AccessLogConfig configures AccessLog middleware
+type AccessLogConfig struct {
+	// BodyLimit is max bytes of request body and response body to be logged, 0 means bodies are not logged
+	BodyLimit int
+	// RedactHeaders are names of headers whose values are masked
+	RedactHeaders []string
+	// RedactFields are json field names and query/form parameter names whose values are masked, case-insensitive
+	RedactFields []string
+	// SkipContentTypes are content type prefixes like image/ whose body is not logged
+	SkipContentTypes []string
+}
+
+// DefaultAccessLogConfig returns AccessLogConfig from GDD_LOG_REQ_BODY_LIMIT, GDD_LOG_REQ_REDACT_HEADERS,
+// GDD_LOG_REQ_REDACT_FIELDS and GDD_LOG_REQ_SKIP_CONTENT_TYPES environment variables
+func DefaultAccessLogConfig() AccessLogConfig {
+	conf := AccessLogConfig{
+		BodyLimit:        config.DefaultGddLogReqBodyLimit,
+		RedactHeaders:    splitList(config.GddLogReqRedactHeaders.LoadOrDefault(config.DefaultGddLogReqRedactHeaders)),
+		RedactFields:     splitList(config.GddLogReqRedactFields.LoadOrDefault(config.DefaultGddLogReqRedactFields)),
+		SkipContentTypes: splitList(config.GddLogReqSkipContentTypes.LoadOrDefault(config.DefaultGddLogReqSkipContentTypes)),
+	}
+	if stringutils.IsNotEmpty(config.GddLogReqBodyLimit.Load()) {
+		if limit, err := cast.ToIntE(config.GddLogReqBodyLimit.Load()); err == nil {
+			conf.BodyLimit = limit
+		}
+	}
+	return conf
+}
+
+func splitList(s string) []string {
+	var ret []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); stringutils.IsNotEmpty(item) {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+// cappedBuffer keeps at most limit bytes written to it and discards the rest
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	remain := b.limit - b.buf.Len()
+	if len(p) > remain {
+		b.truncated = true
+		if remain > 0 {
+			b.buf.Write(p[:remain])
+		}
+		return len(p), nil
+	}
+	b.buf.Write(p)
+	return len(p), nil
+}
+
+type teeReadCloser struct {
+	io.ReadCloser
+	w io.Writer
+}
+
+func (t *teeReadCloser) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.w.Write(p[:n])
+	}
+	return n, err
+}
+
+type accessLogger struct {
+	AccessLogConfig
+	redactHeaders map[string]struct{}
+	redactFields  map[string]struct{}
+	fieldPattern  *regexp.Regexp
+	output        func(fields map[string]interface{})
+}
+
+func newAccessLogger(conf AccessLogConfig) *accessLogger {
+	l := &accessLogger{
+		AccessLogConfig: conf,
+		redactHeaders:   make(map[string]struct{}),
+		redactFields:    make(map[string]struct{}),
+		output:          writeAccessLog,
+	}
+	for _, item := range conf.RedactHeaders {
+		l.redactHeaders[http.CanonicalHeaderKey(item)] = struct{}{}
+	}
+	var names []string
+	for _, item := range conf.RedactFields {
+		l.redactFields[strings.ToLower(item)] = struct{}{}
+		names = append(names, regexp.QuoteMeta(item))
+	}
+	if len(names) > 0 {
+		// matches string, number and literal values of the fields, works for truncated json as well
+		l.fieldPattern = regexp.MustCompile(`(?i)("(?:` + strings.Join(names, "|") + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|-?[0-9][0-9.eE+-]*|true|false|null)`)
+	}
+	return l
+}
+
+func (l *accessLogger) skip(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, item := range l.SkipContentTypes {
+		if strings.HasPrefix(contentType, strings.ToLower(item)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *accessLogger) header(h http.Header) http.Header {
+	ret := h.Clone()
+	for k := range ret {
+		if _, ok := l.redactHeaders[http.CanonicalHeaderKey(k)]; ok {
+			ret[k] = []string{redactedValue}
+		}
+	}
+	return ret
+}
+
+// values masks values of RedactFields in url encoded raw, result is still url encoded
+func (l *accessLogger) values(raw string) string {
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return raw
+	}
+	for k := range values {
+		if _, ok := l.redactFields[strings.ToLower(k)]; ok {
+			values[k] = []string{redactedValue}
+		}
+	}
+	return values.Encode()
+}
+
+func unescape(s string) string {
+	if ret, err := url.QueryUnescape(s); err == nil {
+		return ret
+	}
+	return s
+}
+
+func (l *accessLogger) body(contentType string, capture *cappedBuffer) string {
+	if capture == nil {
+		if l.BodyLimit > 0 && l.skip(contentType) {
+			return fmt.Sprintf("[%s body omitted]", contentType)
+		}
+		return ""
+	}
+	data := capture.buf.Bytes()
+	if capture.truncated {
+		data = trimCutRune(data)
+	}
+	if !utf8.Valid(data) {
+		return "[binary body omitted]"
+	}
+	var ret string
+	switch {
+	case strings.Contains(contentType, "json"):
+		ret = string(data)
+		if l.fieldPattern != nil {
+			ret = l.fieldPattern.ReplaceAllString(ret, `${1}"`+redactedValue+`"`)
+		}
+	case strings.Contains(contentType, "application/x-www-form-urlencoded"):
+		ret = unescape(l.values(string(data)))
+	default:
+		ret = string(data)
+	}
+	if capture.truncated {
+		ret += "...(truncated)"
+	}
+	return ret
+}
+
+// trimCutRune removes the last rune of truncated data if it is cut off, at most utf8.UTFMax-1 bytes are removed
+func trimCutRune(data []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				return data[:len(data)-i]
+			}
+			break
+		}
+	}
+	return data
+}
+
+func (l *accessLogger) newCapture(contentType string) *cappedBuffer {
+	if l.BodyLimit <= 0 || l.skip(contentType) {
+		return nil
+	}
+	return &cappedBuffer{limit: l.BodyLimit}
+}
+
+// AccessLog logs request and response with at most BodyLimit bytes of bodies teed from the stream, so streaming,
+// flushing, hijacking and file downloading work as usual. Bodies of SkipContentTypes are not logged,
+// values of RedactHeaders and RedactFields are masked. Request body is logged as much as the handler reads.
+func AccessLog(conf AccessLogConfig) func(inner http.Handler) http.Handler {
+	return newAccessLogger(conf).middleware
+}
+
+func writeAccessLog(fields map[string]interface{}) {
+	reqLog, err := JsonMarshalIndent(fields, "", "    ", true)
+	if err != nil {
+		reqLog = fmt.Sprintf("call jsonMarshalIndent(fields, \"\", \"    \", true) error: %s", err)
+	}
+	logger.Info().Fields(fields).Msg(reqLog)
+}
+
+func (l *accessLogger) middleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqContentType := r.Header.Get(HeaderContentType)
+		var reqCapture *cappedBuffer
+		if r.Body != nil && r.Body != http.NoBody {
+			if reqCapture = l.newCapture(reqContentType); reqCapture != nil {
+				r.Body = &teeReadCloser{ReadCloser: r.Body, w: reqCapture}
+			}
+		}
+
+		var (
+			lock        sync.Mutex
+			statusCode  int
+			written     int64
+			decided     bool
+			respCapture *cappedBuffer
+		)
+		decide := func() {
+			if !decided {
+				decided = true
+				respCapture = l.newCapture(w.Header().Get(HeaderContentType))
+			}
+		}
+		wrapped := httpsnoop.Wrap(w, httpsnoop.Hooks{
+			WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+				return func(code int) {
+					lock.Lock()
+					if statusCode == 0 && code >= http.StatusOK {
+						statusCode = code
+					}
+					lock.Unlock()
+					next(code)
+				}
+			},
+			Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+				return func(b []byte) (int, error) {
+					n, err := next(b)
+					lock.Lock()
+					decide()
+					if respCapture != nil {
+						respCapture.Write(b[:n])
+					}
+					written += int64(n)
+					lock.Unlock()
+					return n, err
+				}
+			},
+			ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+				return func(src io.Reader) (int64, error) {
+					lock.Lock()
+					decide()
+					if respCapture != nil {
+						src = io.TeeReader(src, respCapture)
+					}
+					lock.Unlock()
+					n, err := next(src)
+					lock.Lock()
+					written += n
+					lock.Unlock()
+					return n, err
+				}
+			},
+		})
+
+		start := time.Now()
+		inner.ServeHTTP(wrapped, r)
+		elapsed := time.Since(start)
+
+		lock.Lock()
+		defer lock.Unlock()
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		rid, _ := requestid.FromContext(r.Context())
+		spanCtx := trace.SpanContextFromContext(r.Context())
+		var traceId, spanId string
+		if spanCtx.IsValid() {
+			traceId = spanCtx.TraceID().String()
+			spanId = spanCtx.SpanID().String()
+		}
+		reqUrl := *r.URL
+		reqUrl.RawQuery = l.values(r.URL.RawQuery)
+		fields := map[string]interface{}{
+			"remoteAddr":        r.RemoteAddr,
+			"httpMethod":        r.Method,
+			"requestUrl":        reqUrl.String(),
+			"proto":             r.Proto,
+			"host":              r.Host,
+			"reqContentLength":  r.ContentLength,
+			"reqHeader":         l.header(r.Header),
+			"requestId":         rid,
+			"reqQuery":          unescape(reqUrl.RawQuery),
+			"reqBody":           l.body(reqContentType, reqCapture),
+			"respBody":          l.body(w.Header().Get(HeaderContentType), respCapture),
+			"statusCode":        statusCode,
+			"respHeader":        l.header(w.Header()),
+			"respContentLength": written,
+			"elapsedTime":       elapsed.String(),
+			"elapsed":           elapsed.Milliseconds(),
+			"spanId":            spanId,
+			"traceId":           traceId,
+		}
+		l.output(fields)
+	})
+}
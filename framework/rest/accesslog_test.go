@@ -0,0 +1,190 @@
+package rest
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAccessLogger(conf AccessLogConfig) (*accessLogger, *[]map[string]interface{}) {
+	var logs []map[string]interface{}
+	l := newAccessLogger(conf)
+	l.output = func(fields map[string]interface{}) {
+		logs = append(logs, fields)
+	}
+	return l, &logs
+}
+
+func TestDefaultAccessLogConfig(t *testing.T) {
+	t.Setenv("GDD_LOG_REQ_BODY_LIMIT", "10")
+	t.Setenv("GDD_LOG_REQ_REDACT_HEADERS", "Authorization, X-Token")
+	t.Setenv("GDD_LOG_REQ_REDACT_FIELDS", "password,")
+	conf := DefaultAccessLogConfig()
+	assert.Equal(t, 10, conf.BodyLimit)
+	assert.Equal(t, []string{"Authorization", "X-Token"}, conf.RedactHeaders)
+	assert.Equal(t, []string{"password"}, conf.RedactFields)
+	assert.Contains(t, conf.SkipContentTypes, "image/")
+}
+
+func TestAccessLog_Redact(t *testing.T) {
+	l, logs := newTestAccessLogger(AccessLogConfig{
+		BodyLimit:     1024,
+		RedactHeaders: []string{"authorization", "Set-Cookie"},
+		RedactFields:  []string{"password", "accessToken"},
+	})
+	handler := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, `{"username":"jack","password":"123456","profile":{"AccessToken": 99}}`, string(body),
+			"handler reads original body")
+		w.Header().Set(HeaderContentType, "application/json")
+		w.Header().Set("Set-Cookie", "session=1")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"accessToken":"abc\"def","ok":true}`)
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/login?password=1&name=a%20b", strings.NewReader(`{"username":"jack","password":"123456","profile":{"AccessToken": 99}}`))
+	req.Header.Set(HeaderContentType, "application/json")
+	req.Header.Set(HeaderAuthorization, "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, `{"accessToken":"abc\"def","ok":true}`, rec.Body.String())
+	assert.Equal(t, "session=1", rec.Header().Get("Set-Cookie"), "response headers are not touched")
+	require.Len(t, *logs, 1)
+	fields := (*logs)[0]
+	assert.Equal(t, `{"username":"jack","password":"***","profile":{"AccessToken": "***"}}`, fields["reqBody"])
+	assert.Equal(t, `{"accessToken":"***","ok":true}`, fields["respBody"])
+	assert.Equal(t, "name=a b&password=***", fields["reqQuery"])
+	assert.Equal(t, "/login?name=a+b&password=%2A%2A%2A", fields["requestUrl"])
+	assert.Equal(t, []string{"***"}, fields["reqHeader"].(http.Header)[HeaderAuthorization])
+	assert.Equal(t, []string{"***"}, fields["respHeader"].(http.Header)["Set-Cookie"])
+	assert.Equal(t, http.StatusCreated, fields["statusCode"])
+	assert.Equal(t, int64(rec.Body.Len()), fields["respContentLength"])
+	assert.Equal(t, "Bearer secret", req.Header.Get(HeaderAuthorization), "request headers are not touched")
+}
+
+func TestAccessLog_Form(t *testing.T) {
+	l, logs := newTestAccessLogger(AccessLogConfig{BodyLimit: 1024, RedactFields: []string{"password"}})
+	handler := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "123", r.FormValue("password"))
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader("username=jack&password=123"))
+	req.Header.Set(HeaderContentType, "application/x-www-form-urlencoded")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	require.Len(t, *logs, 1)
+	assert.Equal(t, "password=***&username=jack", (*logs)[0]["reqBody"])
+	assert.Equal(t, http.StatusOK, (*logs)[0]["statusCode"])
+}
+
+func TestAccessLog_Truncate(t *testing.T) {
+	l, logs := newTestAccessLogger(AccessLogConfig{BodyLimit: 16, RedactFields: []string{"token"}})
+	handler := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HeaderContentType, "application/json")
+		io.WriteString(w, `{"token":"abcdefghijklmnopqrstuvwxyz"}`)
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, `{"token":"abcdefghijklmnopqrstuvwxyz"}`, rec.Body.String())
+	require.Len(t, *logs, 1)
+	assert.Equal(t, `{"token":"***"...(truncated)`, (*logs)[0]["respBody"])
+	assert.Equal(t, "", (*logs)[0]["reqBody"])
+}
+
+func TestAccessLog_TruncateBinary(t *testing.T) {
+	l, logs := newTestAccessLogger(AccessLogConfig{BodyLimit: 8})
+	handler := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/binary" {
+			w.Write([]byte{0x89, 'P', 'N', 'G', 0xff, 0xfe, 0x00, 0x01, 0x02, 0x03})
+			return
+		}
+		io.WriteString(w, "中文中文")
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/binary", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/text", nil))
+	require.Len(t, *logs, 2)
+	assert.Equal(t, "[binary body omitted]", (*logs)[0]["respBody"], "binary bodies over the limit are omitted")
+	assert.Equal(t, "中文...(truncated)", (*logs)[1]["respBody"], "the cut off rune is trimmed")
+}
+
+func TestTrimCutRune(t *testing.T) {
+	assert.Equal(t, []byte("ab"), trimCutRune([]byte("ab")))
+	assert.Equal(t, []byte("a"), trimCutRune([]byte("a中")[:3]))
+	assert.Equal(t, []byte("a中"), trimCutRune([]byte("a中")))
+	assert.Equal(t, []byte{'a', 0xff}, trimCutRune([]byte{'a', 0xff}), "invalid bytes are kept for validation")
+}
+
+func TestAccessLog_SkipContentTypes(t *testing.T) {
+	l, logs := newTestAccessLogger(AccessLogConfig{BodyLimit: 1024, SkipContentTypes: []string{"image/", "application/octet-stream"}})
+	handler := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if r.URL.Path == "/png" {
+			w.Header().Set(HeaderContentType, "image/png")
+		}
+		w.Write([]byte{0x89, 'P', 'N', 'G', 0xff, 0xfe})
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/png", strings.NewReader("binary"))
+	req.Header.Set(HeaderContentType, "application/octet-stream")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	require.Len(t, *logs, 2)
+	assert.Equal(t, "[application/octet-stream body omitted]", (*logs)[0]["reqBody"])
+	assert.Equal(t, "[image/png body omitted]", (*logs)[0]["respBody"])
+	assert.Equal(t, int64(6), (*logs)[0]["respContentLength"])
+	assert.Equal(t, "[binary body omitted]", (*logs)[1]["respBody"], "content type is unknown")
+}
+
+func TestAccessLog_Streaming(t *testing.T) {
+	l, logs := newTestAccessLogger(AccessLogConfig{BodyLimit: 1024})
+	flushed := make(chan struct{})
+	srv := httptest.NewServer(l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HeaderContentType, "text/event-stream")
+		io.WriteString(w, "data: 1\n\n")
+		w.(http.Flusher).Flush()
+		<-flushed
+		io.WriteString(w, "data: 2\n\n")
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "data: 1\n", line, "first event arrives before handler returns")
+	close(flushed)
+	rest, _ := io.ReadAll(reader)
+	assert.Equal(t, "\ndata: 2\n\n", string(rest))
+	srv.Close()
+	require.Len(t, *logs, 1)
+	assert.Equal(t, "data: 1\n\ndata: 2\n\n", (*logs)[0]["respBody"])
+}
+
+func TestAccessLog_Hijack(t *testing.T) {
+	l, _ := newTestAccessLogger(AccessLogConfig{BodyLimit: 1024})
+	srv := httptest.NewServer(l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		buf.Flush()
+	})))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "hijacked", string(body))
+}
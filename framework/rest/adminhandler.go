@@ -0,0 +1,154 @@
+package rest
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/loglevel"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest/httprouter"
+)
+
+// RouteInfo describes a registered route
+type RouteInfo struct {
+	Name        string                 `json:"name"`
+	Method      string                 `json:"method"`
+	Pattern     string                 `json:"pattern"`
+	Middlewares []string               `json:"middlewares"`
+	Annotations []framework.Annotation `json:"annotations"`
+}
+
+// LoggerInfo describes level of a logger
+type LoggerInfo struct {
+	Name  string `json:"name"`
+	Level string `json:"level"`
+}
+
+var closureSuffix = regexp.MustCompile(`^func\d+$`)
+
+// middlewareName returns short name of mw like rest.recoveryWith or handlers.ProxyHeaders
+func middlewareName(mw MiddlewareFunc) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(mw).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	name := strings.TrimSuffix(fn.Name(), "-fm")
+	name = name[strings.LastIndex(name, "/")+1:]
+	parts := strings.Split(name, ".")
+	for len(parts) > 2 && closureSuffix.MatchString(parts[len(parts)-1]) {
+		parts = parts[:len(parts)-1]
+	}
+	// closures created by inlined calls are named after the caller, e.g. rest.NewRestServerWithOptions.deadline.deadlineWith
+	if len(parts) > 2 && !strings.HasPrefix(parts[1], "(") {
+		parts = []string{parts[0], parts[len(parts)-1]}
+	}
+	return strings.Join(parts, ".")
+}
+
+func middlewareNames(mwf []MiddlewareFunc) []string {
+	names := make([]string, 0, len(mwf))
+	for _, mw := range mwf {
+		names = append(names, middlewareName(mw))
+	}
+	return names
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set(HeaderContentType, "application/json; charset=utf-8")
+	w.Header().Set(HeaderCacheControl, "no-store")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Routes returns all registered routes with their middlewares and annotations
+func (srv *RestServer) Routes() []RouteInfo {
+	var all []Route
+	all = append(all, srv.bizRoutes...)
+	all = append(all, srv.gddRoutes...)
+	all = append(all, srv.debugRoutes...)
+	routes := make([]RouteInfo, 0, len(all))
+	for _, r := range all {
+		middlewares := r.middlewares
+		if middlewares == nil {
+			middlewares = []string{}
+		}
+		annotations := framework.GetAnnotations(r.Name)
+		if annotations == nil {
+			annotations = []framework.Annotation{}
+		}
+		routes = append(routes, RouteInfo{
+			Name:        r.Name,
+			Method:      r.Method,
+			Pattern:     r.Pattern,
+			Middlewares: middlewares,
+			Annotations: annotations,
+		})
+	}
+	return routes
+}
+
+func loggers() []LoggerInfo {
+	var result []LoggerInfo
+	for _, name := range loglevel.Names() {
+		level, _ := loglevel.Level(name)
+		result = append(result, LoggerInfo{
+			Name:  name,
+			Level: level.String(),
+		})
+	}
+	return result
+}
+
+// adminRoutes returns json apis for inspecting routes and changing log levels at runtime
+func (srv *RestServer) adminRoutes() []Route {
+	return []Route{
+		{
+			Name:    "GetRoutes",
+			Method:  http.MethodGet,
+			Pattern: gddPathPrefix + "routes",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, srv.Routes())
+			},
+		},
+		{
+			Name:    "GetLoggers",
+			Method:  http.MethodGet,
+			Pattern: gddPathPrefix + "loggers",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, loggers())
+			},
+		},
+		{
+			Name:    "PutLogger",
+			Method:  http.MethodPut,
+			Pattern: gddPathPrefix + "loggers/:name",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				name := httprouter.ParamsFromContext(r.Context()).ByName("name")
+				var body LoggerInfo
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					srv.errorRenderer(w, r, NewBizError(err, WithStatusCode(http.StatusBadRequest)))
+					return
+				}
+				level, err := zerolog.ParseLevel(strings.ToLower(body.Level))
+				if err != nil || level == zerolog.NoLevel {
+					srv.errorRenderer(w, r, NewBizError(errors.Errorf("invalid level %s", body.Level), WithStatusCode(http.StatusBadRequest)))
+					return
+				}
+				if err = loglevel.SetLevel(name, level); err != nil {
+					srv.errorRenderer(w, r, NewBizError(err, WithStatusCode(http.StatusNotFound)))
+					return
+				}
+				writeJSON(w, LoggerInfo{
+					Name:  name,
+					Level: level.String(),
+				})
+			},
+		},
+	}
+}
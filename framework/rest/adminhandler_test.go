@@ -0,0 +1,94 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/loglevel"
+)
+
+func doAdmin(srv *RestServer, method, target, body string, auth bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if auth {
+		req.SetBasicAuth(config.DefaultGddManageUser, config.DefaultGddManagePass)
+	}
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminRoutes(t *testing.T) {
+	framework.RegisterAnnotationStore(framework.AnnotationStore{
+		"AdminGetUser": {{Name: "role", Params: []string{"admin"}}},
+	})
+	srv := NewRestServer()
+	srv.AddRoutes([]Route{
+		{
+			Name:    "AdminGetUser",
+			Method:  http.MethodGet,
+			Pattern: "/admin/user",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			},
+		},
+	}, BasicAuth())
+
+	assert.Equal(t, http.StatusUnauthorized, doAdmin(srv, http.MethodGet, "/go-doudou/routes", "", false).Code)
+	rec := doAdmin(srv, http.MethodGet, "/go-doudou/routes", "", true)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var routes []RouteInfo
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &routes))
+	var found bool
+	for _, item := range routes {
+		if item.Name == "AdminGetUser" {
+			found = true
+			assert.Equal(t, http.MethodGet, item.Method)
+			assert.Equal(t, "/admin/user", item.Pattern)
+			assert.Equal(t, []framework.Annotation{{Name: "role", Params: []string{"admin"}}}, item.Annotations)
+			assert.Equal(t, "rest.recoveryWith", item.Middlewares[1])
+			assert.Equal(t, "rest.basicAuth", item.Middlewares[len(item.Middlewares)-1])
+		}
+	}
+	assert.True(t, found)
+
+	defer loglevel.SetLevel(loglevel.Root, zerolog.InfoLevel)
+	rec = doAdmin(srv, http.MethodPut, "/go-doudou/loggers/root", `{"level":"debug"}`, true)
+	require.Equal(t, http.StatusOK, rec.Code)
+	level, _ := loglevel.Level(loglevel.Root)
+	assert.Equal(t, zerolog.DebugLevel, level)
+	assert.Contains(t, doAdmin(srv, http.MethodGet, "/go-doudou/loggers", "", true).Body.String(), `{"name":"root","level":"debug"}`)
+	assert.Equal(t, http.StatusBadRequest, doAdmin(srv, http.MethodPut, "/go-doudou/loggers/root", `{"level":"verbose"}`, true).Code)
+	assert.Equal(t, http.StatusNotFound, doAdmin(srv, http.MethodPut, "/go-doudou/loggers/unknown", `{"level":"debug"}`, true).Code)
+
+	defer loglevel.SetLevel("rest", zerolog.InfoLevel)
+	rec = doAdmin(srv, http.MethodPut, "/go-doudou/loggers/rest", `{"level":"warn"}`, true)
+	require.Equal(t, http.StatusOK, rec.Code, "framework packages log by named loggers")
+	level, _ = loglevel.Level("rest")
+	assert.Equal(t, zerolog.WarnLevel, level)
+}
+
+func TestConfigRoute(t *testing.T) {
+	t.Setenv("GDD_TEST_ADMIN_PASS", "123456")
+	t.Setenv("GDD_TEST_ADMIN_NAME", "go-doudou")
+	srv := NewRestServer()
+	rec := doAdmin(srv, http.MethodGet, "/go-doudou/config?pre=GDD_TEST_ADMIN_", "", true)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var entries []config.Entry
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+	assert.Equal(t, []config.Entry{
+		{Key: "GDD_TEST_ADMIN_NAME", Value: "go-doudou", Source: config.SourceEnv},
+		{Key: "GDD_TEST_ADMIN_PASS", Value: config.MaskedValue, Source: config.SourceEnv},
+	}, entries)
+}
+
+func TestMiddlewareName(t *testing.T) {
+	assert.Equal(t, "rest.gzipBody", middlewareName(gzipBody))
+	assert.Equal(t, "rest.(*corsMiddleware).Middleware", middlewareName((&corsMiddleware{}).Middleware))
+	assert.Equal(t, "rest.deadlineWith", middlewareName(deadline(JSONErrorRenderer)))
+}
@@ -5,17 +5,33 @@ import (
 	"net/http"
 
 	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/errcode"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // BizError is used for business error implemented error interface
 // StatusCode will be set to http response status code
 // ErrCode is used for business error code
 // ErrMsg is custom error message
+// Type, Title, Instance, FieldErrors and Extensions are rendered as RFC 7807 members by ProblemJSONErrorRenderer
 type BizError struct {
 	StatusCode int
 	ErrCode    int
 	ErrMsg     string
 	Cause      error
+	// Type is a URI reference that identifies the problem type
+	Type string
+	// Title is a short, human-readable summary of the problem type
+	Title string
+	// Instance is a URI reference that identifies the specific occurrence of the problem
+	Instance    string
+	FieldErrors []FieldError
+	Extensions  map[string]interface{}
+	// Args are arguments of message template of ErrCode in errcode catalog
+	Args []interface{}
+	// coded indicates ErrMsg should be localised by errcode catalog
+	coded bool
 }
 
 type BizErrorOption func(bizError *BizError)
@@ -38,19 +54,99 @@ func WithCause(cause error) BizErrorOption {
 	}
 }
 
-// NewBizError is factory function for creating an instance of BizError struct
+func WithType(problemType string) BizErrorOption {
+	return func(bizError *BizError) {
+		bizError.Type = problemType
+	}
+}
+
+func WithTitle(title string) BizErrorOption {
+	return func(bizError *BizError) {
+		bizError.Title = title
+	}
+}
+
+func WithInstance(instance string) BizErrorOption {
+	return func(bizError *BizError) {
+		bizError.Instance = instance
+	}
+}
+
+func WithFieldErrors(fieldErrors ...FieldError) BizErrorOption {
+	return func(bizError *BizError) {
+		bizError.FieldErrors = append(bizError.FieldErrors, fieldErrors...)
+	}
+}
+
+// WithExtension adds an extension member to problem details document
+func WithExtension(key string, value interface{}) BizErrorOption {
+	return func(bizError *BizError) {
+		if bizError.Extensions == nil {
+			bizError.Extensions = make(map[string]interface{})
+		}
+		bizError.Extensions[key] = value
+	}
+}
+
+// NewBizError is factory function for creating an instance of BizError struct.
+// Field errors are taken from err if it is or wraps ValidationErrors.
 func NewBizError(err error, opts ...BizErrorOption) BizError {
 	bz := BizError{
 		ErrCode:    1,
 		StatusCode: http.StatusInternalServerError,
 		ErrMsg:     err.Error(),
 	}
+	var verrs ValidationErrors
+	if errors.As(err, &verrs) {
+		bz.FieldErrors = append(bz.FieldErrors, verrs...)
+	}
 	for _, fn := range opts {
 		fn(&bz)
 	}
 	return bz
 }
 
+// NewCodedError creates BizError from error definition of code registered in errcode catalog. Http status code is
+// taken from the definition, message is formatted from its template in default locale with args, and it will be
+// localised from Accept-Language request header by ErrorRenderer. If code has not been registered, http status code
+// is 500 and message is "error {code}".
+func NewCodedError(code int, args ...interface{}) BizError {
+	bz := BizError{
+		ErrCode:    code,
+		StatusCode: http.StatusInternalServerError,
+		ErrMsg:     fmt.Sprintf("error %d", code),
+		Args:       args,
+	}
+	if def, ok := errcode.Lookup(code); ok {
+		bz.StatusCode = def.HTTPStatus
+		bz.ErrMsg, _, _ = errcode.Localize(code, "", args...)
+		bz.coded = true
+	}
+	return bz
+}
+
+// Localize returns message in the locale best matching acceptLanguage for BizError created by NewCodedError,
+// otherwise ErrMsg
+func (b BizError) Localize(acceptLanguage string) string {
+	if !b.coded {
+		return b.ErrMsg
+	}
+	if message, _, ok := errcode.Localize(b.ErrCode, acceptLanguage, b.Args...); ok {
+		return message
+	}
+	return b.ErrMsg
+}
+
+// GRPCStatus converts BizError to gRPC status, status code is taken from errcode catalog if ErrCode has been registered,
+// otherwise codes.Unknown
+func (b BizError) GRPCStatus() *status.Status {
+	code := codes.Unknown
+	if def, ok := errcode.Lookup(b.ErrCode); ok {
+		code = def.GRPCCode
+	}
+	return status.New(code, b.ErrMsg)
+}
+
 // String function is used for printing string representation of a BizError instance
 func (b BizError) String() string {
 	if b.ErrCode > 0 {
@@ -0,0 +1,347 @@
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-msgpack/codec"
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/toolkit/stringutils"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	MIMEApplicationJSON     = "application/json"
+	MIMEApplicationMsgpack  = "application/msgpack"
+	MIMEApplicationCBOR     = "application/cbor"
+	MIMEApplicationProtobuf = "application/x-protobuf"
+)
+
+// ErrUnsupportedMediaType is returned if no codec is registered for content type of request body
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// Codec encodes and decodes request and response bodies of one media type
+type Codec interface {
+	// ContentType is value of Content-Type header of encoded bodies
+	ContentType() string
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
+// SelectiveCodec is implemented by codecs which can only encode some values, e.g. ProtobufCodec.
+// Response is encoded by the next acceptable codec if Supports returns false.
+type SelectiveCodec interface {
+	Codec
+	Supports(v interface{}) bool
+}
+
+var (
+	codecMu sync.RWMutex
+	codecs  = make(map[string]Codec)
+	// mediaTypes keeps registration order, aliases excluded
+	mediaTypes []string
+)
+
+func init() {
+	RegisterCodec(JSONCodec{})
+	RegisterCodec(MsgpackCodec{}, "application/x-msgpack", "application/vnd.msgpack")
+	RegisterCodec(CBORCodec{})
+	RegisterCodec(ProtobufCodec{}, "application/protobuf", "application/vnd.google.protobuf")
+}
+
+// mediaType returns lower cased media type of contentType without parameters
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	}
+	return strings.ToLower(mt)
+}
+
+// RegisterCodec registers codec for media type of its ContentType and aliases, so that generated handlers decode
+// request bodies of these types and encode responses in it if clients accept it. A codec registered for the same
+// media type before is replaced. It should be called before serving, e.g. in init function.
+func RegisterCodec(c Codec, aliases ...string) {
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	mt := mediaType(c.ContentType())
+	if _, ok := codecs[mt]; !ok {
+		mediaTypes = append(mediaTypes, mt)
+	}
+	codecs[mt] = c
+	for _, alias := range aliases {
+		codecs[mediaType(alias)] = c
+	}
+}
+
+// SupportedMediaTypes returns media types of registered codecs in registration order, json comes first
+func SupportedMediaTypes() []string {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	return append([]string(nil), mediaTypes...)
+}
+
+// LookupCodec returns codec for contentType, json codec is returned if contentType is empty
+func LookupCodec(contentType string) (Codec, error) {
+	if stringutils.IsEmpty(contentType) {
+		return JSONCodec{}, nil
+	}
+	codecMu.RLock()
+	c, ok := codecs[mediaType(contentType)]
+	codecMu.RUnlock()
+	if !ok {
+		return nil, errors.Wrap(ErrUnsupportedMediaType, contentType)
+	}
+	return c, nil
+}
+
+func supports(c Codec, v interface{}) bool {
+	if sc, ok := c.(SelectiveCodec); ok {
+		return sc.Supports(v)
+	}
+	return true
+}
+
+// DecodeBody decodes request body into v by codec of Content-Type header, json if the header is absent.
+// io.EOF is returned as is if the body is empty, errors wrapping ErrUnsupportedMediaType if no codec is registered
+// for the content type.
+func DecodeBody(r *http.Request, v interface{}) error {
+	c, err := LookupCodec(r.Header.Get(HeaderContentType))
+	if err != nil {
+		return err
+	}
+	if r.Body == nil {
+		return io.EOF
+	}
+	br := bufio.NewReader(r.Body)
+	if _, err = br.Peek(1); err != nil {
+		return err
+	}
+	return c.Decode(br, v)
+}
+
+// HandleDecodeBodyErr panics with 415 status code if err is returned by DecodeBody for unsupported content type,
+// or 400 for other errors
+func HandleDecodeBodyErr(err error) {
+	if errors.Is(err, ErrUnsupportedMediaType) {
+		panic(NewBizError(err, WithStatusCode(http.StatusUnsupportedMediaType)))
+	}
+	HandleBadRequestErr(err)
+}
+
+// Unmarshal decodes data into v by codec of contentType, json if contentType is empty or no codec is registered
+// for it, e.g. text/plain or application/problem+json responded by proxies and other frameworks.
+// Generated clients decode responses by it.
+func Unmarshal(contentType string, data []byte, v interface{}) error {
+	c, err := LookupCodec(contentType)
+	if err != nil {
+		c = JSONCodec{}
+	}
+	return c.Decode(bytes.NewReader(data), v)
+}
+
+// acceptItem is one media range of Accept header
+type acceptItem struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept returns media ranges of Accept header with positive quality sorted by quality
+func parseAccept(accept string) []acceptItem {
+	var items []acceptItem
+	for _, part := range strings.Split(accept, ",") {
+		if stringutils.IsEmpty(strings.TrimSpace(part)) {
+			continue
+		}
+		item := acceptItem{mediaType: mediaType(part), q: 1}
+		if _, params, err := mime.ParseMediaType(part); err == nil {
+			if q, ok := params["q"]; ok {
+				if f, err := strconv.ParseFloat(q, 64); err == nil {
+					item.q = f
+				}
+			}
+		}
+		if item.q > 0 {
+			items = append(items, item)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].q > items[j].q
+	})
+	return items
+}
+
+// NegotiateCodec returns the registered codec most preferred by Accept header of r which is able to encode v.
+// Json codec is returned if the header is absent, accepts any type, or accepts nothing registered.
+func NegotiateCodec(r *http.Request, v interface{}) Codec {
+	for _, item := range parseAccept(r.Header.Get(HeaderAccept)) {
+		if item.mediaType == "*/*" || item.mediaType == "application/*" || item.mediaType == MIMEApplicationJSON {
+			break
+		}
+		codecMu.RLock()
+		c, ok := codecs[item.mediaType]
+		codecMu.RUnlock()
+		if ok && supports(c, v) {
+			return c
+		}
+	}
+	return JSONCodec{}
+}
+
+// EncodeBody writes v to w by codec negotiated from Accept header of r and sets Content-Type header
+func EncodeBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	c := NegotiateCodec(r, v)
+	w.Header().Add(HeaderVary, HeaderAccept)
+	w.Header().Set(HeaderContentType, c.ContentType())
+	return c.Encode(w, v)
+}
+
+// JSONCodec is the default codec
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string {
+	return "application/json; charset=UTF-8"
+}
+
+func (JSONCodec) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (JSONCodec) Decode(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+var msgpackHandle = &codec.MsgpackHandle{
+	BasicHandle: codec.BasicHandle{
+		DecodeOptions: codec.DecodeOptions{
+			MapType:     reflect.TypeOf(map[string]interface{}(nil)),
+			RawToString: true,
+		},
+	},
+	WriteExt: true,
+}
+
+// MsgpackCodec encodes bodies in MessagePack, struct fields are named by codec tags or json tags
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) ContentType() string {
+	return MIMEApplicationMsgpack
+}
+
+func (MsgpackCodec) Encode(w io.Writer, v interface{}) error {
+	return codec.NewEncoder(w, msgpackHandle).Encode(v)
+}
+
+func (MsgpackCodec) Decode(r io.Reader, v interface{}) error {
+	return codec.NewDecoder(r, msgpackHandle).Decode(v)
+}
+
+var cborHandle = &codec.CborHandle{
+	BasicHandle: codec.BasicHandle{
+		DecodeOptions: codec.DecodeOptions{
+			MapType: reflect.TypeOf(map[string]interface{}(nil)),
+		},
+	},
+	TimeRFC3339: true,
+}
+
+// CBORCodec encodes bodies in CBOR, struct fields are named by codec tags or json tags
+type CBORCodec struct{}
+
+func (CBORCodec) ContentType() string {
+	return MIMEApplicationCBOR
+}
+
+func (CBORCodec) Encode(w io.Writer, v interface{}) error {
+	return codec.NewEncoder(w, cborHandle).Encode(v)
+}
+
+func (CBORCodec) Decode(r io.Reader, v interface{}) error {
+	return codec.NewDecoder(r, cborHandle).Decode(v)
+}
+
+// ProtobufCodec encodes proto messages in protobuf binary format. A struct with a single exported field holding
+// a proto message, e.g. anonymous struct wrapping the result of a generated handler, is encoded as the message.
+// Other values are not supported, they are responded in json.
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) ContentType() string {
+	return MIMEApplicationProtobuf
+}
+
+func (ProtobufCodec) Supports(v interface{}) bool {
+	return protoMessage(v, false) != nil
+}
+
+func (ProtobufCodec) Encode(w io.Writer, v interface{}) error {
+	m := protoMessage(v, false)
+	if m == nil {
+		return errors.Errorf("%T is not a proto message", v)
+	}
+	data, err := proto.Marshal(m)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (ProtobufCodec) Decode(r io.Reader, v interface{}) error {
+	m := protoMessage(v, true)
+	if m == nil {
+		return errors.Errorf("%T is not a proto message", v)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(proto.Unmarshal(data, m))
+}
+
+var protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+// protoMessage returns v if it is a proto message, or message held by the only exported field of struct v.
+// The field is allocated if it is nil and alloc is true, v should be a pointer in that case.
+func protoMessage(v interface{}, alloc bool) proto.Message {
+	if m, ok := v.(proto.Message); ok {
+		return m
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	var field reflect.Value
+	for i := 0; i < rv.NumField(); i++ {
+		if !rv.Type().Field(i).IsExported() {
+			continue
+		}
+		if field.IsValid() {
+			return nil
+		}
+		field = rv.Field(i)
+	}
+	if !field.IsValid() || field.Kind() != reflect.Ptr || !field.Type().Implements(protoMessageType) {
+		return nil
+	}
+	if field.IsNil() {
+		if !alloc || !field.CanSet() {
+			return nil
+		}
+		field.Set(reflect.New(field.Type().Elem()))
+	}
+	return field.Interface().(proto.Message)
+}
@@ -0,0 +1,128 @@
+package rest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type codecUser struct {
+	Name string   `json:"name"`
+	Age  int      `json:"age"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	in := codecUser{Name: "jack", Age: 18, Tags: []string{"a"}}
+	for _, mt := range []string{MIMEApplicationJSON, MIMEApplicationMsgpack, "application/x-msgpack", MIMEApplicationCBOR} {
+		c, err := LookupCodec(mt)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, c.Encode(&buf, in), mt)
+		var out codecUser
+		require.NoError(t, Unmarshal(c.ContentType(), buf.Bytes(), &out), mt)
+		assert.Equal(t, in, out, mt)
+	}
+}
+
+func TestCodec_MsgpackJsonTags(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, MsgpackCodec{}.Encode(&buf, codecUser{Name: "jack"}))
+	var out map[string]interface{}
+	require.NoError(t, MsgpackCodec{}.Decode(&buf, &out))
+	assert.Equal(t, "jack", out["name"], "field names follow json tags")
+	assert.NotContains(t, out, "tags")
+}
+
+func TestDecodeBody(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, CBORCodec{}.Encode(&buf, codecUser{Name: "jack", Age: 18}))
+	r := httptest.NewRequest(http.MethodPost, "/user", &buf)
+	r.Header.Set(HeaderContentType, MIMEApplicationCBOR)
+	var out codecUser
+	require.NoError(t, DecodeBody(r, &out))
+	assert.Equal(t, "jack", out.Name)
+
+	r = httptest.NewRequest(http.MethodPost, "/user", strings.NewReader(`{"name":"rose"}`))
+	require.NoError(t, DecodeBody(r, &out), "json is decoded without content type")
+	assert.Equal(t, "rose", out.Name)
+
+	r = httptest.NewRequest(http.MethodPost, "/user", strings.NewReader(""))
+	r.Header.Set(HeaderContentType, MIMEApplicationMsgpack)
+	assert.Equal(t, io.EOF, DecodeBody(r, &out))
+
+	r = httptest.NewRequest(http.MethodPost, "/user", strings.NewReader("name: jack"))
+	r.Header.Set(HeaderContentType, "application/yaml")
+	err := DecodeBody(r, &out)
+	assert.ErrorIs(t, err, ErrUnsupportedMediaType)
+	func() {
+		defer func() {
+			bizErr, ok := recover().(BizError)
+			assert.True(t, ok)
+			assert.Equal(t, http.StatusUnsupportedMediaType, bizErr.StatusCode)
+		}()
+		HandleDecodeBodyErr(err)
+	}()
+}
+
+func TestUnmarshal_UnknownContentType(t *testing.T) {
+	for _, ct := range []string{"text/plain; charset=utf-8", "application/problem+json", "application/yaml"} {
+		var out codecUser
+		require.NoError(t, Unmarshal(ct, []byte(`{"name":"jack"}`), &out), ct)
+		assert.Equal(t, "jack", out.Name, ct)
+	}
+	var out codecUser
+	assert.Error(t, Unmarshal("text/html", []byte("<html></html>"), &out), "bodies which are not json fail to decode")
+}
+
+func TestNegotiateCodec(t *testing.T) {
+	user := codecUser{Name: "jack"}
+	msg := wrapperspb.String("jack")
+	cases := []struct {
+		accept string
+		v      interface{}
+		want   Codec
+	}{
+		{"", user, JSONCodec{}},
+		{"*/*", user, JSONCodec{}},
+		{"application/msgpack", user, MsgpackCodec{}},
+		{"application/json;q=0.5, application/cbor", user, CBORCodec{}},
+		{"application/cbor;q=0, application/msgpack;q=0.1", user, MsgpackCodec{}},
+		{"text/html", user, JSONCodec{}},
+		{"application/x-protobuf, application/msgpack", user, MsgpackCodec{}},
+		{"application/x-protobuf", msg, ProtobufCodec{}},
+		{"application/protobuf", struct {
+			Data *wrapperspb.StringValue `json:"data"`
+		}{msg}, ProtobufCodec{}},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/user", nil)
+		r.Header.Set(HeaderAccept, c.accept)
+		assert.Equal(t, c.want, NegotiateCodec(r, c.v), c.accept)
+	}
+}
+
+func TestEncodeBody_Protobuf(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/user", nil)
+	r.Header.Set(HeaderAccept, MIMEApplicationProtobuf)
+	w := httptest.NewRecorder()
+	require.NoError(t, EncodeBody(w, r, struct {
+		Data *wrapperspb.StringValue `json:"data"`
+	}{wrapperspb.String("jack")}))
+	assert.Equal(t, MIMEApplicationProtobuf, w.Header().Get(HeaderContentType))
+	assert.Equal(t, HeaderAccept, w.Header().Get(HeaderVary))
+
+	var result struct {
+		Data *wrapperspb.StringValue `json:"data"`
+	}
+	require.NoError(t, Unmarshal(w.Header().Get(HeaderContentType), w.Body.Bytes(), &result))
+	assert.True(t, proto.Equal(wrapperspb.String("jack"), result.Data))
+}
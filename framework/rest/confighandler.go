@@ -1,16 +1,15 @@
 package rest
 
 import (
-	"fmt"
 	"net/http"
-	"os"
-	"strings"
 
-	"github.com/unionj-cloud/toolkit/stringutils"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
 )
 
 var ConfigRoutes = configRoutes
 
+// configRoutes returns effective configuration from environment variables with their sources, values of
+// secrets are masked. Query parameter pre filters variables by prefix, e.g. /go-doudou/config?pre=GDD_
 func configRoutes() []Route {
 	return []Route{
 		{
@@ -18,15 +17,7 @@ func configRoutes() []Route {
 			Method:  "GET",
 			Pattern: "/go-doudou/config",
 			HandlerFunc: func(_writer http.ResponseWriter, _req *http.Request) {
-				pre := _req.FormValue("pre")
-				var builder strings.Builder
-				for _, pair := range os.Environ() {
-					if stringutils.IsEmpty(pre) || strings.HasPrefix(pair, pre) {
-						builder.WriteString(fmt.Sprintf("%s\n", pair))
-					}
-				}
-				_writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
-				_writer.Write([]byte(builder.String()))
+				writeJSON(_writer, config.Entries(_req.FormValue("pre")))
 			},
 		},
 	}
@@ -0,0 +1,122 @@
+package rest
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/cors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/toolkit/cast"
+)
+
+// CorsConfig configures CORS of business routes
+type CorsConfig struct {
+	Enable bool
+	// AllowedOrigins are origins allowed to make cross-origin requests, an origin may contain one wildcard
+	// like https://*.example.com, * allows all origins
+	AllowedOrigins []string
+	// AllowedMethods are methods allowed in cross-origin requests
+	AllowedMethods []string
+	// AllowedHeaders are non-simple headers allowed in cross-origin requests, * allows all headers
+	AllowedHeaders []string
+	// ExposedHeaders are response headers exposed to browsers
+	ExposedHeaders []string
+	// AllowCredentials allows cross-origin requests to include cookies and authorization headers
+	AllowCredentials bool
+	// MaxAge is how long browsers can cache results of preflight requests, 0 means no Access-Control-Max-Age header
+	MaxAge time.Duration
+}
+
+// DefaultCorsConfig returns CorsConfig from GDD_CORS_* environment variables
+func DefaultCorsConfig() CorsConfig {
+	conf := CorsConfig{
+		Enable:           cast.ToBoolOrDefault(config.GddCorsEnable.Load(), config.DefaultGddCorsEnable),
+		AllowedOrigins:   splitList(config.GddCorsAllowedOrigins.LoadOrDefault(config.DefaultGddCorsAllowedOrigins)),
+		AllowedMethods:   splitList(config.GddCorsAllowedMethods.LoadOrDefault(config.DefaultGddCorsAllowedMethods)),
+		AllowedHeaders:   splitList(config.GddCorsAllowedHeaders.LoadOrDefault(config.DefaultGddCorsAllowedHeaders)),
+		ExposedHeaders:   splitList(config.GddCorsExposedHeaders.Load()),
+		AllowCredentials: cast.ToBoolOrDefault(config.GddCorsAllowCredentials.Load(), config.DefaultGddCorsAllowCredentials),
+	}
+	conf.MaxAge, _ = time.ParseDuration(config.DefaultGddCorsMaxAge)
+	if maxAge, err := time.ParseDuration(config.GddCorsMaxAge.Load()); err == nil {
+		conf.MaxAge = maxAge
+	}
+	return conf
+}
+
+// Options converts CorsConfig to cors.Options
+func (c CorsConfig) Options() cors.Options {
+	opts := cors.Options{
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowedMethods:   c.AllowedMethods,
+		AllowedHeaders:   c.AllowedHeaders,
+		ExposedHeaders:   c.ExposedHeaders,
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           int(c.MaxAge.Seconds()),
+	}
+	return opts
+}
+
+// Validate returns an error if c allows credentials from any origin, which would let any website read responses
+// to requests authenticated by cookies of its users
+func (c CorsConfig) Validate() error {
+	if !c.AllowCredentials {
+		return nil
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			return errors.New("CORS can't allow credentials from any origin, list allowed origins instead")
+		}
+	}
+	return nil
+}
+
+// corsMiddleware applies the latest CORS configuration, it passes requests through if CORS is disabled
+type corsMiddleware struct {
+	current atomic.Pointer[cors.Cors]
+}
+
+// update applies conf, the current configuration is kept if conf is invalid
+func (m *corsMiddleware) update(conf CorsConfig) error {
+	if !conf.Enable {
+		m.current.Store(nil)
+		return nil
+	}
+	if err := conf.Validate(); err != nil {
+		return err
+	}
+	m.current.Store(cors.New(conf.Options()))
+	return nil
+}
+
+func (m *corsMiddleware) Middleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := m.current.Load()
+		if c == nil {
+			inner.ServeHTTP(w, r)
+			return
+		}
+		c.ServeHTTP(w, r, inner.ServeHTTP)
+	})
+}
+
+// preflight handles OPTIONS requests to paths having no OPTIONS route, which never reach route middlewares
+func (m *corsMiddleware) preflight(w http.ResponseWriter, r *http.Request) {
+	if c := m.current.Load(); c != nil {
+		c.HandlerFunc(w, r)
+	}
+}
+
+// envCors is configured by GDD_CORS_* environment variables and updated by remote configuration changes
+var envCors = &corsMiddleware{}
+
+// reloadEnvCors applies GDD_CORS_* environment variables, CORS stays disabled or unchanged if they are invalid
+func reloadEnvCors() error {
+	if err := envCors.update(DefaultCorsConfig()); err != nil {
+		logger.Error().Err(err).Msg("[go-doudou] invalid CORS config is ignored")
+		return err
+	}
+	return nil
+}
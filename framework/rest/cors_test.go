@@ -0,0 +1,108 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/apolloconfig/agollo/v4/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCors(t *testing.T) {
+	t.Setenv("GDD_CORS_ENABLE", "true")
+	t.Setenv("GDD_CORS_ALLOWED_ORIGINS", "https://*.example.com")
+	t.Setenv("GDD_CORS_ALLOWED_HEADERS", "Authorization,Content-Type")
+	t.Setenv("GDD_CORS_EXPOSED_HEADERS", "X-Request-Id")
+	t.Setenv("GDD_CORS_ALLOW_CREDENTIALS", "true")
+	t.Setenv("GDD_CORS_MAX_AGE", "10m")
+	defer reloadEnvCors()
+
+	srv := NewRestServer()
+	srv.AddRoutes([]Route{
+		{
+			Name:    "GetUser",
+			Method:  http.MethodGet,
+			Pattern: "/user",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("go-doudou"))
+			},
+		},
+	})
+	do := func(method, origin string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/user", nil)
+		req.Header.Set("Origin", origin)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodGet, "https://app.example.com", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "X-Request-Id", rec.Header().Get("Access-Control-Expose-Headers"))
+
+	rec = do(http.MethodGet, "https://evil.com", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	rec = do(http.MethodOptions, "https://app.example.com", map[string]string{
+		"Access-Control-Request-Method":  http.MethodGet,
+		"Access-Control-Request-Headers": "Authorization",
+	})
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, http.MethodGet, rec.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Authorization", rec.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+
+	listener := NewHttpConfigListener()
+	listener.SkippedFirstEvent = true
+	listener.OnChange(&storage.ChangeEvent{
+		Changes: map[string]*storage.ConfigChange{
+			"gdd.cors.allowed.origins": {
+				OldValue:   "https://*.example.com",
+				NewValue:   "https://*.example.org",
+				ChangeType: storage.MODIFIED,
+			},
+		},
+	})
+	rec = do(http.MethodGet, "https://app.example.com", nil)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"), "remote config change takes effect")
+	rec = do(http.MethodGet, "https://app.example.org", nil)
+	assert.Equal(t, "https://app.example.org", rec.Header().Get("Access-Control-Allow-Origin"))
+
+	listener.OnChange(&storage.ChangeEvent{
+		Changes: map[string]*storage.ConfigChange{
+			"gdd.cors.enable": {
+				OldValue:   "true",
+				ChangeType: storage.DELETED,
+			},
+		},
+	})
+	rec = do(http.MethodGet, "https://app.example.org", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"), "CORS is disabled by default")
+}
+
+func TestCorsConfig_Validate(t *testing.T) {
+	conf := CorsConfig{Enable: true, AllowedOrigins: []string{"*"}, AllowCredentials: true}
+	assert.Error(t, conf.Validate(), "credentials from any origin")
+	assert.Panics(t, func() {
+		NewRestServerWithOptions(WithCors(conf))
+	})
+
+	m := &corsMiddleware{}
+	require.NoError(t, m.update(CorsConfig{Enable: true, AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true}))
+	current := m.current.Load()
+	assert.Error(t, m.update(conf))
+	assert.Same(t, current, m.current.Load(), "invalid config is not applied")
+
+	assert.NoError(t, CorsConfig{AllowedOrigins: []string{"*"}}.Validate())
+	assert.Equal(t, []string{"*"}, CorsConfig{AllowedOrigins: []string{"*"}}.Options().AllowedOrigins)
+}
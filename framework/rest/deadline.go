@@ -0,0 +1,123 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest/httprouter"
+	"github.com/unionj-cloud/toolkit/stringutils"
+)
+
+// TimeoutAnnotation bounds processing time of a route, e.g. @timeout(5s)
+const TimeoutAnnotation = "timeout"
+
+// ErrDeadlineExceeded is rendered with 504 Gateway Timeout when time budget of a request is exhausted
+var ErrDeadlineExceeded = errors.New("deadline exceeded")
+
+// FormatTimeout formats remaining time budget as value of X-Request-Timeout header in milliseconds
+func FormatTimeout(d time.Duration) string {
+	return strconv.FormatInt(d.Milliseconds(), 10)
+}
+
+// ParseTimeout parses value of X-Request-Timeout header in milliseconds
+func ParseTimeout(value string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s header %s", HeaderXRequestTimeout, value)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// RouteTimeout returns timeout set by @timeout annotation of the matched route, it is zero if there is none
+func RouteTimeout(r *http.Request) time.Duration {
+	name := httprouter.ParamsFromContext(r.Context()).MatchedRouteName()
+	if stringutils.IsEmpty(name) {
+		return 0
+	}
+	item, ok := framework.GetAnnotation(name, TimeoutAnnotation)
+	if !ok || len(item.Params) == 0 {
+		return 0
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(item.Params[0]))
+	if err != nil || d <= 0 {
+		logger.Warn().Err(err).Msgf("[go-doudou] invalid @%s on %s", TimeoutAnnotation, name)
+		return 0
+	}
+	return d
+}
+
+// Timeout cancels context of requests after timeout, or earlier if the caller has less time budget left in
+// X-Request-Timeout header. Handlers should pass the request context to downstream calls so that they stop
+// working once the caller has given up. 504 Gateway Timeout is written if the handler has written nothing
+// when the deadline is exceeded.
+func Timeout(timeout time.Duration) func(inner http.Handler) http.Handler {
+	return deadlineWith(JSONErrorRenderer, func(_ *http.Request) time.Duration {
+		return timeout
+	})
+}
+
+// deadline applies X-Request-Timeout header and @timeout annotations, it is added to RestServer by default
+func deadline(renderer ErrorRenderer) func(inner http.Handler) http.Handler {
+	return deadlineWith(renderer, RouteTimeout)
+}
+
+func deadlineWith(renderer ErrorRenderer, timeoutFn func(r *http.Request) time.Duration) func(inner http.Handler) http.Handler {
+	return func(inner http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := timeoutFn(r)
+			if value := r.Header.Get(HeaderXRequestTimeout); stringutils.IsNotEmpty(value) {
+				budget, err := ParseTimeout(value)
+				if err != nil {
+					renderer(w, r, NewBizError(err, WithStatusCode(http.StatusBadRequest)))
+					return
+				}
+				// the caller has already given up, don't waste resources on it
+				if budget <= 0 {
+					renderer(w, r, NewBizError(ErrDeadlineExceeded, WithStatusCode(http.StatusGatewayTimeout)))
+					return
+				}
+				if timeout <= 0 || budget < timeout {
+					timeout = budget
+				}
+			}
+			if timeout <= 0 {
+				inner.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			var written bool
+			ww := httpsnoop.Wrap(w, httpsnoop.Hooks{
+				WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+					return func(code int) {
+						written = true
+						next(code)
+					}
+				},
+				Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+					return func(b []byte) (int, error) {
+						written = true
+						return next(b)
+					}
+				},
+				ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+					return func(src io.Reader) (int64, error) {
+						written = true
+						return next(src)
+					}
+				},
+			})
+			inner.ServeHTTP(ww, r.WithContext(ctx))
+			if !written && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				renderer(w, r, NewBizError(ErrDeadlineExceeded, WithStatusCode(http.StatusGatewayTimeout)))
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+)
+
+func TestDeadline(t *testing.T) {
+	framework.RegisterAnnotationStore(framework.AnnotationStore{
+		"DeadlineSlow":  {{Name: TimeoutAnnotation, Params: []string{"20ms"}}},
+		"DeadlineLong":  {{Name: TimeoutAnnotation, Params: []string{"1h"}}},
+		"DeadlineWrong": {{Name: TimeoutAnnotation, Params: []string{"soon"}}},
+	})
+	var (
+		called    bool
+		remaining time.Duration
+		deadline  bool
+	)
+	record := func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		var d time.Time
+		d, deadline = r.Context().Deadline()
+		remaining = time.Until(d)
+	}
+	srv := NewRestServer()
+	srv.AddRoutes([]Route{
+		{
+			Name:    "DeadlineSlow",
+			Method:  http.MethodGet,
+			Pattern: "/slow",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			},
+		},
+		{
+			Name:    "DeadlineDownstream",
+			Method:  http.MethodGet,
+			Pattern: "/downstream",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				panic(errors.Wrap(context.DeadlineExceeded, "call downstream fail"))
+			},
+		},
+		{Name: "DeadlineLong", Method: http.MethodGet, Pattern: "/long", HandlerFunc: record},
+		{Name: "DeadlineWrong", Method: http.MethodGet, Pattern: "/wrong", HandlerFunc: record},
+		{Name: "DeadlineNone", Method: http.MethodGet, Pattern: "/none", HandlerFunc: record},
+	})
+	do := func(target, timeout string) *httptest.ResponseRecorder {
+		called, deadline = false, false
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if timeout != "" {
+			req.Header.Set(HeaderXRequestTimeout, timeout)
+		}
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("/slow", "")
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.Contains(t, rec.Body.String(), ErrDeadlineExceeded.Error())
+	assert.Equal(t, http.StatusGatewayTimeout, do("/downstream", "").Code)
+
+	rec = do("/none", "0")
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.False(t, called, "caller has already given up")
+	assert.Equal(t, http.StatusBadRequest, do("/none", "soon").Code)
+	assert.False(t, called)
+
+	require.Equal(t, http.StatusOK, do("/none", "").Code)
+	assert.False(t, deadline)
+	require.Equal(t, http.StatusOK, do("/none", "500").Code)
+	assert.True(t, deadline)
+	assert.InDelta(t, 500*time.Millisecond, remaining, float64(50*time.Millisecond))
+	require.Equal(t, http.StatusOK, do("/long", "500").Code)
+	assert.InDelta(t, 500*time.Millisecond, remaining, float64(50*time.Millisecond), "shorter budget of caller wins")
+	require.Equal(t, http.StatusOK, do("/long", "").Code)
+	assert.InDelta(t, time.Hour, remaining, float64(time.Second))
+	require.Equal(t, http.StatusOK, do("/wrong", "").Code)
+	assert.False(t, deadline, "invalid annotation is ignored")
+}
+
+func TestTimeout(t *testing.T) {
+	h := Timeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+			w.Write([]byte("go-doudou"))
+		}
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+}
+
+func TestParseTimeout(t *testing.T) {
+	d, err := ParseTimeout(FormatTimeout(1500 * time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, 1500*time.Millisecond, d)
+	_, err = ParseTimeout("1s")
+	assert.Error(t, err)
+}
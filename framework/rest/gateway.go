@@ -1,7 +1,11 @@
 package rest
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -9,15 +13,19 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru"
+	"github.com/pkg/errors"
 	"github.com/unionj-cloud/go-doudou/v2/framework/cache"
 	"github.com/unionj-cloud/go-doudou/v2/framework/config"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/etcd"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/memberlist"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/nacos"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/zk"
+	"github.com/unionj-cloud/toolkit/stringutils"
 	"github.com/wubin1989/nacos-sdk-go/v2/vo"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
@@ -26,6 +34,7 @@ import (
 const (
 	HeaderAccept              = "Accept"
 	HeaderAcceptEncoding      = "Accept-Encoding"
+	HeaderAcceptLanguage      = "Accept-Language"
 	HeaderAllow               = "Allow"
 	HeaderAuthorization       = "Authorization"
 	HeaderContentDisposition  = "Content-Disposition"
@@ -35,6 +44,10 @@ const (
 	HeaderCookie              = "Cookie"
 	HeaderSetCookie           = "Set-Cookie"
 	HeaderIfModifiedSince     = "If-Modified-Since"
+	HeaderIfNoneMatch         = "If-None-Match"
+	HeaderCacheControl        = "Cache-Control"
+	HeaderETag                = "ETag"
+	HeaderAge                 = "Age"
 	HeaderLastModified        = "Last-Modified"
 	HeaderLocation            = "Location"
 	HeaderUpgrade             = "Upgrade"
@@ -48,6 +61,7 @@ const (
 	HeaderXHTTPMethodOverride = "X-HTTP-Method-Override"
 	HeaderXRealIP             = "X-Real-IP"
 	HeaderXRequestID          = "X-Request-ID"
+	HeaderXRequestTimeout     = "X-Request-Timeout"
 	HeaderXRequestedWith      = "X-Requested-With"
 	HeaderServer              = "Server"
 	HeaderOrigin              = "Origin"
@@ -86,6 +100,20 @@ type ProxyConfig struct {
 
 	// ModifyResponse defines function to modify response from ProxyTarget.
 	ModifyResponse func(*http.Response) error
+
+	// Upstreams declares static upstreams which are not registered to any service registry,
+	// key is service name. If nil, it will be parsed from GDD_GATEWAY_UPSTREAMS environment variable.
+	// Static upstreams take precedence over service registries.
+	Upstreams map[string][]Upstream
+
+	// Router holds declarative routing rules. If nil, rules will be loaded from the file specified by GDD_GATEWAY_ROUTES_FILE
+	// and kept in sync with remote config center if GDD_GATEWAY_ROUTES_DATAID is set.
+	Router *ProxyRouter
+
+	// Policies declares timeout, retry and outlier ejection policy per service, key is service name.
+	// If nil, it will be parsed from GDD_GATEWAY_POLICIES environment variable.
+	// Services not declared use DefaultUpstreamPolicy.
+	Policies map[string]UpstreamPolicy
 }
 
 func captureTokens(pattern *regexp.Regexp, input string) *strings.Replacer {
@@ -116,6 +144,233 @@ func isWebSocket(r *http.Request) bool {
 	return strings.ToLower(upgrade) == "websocket"
 }
 
+func isEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get(HeaderAccept), "text/event-stream")
+}
+
+// providerKey identifies service provider of the specified version in ProviderStore
+func providerKey(serviceName, version string) string {
+	if stringutils.IsEmpty(version) {
+		return serviceName
+	}
+	return serviceName + "@" + version
+}
+
+type gateway struct {
+	ProxyConfig
+	staticProviders map[string]registry.IServiceProvider
+	defaultPolicy   UpstreamPolicy
+	outlier         *outlierDetector
+}
+
+// maxSelectAttempts limits how many times gateway asks service provider for an instance which is neither ejected nor tried
+const maxSelectAttempts = 16
+
+var errUpstreamStatus = errors.New("upstream responded with server error")
+
+type modifyResponseError struct {
+	error
+}
+
+func (g *gateway) policy(serviceName string) UpstreamPolicy {
+	if policy, ok := g.Policies[serviceName]; ok {
+		return policy
+	}
+	return g.defaultPolicy
+}
+
+// selectServer skips ejected and tried instances. If all instances are ejected, the first selected one is returned
+// to avoid rejecting all traffic to the service.
+func (g *gateway) selectServer(serviceName string, provider registry.IServiceProvider, tried map[string]bool) string {
+	var fallback string
+	for i := 0; i < maxSelectAttempts; i++ {
+		server := provider.SelectServer()
+		if stringutils.IsEmpty(server) {
+			break
+		}
+		if stringutils.IsEmpty(fallback) {
+			fallback = server
+		}
+		if tried[server] || g.outlier.ejected(serviceName, server) {
+			continue
+		}
+		return server
+	}
+	return fallback
+}
+
+func isRetryable(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	// request body cannot be replayed
+	return r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0
+}
+
+// proxyWithRetry forwards request to an instance of the service with timeout, retries idempotent request on another
+// instance on connection error or 5xx response, and reports result of each attempt to outlier detector.
+func (g *gateway) proxyWithRetry(w http.ResponseWriter, r *http.Request, serviceName string, provider registry.IServiceProvider, cfg ProxyConfig) {
+	policy := g.policy(serviceName)
+	retries := 0
+	if isRetryable(r) {
+		retries = policy.Retries
+	}
+	tried := make(map[string]bool)
+	for attempt := 0; ; attempt++ {
+		server := g.selectServer(serviceName, provider, tried)
+		parsed, err := url.Parse(server)
+		if stringutils.IsEmpty(server) || err != nil {
+			http.Error(w, fmt.Sprintf("available server for service %s not found", serviceName), http.StatusBadGateway)
+			return
+		}
+		tried[server] = true
+		last := attempt >= retries
+		var failed, retry bool
+		proxy := proxyHTTP(&ProxyTarget{
+			Name: serviceName,
+			URL:  parsed,
+		}, cfg)
+		errorHandler := proxy.ErrorHandler
+		modifyResponse := proxy.ModifyResponse
+		proxy.ModifyResponse = func(resp *http.Response) error {
+			if resp.StatusCode >= http.StatusInternalServerError {
+				failed = true
+				if !last {
+					return errUpstreamStatus
+				}
+			}
+			if modifyResponse != nil {
+				if err := modifyResponse(resp); err != nil {
+					return modifyResponseError{err}
+				}
+			}
+			return nil
+		}
+		proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+			var mre modifyResponseError
+			switch {
+			case errors.Is(err, errUpstreamStatus):
+				retry = true
+			case errors.As(err, &mre):
+				errorHandler(w, req, mre.error)
+			case r.Context().Err() != nil:
+				// client has gone away, it's not upstream's fault
+				errorHandler(w, req, err)
+			default:
+				failed = true
+				if !last {
+					retry = true
+					return
+				}
+				if errors.Is(err, context.DeadlineExceeded) {
+					http.Error(w, fmt.Sprintf("remote %s(%s) timeout after %s", serviceName, parsed.String(), policy.Timeout), http.StatusGatewayTimeout)
+					return
+				}
+				errorHandler(w, req, err)
+			}
+		}
+		req := r
+		cancel := func() {}
+		if policy.Timeout > 0 {
+			var ctx context.Context
+			ctx, cancel = context.WithTimeout(r.Context(), policy.Timeout)
+			req = r.WithContext(ctx)
+		}
+		proxy.ServeHTTP(w, req)
+		cancel()
+		if r.Context().Err() == nil {
+			g.outlier.report(serviceName, server, policy, failed)
+		}
+		if !retry {
+			return
+		}
+		gatewayRetries.WithLabelValues(serviceName).Inc()
+		logger.Debug().Msgf("[go-doudou] retry %s %s of service %s on another instance", r.Method, r.URL.Path, serviceName)
+	}
+}
+
+// provider looks up service provider of the specified version from static upstreams first, then from service registries.
+// Empty version means any version.
+func (g *gateway) provider(ctx context.Context, serviceName, version string) registry.IServiceProvider {
+	key := providerKey(serviceName, version)
+	if provider := g.staticProviders[key]; provider != nil {
+		return provider
+	}
+	var provider registry.IServiceProvider
+	modes := strings.Split(os.Getenv("GDD_SERVICE_DISCOVERY_MODE"), ",")
+	// TODO call Close method to release resource
+	for _, mode := range modes {
+		if provider != nil {
+			break
+		}
+		switch mode {
+		case constants.SD_NACOS:
+			cluster := config.GddNacosClusterName.LoadOrDefault(config.DefaultGddNacosClusterName)
+			group := config.GddNacosGroupName.LoadOrDefault(config.DefaultGddNacosGroupName)
+			_, err := nacos.NamingClient.GetService(vo.GetServiceParam{
+				Clusters:    []string{cluster},
+				ServiceName: serviceName,
+				GroupName:   group,
+			})
+			if err != nil {
+				continue
+			}
+			if value, ok := g.ProviderStore.Get(key); ok {
+				if provider, ok = value.(*nacos.WRRServiceProvider); ok {
+					break
+				}
+			}
+			provider = nacos.NewWRRServiceProvider(serviceName, nacos.WithNacosClusters([]string{cluster}), nacos.WithNacosGroupName(group),
+				nacos.WithNacosVersion(version))
+			g.ProviderStore.Add(key, provider)
+		case constants.SD_ETCD:
+			getResponse, err := etcd.EtcdCli.Get(ctx, serviceName+"/", clientv3.WithPrefix())
+			if err != nil || getResponse.Count == 0 {
+				continue
+			}
+			if value, ok := g.ProviderStore.Get(key); ok {
+				if provider, ok = value.(*etcd.SWRRServiceProvider); ok {
+					break
+				}
+			}
+			provider = etcd.NewSWRRServiceProvider(serviceName, etcd.WithVersion(version))
+			g.ProviderStore.Add(key, provider)
+		case constants.SD_ZK:
+			if value, ok := g.ProviderStore.Get(key); ok {
+				if provider, ok = value.(*zk.SWRRServiceProvider); ok {
+					break
+				}
+			}
+			group := config.GddServiceGroup.LoadOrDefault(config.DefaultGddServiceGroup)
+			zkVersion := version
+			if stringutils.IsEmpty(zkVersion) {
+				zkVersion = config.GddServiceVersion.LoadOrDefault(config.DefaultGddServiceVersion)
+			}
+			provider = zk.NewSWRRServiceProvider(zk.ServiceConfig{
+				Name:    serviceName,
+				Group:   group,
+				Version: zkVersion,
+			})
+			g.ProviderStore.Add(key, provider)
+		case constants.SD_MEMBERLIST:
+			if !memberlist.HasService(serviceName) {
+				continue
+			}
+			if value, ok := g.ProviderStore.Get(key); ok {
+				if provider, ok = value.(*memberlist.SWRRServiceProvider); ok {
+					break
+				}
+			}
+			provider = memberlist.NewSWRRServiceProvider(serviceName, memberlist.WithVersion(version))
+			g.ProviderStore.Add(key, provider)
+		default:
+		}
+	}
+	return provider
+}
+
 func Proxy(proxyConfig ProxyConfig) func(inner http.Handler) http.Handler {
 	if proxyConfig.ProviderStore == nil {
 		arc, _ := lru.NewARC(128)
@@ -124,92 +379,118 @@ func Proxy(proxyConfig ProxyConfig) func(inner http.Handler) http.Handler {
 	if proxyConfig.Transport == nil {
 		proxyConfig.Transport = http.DefaultTransport
 	}
+	if proxyConfig.Upstreams == nil {
+		upstreams, err := ParseUpstreams(config.GddGatewayUpstreams.LoadOrDefault(config.DefaultGddGatewayUpstreams))
+		if err != nil {
+			logger.Panic().Err(err).Msg("[go-doudou] failed to parse static upstreams")
+		}
+		proxyConfig.Upstreams = upstreams
+	}
+	if proxyConfig.Router == nil {
+		var routes []ProxyRoute
+		if file := config.GddGatewayRoutesFile.LoadOrDefault(config.DefaultGddGatewayRoutesFile); stringutils.IsNotEmpty(file) {
+			var err error
+			if routes, err = LoadProxyRoutesFromFile(file); err != nil {
+				logger.Panic().Err(err).Msgf("[go-doudou] failed to load routing rules from %s", file)
+			}
+		}
+		router, err := NewProxyRouter(routes)
+		if err != nil {
+			logger.Panic().Err(err).Msg("[go-doudou] invalid routing rules")
+		}
+		if dataId := config.GddGatewayRoutesDataId.LoadOrDefault(config.DefaultGddGatewayRoutesDataId); stringutils.IsNotEmpty(dataId) {
+			if err = router.ListenRemote(dataId); err != nil {
+				logger.Error().Err(err).Msgf("[go-doudou] failed to listen routing rules from %s", dataId)
+			}
+		}
+		proxyConfig.Router = router
+	}
+	defaultPolicy := DefaultUpstreamPolicy()
+	if proxyConfig.Policies == nil {
+		policies, err := ParsePolicies(config.GddGatewayPolicies.LoadOrDefault(config.DefaultGddGatewayPolicies), defaultPolicy)
+		if err != nil {
+			logger.Panic().Err(err).Msg("[go-doudou] failed to parse upstream policies")
+		}
+		proxyConfig.Policies = policies
+	}
+	g := &gateway{
+		ProxyConfig:     proxyConfig,
+		staticProviders: make(map[string]registry.IServiceProvider),
+		defaultPolicy:   defaultPolicy,
+		outlier:         newOutlierDetector(),
+	}
+	for name, upstreams := range proxyConfig.Upstreams {
+		g.staticProviders[name] = NewStaticServiceProvider(name, upstreams)
+		versions := make(map[string][]Upstream)
+		for _, upstream := range upstreams {
+			if stringutils.IsNotEmpty(upstream.Version) {
+				versions[upstream.Version] = append(versions[upstream.Version], upstream)
+			}
+		}
+		for version, items := range versions {
+			g.staticProviders[providerKey(name, version)] = NewStaticServiceProvider(name, items)
+		}
+	}
 	return func(inner http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if isWebSocket(r) || r.Header.Get(HeaderAccept) == "text/event-stream" {
-				http.Error(w, "not support", http.StatusBadGateway)
-				return
+			var serviceName, version string
+			route := proxyConfig.Router.match(r)
+			if route != nil {
+				split := route.pick()
+				serviceName, version = split.Service, split.Version
+			} else {
+				parts := strings.Split(r.URL.Path, "/")
+				if len(parts) <= 1 {
+					http.Error(w, "request url must be prefixed / + service name", http.StatusBadGateway)
+					return
+				}
+				serviceName = parts[1]
 			}
-			parts := strings.Split(r.URL.Path, "/")
-			if len(parts) <= 1 {
-				http.Error(w, "request url must be prefixed / + service name", http.StatusBadGateway)
+			provider := g.provider(r.Context(), serviceName, version)
+			if provider == nil {
+				http.Error(w, fmt.Sprintf("available server for service %s not found", providerKey(serviceName, version)), http.StatusBadGateway)
 				return
 			}
-			serviceName := parts[1]
-			modes := strings.Split(os.Getenv("GDD_SERVICE_DISCOVERY_MODE"), ",")
-			// TODO call Close method to release resource
-			var provider registry.IServiceProvider
-			for _, mode := range modes {
-				switch mode {
-				case constants.SD_NACOS:
-					cluster := config.GddNacosClusterName.LoadOrDefault(config.DefaultGddNacosClusterName)
-					group := config.GddNacosGroupName.LoadOrDefault(config.DefaultGddNacosGroupName)
-					_, err := nacos.NamingClient.GetService(vo.GetServiceParam{
-						Clusters:    []string{cluster},
-						ServiceName: serviceName,
-						GroupName:   group,
-					})
-					if err != nil {
-						continue
-					}
-					if value, ok := proxyConfig.ProviderStore.Get(serviceName); ok {
-						if provider, ok = value.(*nacos.WRRServiceProvider); ok {
-							break
+			cfg := proxyConfig
+			if route != nil {
+				route.rewrite(r)
+				if !route.ResponseHeaders.empty() {
+					modifyResponse := cfg.ModifyResponse
+					cfg.ModifyResponse = func(resp *http.Response) error {
+						route.ResponseHeaders.apply(resp.Header)
+						if modifyResponse != nil {
+							return modifyResponse(resp)
 						}
+						return nil
 					}
-					provider = nacos.NewWRRServiceProvider(serviceName, nacos.WithNacosClusters([]string{cluster}), nacos.WithNacosGroupName(group))
-					proxyConfig.ProviderStore.Add(serviceName, provider)
-				case constants.SD_ETCD:
-					getResponse, err := etcd.EtcdCli.Get(r.Context(), serviceName+"/", clientv3.WithPrefix())
-					if err != nil || getResponse.Count == 0 {
-						continue
-					}
-					if value, ok := proxyConfig.ProviderStore.Get(serviceName); ok {
-						if provider, ok = value.(*etcd.SWRRServiceProvider); ok {
-							break
-						}
-					}
-					provider = etcd.NewSWRRServiceProvider(serviceName)
-					proxyConfig.ProviderStore.Add(serviceName, provider)
-				case constants.SD_ZK:
-					if value, ok := proxyConfig.ProviderStore.Get(serviceName); ok {
-						if provider, ok = value.(*zk.SWRRServiceProvider); ok {
-							break
-						}
-					}
-					group := config.GddServiceGroup.LoadOrDefault(config.DefaultGddServiceGroup)
-					version := config.GddServiceVersion.LoadOrDefault(config.DefaultGddServiceVersion)
-					provider = zk.NewSWRRServiceProvider(zk.ServiceConfig{
-						Name:    serviceName,
-						Group:   group,
-						Version: version,
-					})
-					proxyConfig.ProviderStore.Add(serviceName, provider)
-				default:
 				}
-				if provider != nil {
-					break
+			} else {
+				k := regexp.MustCompile(strings.Replace(fmt.Sprintf("/%s/*", serviceName), "*", "(\\S*)", -1))
+				replacer := captureTokens(k, getPath(r))
+				if replacer != nil {
+					r.URL.Path = replacer.Replace("/$1")
 				}
 			}
-			if provider == nil {
-				http.Error(w, fmt.Sprintf("available server for service %s not found", serviceName), http.StatusBadGateway)
+			if !isWebSocket(r) && !isEventStream(r) {
+				g.proxyWithRetry(w, r, serviceName, provider, cfg)
 				return
 			}
-			k := regexp.MustCompile(strings.Replace(fmt.Sprintf("/%s/*", serviceName), "*", "(\\S*)", -1))
-			replacer := captureTokens(k, getPath(r))
-			if replacer != nil {
-				r.URL.Path = replacer.Replace("/$1")
-			}
-			parsed, err := url.Parse(provider.SelectServer())
-			if err != nil {
-				http.Error(w, fmt.Sprintf("available server for service %s not found with error: %s", serviceName, err), http.StatusBadGateway)
+			// long-lived connections are neither timed out nor retried
+			server := g.selectServer(serviceName, provider, nil)
+			parsed, err := url.Parse(server)
+			if stringutils.IsEmpty(server) || err != nil {
+				http.Error(w, fmt.Sprintf("available server for service %s not found", serviceName), http.StatusBadGateway)
 				return
 			}
 			tgt := &ProxyTarget{
 				Name: serviceName,
 				URL:  parsed,
 			}
-			proxyHTTP(tgt, proxyConfig).ServeHTTP(w, r)
+			if isWebSocket(r) {
+				proxyRaw(tgt, cfg).ServeHTTP(w, r)
+			} else {
+				proxySSE(tgt, cfg).ServeHTTP(w, r)
+			}
 		})
 	}
 }
@@ -226,7 +507,7 @@ func singleJoiningSlash(a, b string) string {
 	return a + b
 }
 
-func proxyHTTP(tgt *ProxyTarget, config ProxyConfig) http.Handler {
+func proxyHTTP(tgt *ProxyTarget, config ProxyConfig) *httputil.ReverseProxy {
 	target := tgt.URL
 	targetQuery := target.RawQuery
 	director := func(req *http.Request) {
@@ -257,3 +538,112 @@ func proxyHTTP(tgt *ProxyTarget, config ProxyConfig) http.Handler {
 	proxy.ModifyResponse = config.ModifyResponse
 	return proxy
 }
+
+// proxySSE streams Server-Sent Events from upstream, each event is flushed to client immediately
+func proxySSE(tgt *ProxyTarget, config ProxyConfig) http.Handler {
+	proxy := proxyHTTP(tgt, config)
+	proxy.FlushInterval = -1
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// event stream is long-lived, so server write timeout should not apply
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			logger.Debug().Err(err).Msg("[go-doudou] failed to clear write deadline for event stream")
+		}
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+// proxyRaw tunnels WebSocket connection to upstream. It dials upstream first, forwards the upgrade request,
+// then hijacks client connection and copies frames bidirectionally until either side closes.
+func proxyRaw(tgt *ProxyTarget, config ProxyConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		out, err := dialUpstream(r.Context(), tgt.URL, config.Transport)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("remote %s(%s) unreachable, could not forward: %v", tgt.Name, tgt.URL.String(), err), http.StatusBadGateway)
+			return
+		}
+		defer out.Close()
+
+		// http.ResponseController unwraps response writers of middlewares which implement Unwrap
+		in, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("proxy raw, hijack error=%v", err), http.StatusBadGateway)
+			return
+		}
+		defer in.Close()
+		// hijacked connection keeps deadlines set by http.Server
+		_ = in.SetDeadline(time.Time{})
+
+		r.URL.Scheme = tgt.URL.Scheme
+		r.URL.Host = tgt.URL.Host
+		r.URL.Path = singleJoiningSlash(tgt.URL.Path, r.URL.Path)
+		r.Host = tgt.URL.Host
+		if clientIP, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			if prior := r.Header.Get(HeaderXForwardedFor); prior != "" {
+				clientIP = prior + ", " + clientIP
+			}
+			r.Header.Set(HeaderXForwardedFor, clientIP)
+		}
+		if err = r.Write(out); err != nil {
+			logger.Error().Err(err).Msgf("[go-doudou] proxy raw, request header copy error to %s", tgt.URL.String())
+			return
+		}
+
+		errCh := make(chan error, 2)
+		cp := func(dst io.Writer, src io.Reader) {
+			_, err := io.Copy(dst, src)
+			errCh <- err
+		}
+		// brw.Reader may have buffered bytes sent by client right after the upgrade request
+		go cp(out, brw.Reader)
+		go cp(in, out)
+		if err = <-errCh; err != nil && !errors.Is(err, net.ErrClosed) {
+			logger.Debug().Err(err).Msgf("[go-doudou] proxy raw, copy body error to %s", tgt.URL.String())
+		}
+	})
+}
+
+// dialUpstream opens a tcp connection or a tls connection for https and wss upstream.
+// If transport is *http.Transport, its DialContext and TLSClientConfig will be reused.
+func dialUpstream(ctx context.Context, target *url.URL, transport http.RoundTripper) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	dial := dialer.DialContext
+	var tlsConfig *tls.Config
+	if t, ok := transport.(*http.Transport); ok {
+		if t.DialContext != nil {
+			dial = t.DialContext
+		}
+		if t.TLSClientConfig != nil {
+			tlsConfig = t.TLSClientConfig.Clone()
+		}
+	}
+	addr := target.Host
+	secure := target.Scheme == "https" || target.Scheme == "wss"
+	if target.Port() == "" {
+		if secure {
+			addr = net.JoinHostPort(target.Hostname(), "443")
+		} else {
+			addr = net.JoinHostPort(target.Hostname(), "80")
+		}
+	}
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil || !secure {
+		return conn, err
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = target.Hostname()
+	}
+	// websocket upgrade only works over http/1.1
+	tlsConfig.NextProtos = []string{"http/1.1"}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
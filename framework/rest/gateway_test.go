@@ -0,0 +1,129 @@
+package rest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newEchoUpgradeServer returns an upstream which accepts any upgrade request and echoes back every line it receives
+func newEchoUpgradeServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isWebSocket(r) {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nX-Upstream-Path: %s\r\n\r\n", r.URL.Path)
+		brw.Flush()
+		for {
+			line, err := brw.ReadString('\n')
+			if err != nil {
+				return
+			}
+			brw.WriteString("echo: " + line)
+			brw.Flush()
+		}
+	}))
+}
+
+func TestProxyRaw(t *testing.T) {
+	upstream := newEchoUpgradeServer(t)
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = "/ws"
+		proxyRaw(&ProxyTarget{Name: "echo", URL: target}, ProxyConfig{Transport: http.DefaultTransport}).ServeHTTP(w, r)
+	}))
+	defer gateway.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(gateway.URL, "http://"))
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprintf(conn, "GET /echo/ws HTTP/1.1\r\nHost: gateway\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "/ws", resp.Header.Get("X-Upstream-Path"))
+
+	for _, msg := range []string{"hello", "world"} {
+		fmt.Fprintf(conn, "%s\n", msg)
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "echo: "+msg+"\n", line)
+	}
+}
+
+func TestProxyRaw_UpstreamUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+	target, _ := url.Parse("http://" + addr)
+
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set(HeaderUpgrade, "websocket")
+	rec := httptest.NewRecorder()
+	proxyRaw(&ProxyTarget{Name: "echo", URL: target}, ProxyConfig{Transport: http.DefaultTransport}).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+}
+
+func TestProxySSE(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HeaderContentType, "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		// the second event is held until client has received the first one
+		<-release
+		fmt.Fprint(w, "data: second\n\n")
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+
+	gateway := httptest.NewServer(proxySSE(&ProxyTarget{Name: "sse", URL: target}, ProxyConfig{Transport: http.DefaultTransport}))
+	defer gateway.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, gateway.URL+"/events", nil)
+	req.Header.Set(HeaderAccept, "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	done := make(chan string)
+	go func() {
+		line, _ := reader.ReadString('\n')
+		done <- line
+	}()
+	select {
+	case line := <-done:
+		assert.Equal(t, "data: first\n", line)
+	case <-time.After(5 * time.Second):
+		t.Fatal("first event was not flushed by gateway")
+	}
+	close(release)
+	rest, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "\ndata: second\n\n", string(rest))
+}
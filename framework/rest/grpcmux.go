@@ -0,0 +1,65 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// WithGrpcServer serves grpc requests on the listeners of the http server, so that rest and grpc share one port.
+// Requests over HTTP/2 whose content type is application/grpc are passed to grpcServer, other requests are routed
+// as usual. Cleartext HTTP/2 (h2c) is enabled if tls is not configured, so grpc clients connect with insecure
+// credentials. Only one rest address flagged by protocol metadata is registered to service registry, grpc clients
+// resolve it by the rest service name, see registry.NewMux. GDD_READTIMEOUT and GDD_WRITETIMEOUT don't apply to
+// grpc calls, so streaming calls may last longer, use deadlines of grpc clients instead. grpcServer is drained
+// with the http server, it should not be run by itself.
+func WithGrpcServer(grpcServer *grpcx.GrpcServer) ServerOption {
+	return func(server *RestServer) {
+		server.grpcServer = grpcServer
+	}
+}
+
+// isGrpcRequest reports whether r is a grpc call
+func isGrpcRequest(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// serveGrpc enables HTTP/2 and routes grpc calls to the grpc server
+func (srv *RestServer) serveGrpc() {
+	h2s := &http2.Server{
+		IdleTimeout: srv.IdleTimeout,
+	}
+	tlsConfig := srv.TLSConfig
+	// connections receive GOAWAY when the http server shuts down
+	if err := http2.ConfigureServer(srv.Server, h2s); err != nil {
+		logger.Panic().Err(err).Msg("[go-doudou] failed to enable http2")
+	}
+	// ConfigureServer creates TLSConfig if it is nil, https is served only if TLSConfig is set
+	srv.TLSConfig = tlsConfig
+	grpcHandler := srv.grpcServer.HTTPHandler()
+	next := srv.Server.Handler
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isGrpcRequest(r) {
+			// deadlines set by the http server from its timeouts would reset streams running longer
+			rc := http.NewResponseController(w)
+			if err := rc.SetReadDeadline(time.Time{}); err != nil {
+				logger.Debug().Err(err).Msg("[go-doudou] failed to clear read deadline of grpc call")
+			}
+			if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+				logger.Debug().Err(err).Msg("[go-doudou] failed to clear write deadline of grpc call")
+			}
+			grpcHandler.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+	if tlsConfig == nil {
+		handler = h2c.NewHandler(handler, h2s)
+	}
+	srv.Server.Handler = handler
+	logger.Info().Msg("Grpc server is served on the same port as http server")
+}
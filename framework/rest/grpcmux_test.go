@@ -0,0 +1,103 @@
+package rest
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestWithGrpcServer(t *testing.T) {
+	srv := NewRestServerWithOptions(WithGrpcServer(grpcx.NewGrpcServer()))
+	srv.AddRoute(Route{
+		Name:    "MuxPing",
+		Method:  http.MethodGet,
+		Pattern: "/mux/ping",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("pong"))
+		},
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv.Serve(ln)
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/mux/ping")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(body), "http/1.1 requests are routed as usual")
+
+	conn, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	lifecycle.SetReady(true)
+	defer lifecycle.SetReady(false)
+	client := healthpb.NewHealthClient(conn)
+	check, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err, "grpc calls are served on the same port over h2c")
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check.Status)
+
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer drainCancel()
+	require.NoError(t, srv.Drain(drainCtx), "watch streams don't block draining")
+	_, err = net.DialTimeout("tcp", ln.Addr().String(), time.Second)
+	assert.Error(t, err, "listener is closed")
+}
+
+func TestWithGrpcServer_WriteTimeout(t *testing.T) {
+	srv := NewRestServerWithOptions(WithGrpcServer(grpcx.NewGrpcServer()))
+	srv.WriteTimeout = 100 * time.Millisecond
+	srv.ReadTimeout = 100 * time.Millisecond
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv.Serve(ln)
+
+	conn, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	lifecycle.SetReady(true)
+	defer lifecycle.SetReady(false)
+	stream, err := healthpb.NewHealthClient(conn).Watch(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	check, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check.Status)
+
+	time.Sleep(300 * time.Millisecond)
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer drainCancel()
+	require.NoError(t, srv.Drain(drainCtx))
+	check, err = stream.Recv()
+	require.NoError(t, err, "streams outlive write timeout of the http server")
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check.Status)
+}
+
+func TestIsGrpcRequest(t *testing.T) {
+	r, _ := http.NewRequest(http.MethodPost, "/grpc.health.v1.Health/Check", nil)
+	r.Header.Set("Content-Type", "application/grpc+proto")
+	assert.False(t, isGrpcRequest(r), "grpc is served over http2 only")
+	r.ProtoMajor = 2
+	assert.True(t, isGrpcRequest(r))
+	r.Header.Set("Content-Type", "application/json")
+	assert.False(t, isGrpcRequest(r))
+}
@@ -0,0 +1,42 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/health"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
+)
+
+func writeHealthReport(w http.ResponseWriter, report health.Report) {
+	w.Header().Set(HeaderContentType, "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if !report.Up() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// healthRoutes returns liveness and readiness probe routes, they respond 200 if the report is UP, otherwise 503.
+// They are not protected by basic auth for being called by kubelet. Readiness follows lc which manages the server.
+func healthRoutes(lc *lifecycle.Lifecycle) []Route {
+	return []Route{
+		{
+			Name:    "GetHealthLive",
+			Method:  http.MethodGet,
+			Pattern: gddPathPrefix + "health/live",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				writeHealthReport(w, health.Live(r.Context()))
+			},
+		},
+		{
+			Name:    "GetHealthReady",
+			Method:  http.MethodGet,
+			Pattern: gddPathPrefix + "health/ready",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				writeHealthReport(w, health.ReadyOf(r.Context(), lc))
+			},
+		},
+	}
+}
@@ -0,0 +1,58 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/health"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
+)
+
+func TestHealthRoutes(t *testing.T) {
+	srv := NewRestServer()
+	get := func(path string) (*httptest.ResponseRecorder, health.Report) {
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var report health.Report
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+		return rec, report
+	}
+
+	rec, report := get("/go-doudou/health/live")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	assert.True(t, report.Up())
+
+	lifecycle.SetReady(true)
+	defer lifecycle.SetReady(false)
+	rec, report = get("/go-doudou/health/ready")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, report.Up())
+
+	health.Register("redis", health.CheckerFunc(func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}))
+	defer health.Unregister("redis")
+	rec, report = get("/go-doudou/health/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, health.StatusDown, report.Status)
+	assert.Equal(t, "connection refused", report.Checks["redis"].Error)
+}
+
+func TestHealthRoutes_Lifecycle(t *testing.T) {
+	lc := lifecycle.New()
+	srv := NewRestServerWithOptions(WithLifecycle(lc))
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/go-doudou/health/ready", nil))
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, ready())
+	lc.SetReady(true)
+	assert.Equal(t, http.StatusOK, ready(), "readiness follows the lifecycle of the server")
+}
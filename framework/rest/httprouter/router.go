@@ -139,6 +139,17 @@ func (ps Params) MatchedRouteName() string {
 	return ps.ByName(MatchedRouteNameParam)
 }
 
+// MatchedRoutePathParam is the Param name under which the path of the matched
+// route is stored, if Router.SaveMatchedRoutePath is set.
+var MatchedRoutePathParam = "$matchedRoutePath"
+
+// MatchedRoutePath retrieves the path template of the matched route like /users/:id.
+// Router.SaveMatchedRoutePath must have been enabled when the respective
+// handler was added, otherwise this function always returns an empty string.
+func (ps Params) MatchedRoutePath() string {
+	return ps.ByName(MatchedRoutePathParam)
+}
+
 // Router is a http.Handler which can be used to dispatch requests to different
 // handler functions via configurable routes
 type Router struct {
@@ -220,7 +231,7 @@ func New() *Router {
 		r.dynamicHandlers[i] = make(map[*urlpath.Path]Handle)
 	}
 	r.paramsPool.New = func() interface{} {
-		ps := make(Params, 0, 1)
+		ps := make(Params, 0, 2)
 		return &ps
 	}
 	return r
@@ -242,16 +253,17 @@ func (r *Router) putParams(ps *Params) {
 	}
 }
 
-func (r *Router) saveMatchedRoutePath(name string, handle Handle) Handle {
+func (r *Router) saveMatchedRoutePath(name, path string, handle Handle) Handle {
 	return func(w http.ResponseWriter, req *http.Request, ps Params) {
 		if ps == nil {
 			psp := r.getParams()
-			ps = (*psp)[0:1]
+			ps = (*psp)[0:2]
 			ps[0] = Param{Key: MatchedRouteNameParam, Value: name}
+			ps[1] = Param{Key: MatchedRoutePathParam, Value: path}
 			handle(w, req, ps)
 			r.putParams(psp)
 		} else {
-			ps = append(ps, Param{Key: MatchedRouteNameParam, Value: name})
+			ps = append(ps, Param{Key: MatchedRouteNameParam, Value: name}, Param{Key: MatchedRoutePathParam, Value: path})
 			handle(w, req, ps)
 		}
 	}
@@ -365,7 +377,7 @@ func (r *Router) Handle(method, path string, handle Handle, name ...string) {
 		if len(name) == 0 {
 			panic("route name must not be nil")
 		}
-		handle = r.saveMatchedRoutePath(name[0], handle)
+		handle = r.saveMatchedRoutePath(name[0], path, handle)
 	}
 	key := path2key(method, path)
 	// later registered rest handler will replace previous one
@@ -4,30 +4,22 @@ import (
 	"context"
 	"crypto/subtle"
 	"fmt"
-	"io"
 	"net/http"
-	"net/http/httptest"
-	"net/url"
-	"os"
 	"runtime/debug"
 	"strings"
 	"time"
 
 	"github.com/apolloconfig/agollo/v4/storage"
-	"github.com/ascarter/requestid"
 	"github.com/bytedance/sonic"
 	"github.com/felixge/httpsnoop"
 	"github.com/klauspost/compress/gzip"
-	"github.com/opentracing-contrib/go-stdlib/nethttp"
-	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/slok/goresilience"
 	"github.com/slok/goresilience/bulkhead"
-	"github.com/uber/jaeger-client-go"
 	"github.com/unionj-cloud/go-doudou/v2/framework/config"
 	"github.com/unionj-cloud/go-doudou/v2/framework/configmgr"
 	"github.com/unionj-cloud/toolkit/stringutils"
-	logger "github.com/unionj-cloud/toolkit/zlogger"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 var json = sonic.ConfigDefault
@@ -55,12 +47,24 @@ func (c *httpConfigListener) OnChange(event *storage.ChangeEvent) {
 		c.SkippedFirstEvent = true
 		return
 	}
+	var corsChanged bool
 	for key, value := range event.Changes {
 		upperKey := strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
 		if strings.HasPrefix(upperKey, "GDD_MANAGE_") {
-			_ = os.Setenv(upperKey, fmt.Sprint(value.NewValue))
+			_ = config.SetRemote(upperKey, fmt.Sprint(value.NewValue))
+		}
+		if strings.HasPrefix(upperKey, "GDD_CORS_") {
+			if value.ChangeType == storage.DELETED {
+				_ = config.UnsetRemote(upperKey)
+			} else {
+				_ = config.SetRemote(upperKey, fmt.Sprint(value.NewValue))
+			}
+			corsChanged = true
 		}
 	}
+	if corsChanged && reloadEnvCors() == nil {
+		logger.Info().Msg("[go-doudou] CORS config reloaded")
+	}
 }
 
 func CallbackOnChange(listener *httpConfigListener) func(event *configmgr.NacosChangeEvent) {
@@ -122,65 +126,9 @@ func metrics(inner http.Handler) http.Handler {
 	})
 }
 
-// log logs http request body and response body for debugging
+// log logs request and response by AccessLog middleware configured from environment variables
 func log(inner http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var (
-			reqBodyCopy io.ReadCloser
-			err         error
-			traceId     string
-		)
-		if reqBodyCopy, r.Body, err = CopyReqBody(r.Body); err != nil {
-			logger.Error().Err(err).Msg("call copyReqBody(r.Body) error")
-		}
-
-		rec := httptest.NewRecorder()
-		start := time.Now()
-		inner.ServeHTTP(rec, r)
-		elapsed := time.Since(start)
-		reqBody := GetReqBody(reqBodyCopy, r)
-		rid, _ := requestid.FromContext(r.Context())
-		span := opentracing.SpanFromContext(r.Context())
-		if jspan, ok := span.(*jaeger.Span); ok {
-			traceId = jspan.SpanContext().TraceID().String()
-		}
-		respBody := GetRespBody(rec)
-		reqQuery := r.URL.RawQuery
-		if unescape, err := url.QueryUnescape(reqQuery); err == nil {
-			reqQuery = unescape
-		}
-		fields := map[string]interface{}{
-			"remoteAddr":        r.RemoteAddr,
-			"httpMethod":        r.Method,
-			"requestUrl":        r.URL.String(),
-			"proto":             r.Proto,
-			"host":              r.Host,
-			"reqContentLength":  r.ContentLength,
-			"reqHeader":         r.Header,
-			"requestId":         rid,
-			"reqQuery":          reqQuery,
-			"reqBody":           reqBody,
-			"respBody":          respBody,
-			"statusCode":        rec.Result().StatusCode,
-			"respHeader":        rec.Result().Header,
-			"respContentLength": rec.Body.Len(),
-			"elapsedTime":       elapsed.String(),
-			"elapsed":           elapsed.Milliseconds(),
-			"span":              span,
-			"traceId":           traceId,
-		}
-		var reqLog string
-		if reqLog, err = JsonMarshalIndent(fields, "", "    ", true); err != nil {
-			reqLog = fmt.Sprintf("call jsonMarshalIndent(fields, \"\", \"    \", true) error: %s", err)
-		}
-		logger.Info().Fields(fields).Msg(reqLog)
-		header := rec.Result().Header
-		for k, v := range header {
-			w.Header()[k] = v
-		}
-		w.WriteHeader(rec.Result().StatusCode)
-		rec.Body.WriteTo(w)
-	})
+	return AccessLog(DefaultAccessLogConfig())(inner)
 }
 
 // rest set Content-Type to application/json
@@ -219,44 +167,30 @@ func basicAuth() func(inner http.Handler) http.Handler {
 
 // recovery handles panic from processing incoming http request
 func recovery(inner http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer func() {
-			if e := recover(); e != nil {
-				statusCode := http.StatusInternalServerError
-				errCode := 1 // 1 indicates there is an error
-				message := fmt.Sprintf("%v", e)
-				if err, ok := e.(error); ok {
-					switch {
-					case errors.Is(err, context.Canceled):
-						statusCode = http.StatusBadRequest
-					default:
-						var bizError BizError
-						if errors.As(err, &bizError) {
-							statusCode = bizError.StatusCode
-							errCode = bizError.ErrCode
-							message = bizError.Error()
-						}
+	return recoveryWith(JSONErrorRenderer)(inner)
+}
+
+// recoveryWith recovers from panic and writes the error to response by renderer
+func recoveryWith(renderer ErrorRenderer) func(inner http.Handler) http.Handler {
+	return func(inner http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, rc := withRecoveryContext(r)
+			defer func() {
+				if e := recover(); e != nil {
+					logger.Error().Msgf("panic: %+v\n\nstacktrace from panic: %s\n", e, string(debug.Stack()))
+					err, ok := e.(error)
+					if !ok {
+						err = errors.New(fmt.Sprintf("%v", e))
 					}
+					if rc.ctx != nil {
+						r = r.WithContext(rc.ctx)
+					}
+					renderer(w, r, err)
 				}
-				w.WriteHeader(statusCode)
-				if stringutils.IsEmpty(message) {
-					message = http.StatusText(statusCode)
-				}
-				logger.Error().Msgf("panic: %+v\n\nstacktrace from panic: %s\n", e, string(debug.Stack()))
-				if _err := json.NewEncoder(w).Encode(struct {
-					Code    int    `json:"code"`
-					Message string `json:"message"`
-				}{
-					Code:    errCode,
-					Message: message,
-				}); _err != nil {
-					http.Error(w, _err.Error(), http.StatusInternalServerError)
-					return
-				}
-			}
-		}()
-		inner.ServeHTTP(w, r)
-	})
+			}()
+			inner.ServeHTTP(w, r)
+		})
+	}
 }
 
 // gzipBody handles gzip-ed request body
@@ -276,12 +210,16 @@ func gzipBody(inner http.Handler) http.Handler {
 	})
 }
 
-// tracing add jaeger tracing middleware
+// tracing add OpenTelemetry tracing middleware, span context is extracted from
+// W3C traceparent and baggage headers by the global propagator
 func tracing(inner http.Handler) http.Handler {
-	return nethttp.Middleware(
-		opentracing.GlobalTracer(),
-		inner,
-		nethttp.OperationNameFunc(func(r *http.Request) string {
+	return otelhttp.NewHandler(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			captureRecoveryContext(r)
+			inner.ServeHTTP(w, r)
+		}),
+		"",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
 			return fmt.Sprintf("HTTP %s: %s", r.Method, r.URL.Path)
 		}))
 }
@@ -291,6 +229,9 @@ var RunnerChain = goresilience.RunnerChain
 // BulkHead add bulk head pattern middleware based on https://github.com/slok/goresilience
 // workers is the number of workers in the execution pool.
 // maxWaitTime is the max time an incoming request will wait to execute before being dropped its execution and return 429 response.
+//
+// Deprecated: a fixed number of workers is either over-provisioned or sheds too early,
+// use concurrencylimit.Middleware which adjusts the limit by observed latency instead
 func BulkHead(workers int, maxWaitTime time.Duration) func(inner http.Handler) http.Handler {
 	runner := RunnerChain(
 		bulkhead.NewMiddleware(bulkhead.Config{
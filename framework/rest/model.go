@@ -10,7 +10,6 @@ import (
 	"strings"
 
 	"github.com/pkg/errors"
-	logger "github.com/unionj-cloud/toolkit/zlogger"
 )
 
 // Route wraps config for route
@@ -19,6 +18,8 @@ type Route struct {
 	Method      string
 	Pattern     string
 	HandlerFunc http.HandlerFunc
+	// middlewares are names of middlewares wrapping HandlerFunc, outermost first
+	middlewares []string
 }
 
 // borrowed from httputil unexported function drainBody
@@ -0,0 +1,153 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/toolkit/stringutils"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ContentTypeProblemJSON is media type of RFC 7807 problem details document
+const ContentTypeProblemJSON = "application/problem+json"
+
+// ErrorRenderer writes error recovered from panic to response. Use WithErrorRenderer to replace the default JSONErrorRenderer.
+type ErrorRenderer func(w http.ResponseWriter, r *http.Request, err error)
+
+// ProblemDetails is RFC 7807 problem details document, Extensions are marshaled as top level members
+type ProblemDetails struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]interface{}
+}
+
+// MarshalJSON flattens Extensions into the document, standard members cannot be overridden by extensions
+func (p ProblemDetails) MarshalJSON() ([]byte, error) {
+	members := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+	members["type"] = p.Type
+	members["title"] = p.Title
+	members["status"] = p.Status
+	if stringutils.IsNotEmpty(p.Detail) {
+		members["detail"] = p.Detail
+	}
+	if stringutils.IsNotEmpty(p.Instance) {
+		members["instance"] = p.Instance
+	}
+	return json.Marshal(members)
+}
+
+// resolveError returns http status code, business error code and message of err, message of BizError created
+// by NewCodedError is localised from Accept-Language request header
+func resolveError(r *http.Request, err error) (int, int, string) {
+	statusCode := http.StatusInternalServerError
+	errCode := 1 // 1 indicates there is an error
+	message := err.Error()
+	switch {
+	case errors.Is(err, context.Canceled):
+		statusCode = http.StatusBadRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		statusCode = http.StatusGatewayTimeout
+	default:
+		var bizError BizError
+		if errors.As(err, &bizError) {
+			statusCode = bizError.StatusCode
+			errCode = bizError.ErrCode
+			message = bizError.Localize(r.Header.Get(HeaderAcceptLanguage))
+		}
+	}
+	if stringutils.IsEmpty(message) {
+		message = http.StatusText(statusCode)
+	}
+	return statusCode, errCode, message
+}
+
+// JSONErrorRenderer writes {"code":..,"message":..}, it is the default ErrorRenderer
+func JSONErrorRenderer(w http.ResponseWriter, r *http.Request, err error) {
+	statusCode, errCode, message := resolveError(r, err)
+	w.WriteHeader(statusCode)
+	if _err := json.NewEncoder(w).Encode(struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}{
+		Code:    errCode,
+		Message: message,
+	}); _err != nil {
+		http.Error(w, _err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ProblemJSONErrorRenderer writes RFC 7807 application/problem+json document. Besides standard members,
+// business error code, request id, trace id and field level validation errors are written as extension members
+// code, requestId, traceId and errors, together with BizError.Extensions.
+func ProblemJSONErrorRenderer(w http.ResponseWriter, r *http.Request, err error) {
+	statusCode, errCode, message := resolveError(r, err)
+	problem := ProblemDetails{
+		Type:     "about:blank",
+		Title:    http.StatusText(statusCode),
+		Status:   statusCode,
+		Detail:   message,
+		Instance: r.URL.RequestURI(),
+		Extensions: map[string]interface{}{
+			"code": errCode,
+		},
+	}
+	var bizError BizError
+	if errors.As(err, &bizError) {
+		if stringutils.IsNotEmpty(bizError.Type) {
+			problem.Type = bizError.Type
+		}
+		if stringutils.IsNotEmpty(bizError.Title) {
+			problem.Title = bizError.Title
+		}
+		if stringutils.IsNotEmpty(bizError.Instance) {
+			problem.Instance = bizError.Instance
+		}
+		if len(bizError.FieldErrors) > 0 {
+			problem.Extensions["errors"] = bizError.FieldErrors
+		}
+		for k, v := range bizError.Extensions {
+			problem.Extensions[k] = v
+		}
+	}
+	if requestId := r.Header.Get(HeaderXRequestID); stringutils.IsNotEmpty(requestId) {
+		problem.Extensions["requestId"] = requestId
+	}
+	if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+		problem.Extensions["traceId"] = sc.TraceID().String()
+	}
+	w.Header().Set(HeaderContentType, ContentTypeProblemJSON)
+	w.WriteHeader(statusCode)
+	if _err := json.NewEncoder(w).Encode(problem); _err != nil {
+		http.Error(w, _err.Error(), http.StatusInternalServerError)
+	}
+}
+
+type recoveryContextKey struct{}
+
+// recoveryContext keeps context of the innermost request, so that ErrorRenderer and PrometheusMiddleware can get
+// values like span set by middlewares after them
+type recoveryContext struct {
+	ctx context.Context
+}
+
+// withRecoveryContext returns recoveryContext of the request, a new one is attached if there is none
+func withRecoveryContext(r *http.Request) (*http.Request, *recoveryContext) {
+	if rc, ok := r.Context().Value(recoveryContextKey{}).(*recoveryContext); ok {
+		return r, rc
+	}
+	rc := &recoveryContext{}
+	return r.WithContext(context.WithValue(r.Context(), recoveryContextKey{}, rc)), rc
+}
+
+func captureRecoveryContext(r *http.Request) {
+	if rc, ok := r.Context().Value(recoveryContextKey{}).(*recoveryContext); ok {
+		rc.ctx = r.Context()
+	}
+}
@@ -0,0 +1,190 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ascarter/requestid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/errcode"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	assert.Equal(t, ContentTypeProblemJSON, rec.Header().Get(HeaderContentType))
+	var problem map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+	return problem
+}
+
+func TestProblemJSONErrorRenderer(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/orders/1?dry=true", nil)
+	req.Header.Set(HeaderXRequestID, "req-1")
+	ProblemJSONErrorRenderer(rec, req, NewBizError(errors.New("insufficient balance"),
+		WithStatusCode(http.StatusConflict),
+		WithErrCode(40901),
+		WithType("https://example.com/probs/out-of-credit"),
+		WithTitle("You do not have enough credit."),
+		WithExtension("balance", 30),
+		WithExtension("status", "ignored"),
+	))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, map[string]interface{}{
+		"type":      "https://example.com/probs/out-of-credit",
+		"title":     "You do not have enough credit.",
+		"status":    float64(http.StatusConflict),
+		"detail":    "insufficient balance",
+		"instance":  "/orders/1?dry=true",
+		"code":      float64(40901),
+		"requestId": "req-1",
+		"balance":   float64(30),
+	}, decodeProblem(t, rec))
+}
+
+func TestProblemJSONErrorRenderer_PlainError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	ProblemJSONErrorRenderer(rec, httptest.NewRequest(http.MethodGet, "/", nil), errors.New("boom"))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	problem := decodeProblem(t, rec)
+	assert.Equal(t, "about:blank", problem["type"])
+	assert.Equal(t, "Internal Server Error", problem["title"])
+	assert.Equal(t, "boom", problem["detail"])
+	assert.Equal(t, float64(1), problem["code"])
+
+	rec = httptest.NewRecorder()
+	ProblemJSONErrorRenderer(rec, httptest.NewRequest(http.MethodGet, "/", nil), errors.Wrap(context.Canceled, ""))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestProblemJSONErrorRenderer_ValidationErrors(t *testing.T) {
+	err := ValidateStruct(User{Email: "invalid", Age: 200})
+	require.Error(t, err)
+	rec := httptest.NewRecorder()
+	ProblemJSONErrorRenderer(rec, httptest.NewRequest(http.MethodGet, "/", nil), NewBizError(err, WithStatusCode(http.StatusBadRequest)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	problem := decodeProblem(t, rec)
+	fieldErrors, ok := problem["errors"].([]interface{})
+	require.True(t, ok)
+	var fields []string
+	for _, item := range fieldErrors {
+		fe := item.(map[string]interface{})
+		fields = append(fields, fe["field"].(string)+":"+fe["rule"].(string))
+		assert.NotEmpty(t, fe["message"])
+	}
+	assert.Equal(t, []string{"Name:required", "Email:email", "Age:lte"}, fields)
+}
+
+func TestRecoveryWith(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	defer tp.Shutdown(context.Background())
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(prev)
+
+	var traceID string
+	handler := recoveryWith(ProblemJSONErrorRenderer)(tracing(requestid.RequestIDHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID = trace.SpanContextFromContext(r.Context()).TraceID().String()
+		panic("something wrong")
+	}))))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	problem := decodeProblem(t, rec)
+	assert.Equal(t, "something wrong", problem["detail"])
+	assert.Equal(t, traceID, problem["traceId"])
+	assert.NotEmpty(t, problem["requestId"])
+}
+
+func TestWithErrorRenderer(t *testing.T) {
+	srv := NewRestServerWithOptions(WithErrorRenderer(ProblemJSONErrorRenderer))
+	srv.AddRoute(Route{
+		Name:    "Panic",
+		Method:  http.MethodGet,
+		Pattern: "/panic",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			HandleBadRequestErr(errors.New("bad"))
+		},
+	})
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "bad", decodeProblem(t, rec)["detail"])
+
+	// default renderer keeps {"code":..,"message":..}
+	srv = NewRestServerWithOptions()
+	srv.AddRoute(Route{
+		Name:    "Panic",
+		Method:  http.MethodGet,
+		Pattern: "/panic",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			HandleBadRequestErr(errors.New("bad"))
+		},
+	})
+	rec = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"code":1,"message":"bad"}`, rec.Body.String())
+}
+
+var registerErrCodes sync.Once
+
+func setupErrCodes(t *testing.T) {
+	registerErrCodes.Do(func() {
+		require.NoError(t, errcode.Register(errcode.ErrorDef{
+			Code:       40471,
+			HTTPStatus: http.StatusNotFound,
+			GRPCCode:   codes.NotFound,
+			Messages: map[string]string{
+				"en":    "order %s not found",
+				"zh-CN": "订单%s不存在",
+			},
+		}))
+	})
+}
+
+func TestNewCodedError(t *testing.T) {
+	setupErrCodes(t)
+	bz := NewCodedError(40471, "A1")
+	assert.Equal(t, http.StatusNotFound, bz.StatusCode)
+	assert.Equal(t, 40471, bz.ErrCode)
+	assert.Equal(t, "order A1 not found", bz.Error())
+	assert.Equal(t, "订单A1不存在", bz.Localize("zh-CN,zh;q=0.9"))
+	assert.Equal(t, codes.NotFound, status.Convert(bz).Code())
+
+	bz = NewCodedError(40472)
+	assert.Equal(t, http.StatusInternalServerError, bz.StatusCode)
+	assert.Equal(t, "error 40472", bz.Error())
+	assert.Equal(t, "error 40472", bz.Localize("zh-CN"))
+	assert.Equal(t, codes.Unknown, status.Convert(bz).Code())
+
+	// messages of BizError created by NewBizError are not localised even if code is registered
+	bz = NewBizError(errors.New("custom"), WithErrCode(40471))
+	assert.Equal(t, "custom", bz.Localize("zh-CN"))
+	assert.Equal(t, codes.NotFound, status.Convert(bz).Code())
+}
+
+func TestErrorRenderer_Localize(t *testing.T) {
+	setupErrCodes(t)
+	req := httptest.NewRequest(http.MethodGet, "/orders/A1", nil)
+	req.Header.Set(HeaderAcceptLanguage, "zh-CN")
+
+	rec := httptest.NewRecorder()
+	JSONErrorRenderer(rec, req, NewCodedError(40471, "A1"))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.JSONEq(t, `{"code":40471,"message":"订单A1不存在"}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	ProblemJSONErrorRenderer(rec, req, errors.Wrap(NewCodedError(40471, "A1"), "wrapped"))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "订单A1不存在", decodeProblem(t, rec)["detail"])
+}
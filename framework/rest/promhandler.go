@@ -1,18 +1,22 @@
 package rest
 
 import (
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var PromRoutes = promRoutes
 
 func promRoutes() []Route {
+	// OpenMetrics format is negotiated by scrapers to expose exemplars
+	handler := promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
 	return []Route{
 		{
 			Name:        "Prometheus",
 			Method:      "GET",
 			Pattern:     "/go-doudou/prometheus",
-			HandlerFunc: promhttp.Handler().ServeHTTP,
+			HandlerFunc: handler.ServeHTTP,
 		},
 	}
 }
@@ -4,13 +4,17 @@ package rest
 // Many thanks to TannerGabriel https://github.com/TannerGabriel
 // Post link https://gabrieltanner.org/blog/collecting-prometheus-metrics-in-golang written by TannerGabriel
 import (
+	"io"
 	"net/http"
 	"runtime"
 	"strconv"
 	"time"
 
+	"github.com/felixge/httpsnoop"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/unionj-cloud/go-doudou/v2/framework/buildinfo"
+	gddmetrics "github.com/unionj-cloud/go-doudou/v2/framework/metrics"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest/httprouter"
 	"github.com/unionj-cloud/toolkit/constants"
 	"github.com/unionj-cloud/toolkit/stringutils"
 )
@@ -31,40 +35,117 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-var countRequests = prometheus.NewCounterVec(
-	prometheus.CounterOpts{
+const unmatchedRoute = "unmatched"
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "go_doudou_http_requests_total",
+		Help: "Number of http requests by matched route template.",
+	}, []string{"route", "method", "status"})
+	httpErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "go_doudou_http_request_errors_total",
+		Help: "Number of http requests responded with 5xx status code.",
+	}, []string{"route", "method"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "go_doudou_http_request_duration_seconds",
+		Help:    "Duration of http requests.",
+		Buckets: gddmetrics.Buckets(),
+	}, []string{"route", "method", "status"})
+	httpInflight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "go_doudou_http_requests_in_flight",
+		Help: "Number of http requests in processing.",
+	}, []string{"route", "method"})
+	httpRequestSize = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name: "go_doudou_http_request_size_bytes",
+		Help: "Size of http request bodies.",
+	}, []string{"route", "method"})
+	httpResponseSize = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name: "go_doudou_http_response_size_bytes",
+		Help: "Size of http response bodies.",
+	}, []string{"route", "method"})
+)
+
+// series of earlier releases, recorded only if GDD_METRICS_LEGACY is true
+var (
+	legacyRequestCount = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "go_doudou_http_request_count",
-		Help: "Number of http requests.",
-	},
-	[]string{"path", "method", "status"},
+		Help: "Number of http requests. Deprecated, use go_doudou_http_requests_total.",
+	}, []string{"path", "method", "status"})
+	legacyResponseTime = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "go_doudou_http_response_time_seconds",
+		Help: "Duration of HTTP requests. Deprecated, use go_doudou_http_request_duration_seconds.",
+	}, []string{"path", "method"})
 )
 
-var httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-	Name: "go_doudou_http_response_time_seconds",
-	Help: "Duration of HTTP requests.",
-}, []string{"path", "method"})
+// countingReader counts bytes of request body whose length is unknown
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
 
-// PrometheusMiddleware returns http HandlerFunc for prometheus matrix
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// PrometheusMiddleware collects request count, error count, duration, in-flight requests and body sizes labelled
+// by matched route template rather than raw url path, so that path parameters don't blow up cardinality.
+// Duration and count carry trace id of the request as exemplar. Series of earlier releases are recorded as well
+// if GDD_METRICS_LEGACY is true.
 func PrometheusMiddleware(next http.Handler) http.Handler {
+	legacy := gddmetrics.Legacy()
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		path := r.URL.Path
+		route := httprouter.ParamsFromContext(r.Context()).MatchedRoutePath()
+		if stringutils.IsEmpty(route) {
+			route = unmatchedRoute
+		}
 		method := r.Method
-		timer := prometheus.NewTimer(httpDuration.WithLabelValues(path, method))
+		inflight := httpInflight.WithLabelValues(route, method)
+		inflight.Inc()
+		defer inflight.Dec()
 
-		rw := NewResponseWriter(w)
-		next.ServeHTTP(rw, r)
-
-		statusCode := rw.statusCode
-
-		countRequests.WithLabelValues(path, method, strconv.Itoa(statusCode)).Inc()
+		// span is started by tracing middleware after this one, it is captured for exemplars
+		r, rc := withRecoveryContext(r)
+		var body *countingReader
+		if r.ContentLength < 0 && r.Body != nil && r.Body != http.NoBody {
+			body = &countingReader{ReadCloser: r.Body}
+			r.Body = body
+		}
+		m := httpsnoop.CaptureMetrics(next, w, r)
 
-		timer.ObserveDuration()
+		ctx := r.Context()
+		if rc.ctx != nil {
+			ctx = rc.ctx
+		}
+		status := gddmetrics.StatusClass(m.Code)
+		gddmetrics.Inc(httpRequests.WithLabelValues(route, method, status), ctx)
+		if m.Code >= http.StatusInternalServerError {
+			gddmetrics.Inc(httpErrors.WithLabelValues(route, method), ctx)
+		}
+		gddmetrics.Observe(httpDuration.WithLabelValues(route, method, status), m.Duration.Seconds(), ctx)
+		size := r.ContentLength
+		if body != nil {
+			size = body.n
+		}
+		httpRequestSize.WithLabelValues(route, method).Observe(float64(size))
+		httpResponseSize.WithLabelValues(route, method).Observe(float64(m.Written))
+		if legacy {
+			legacyRequestCount.WithLabelValues(r.URL.Path, method, strconv.Itoa(m.Code)).Inc()
+			legacyResponseTime.WithLabelValues(r.URL.Path, method).Observe(m.Duration.Seconds())
+		}
 	})
 }
 
 func init() {
-	prometheus.Register(countRequests)
+	prometheus.Register(httpRequests)
+	prometheus.Register(httpErrors)
 	prometheus.Register(httpDuration)
+	prometheus.Register(httpInflight)
+	prometheus.Register(httpRequestSize)
+	prometheus.Register(httpResponseSize)
+	prometheus.Register(legacyRequestCount)
+	prometheus.Register(legacyResponseTime)
 	buildTime := buildinfo.BuildTime
 	if stringutils.IsNotEmpty(buildinfo.BuildTime) {
 		if t, err := time.Parse(constants.FORMAT15, buildinfo.BuildTime); err == nil {
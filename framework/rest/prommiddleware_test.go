@@ -0,0 +1,140 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestPrometheusMiddleware(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	defer tp.Shutdown(context.Background())
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(prev)
+
+	var traceID string
+	srv := NewRestServer()
+	srv.AddRoutes([]Route{
+		{
+			Name:    "PromGetOrder",
+			Method:  http.MethodGet,
+			Pattern: "/prom/orders/:id",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				traceID = trace.SpanContextFromContext(r.Context()).TraceID().String()
+				w.Write([]byte("go-doudou"))
+			},
+		},
+		{
+			Name:    "PromPostOrder",
+			Method:  http.MethodPost,
+			Pattern: "/prom/orders",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				panic("something wrong")
+			},
+		},
+	})
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/prom/orders/1", "").Code)
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/prom/orders/2", "").Code)
+	require.Equal(t, http.StatusInternalServerError, do(http.MethodPost, "/prom/orders", "{}").Code)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(httpRequests.WithLabelValues("/prom/orders/:id", http.MethodGet, "2xx")),
+		"requests are labelled by route template instead of url path")
+	assert.Equal(t, float64(0), testutil.ToFloat64(httpErrors.WithLabelValues("/prom/orders/:id", http.MethodGet)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(httpErrors.WithLabelValues("/prom/orders", http.MethodPost)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(httpInflight.WithLabelValues("/prom/orders/:id", http.MethodGet)))
+
+	req := httptest.NewRequest(http.MethodGet, "/go-doudou/prometheus", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	req.SetBasicAuth(config.DefaultGddManageUser, config.DefaultGddManagePass)
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, `go_doudou_http_request_duration_seconds_count{method="POST",route="/prom/orders",status="5xx"} 1`)
+	assert.Contains(t, body, `go_doudou_http_request_size_bytes_sum{method="POST",route="/prom/orders"} 2`)
+	assert.Contains(t, body, `go_doudou_http_response_size_bytes_sum{method="GET",route="/prom/orders/:id"} 18`)
+	assert.Contains(t, body, `trace_id="`+traceID+`"`, "exemplars carry trace id")
+}
+
+func TestPrometheusRoute(t *testing.T) {
+	scrape := func(srv *RestServer, auth bool) int {
+		req := httptest.NewRequest(http.MethodGet, "/go-doudou/prometheus", nil)
+		if auth {
+			req.SetBasicAuth(config.DefaultGddManageUser, config.DefaultGddManagePass)
+		}
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, scrape(NewRestServer(), false), "credentials are required by default")
+
+	manageEnable := config.GddConfig.ManageEnable
+	defer func() {
+		config.GddConfig.ManageEnable = manageEnable
+	}()
+	config.GddConfig.ManageEnable = false
+	assert.Equal(t, http.StatusNotFound, scrape(NewRestServer(), false), "not served without manage routes")
+
+	t.Setenv(string(config.GddMetricsPublic), "true")
+	assert.Equal(t, http.StatusOK, scrape(NewRestServer(), false))
+	config.GddConfig.ManageEnable = true
+	assert.Equal(t, http.StatusOK, scrape(NewRestServer(), false))
+}
+
+func TestPrometheusMiddleware_ManageDisabled(t *testing.T) {
+	manageEnable := config.GddConfig.ManageEnable
+	defer func() {
+		config.GddConfig.ManageEnable = manageEnable
+	}()
+	config.GddConfig.ManageEnable = false
+	srv := NewRestServer()
+	srv.AddRoutes([]Route{
+		{
+			Name:    "PromGetItem",
+			Method:  http.MethodGet,
+			Pattern: "/prom/items/:id",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("go-doudou"))
+			},
+		},
+	})
+	srv.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/prom/items/1", nil))
+	assert.Equal(t, float64(1), testutil.ToFloat64(httpRequests.WithLabelValues("/prom/items/:id", http.MethodGet, "2xx")),
+		"metrics are collected without manage routes")
+}
+
+func TestPrometheusMiddleware_Legacy(t *testing.T) {
+	t.Setenv(string(config.GddMetricsLegacy), "true")
+	srv := NewRestServer()
+	srv.AddRoutes([]Route{
+		{
+			Name:    "PromGetUser",
+			Method:  http.MethodGet,
+			Pattern: "/prom/users/:id",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("go-doudou"))
+			},
+		},
+	})
+	srv.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/prom/users/1", nil))
+	assert.Equal(t, float64(1), testutil.ToFloat64(legacyRequestCount.WithLabelValues("/prom/users/1", http.MethodGet, "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(httpRequests.WithLabelValues("/prom/users/:id", http.MethodGet, "2xx")))
+}
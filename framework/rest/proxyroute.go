@@ -0,0 +1,387 @@
+package rest
+
+import (
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/configmgr"
+	"github.com/unionj-cloud/toolkit/stringutils"
+)
+
+// ProxyRouteTable is the root element of routing rules yaml
+//
+//	routes:
+//	  - name: order-canary
+//	    match:
+//	      pathPrefix: /orders
+//	      headers:
+//	        - name: X-Canary
+//	          value: "true"
+//	    rewrite:
+//	      pathPrefix: /api/orders
+//	    requestHeaders:
+//	      set:
+//	        X-Gateway: go-doudou
+//	    splits:
+//	      - service: order_rest
+//	        version: v1
+//	        weight: 90
+//	      - service: order_rest
+//	        version: v2
+//	        weight: 10
+type ProxyRouteTable struct {
+	Routes []ProxyRoute `yaml:"routes"`
+}
+
+// ProxyRoute is a declarative routing rule for rest.Proxy gateway. Routes are evaluated in order, the first matched one wins.
+// Requests which match no route fall back to /{service name}/{path} convention.
+type ProxyRoute struct {
+	Name  string     `yaml:"name"`
+	Match RouteMatch `yaml:"match"`
+	// Rewrite is optional, request path is forwarded as is if nil
+	Rewrite         *RouteRewrite    `yaml:"rewrite"`
+	RequestHeaders  HeaderOperations `yaml:"requestHeaders"`
+	ResponseHeaders HeaderOperations `yaml:"responseHeaders"`
+	// Service is target service name, it's also the default service of Splits
+	Service string `yaml:"service"`
+	// Version is optional, only instances with the same version metadata are selected if specified
+	Version string `yaml:"version"`
+	// Splits distributes traffic across services or versions by weight, Service and Version are ignored if not empty
+	Splits []RouteSplit `yaml:"splits"`
+}
+
+// RouteMatch defines conditions of a route, all specified conditions must be satisfied
+type RouteMatch struct {
+	// Host matches request host without port, wildcard like *.example.com is supported
+	Host       string `yaml:"host"`
+	PathPrefix string `yaml:"pathPrefix"`
+	PathRegex  string `yaml:"pathRegex"`
+	// Methods matches any of the http methods, all methods match if empty
+	Methods []string      `yaml:"methods"`
+	Headers []HeaderMatch `yaml:"headers"`
+}
+
+// HeaderMatch matches a request header. Header only needs to be present if Value is empty.
+type HeaderMatch struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+	// Regex treats Value as regular expression
+	Regex bool `yaml:"regex"`
+}
+
+// RouteRewrite rewrites request path before forwarding
+type RouteRewrite struct {
+	// PathPrefix replaces matched RouteMatch.PathPrefix
+	PathPrefix string `yaml:"pathPrefix"`
+	// Path replaces matched RouteMatch.PathRegex, capture groups can be referenced like $1
+	Path string `yaml:"path"`
+}
+
+// HeaderOperations modifies headers, operations are applied in order of Remove, Set, Add
+type HeaderOperations struct {
+	Add    map[string]string `yaml:"add"`
+	Set    map[string]string `yaml:"set"`
+	Remove []string          `yaml:"remove"`
+}
+
+// RouteSplit is a weighted backend of a route
+type RouteSplit struct {
+	Service string `yaml:"service"`
+	Version string `yaml:"version"`
+	Weight  int    `yaml:"weight"`
+}
+
+func (h HeaderOperations) apply(header http.Header) {
+	for _, name := range h.Remove {
+		header.Del(name)
+	}
+	for name, value := range h.Set {
+		header.Set(name, value)
+	}
+	for name, value := range h.Add {
+		header.Add(name, value)
+	}
+}
+
+func (h HeaderOperations) empty() bool {
+	return len(h.Add) == 0 && len(h.Set) == 0 && len(h.Remove) == 0
+}
+
+type headerMatcher struct {
+	HeaderMatch
+	regex *regexp.Regexp
+}
+
+func (m headerMatcher) match(header http.Header) bool {
+	values, ok := header[http.CanonicalHeaderKey(m.Name)]
+	if !ok {
+		return false
+	}
+	if stringutils.IsEmpty(m.Value) {
+		return true
+	}
+	for _, value := range values {
+		if m.regex != nil && m.regex.MatchString(value) || m.regex == nil && value == m.Value {
+			return true
+		}
+	}
+	return false
+}
+
+type compiledRoute struct {
+	ProxyRoute
+	pathRegex   *regexp.Regexp
+	headers     []headerMatcher
+	splits      []RouteSplit
+	totalWeight int
+}
+
+func compileRoute(route ProxyRoute) (*compiledRoute, error) {
+	compiled := &compiledRoute{
+		ProxyRoute: route,
+	}
+	var err error
+	if stringutils.IsNotEmpty(route.Match.PathRegex) {
+		if compiled.pathRegex, err = regexp.Compile(route.Match.PathRegex); err != nil {
+			return nil, errors.Wrapf(err, "invalid pathRegex of route %s", route.Name)
+		}
+	}
+	for _, item := range route.Match.Headers {
+		if stringutils.IsEmpty(item.Name) {
+			return nil, errors.Errorf("header name of route %s should not be empty", route.Name)
+		}
+		matcher := headerMatcher{
+			HeaderMatch: item,
+		}
+		if item.Regex {
+			if matcher.regex, err = regexp.Compile(item.Value); err != nil {
+				return nil, errors.Wrapf(err, "invalid header regex of route %s", route.Name)
+			}
+		}
+		compiled.headers = append(compiled.headers, matcher)
+	}
+	if route.Rewrite != nil && stringutils.IsNotEmpty(route.Rewrite.Path) && compiled.pathRegex == nil {
+		return nil, errors.Errorf("rewrite path of route %s requires pathRegex", route.Name)
+	}
+	compiled.splits = append([]RouteSplit(nil), route.Splits...)
+	if len(compiled.splits) == 0 {
+		compiled.splits = []RouteSplit{
+			{
+				Service: route.Service,
+				Version: route.Version,
+				Weight:  1,
+			},
+		}
+	}
+	for i, split := range compiled.splits {
+		if stringutils.IsEmpty(split.Service) {
+			if stringutils.IsEmpty(route.Service) {
+				return nil, errors.Errorf("service of route %s should not be empty", route.Name)
+			}
+			compiled.splits[i].Service = route.Service
+		}
+		if split.Weight < 0 {
+			return nil, errors.Errorf("weight of route %s should not be negative", route.Name)
+		}
+		compiled.totalWeight += split.Weight
+	}
+	if compiled.totalWeight == 0 {
+		return nil, errors.Errorf("total weight of route %s should be greater than 0", route.Name)
+	}
+	return compiled, nil
+}
+
+func matchHost(pattern, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(strings.ToLower(host), strings.ToLower(pattern[1:]))
+	}
+	return strings.EqualFold(pattern, host)
+}
+
+// matchPathPrefix reports whether path is prefix or under it, /orders matches /orders/1 but not /ordersfoo
+func matchPathPrefix(prefix, path string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+func (c *compiledRoute) match(r *http.Request) bool {
+	m := c.Match
+	if stringutils.IsNotEmpty(m.Host) && !matchHost(m.Host, r.Host) {
+		return false
+	}
+	if stringutils.IsNotEmpty(m.PathPrefix) && !matchPathPrefix(m.PathPrefix, r.URL.Path) {
+		return false
+	}
+	if c.pathRegex != nil && !c.pathRegex.MatchString(r.URL.Path) {
+		return false
+	}
+	if len(m.Methods) > 0 {
+		var matched bool
+		for _, method := range m.Methods {
+			if strings.EqualFold(method, r.Method) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, header := range c.headers {
+		if !header.match(r.Header) {
+			return false
+		}
+	}
+	return true
+}
+
+// rewrite applies path rewrite and request header operations to r
+func (c *compiledRoute) rewrite(r *http.Request) {
+	if c.Rewrite != nil {
+		path := r.URL.Path
+		if stringutils.IsNotEmpty(c.Match.PathPrefix) && stringutils.IsNotEmpty(c.Rewrite.PathPrefix) {
+			rest := strings.TrimPrefix(path, c.Match.PathPrefix)
+			if rest == "" {
+				path = c.Rewrite.PathPrefix
+			} else {
+				path = singleJoiningSlash(c.Rewrite.PathPrefix, rest)
+			}
+		}
+		if c.pathRegex != nil && stringutils.IsNotEmpty(c.Rewrite.Path) {
+			path = c.pathRegex.ReplaceAllString(path, c.Rewrite.Path)
+		}
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		r.URL.Path = path
+		r.URL.RawPath = ""
+	}
+	c.RequestHeaders.apply(r.Header)
+}
+
+// pick selects a split randomly by weight
+func (c *compiledRoute) pick() RouteSplit {
+	if len(c.splits) == 1 {
+		return c.splits[0]
+	}
+	n := rand.Intn(c.totalWeight)
+	for _, split := range c.splits {
+		n -= split.Weight
+		if n < 0 {
+			return split
+		}
+	}
+	return c.splits[len(c.splits)-1]
+}
+
+// ProxyRouter holds routing rules for rest.Proxy gateway, rules can be updated at runtime safely
+type ProxyRouter struct {
+	routes atomic.Value
+}
+
+// NewProxyRouter creates a ProxyRouter instance
+func NewProxyRouter(routes []ProxyRoute) (*ProxyRouter, error) {
+	router := &ProxyRouter{}
+	if err := router.Update(routes); err != nil {
+		return nil, err
+	}
+	return router, nil
+}
+
+// Update replaces all routing rules. Rules stay unchanged if any of the new rules is invalid.
+func (rt *ProxyRouter) Update(routes []ProxyRoute) error {
+	compiled := make([]*compiledRoute, 0, len(routes))
+	for _, route := range routes {
+		item, err := compileRoute(route)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, item)
+	}
+	rt.routes.Store(compiled)
+	return nil
+}
+
+// Routes returns current routing rules
+func (rt *ProxyRouter) Routes() []ProxyRoute {
+	compiled, _ := rt.routes.Load().([]*compiledRoute)
+	routes := make([]ProxyRoute, 0, len(compiled))
+	for _, item := range compiled {
+		routes = append(routes, item.ProxyRoute)
+	}
+	return routes
+}
+
+func (rt *ProxyRouter) match(r *http.Request) *compiledRoute {
+	compiled, _ := rt.routes.Load().([]*compiledRoute)
+	for _, item := range compiled {
+		if item.match(r) {
+			return item
+		}
+	}
+	return nil
+}
+
+// ListenRemote loads routing rules from nacos dataId or apollo namespace according to GDD_CONFIG_REMOTE_TYPE,
+// and reloads them whenever they change. Invalid rules are logged and ignored.
+func (rt *ProxyRouter) ListenRemote(dataId string) error {
+	reload := func(content string) {
+		routes, err := LoadProxyRoutes([]byte(content))
+		if err != nil {
+			logger.Error().Err(err).Msgf("[go-doudou] failed to parse routing rules from %s", dataId)
+			return
+		}
+		if err = rt.Update(routes); err != nil {
+			logger.Error().Err(err).Msgf("[go-doudou] invalid routing rules from %s", dataId)
+			return
+		}
+		logger.Info().Msgf("[go-doudou] %d routing rules loaded from %s", len(routes), dataId)
+	}
+	configType := config.GddConfigRemoteType.LoadOrDefault(config.DefaultGddConfigRemoteType)
+	switch configType {
+	case config.NacosConfigType:
+		if configmgr.NacosClient == nil {
+			return errors.New("nacos config client has not been initialized")
+		}
+		return configmgr.NacosClient.ListenRaw(dataId, reload)
+	case config.ApolloConfigType:
+		if configmgr.ApolloClient == nil {
+			return errors.New("apollo client has not been initialized")
+		}
+		configmgr.ListenApolloRaw(dataId, reload)
+		return nil
+	default:
+		return errors.Errorf("unknown config type: %s", configType)
+	}
+}
+
+// LoadProxyRoutes parses routing rules from yaml
+func LoadProxyRoutes(data []byte) ([]ProxyRoute, error) {
+	var table ProxyRouteTable
+	if err := yaml.Unmarshal(data, &table); err != nil {
+		return nil, errors.Wrap(err, "failed to parse routing rules")
+	}
+	return table.Routes, nil
+}
+
+// LoadProxyRoutesFromFile parses routing rules from yaml file
+func LoadProxyRoutesFromFile(file string) ([]ProxyRoute, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return LoadProxyRoutes(data)
+}
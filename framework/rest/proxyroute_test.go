@@ -0,0 +1,227 @@
+package rest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const routesYaml = `
+routes:
+  - name: canary
+    match:
+      host: "*.example.com"
+      pathPrefix: /orders
+      methods: [GET]
+      headers:
+        - name: X-Canary
+          value: "^(true|1)$"
+          regex: true
+    rewrite:
+      pathPrefix: /api/orders
+    requestHeaders:
+      set:
+        X-Gateway: go-doudou
+      remove: [Cookie]
+    responseHeaders:
+      add:
+        X-Route: canary
+    service: order
+    version: v2
+  - name: users
+    match:
+      pathRegex: ^/users/(\d+)$
+    rewrite:
+      path: /api/users/$1/profile
+    splits:
+      - service: user
+        version: v1
+        weight: 3
+      - service: user
+        version: v2
+        weight: 1
+`
+
+func TestLoadProxyRoutes(t *testing.T) {
+	routes, err := LoadProxyRoutes([]byte(routesYaml))
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+	assert.Equal(t, "*.example.com", routes[0].Match.Host)
+	assert.Equal(t, []HeaderMatch{{Name: "X-Canary", Value: "^(true|1)$", Regex: true}}, routes[0].Match.Headers)
+	assert.Equal(t, "/api/orders", routes[0].Rewrite.PathPrefix)
+	assert.Equal(t, map[string]string{"X-Gateway": "go-doudou"}, routes[0].RequestHeaders.Set)
+	assert.Equal(t, []RouteSplit{{Service: "user", Version: "v1", Weight: 3}, {Service: "user", Version: "v2", Weight: 1}}, routes[1].Splits)
+
+	file := filepath.Join(t.TempDir(), "routes.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(routesYaml), 0644))
+	fromFile, err := LoadProxyRoutesFromFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, routes, fromFile)
+
+	_, err = LoadProxyRoutesFromFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestNewProxyRouter_Invalid(t *testing.T) {
+	for name, route := range map[string]ProxyRoute{
+		"no service":    {Name: "a"},
+		"bad regex":     {Name: "b", Service: "s", Match: RouteMatch{PathRegex: "("}},
+		"bad header":    {Name: "c", Service: "s", Match: RouteMatch{Headers: []HeaderMatch{{Name: "X", Value: "(", Regex: true}}}},
+		"empty header":  {Name: "d", Service: "s", Match: RouteMatch{Headers: []HeaderMatch{{Value: "v"}}}},
+		"rewrite path":  {Name: "e", Service: "s", Rewrite: &RouteRewrite{Path: "/x"}},
+		"zero weight":   {Name: "f", Splits: []RouteSplit{{Service: "s"}}},
+		"negative":      {Name: "g", Splits: []RouteSplit{{Service: "s", Weight: -1}, {Service: "s", Weight: 2}}},
+		"split service": {Name: "h", Splits: []RouteSplit{{Weight: 1}}},
+	} {
+		_, err := NewProxyRouter([]ProxyRoute{route})
+		assert.Error(t, err, name)
+	}
+}
+
+func TestProxyRouter_Match(t *testing.T) {
+	routes, err := LoadProxyRoutes([]byte(routesYaml))
+	require.NoError(t, err)
+	router, err := NewProxyRouter(routes)
+	require.NoError(t, err)
+
+	newRequest := func(method, target, host, canary string) *http.Request {
+		r := httptest.NewRequest(method, target, nil)
+		r.Host = host
+		if canary != "" {
+			r.Header.Set("X-Canary", canary)
+		}
+		return r
+	}
+	cases := []struct {
+		req  *http.Request
+		want string
+	}{
+		{newRequest(http.MethodGet, "/orders/1", "api.example.com:8080", "true"), "canary"},
+		{newRequest(http.MethodGet, "/orders/1", "API.EXAMPLE.COM", "1"), "canary"},
+		{newRequest(http.MethodGet, "/orders/1", "example.org", "true"), ""},
+		{newRequest(http.MethodPost, "/orders/1", "api.example.com", "true"), ""},
+		{newRequest(http.MethodGet, "/orders/1", "api.example.com", "yes"), ""},
+		{newRequest(http.MethodGet, "/orders/1", "api.example.com", ""), ""},
+		{newRequest(http.MethodGet, "/orders", "api.example.com", "true"), "canary"},
+		{newRequest(http.MethodGet, "/ordersfoo", "api.example.com", "true"), ""},
+		{newRequest(http.MethodDelete, "/users/42", "any", ""), "users"},
+		{newRequest(http.MethodGet, "/users/abc", "any", ""), ""},
+	}
+	for _, c := range cases {
+		route := router.match(c.req)
+		if c.want == "" {
+			assert.Nil(t, route, c.req.URL.Path)
+			continue
+		}
+		require.NotNil(t, route, c.req.URL.Path)
+		assert.Equal(t, c.want, route.Name)
+	}
+
+	require.NoError(t, router.Update(nil))
+	assert.Nil(t, router.match(cases[0].req))
+	assert.Empty(t, router.Routes())
+	// invalid rules should not replace current ones
+	require.NoError(t, router.Update(routes))
+	assert.Error(t, router.Update([]ProxyRoute{{Name: "invalid"}}))
+	assert.Len(t, router.Routes(), 2)
+}
+
+func TestCompiledRoute_Rewrite(t *testing.T) {
+	routes, err := LoadProxyRoutes([]byte(routesYaml))
+	require.NoError(t, err)
+	router, err := NewProxyRouter(routes)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/orders/1/items", nil)
+	r.Host = "api.example.com"
+	r.Header.Set("X-Canary", "true")
+	r.Header.Set("Cookie", "session=1")
+	route := router.match(r)
+	require.NotNil(t, route)
+	route.rewrite(r)
+	assert.Equal(t, "/api/orders/1/items", r.URL.Path)
+	assert.Equal(t, "go-doudou", r.Header.Get("X-Gateway"))
+	assert.Empty(t, r.Header.Get("Cookie"))
+
+	r = httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	route = router.match(r)
+	require.NotNil(t, route)
+	route.rewrite(r)
+	assert.Equal(t, "/api/users/42/profile", r.URL.Path)
+}
+
+func TestCompiledRoute_Pick(t *testing.T) {
+	route, err := compileRoute(ProxyRoute{
+		Service: "user",
+		Splits: []RouteSplit{
+			{Version: "v1", Weight: 3},
+			{Version: "v2", Weight: 1},
+			{Version: "v3", Weight: 0},
+		},
+	})
+	require.NoError(t, err)
+	counts := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		split := route.pick()
+		assert.Equal(t, "user", split.Service)
+		counts[split.Version]++
+	}
+	assert.Zero(t, counts["v3"])
+	assert.InDelta(t, 3000, counts["v1"], 300)
+	assert.InDelta(t, 1000, counts["v2"], 300)
+}
+
+func TestProxy_Routes(t *testing.T) {
+	newUpstream := func(version string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s %s", version, r.URL.Path, r.Header.Get("X-Gateway"))
+		}))
+	}
+	v1, v2 := newUpstream("v1"), newUpstream("v2")
+	defer v1.Close()
+	defer v2.Close()
+	t.Setenv("GDD_SERVICE_DISCOVERY_MODE", "")
+
+	routes, err := LoadProxyRoutes([]byte(routesYaml))
+	require.NoError(t, err)
+	router, err := NewProxyRouter(routes)
+	require.NoError(t, err)
+	gateway := Proxy(ProxyConfig{
+		Upstreams: map[string][]Upstream{
+			"order": {{URL: v1.URL, Version: "v1"}, {URL: v2.URL, Version: "v2"}},
+		},
+		Router: router,
+	})(nil)
+
+	serve := func(r *http.Request) (*httptest.ResponseRecorder, string) {
+		rec := httptest.NewRecorder()
+		gateway.ServeHTTP(rec, r)
+		body, _ := io.ReadAll(rec.Body)
+		return rec, string(body)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/7", nil)
+	req.Host = "api.example.com"
+	req.Header.Set("X-Canary", "true")
+	rec, body := serve(req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "v2 /api/orders/7 go-doudou", body)
+	assert.Equal(t, "canary", rec.Header().Get("X-Route"))
+
+	// requests which match no route fall back to /{service name}/{path}
+	rec, body = serve(httptest.NewRequest(http.MethodGet, "/order/orders/7", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, []string{"v1 /orders/7 ", "v2 /orders/7 "}, body)
+	assert.Empty(t, rec.Header().Get("X-Route"))
+
+	// no upstream of service user
+	rec, _ = serve(httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+}
@@ -0,0 +1,467 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/cache"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest/httprouter"
+	"github.com/unionj-cloud/toolkit/cast"
+	gocache "github.com/unionj-cloud/toolkit/gocache/lib/cache"
+	"github.com/unionj-cloud/toolkit/gocache/lib/store"
+	"github.com/unionj-cloud/toolkit/stringutils"
+)
+
+const (
+	// HeaderXCache tells whether a response is served from ResponseCache, value is HIT or MISS
+	HeaderXCache = "X-Cache"
+	// CacheAnnotation enables ResponseCache for a route, e.g. @cache or @cache(5m) to override TTL
+	CacheAnnotation = "cache"
+)
+
+const (
+	responseCacheKeyPrefix = "go-doudou:httpcache:"
+	// localResponseCacheTTL only limits how long entries stay in memory, freshness is checked by expireAt of entries
+	localResponseCacheTTL = 24 * time.Hour
+)
+
+// ResponseCacheStore stores cached responses
+type ResponseCacheStore interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, data []byte, ttl time.Duration) error
+}
+
+// LocalCache is implemented by cache.LruCache, cache.ARCCache and cache.TwoQueueCache
+type LocalCache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, data []byte)
+}
+
+type localResponseCacheStore struct {
+	c LocalCache
+}
+
+func (s localResponseCacheStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	data, ok := s.c.Get(key)
+	return data, ok, nil
+}
+
+func (s localResponseCacheStore) Set(_ context.Context, key string, data []byte, _ time.Duration) error {
+	s.c.Set(key, data)
+	return nil
+}
+
+// NewLocalResponseCacheStore stores responses in c, ttl of c should be longer than ttl of any cached route
+func NewLocalResponseCacheStore(c LocalCache) ResponseCacheStore {
+	return localResponseCacheStore{c: c}
+}
+
+type managerResponseCacheStore struct {
+	m gocache.CacheInterface[any]
+}
+
+func (s managerResponseCacheStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.m.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, &store.NotFound{}) {
+			return nil, false, nil
+		}
+		return nil, false, errors.WithStack(err)
+	}
+	switch v := value.(type) {
+	case string:
+		return []byte(v), true, nil
+	case []byte:
+		return v, true, nil
+	default:
+		return nil, false, errors.Errorf("unexpected cached response type %T", value)
+	}
+}
+
+func (s managerResponseCacheStore) Set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	// stored as string, so that it works with redis store as well
+	return s.m.Set(ctx, key, string(data), store.WithExpiration(ttl))
+}
+
+// NewManagerResponseCacheStore stores responses in m, e.g. cache.CacheManager shared by all instances
+func NewManagerResponseCacheStore(m gocache.CacheInterface[any]) ResponseCacheStore {
+	return managerResponseCacheStore{m: m}
+}
+
+// ResponseCacheConfig configures ResponseCache middleware
+type ResponseCacheConfig struct {
+	// TTL is how long responses are cached if neither @cache(ttl) nor max-age of Cache-Control header is given
+	TTL time.Duration
+	// VaryHeaders are request headers whose values are part of cache key besides route, path and query
+	VaryHeaders []string
+	// MaxBodySize is max bytes of response body to be cached, larger responses are streamed without caching
+	MaxBodySize int
+	// Store stores cached responses
+	Store ResponseCacheStore
+	// AnnotationStore is where @cache is looked up, default is the one registered by framework.RegisterAnnotationStore
+	AnnotationStore framework.AnnotationStore
+}
+
+// DefaultResponseCacheConfig returns ResponseCacheConfig from GDD_HTTPCACHE_* environment variables. Responses are
+// stored in cache.CacheManager if GDD_CACHE_STORES is set, otherwise in a local LRU cache.
+func DefaultResponseCacheConfig() ResponseCacheConfig {
+	conf := ResponseCacheConfig{
+		TTL:         config.GddHttpCacheTTL.LoadDurationOrDefault(config.DefaultGddHttpCacheTTL),
+		VaryHeaders: splitList(config.GddHttpCacheVaryHeaders.LoadOrDefault(config.DefaultGddHttpCacheVaryHeaders)),
+		MaxBodySize: cast.ToIntOrDefault(config.GddHttpCacheMaxBodySize.Load(), config.DefaultGddHttpCacheMaxBodySize),
+	}
+	if cache.CacheManager != nil {
+		conf.Store = NewManagerResponseCacheStore(cache.CacheManager)
+	} else {
+		size := cast.ToIntOrDefault(config.GddHttpCacheLocalSize.Load(), config.DefaultGddHttpCacheLocalSize)
+		conf.Store = NewLocalResponseCacheStore(cache.NewLruCache(size, localResponseCacheTTL))
+	}
+	return conf
+}
+
+// cachedResponse is stored as json, so that it works with any store
+type cachedResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	StoredAt   int64       `json:"storedAt"`
+	ExpireAt   int64       `json:"expireAt"`
+}
+
+// parseCacheControl returns lower case directives of Cache-Control header value
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if stringutils.IsEmpty(item) {
+			continue
+		}
+		k, v, _ := strings.Cut(item, "=")
+		directives[strings.ToLower(strings.TrimSpace(k))] = strings.Trim(strings.TrimSpace(v), `"`)
+	}
+	return directives
+}
+
+// etagMatch reports whether If-None-Match header value matches etag by weak comparison
+func etagMatch(ifNoneMatch, etag string) bool {
+	if stringutils.IsEmpty(ifNoneMatch) || stringutils.IsEmpty(etag) {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, item := range strings.Split(ifNoneMatch, ",") {
+		item = strings.TrimSpace(item)
+		if item == "*" || strings.TrimPrefix(item, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// strongETag returns an entity tag derived from body
+func strongETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModifiedHeaders are canonical keys of headers kept in 304 Not Modified responses
+var notModifiedHeaders = map[string]struct{}{
+	http.CanonicalHeaderKey(HeaderETag):         {},
+	http.CanonicalHeaderKey(HeaderCacheControl): {},
+	http.CanonicalHeaderKey(HeaderVary):         {},
+	http.CanonicalHeaderKey(HeaderAge):          {},
+	http.CanonicalHeaderKey(HeaderXCache):       {},
+	"Expires":                                   {},
+	"Content-Location":                          {},
+	"Date":                                      {},
+}
+
+// uncachedHeaders are hop-by-hop and per response headers never cached
+var uncachedHeaders = map[string]struct{}{
+	"Connection":        {},
+	"Keep-Alive":        {},
+	"Transfer-Encoding": {},
+	"Upgrade":           {},
+	"Trailer":           {},
+	"Date":              {},
+}
+
+// HandlerHeader returns headers in after which are set or changed since before was cloned, except those in skip.
+// Middleware storing responses for later requests, e.g. response cache and idempotency, use it to leave out headers
+// which outer middleware set ahead of the handler for each request, like CORS and request id.
+func HandlerHeader(before, after http.Header, skip map[string]struct{}) http.Header {
+	header := make(http.Header)
+	for k, v := range after {
+		if _, ok := skip[k]; ok {
+			continue
+		}
+		if slices.Equal(before[k], v) {
+			continue
+		}
+		header[k] = slices.Clone(v)
+	}
+	return header
+}
+
+// notModified writes 304 Not Modified keeping only headers allowed by RFC 9110
+func notModified(w http.ResponseWriter) {
+	header := w.Header()
+	for k := range header {
+		if _, ok := notModifiedHeaders[k]; !ok {
+			header.Del(k)
+		}
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
+
+type responseCache struct {
+	ResponseCacheConfig
+	annotations func(operation string) []framework.Annotation
+}
+
+// ResponseCache caches 200 OK responses of GET requests to routes annotated by @cache. Responses are keyed by route,
+// path, query, VaryHeaders, Authorization and Cookie headers, so that responses to different credentials are never
+// mixed. Only headers set by the handler are cached, headers set by outer middleware are computed for each request.
+// Strong ETag is generated if the handler doesn't set one, and requests having matching If-None-Match header are
+// answered with 304 Not Modified. Handlers control caching by Cache-Control header: no-store, no-cache and private
+// prevent a response from being cached, s-maxage and max-age override TTL. Requests having Cache-Control: no-cache
+// bypass the cached response and refresh it, requests having Cache-Control: no-store bypass the middleware.
+func ResponseCache(conf ResponseCacheConfig) func(inner http.Handler) http.Handler {
+	rc := &responseCache{
+		ResponseCacheConfig: conf,
+		annotations:         framework.GetAnnotations,
+	}
+	if conf.AnnotationStore != nil {
+		rc.annotations = func(operation string) []framework.Annotation {
+			return conf.AnnotationStore[operation]
+		}
+	}
+	if rc.Store == nil {
+		rc.Store = NewLocalResponseCacheStore(cache.NewLruCache(config.DefaultGddHttpCacheLocalSize, localResponseCacheTTL))
+	}
+	return rc.middleware
+}
+
+// ttl returns TTL of operation, ok is false if operation is not annotated by @cache
+func (rc *responseCache) ttl(operation string) (time.Duration, bool) {
+	for _, item := range rc.annotations(operation) {
+		if item.Name != CacheAnnotation {
+			continue
+		}
+		if len(item.Params) > 0 {
+			if ttl, err := time.ParseDuration(item.Params[0]); err == nil {
+				return ttl, true
+			}
+			logger.Warn().Msgf("[go-doudou] invalid ttl %s of @%s on %s", item.Params[0], CacheAnnotation, operation)
+		}
+		return rc.TTL, true
+	}
+	return 0, false
+}
+
+func (rc *responseCache) key(r *http.Request, operation string) string {
+	h := sha256.New()
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{0})
+	// Encode sorts query by key
+	h.Write([]byte(r.URL.Query().Encode()))
+	for _, name := range append(rc.VaryHeaders, HeaderAuthorization, HeaderCookie) {
+		h.Write([]byte{0})
+		h.Write([]byte(strings.Join(r.Header.Values(name), ",")))
+	}
+	return responseCacheKeyPrefix + operation + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+func (rc *responseCache) load(ctx context.Context, key string) (*cachedResponse, error) {
+	data, ok, err := rc.Store.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var resp cachedResponse
+	if err = json.Unmarshal(data, &resp); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if time.Now().UnixMilli() >= resp.ExpireAt {
+		return nil, nil
+	}
+	return &resp, nil
+}
+
+// storeTTL returns how long a response having header can be cached, 0 means it must not be cached
+func storeTTL(header http.Header, ttl time.Duration) time.Duration {
+	if len(header.Values(HeaderSetCookie)) > 0 {
+		return 0
+	}
+	directives := parseCacheControl(strings.Join(header.Values(HeaderCacheControl), ","))
+	for _, item := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[item]; ok {
+			return 0
+		}
+	}
+	for _, item := range []string{"s-maxage", "max-age"} {
+		if v, ok := directives[item]; ok {
+			if seconds, err := strconv.Atoi(v); err == nil {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return ttl
+}
+
+func (rc *responseCache) middleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			inner.ServeHTTP(w, r)
+			return
+		}
+		operation := httprouter.ParamsFromContext(r.Context()).MatchedRouteName()
+		ttl, ok := rc.ttl(operation)
+		if !ok {
+			inner.ServeHTTP(w, r)
+			return
+		}
+		reqDirectives := parseCacheControl(r.Header.Get(HeaderCacheControl))
+		if _, ok = reqDirectives["no-store"]; ok {
+			inner.ServeHTTP(w, r)
+			return
+		}
+		key := rc.key(r, operation)
+		if _, ok = reqDirectives["no-cache"]; !ok {
+			resp, err := rc.load(r.Context(), key)
+			if err != nil {
+				logger.Error().Err(err).Msgf("[go-doudou] failed to load cached response %s", key)
+			}
+			if resp != nil {
+				rc.replay(w, r, resp)
+				return
+			}
+		}
+		rc.serve(w, r, inner, key, ttl)
+	})
+}
+
+func (rc *responseCache) replay(w http.ResponseWriter, r *http.Request, resp *cachedResponse) {
+	header := w.Header()
+	for k, v := range resp.Header {
+		header[k] = v
+	}
+	header.Set(HeaderAge, strconv.FormatInt(max(time.Now().UnixMilli()-resp.StoredAt, 0)/1000, 10))
+	header.Set(HeaderXCache, "HIT")
+	if etagMatch(r.Header.Get(HeaderIfNoneMatch), header.Get(HeaderETag)) {
+		notModified(w)
+		return
+	}
+	w.WriteHeader(resp.StatusCode)
+	w.Write(resp.Body)
+}
+
+// serve buffers response of inner until it is done, so that ETag can be derived from body. Responses other than
+// 200 OK, larger than MaxBodySize or flushed by the handler are streamed as usual and not cached.
+func (rc *responseCache) serve(w http.ResponseWriter, r *http.Request, inner http.Handler, key string, ttl time.Duration) {
+	var (
+		statusCode int
+		buf        bytes.Buffer
+		streaming  bool
+	)
+	stream := func() {
+		if streaming {
+			return
+		}
+		streaming = true
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		w.WriteHeader(statusCode)
+		if buf.Len() > 0 {
+			w.Write(buf.Bytes())
+			buf.Reset()
+		}
+	}
+	before := w.Header().Clone()
+	var wrapped http.ResponseWriter
+	wrapped = httpsnoop.Wrap(w, httpsnoop.Hooks{
+		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return func(code int) {
+				if streaming || code < http.StatusOK {
+					next(code)
+					return
+				}
+				if statusCode == 0 {
+					statusCode = code
+				}
+				if statusCode != http.StatusOK {
+					stream()
+				}
+			}
+		},
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(b []byte) (int, error) {
+				if !streaming && buf.Len()+len(b) > rc.MaxBodySize {
+					stream()
+				}
+				if streaming {
+					return next(b)
+				}
+				return buf.Write(b)
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				// copy through Write so that the body is buffered
+				return io.Copy(struct{ io.Writer }{wrapped}, src)
+			}
+		},
+		Flush: func(next httpsnoop.FlushFunc) httpsnoop.FlushFunc {
+			return func() {
+				stream()
+				next()
+			}
+		},
+	})
+	inner.ServeHTTP(wrapped, r)
+	if streaming {
+		return
+	}
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	body := buf.Bytes()
+	header := w.Header()
+	if stringutils.IsEmpty(header.Get(HeaderETag)) {
+		header.Set(HeaderETag, strongETag(body))
+	}
+	header.Set(HeaderContentLength, strconv.Itoa(len(body)))
+	if ttl = storeTTL(header, ttl); ttl > 0 {
+		now := time.Now()
+		resp := cachedResponse{
+			StatusCode: statusCode,
+			Header:     HandlerHeader(before, header, uncachedHeaders),
+			Body:       body,
+			StoredAt:   now.UnixMilli(),
+			ExpireAt:   now.Add(ttl).UnixMilli(),
+		}
+		if data, err := json.Marshal(resp); err != nil {
+			logger.Error().Err(err).Msgf("[go-doudou] failed to marshal response %s", key)
+		} else if err = rc.Store.Set(context.WithoutCancel(r.Context()), key, data, ttl); err != nil {
+			logger.Error().Err(err).Msgf("[go-doudou] failed to cache response %s", key)
+		}
+	}
+	header.Set(HeaderXCache, "MISS")
+	if etagMatch(r.Header.Get(HeaderIfNoneMatch), header.Get(HeaderETag)) {
+		notModified(w)
+		return
+	}
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
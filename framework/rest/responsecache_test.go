@@ -0,0 +1,185 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/cache"
+)
+
+func newResponseCacheServer(calls *int32) *RestServer {
+	srv := NewRestServer()
+	handler := func(cacheControl string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(calls, 1)
+			if cacheControl != "" {
+				w.Header().Set(HeaderCacheControl, cacheControl)
+			}
+			w.Header().Set(HeaderContentType, "text/plain")
+			fmt.Fprintf(w, "%s-%d", r.URL.Query().Get("name"), n)
+		}
+	}
+	srv.AddRoutes([]Route{
+		{Name: "GetUser", Method: http.MethodGet, Pattern: "/user", HandlerFunc: handler("")},
+		{Name: "GetOrder", Method: http.MethodGet, Pattern: "/order", HandlerFunc: handler("")},
+		{Name: "GetSession", Method: http.MethodGet, Pattern: "/session", HandlerFunc: handler("private")},
+		{Name: "GetStock", Method: http.MethodGet, Pattern: "/stock", HandlerFunc: handler("max-age=0")},
+		{
+			Name:    "GetMissing",
+			Method:  http.MethodGet,
+			Pattern: "/missing",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(calls, 1)
+				http.NotFound(w, r)
+			},
+		},
+	}, ResponseCache(ResponseCacheConfig{
+		TTL:         time.Minute,
+		VaryHeaders: []string{HeaderAcceptLanguage},
+		MaxBodySize: 1 << 10,
+		Store:       NewLocalResponseCacheStore(cache.NewLruCache(10, time.Hour)),
+		AnnotationStore: framework.AnnotationStore{
+			"GetUser":    {{Name: "cache", Params: []string{"1h"}}},
+			"GetSession": {{Name: "cache"}},
+			"GetStock":   {{Name: "cache"}},
+			"GetMissing": {{Name: "cache"}},
+		},
+	}))
+	return srv
+}
+
+func doGet(srv *RestServer, target string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestResponseCache(t *testing.T) {
+	var calls int32
+	srv := newResponseCacheServer(&calls)
+
+	first := doGet(srv, "/user?name=jack&age=1", nil)
+	require.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, "jack-1", first.Body.String())
+	assert.Equal(t, "MISS", first.Header().Get(HeaderXCache))
+	etag := first.Header().Get(HeaderETag)
+	assert.NotEmpty(t, etag)
+
+	second := doGet(srv, "/user?age=1&name=jack", nil)
+	assert.Equal(t, "jack-1", second.Body.String(), "query order doesn't matter")
+	assert.Equal(t, "HIT", second.Header().Get(HeaderXCache))
+	assert.Equal(t, etag, second.Header().Get(HeaderETag))
+	assert.Equal(t, "text/plain", second.Header().Get(HeaderContentType))
+	assert.Equal(t, "0", second.Header().Get(HeaderAge))
+
+	notModified := doGet(srv, "/user?name=jack&age=1", map[string]string{HeaderIfNoneMatch: `"other", ` + etag})
+	assert.Equal(t, http.StatusNotModified, notModified.Code)
+	assert.Empty(t, notModified.Body.String())
+	assert.Equal(t, etag, notModified.Header().Get(HeaderETag))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+
+	assert.Equal(t, "rose-2", doGet(srv, "/user?name=rose", nil).Body.String())
+	assert.Equal(t, "jack-3", doGet(srv, "/user?name=jack&age=1", map[string]string{HeaderAcceptLanguage: "zh"}).Body.String())
+	assert.Equal(t, "jack-4", doGet(srv, "/user?name=jack&age=1", map[string]string{HeaderAuthorization: "Bearer a"}).Body.String())
+	assert.Equal(t, "jack-5", doGet(srv, "/user?name=jack&age=1", map[string]string{HeaderCookie: "session=a"}).Body.String())
+	assert.Equal(t, "jack-6", doGet(srv, "/user?name=jack&age=1", map[string]string{HeaderCacheControl: "no-cache"}).Body.String())
+	assert.Equal(t, "jack-6", doGet(srv, "/user?name=jack&age=1", nil).Body.String(), "refreshed by no-cache request")
+}
+
+func TestResponseCache_HandlerHeaderOnly(t *testing.T) {
+	var calls int32
+	srv := newResponseCacheServer(&calls)
+	// outer middleware sets headers for each request before the handler
+	get := func(origin, requestID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/user?name=jack", nil)
+		rec := httptest.NewRecorder()
+		rec.Header().Set(HeaderAccessControlAllowOrigin, origin)
+		rec.Header().Set(HeaderXRequestID, requestID)
+		srv.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	get("https://a.com", "1")
+	rec := get("https://b.com", "2")
+	assert.Equal(t, "HIT", rec.Header().Get(HeaderXCache))
+	assert.Equal(t, "https://b.com", rec.Header().Get(HeaderAccessControlAllowOrigin))
+	assert.Equal(t, "2", rec.Header().Get(HeaderXRequestID))
+	assert.Equal(t, "text/plain", rec.Header().Get(HeaderContentType))
+}
+
+func TestResponseCache_NotCached(t *testing.T) {
+	var calls int32
+	srv := newResponseCacheServer(&calls)
+
+	for _, target := range []string{"/order", "/session", "/stock", "/missing"} {
+		doGet(srv, target, nil)
+		rec := doGet(srv, target, nil)
+		assert.NotEqual(t, "HIT", rec.Header().Get(HeaderXCache), target)
+	}
+	assert.EqualValues(t, 8, atomic.LoadInt32(&calls))
+
+	rec := doGet(srv, "/session", nil)
+	etag := rec.Header().Get(HeaderETag)
+	assert.NotEmpty(t, etag, "ETag is generated even if the response is not cached")
+	rec = doGet(srv, "/session", map[string]string{HeaderIfNoneMatch: etag})
+	assert.Equal(t, http.StatusOK, rec.Code, "body differs")
+	assert.Equal(t, http.StatusNotFound, doGet(srv, "/missing", nil).Code)
+}
+
+func TestResponseCache_LargeBody(t *testing.T) {
+	var calls int32
+	srv := NewRestServer()
+	srv.AddRoutes([]Route{
+		{
+			Name:    "GetFile",
+			Method:  http.MethodGet,
+			Pattern: "/file",
+			HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				w.Write(make([]byte, 600))
+				w.Write(make([]byte, 600))
+			},
+		},
+	}, ResponseCache(ResponseCacheConfig{
+		TTL:             time.Minute,
+		MaxBodySize:     1 << 10,
+		AnnotationStore: framework.AnnotationStore{"GetFile": {{Name: "cache"}}},
+	}))
+
+	rec := doGet(srv, "/file", nil)
+	assert.Equal(t, 1200, rec.Body.Len())
+	assert.Empty(t, rec.Header().Get(HeaderETag))
+	doGet(srv, "/file", nil)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+}
+
+func TestParseCacheControl(t *testing.T) {
+	directives := parseCacheControl(`public, Max-Age=60, s-maxage="120",no-transform`)
+	assert.Equal(t, map[string]string{"public": "", "max-age": "60", "s-maxage": "120", "no-transform": ""}, directives)
+	assert.Equal(t, 120*time.Second, storeTTL(http.Header{HeaderCacheControl: {"max-age=60, s-maxage=120"}}, time.Minute))
+	assert.Equal(t, time.Duration(0), storeTTL(http.Header{HeaderSetCookie: {"a=b"}}, time.Minute))
+	assert.True(t, etagMatch(`W/"abc"`, `"abc"`))
+	assert.True(t, etagMatch(`*`, `"abc"`))
+	assert.False(t, etagMatch(`"abd"`, `"abc"`))
+}
+
+func TestHandlerHeader(t *testing.T) {
+	before := http.Header{"X-Request-Id": {"1"}, "Vary": {"Origin"}}
+	after := before.Clone()
+	after.Add("Vary", "Accept")
+	after.Set("Location", "/order/1")
+	after.Set("Date", "now")
+	header := HandlerHeader(before, after, map[string]struct{}{"Date": {}})
+	assert.Equal(t, http.Header{"Vary": {"Origin", "Accept"}, "Location": {"/order/1"}}, header)
+}
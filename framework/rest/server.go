@@ -5,10 +5,10 @@ import (
 	"io/fs"
 	"net"
 	"net/http"
-	"os"
-	"os/signal"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/arl/statsviz"
@@ -21,13 +21,21 @@ import (
 	"github.com/samber/lo"
 	"github.com/unionj-cloud/go-doudou/v2/framework"
 	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
+	"github.com/unionj-cloud/go-doudou/v2/framework/listener"
+	"github.com/unionj-cloud/go-doudou/v2/framework/loglevel"
+	gddmetrics "github.com/unionj-cloud/go-doudou/v2/framework/metrics"
 	register "github.com/unionj-cloud/go-doudou/v2/framework/registry"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
 	"github.com/unionj-cloud/go-doudou/v2/framework/rest/httprouter"
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
 	"github.com/unionj-cloud/toolkit/stringutils"
-	logger "github.com/unionj-cloud/toolkit/zlogger"
 )
 
+// logger logs http server and middleware events, level of it can be changed by PUT /go-doudou/loggers/rest
+var logger = loglevel.Named("rest")
+
 type MiddlewareFunc func(http.Handler) http.Handler
 
 // Middleware allows MiddlewareFunc to implement the middleware interface.
@@ -86,15 +94,20 @@ func toMiddlewareFunc(m func(http.Handler) http.HandlerFunc) MiddlewareFunc {
 
 // RestServer wraps httpRouter router
 type RestServer struct {
-	bizRouter    *httprouter.RouteGroup
-	rootRouter   *httprouter.Router
-	gddRoutes    []Route
-	debugRoutes  []Route
-	bizRoutes    []Route
-	middlewares  []MiddlewareFunc
-	data         map[string]interface{}
-	panicHandler func(inner http.Handler) http.Handler
-	listenConfig *net.ListenConfig
+	bizRouter     *httprouter.RouteGroup
+	rootRouter    *httprouter.Router
+	gddRoutes     []Route
+	debugRoutes   []Route
+	bizRoutes     []Route
+	middlewares   []MiddlewareFunc
+	data          map[string]interface{}
+	panicHandler  func(inner http.Handler) http.Handler
+	errorRenderer ErrorRenderer
+	listenConfig  *net.ListenConfig
+	lifecycle     *lifecycle.Lifecycle
+	cors          *corsMiddleware
+	grpcServer    *grpcx.GrpcServer
+	grpcOnce      sync.Once
 	*http.Server
 }
 
@@ -156,26 +169,53 @@ func WithPanicHandler(panicHandler func(inner http.Handler) http.Handler) Server
 	}
 }
 
+// WithErrorRenderer customizes how errors recovered from panic are written to response,
+// e.g. WithErrorRenderer(ProblemJSONErrorRenderer) for RFC 7807 problem+json. It is ignored if WithPanicHandler is used.
+func WithErrorRenderer(renderer ErrorRenderer) ServerOption {
+	return func(server *RestServer) {
+		server.errorRenderer = renderer
+	}
+}
+
 func WithUserData(userData map[string]interface{}) ServerOption {
 	return func(server *RestServer) {
 		server.data = userData
 	}
 }
 
+// WithListenConfig sets net.ListenConfig of listeners opened by Run, e.g. WithListenConfig(listener.ReusePort())
+// to set SO_REUSEPORT on tcp sockets
 func WithListenConfig(listenConfig *net.ListenConfig) ServerOption {
 	return func(server *RestServer) {
 		server.listenConfig = listenConfig
 	}
 }
 
+// WithLifecycle sets lifecycle.Lifecycle instance which coordinates shutdown of the server, default is lifecycle.Default()
+func WithLifecycle(lc *lifecycle.Lifecycle) ServerOption {
+	return func(server *RestServer) {
+		server.lifecycle = lc
+	}
+}
+
+// WithCors enables CORS for business routes by conf instead of GDD_CORS_* environment variables,
+// so that it is not updated by remote configuration changes. It panics if conf is invalid, see CorsConfig.Validate.
+func WithCors(conf CorsConfig) ServerOption {
+	return func(server *RestServer) {
+		server.cors = &corsMiddleware{}
+		if err := server.cors.update(conf); err != nil {
+			panic(err)
+		}
+	}
+}
+
 // NewRestServerWithOptions create a RestServer instance with options
 func NewRestServerWithOptions(options ...ServerOption) *RestServer {
 	rootRouter := httprouter.New()
 	rootRouter.SaveMatchedRoutePath = true
 	srv := &RestServer{
-		bizRouter:    rootRouter.NewGroup(config.GddConfig.RouteRootPath),
-		rootRouter:   rootRouter,
-		panicHandler: recovery,
+		bizRouter:  rootRouter.NewGroup(config.GddConfig.RouteRootPath),
+		rootRouter: rootRouter,
 		Server: &http.Server{
 			// Good practice to set timeouts to avoid Slowloris attacks.
 			WriteTimeout: config.GddConfig.WriteTimeout,
@@ -184,11 +224,30 @@ func NewRestServerWithOptions(options ...ServerOption) *RestServer {
 			Handler:      rootRouter, // Pass our instance of httprouter.Router in.
 		},
 	}
+	tlsConfig, err := tlsx.ServerConfig("h2", "http/1.1")
+	if err != nil {
+		logger.Panic().Err(err).Msg("[go-doudou] invalid tls config")
+	}
+	srv.Server.TLSConfig = tlsConfig
 	for _, fn := range options {
 		fn(srv)
 	}
+	if srv.lifecycle == nil {
+		srv.lifecycle = lifecycle.Default()
+	}
+	if srv.errorRenderer == nil {
+		srv.errorRenderer = JSONErrorRenderer
+	}
+	if srv.panicHandler == nil {
+		srv.panicHandler = recoveryWith(srv.errorRenderer)
+	}
+	if srv.cors == nil {
+		reloadEnvCors()
+		srv.cors = envCors
+	}
 	srv.middlewares = append(srv.middlewares,
 		srv.panicHandler,
+		srv.cors.Middleware,
 		tracing,
 		metrics,
 		gzipBody,
@@ -206,13 +265,21 @@ func NewRestServerWithOptions(options ...ServerOption) *RestServer {
 	srv.middlewares = append(srv.middlewares,
 		requestid.RequestIDHandler,
 		handlers.ProxyHeaders,
+		deadline(srv.errorRenderer),
 	)
-	if config.GddConfig.ManageEnable {
+	publicMetrics := gddmetrics.Public()
+	// RED metrics are collected independent of the manage switch, only the /metrics route depends on it
+	if gddmetrics.Enabled() {
 		srv.middlewares = append([]MiddlewareFunc{PrometheusMiddleware}, srv.middlewares...)
+	}
+	if config.GddConfig.ManageEnable {
 		basicAuthMiddle := MiddlewareFunc(basicAuth())
 		gddmiddlewares := []MiddlewareFunc{metrics, basicAuthMiddle}
-		srv.gddRoutes = append(srv.gddRoutes, promRoutes()...)
+		if !publicMetrics {
+			srv.gddRoutes = append(srv.gddRoutes, promRoutes()...)
+		}
 		srv.gddRoutes = append(srv.gddRoutes, configRoutes()...)
+		srv.gddRoutes = append(srv.gddRoutes, srv.adminRoutes()...)
 		if _, ok := config.ServiceDiscoveryMap()[constants.SD_MEMBERLIST]; ok {
 			srv.gddRoutes = append(srv.gddRoutes, MemberlistUIRoutes()...)
 		}
@@ -251,6 +318,7 @@ func NewRestServerWithOptions(options ...ServerOption) *RestServer {
 					h = gddmiddlewares[i].Middleware(h)
 				}
 				srv.bizRouter.Handler(item.Method, item.Pattern, h, item.Name)
+				item.middlewares = middlewareNames(gddmiddlewares)
 			}
 			item.Pattern = srv.bizRouter.SubPath(item.Pattern)
 			srv.gddRoutes[k] = item
@@ -307,11 +375,26 @@ func NewRestServerWithOptions(options ...ServerOption) *RestServer {
 					h = gddmiddlewares[i].Middleware(h)
 				}
 				srv.bizRouter.Handler(item.Method, item.Pattern, h, item.Name)
+				item.middlewares = middlewareNames(gddmiddlewares)
 			}
 			item.Pattern = srv.bizRouter.SubPath(item.Pattern)
 			srv.debugRoutes[k] = item
 		}
 	}
+	for _, item := range healthRoutes(srv.lifecycle) {
+		srv.bizRouter.Handler(item.Method, item.Pattern, item.HandlerFunc, item.Name)
+		item.Pattern = srv.bizRouter.SubPath(item.Pattern)
+		srv.gddRoutes = append(srv.gddRoutes, item)
+	}
+	if publicMetrics {
+		// scraped without credentials like health checks, only if it is asked for explicitly
+		for _, item := range promRoutes() {
+			srv.bizRouter.Handler(item.Method, item.Pattern, item.HandlerFunc, item.Name)
+			item.Pattern = srv.bizRouter.SubPath(item.Pattern)
+			srv.gddRoutes = append(srv.gddRoutes, item)
+		}
+	}
+	srv.rootRouter.GlobalOPTIONS = http.HandlerFunc(srv.cors.preflight)
 	srv.rootRouter.NotFound = http.HandlerFunc(http.NotFound)
 	srv.rootRouter.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -332,6 +415,7 @@ func (srv *RestServer) groupRoutes(routeGroup *httprouter.RouteGroup, routes []R
 		}
 		routeGroup.Handler(item.Method, item.Pattern, h, item.Name)
 		item.Pattern = routeGroup.SubPath(item.Pattern)
+		item.middlewares = middlewareNames(mwf)
 		srv.bizRoutes = append(srv.bizRoutes, item)
 	}
 }
@@ -376,45 +460,56 @@ func (srv *RestServer) Use(mwf ...func(http.Handler) http.Handler) {
 	}
 }
 
-// Run runs http server
+// Run runs http server and blocks until it is shut down by SIGINT, SIGTERM or SIGQUIT. It serves https if
+// GDD_TLS_CERT_FILE and GDD_TLS_KEY_FILE are set, see package tlsx for details.
+// It listens on addresses in GDD_LISTEN, or GDD_HOST:GDD_PORT if it is empty, see package listener for details.
+// Shutdown is coordinated by lifecycle.Default() unless WithLifecycle is used, see package lifecycle for details.
 func (srv *RestServer) Run() {
-	var (
-		ln  net.Listener
-		err error
-	)
-	if srv.listenConfig != nil {
-		ln, err = srv.listenConfig.Listen(context.Background(), "tcp", strings.Join([]string{config.GddConfig.Host, config.GddConfig.Port}, ":"))
-	} else {
-		ln, err = net.Listen("tcp", strings.Join([]string{config.GddConfig.Host, config.GddConfig.Port}, ":"))
+	addrs, err := listener.ParseAddresses(config.GddListen.LoadOrDefault(net.JoinHostPort(config.GddConfig.Host, config.GddConfig.Port)))
+	if err != nil {
+		logger.Panic().Msg(err.Error())
 	}
+	lns, err := listener.Listen(context.Background(), listener.ListenConfig(srv.listenConfig), addrs)
 	if err != nil {
 		logger.Panic().Msg(err.Error())
 	}
-	srv.Serve(ln)
-	defer func() {
-		logger.Info().Msgf("Rest server is gracefully shutting down in %s", config.GddConfig.GraceTimeout)
-		// Make sure to set a deadline on exiting the process
-		// after upg.Exit() is closed. No new upgrades can be
-		// performed if the parent doesn't exit.
-		time.AfterFunc(config.GddConfig.GraceTimeout, func() {
-			logger.Error().Msg("Graceful shutdown timed out")
-			config.Shutdown()
-			os.Exit(1)
-		})
-		register.ShutdownRest()
-		srv.Shutdown(context.Background())
-	}()
+	srv.ServeListeners(lns...)
+	srv.lifecycle.AddServer("http", srv)
+	srv.lifecycle.SetReady(true)
+	srv.lifecycle.Wait()
+}
 
-	c := make(chan os.Signal, 1)
-	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C)
-	// SIGKILL, SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
-	signal.Notify(c, os.Interrupt)
+// Deregister removes the http service from service registry, it implements lifecycle.Server
+func (srv *RestServer) Deregister() {
+	register.ShutdownRest()
+}
 
-	// Block until we receive our signal.
-	<-c
+// Drain gracefully shuts down the http server, and the grpc server set by WithGrpcServer if any.
+// It implements lifecycle.Server
+func (srv *RestServer) Drain(ctx context.Context) error {
+	if srv.grpcServer == nil {
+		return srv.Shutdown(ctx)
+	}
+	// grpc health watch streams keep http2 connections active until the grpc server is drained
+	grpcErr := make(chan error, 1)
+	go func() {
+		grpcErr <- srv.grpcServer.Drain(ctx)
+	}()
+	err := srv.Shutdown(ctx)
+	if gerr := <-grpcErr; err == nil {
+		err = gerr
+	}
+	return err
 }
 
+// Serve serves http requests from ln in background
 func (srv *RestServer) Serve(ln net.Listener) {
+	srv.ServeListeners(ln)
+}
+
+// ServeListeners serves http requests from all listeners in background. Only the port of the first tcp listener
+// is registered to service registry, the service is not registered if there is no tcp listener.
+func (srv *RestServer) ServeListeners(lns ...net.Listener) {
 	var all []Route
 	all = append(all, srv.bizRoutes...)
 	all = append(all, srv.gddRoutes...)
@@ -435,15 +530,43 @@ func (srv *RestServer) Serve(ln net.Listener) {
 	Docs = docs.ToSlice()
 	framework.PrintBanner()
 	framework.PrintLock.Lock()
-	register.NewRest(srv.data)
+	if port, ok := listener.TCPPort(lns); ok {
+		// registry reads the port from GDD_PORT, it differs from the port listened on by GDD_LISTEN or systemd
+		if uint64(port) != config.GetPort() {
+			config.GddPort.Write(strconv.Itoa(port))
+		}
+		if srv.grpcServer != nil {
+			register.NewMux(srv.data)
+		} else {
+			register.NewRest(srv.data)
+		}
+	} else {
+		logger.Warn().Msg("[go-doudou] http server has no tcp listener, skip registering to service registry")
+	}
 	srv.printRoutes()
-	// Run our server in a goroutine so that it doesn't block.
-	go func() {
-		if err := srv.Server.Serve(ln); err != http.ErrServerClosed {
-			logger.Error().Msgf("HTTP server: %s", err.Error())
+	if srv.grpcServer != nil {
+		srv.grpcOnce.Do(srv.serveGrpc)
+	}
+	for _, ln := range lns {
+		// Run our server in a goroutine so that it doesn't block.
+		go func(ln net.Listener) {
+			var err error
+			if srv.TLSConfig != nil {
+				// certificate is provided by TLSConfig.GetCertificate
+				err = srv.Server.ServeTLS(ln, "", "")
+			} else {
+				err = srv.Server.Serve(ln)
+			}
+			if err != http.ErrServerClosed {
+				logger.Error().Msgf("HTTP server: %s", err.Error())
+			}
+		}(ln)
+		if srv.TLSConfig != nil {
+			logger.Info().Msgf("Http server is listening at %v with tls", ln.Addr().String())
+		} else {
+			logger.Info().Msgf("Http server is listening at %v", ln.Addr().String())
 		}
-	}()
-	logger.Info().Msgf("Http server is listening at %v", ln.Addr().String())
+	}
 	logger.Info().Msgf("Http server started in %s", time.Since(startAt))
 	framework.PrintLock.Unlock()
 }
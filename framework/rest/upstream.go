@@ -0,0 +1,123 @@
+package rest
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry"
+	"github.com/unionj-cloud/toolkit/stringutils"
+)
+
+// Upstream defines a static backend server which is not registered to any service registry
+type Upstream struct {
+	URL    string
+	Weight int
+	// Version is optional, it is matched against version of routing rule splits
+	Version string
+}
+
+// ParseUpstreams parses static upstream table from string like
+// legacy=http://10.0.0.1:8080|3,http://10.0.0.2:8080|1|v2;billing=http://billing:9000
+func ParseUpstreams(s string) (map[string][]Upstream, error) {
+	result := make(map[string][]Upstream)
+	for _, item := range strings.Split(s, ";") {
+		item = strings.TrimSpace(item)
+		if stringutils.IsEmpty(item) {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || stringutils.IsEmpty(strings.TrimSpace(kv[0])) {
+			return nil, errors.Errorf("invalid upstream declaration: %s", item)
+		}
+		name := strings.TrimSpace(kv[0])
+		for _, server := range strings.Split(kv[1], ",") {
+			server = strings.TrimSpace(server)
+			if stringutils.IsEmpty(server) {
+				continue
+			}
+			fields := strings.Split(server, "|")
+			if len(fields) > 3 {
+				return nil, errors.Errorf("invalid upstream %s for service %s", server, name)
+			}
+			upstream := Upstream{
+				URL:    strings.TrimSpace(fields[0]),
+				Weight: 1,
+			}
+			if len(fields) > 1 {
+				weight, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+				if err != nil || weight <= 0 {
+					return nil, errors.Errorf("invalid weight of upstream %s for service %s", server, name)
+				}
+				upstream.Weight = weight
+			}
+			if len(fields) > 2 {
+				upstream.Version = strings.TrimSpace(fields[2])
+			}
+			if _, err := url.ParseRequestURI(upstream.URL); err != nil {
+				return nil, errors.Wrapf(err, "invalid url of upstream for service %s", name)
+			}
+			result[name] = append(result[name], upstream)
+		}
+	}
+	return result, nil
+}
+
+type staticServer struct {
+	baseUrl       string
+	weight        int
+	currentWeight int
+}
+
+var _ registry.IServiceProvider = (*StaticServiceProvider)(nil)
+
+// StaticServiceProvider is a smooth weighted round-robin service provider for static upstreams
+// https://github.com/nginx/nginx/commit/52327e0627f49dbda1e8db695e63a4b0af4448b1
+type StaticServiceProvider struct {
+	name    string
+	servers []*staticServer
+	lock    sync.Mutex
+}
+
+// SelectServer selects an upstream for the service
+func (s *StaticServiceProvider) SelectServer() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.servers) == 0 {
+		return ""
+	}
+	var selected *staticServer
+	total := 0
+	for _, server := range s.servers {
+		server.currentWeight += server.weight
+		total += server.weight
+		if selected == nil || server.currentWeight > selected.currentWeight {
+			selected = server
+		}
+	}
+	selected.currentWeight -= total
+	return selected.baseUrl
+}
+
+func (s *StaticServiceProvider) Close() {
+}
+
+// NewStaticServiceProvider creates a StaticServiceProvider instance
+func NewStaticServiceProvider(name string, upstreams []Upstream) *StaticServiceProvider {
+	sp := &StaticServiceProvider{
+		name: name,
+	}
+	for _, upstream := range upstreams {
+		weight := upstream.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		sp.servers = append(sp.servers, &staticServer{
+			baseUrl: strings.TrimSuffix(upstream.URL, "/"),
+			weight:  weight,
+		})
+	}
+	return sp
+}
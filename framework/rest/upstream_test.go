@@ -0,0 +1,90 @@
+package rest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUpstreams(t *testing.T) {
+	upstreams, err := ParseUpstreams("legacy=http://10.0.0.1:8080|3, http://10.0.0.2:8080;billing=http://billing:9000/api;")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]Upstream{
+		"legacy": {
+			{URL: "http://10.0.0.1:8080", Weight: 3},
+			{URL: "http://10.0.0.2:8080", Weight: 1},
+		},
+		"billing": {
+			{URL: "http://billing:9000/api", Weight: 1},
+		},
+	}, upstreams)
+
+	upstreams, err = ParseUpstreams("order=http://10.0.0.1:8080|2|v1,http://10.0.0.2:8080|1|v2")
+	require.NoError(t, err)
+	assert.Equal(t, []Upstream{
+		{URL: "http://10.0.0.1:8080", Weight: 2, Version: "v1"},
+		{URL: "http://10.0.0.2:8080", Weight: 1, Version: "v2"},
+	}, upstreams["order"])
+
+	upstreams, err = ParseUpstreams("")
+	require.NoError(t, err)
+	assert.Empty(t, upstreams)
+}
+
+func TestParseUpstreams_Invalid(t *testing.T) {
+	for _, s := range []string{
+		"legacy",
+		"=http://10.0.0.1:8080",
+		"legacy=http://10.0.0.1:8080|abc",
+		"legacy=http://10.0.0.1:8080|0",
+		"legacy=10.0.0.1:8080",
+		"legacy=http://10.0.0.1:8080|1|v1|x",
+	} {
+		_, err := ParseUpstreams(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestStaticServiceProvider_SelectServer(t *testing.T) {
+	sp := NewStaticServiceProvider("legacy", []Upstream{
+		{URL: "http://a/", Weight: 5},
+		{URL: "http://b", Weight: 1},
+		{URL: "http://c", Weight: 1},
+	})
+	var selected []string
+	for i := 0; i < 7; i++ {
+		selected = append(selected, sp.SelectServer())
+	}
+	// smooth weighted round-robin should not pick the heavy server five times in a row
+	assert.Equal(t, []string{"http://a", "http://a", "http://b", "http://a", "http://c", "http://a", "http://a"}, selected)
+	assert.Equal(t, "", NewStaticServiceProvider("empty", nil).SelectServer())
+}
+
+func TestProxy_StaticUpstream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s?%s", r.URL.Path, r.URL.RawQuery)
+	}))
+	defer upstream.Close()
+	t.Setenv("GDD_SERVICE_DISCOVERY_MODE", "")
+
+	gateway := Proxy(ProxyConfig{
+		Upstreams: map[string][]Upstream{
+			"legacy": {{URL: upstream.URL + "/v1"}},
+		},
+	})(nil)
+
+	rec := httptest.NewRecorder()
+	gateway.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/legacy/users?page=1", nil))
+	body, _ := io.ReadAll(rec.Body)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "/v1/users?page=1", string(body))
+
+	rec = httptest.NewRecorder()
+	gateway.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/unknown/users", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+}
@@ -0,0 +1,205 @@
+package rest
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/toolkit/cast"
+	"github.com/unionj-cloud/toolkit/stringutils"
+)
+
+// UpstreamPolicy defines timeout, retry and passive outlier ejection policy of a service behind rest.Proxy gateway
+type UpstreamPolicy struct {
+	// Timeout applies to each attempt, 0 means no timeout
+	Timeout time.Duration
+	// Retries is max retries on another instance. Only idempotent requests without body are retried,
+	// on connection error or 5xx response.
+	Retries int
+	// ConsecutiveErrors is the number of consecutive 5xx responses or connection errors after which
+	// an instance is ejected, 0 means outlier ejection is disabled
+	ConsecutiveErrors int
+	// BaseEjectionTime is multiplied by the number of continuous ejections of the instance
+	BaseEjectionTime time.Duration
+	MaxEjectionTime  time.Duration
+}
+
+// DefaultUpstreamPolicy returns policy configured by GDD_GATEWAY_TIMEOUT, GDD_GATEWAY_RETRIES and GDD_GATEWAY_OUTLIER_* environment variables
+func DefaultUpstreamPolicy() UpstreamPolicy {
+	policy := UpstreamPolicy{
+		Timeout:           config.GddGatewayTimeout.LoadDurationOrDefault(config.DefaultGddGatewayTimeout),
+		Retries:           config.DefaultGddGatewayRetries,
+		ConsecutiveErrors: config.DefaultGddGatewayOutlierConsecutiveErrors,
+		BaseEjectionTime:  config.GddGatewayOutlierBaseEjectionTime.LoadDurationOrDefault(config.DefaultGddGatewayOutlierBaseEjectionTime),
+		MaxEjectionTime:   config.GddGatewayOutlierMaxEjectionTime.LoadDurationOrDefault(config.DefaultGddGatewayOutlierMaxEjectionTime),
+	}
+	if stringutils.IsNotEmpty(config.GddGatewayRetries.Load()) {
+		if retries, err := cast.ToIntE(config.GddGatewayRetries.Load()); err == nil {
+			policy.Retries = retries
+		}
+	}
+	if stringutils.IsNotEmpty(config.GddGatewayOutlierConsecutiveErrors.Load()) {
+		if n, err := cast.ToIntE(config.GddGatewayOutlierConsecutiveErrors.Load()); err == nil {
+			policy.ConsecutiveErrors = n
+		}
+	}
+	return policy
+}
+
+// ParsePolicies parses per service policies from string like order=timeout:3s,retries:2;billing=consecutiveErrors:3,
+// options not specified are inherited from base
+func ParsePolicies(s string, base UpstreamPolicy) (map[string]UpstreamPolicy, error) {
+	result := make(map[string]UpstreamPolicy)
+	for _, item := range strings.Split(s, ";") {
+		item = strings.TrimSpace(item)
+		if stringutils.IsEmpty(item) {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || stringutils.IsEmpty(strings.TrimSpace(kv[0])) {
+			return nil, errors.Errorf("invalid policy declaration: %s", item)
+		}
+		name := strings.TrimSpace(kv[0])
+		policy := base
+		for _, option := range strings.Split(kv[1], ",") {
+			option = strings.TrimSpace(option)
+			if stringutils.IsEmpty(option) {
+				continue
+			}
+			pair := strings.SplitN(option, ":", 2)
+			if len(pair) != 2 {
+				return nil, errors.Errorf("invalid policy option %s for service %s", option, name)
+			}
+			key, value := strings.TrimSpace(pair[0]), strings.TrimSpace(pair[1])
+			var err error
+			switch key {
+			case "timeout":
+				policy.Timeout, err = time.ParseDuration(value)
+			case "retries":
+				policy.Retries, err = strconv.Atoi(value)
+			case "consecutiveErrors":
+				policy.ConsecutiveErrors, err = strconv.Atoi(value)
+			case "baseEjectionTime":
+				policy.BaseEjectionTime, err = time.ParseDuration(value)
+			case "maxEjectionTime":
+				policy.MaxEjectionTime, err = time.ParseDuration(value)
+			default:
+				return nil, errors.Errorf("unknown policy option %s for service %s", key, name)
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid policy option %s for service %s", key, name)
+			}
+		}
+		result[name] = policy
+	}
+	return result, nil
+}
+
+var gatewayEjections = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "go_doudou_gateway_upstream_ejections_total",
+		Help: "Number of upstream instances ejected by gateway outlier detection.",
+	},
+	[]string{"service", "upstream"},
+)
+
+var gatewayEjected = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "go_doudou_gateway_upstream_ejected",
+		Help: "Whether upstream instance is ejected by gateway outlier detection currently.",
+	},
+	[]string{"service", "upstream"},
+)
+
+var gatewayRetries = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "go_doudou_gateway_retries_total",
+		Help: "Number of requests retried by gateway on another upstream instance.",
+	},
+	[]string{"service"},
+)
+
+func init() {
+	prometheus.Register(gatewayEjections)
+	prometheus.Register(gatewayEjected)
+	prometheus.Register(gatewayRetries)
+}
+
+type hostState struct {
+	consecutiveErrors int
+	ejections         int
+	ejectedUntil      time.Time
+}
+
+// outlierDetector ejects upstream instances passively by observing results of proxied requests
+type outlierDetector struct {
+	lock  sync.Mutex
+	hosts map[string]*hostState
+	now   func() time.Time
+}
+
+func newOutlierDetector() *outlierDetector {
+	return &outlierDetector{
+		hosts: make(map[string]*hostState),
+		now:   time.Now,
+	}
+}
+
+func (d *outlierDetector) ejected(service, upstream string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	state, ok := d.hosts[service+"|"+upstream]
+	if !ok || state.ejectedUntil.IsZero() {
+		return false
+	}
+	if d.now().Before(state.ejectedUntil) {
+		return true
+	}
+	state.ejectedUntil = time.Time{}
+	gatewayEjected.WithLabelValues(service, upstream).Set(0)
+	logger.Info().Msgf("[go-doudou] upstream %s of service %s is back from ejection", upstream, service)
+	return false
+}
+
+// report records result of an attempt to upstream
+func (d *outlierDetector) report(service, upstream string, policy UpstreamPolicy, failed bool) {
+	if policy.ConsecutiveErrors <= 0 {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	key := service + "|" + upstream
+	state, ok := d.hosts[key]
+	if !ok {
+		if !failed {
+			return
+		}
+		state = &hostState{}
+		d.hosts[key] = state
+	}
+	if !failed {
+		state.consecutiveErrors = 0
+		if state.ejectedUntil.IsZero() {
+			state.ejections = 0
+		}
+		return
+	}
+	state.consecutiveErrors++
+	if state.consecutiveErrors < policy.ConsecutiveErrors || !state.ejectedUntil.IsZero() {
+		return
+	}
+	state.consecutiveErrors = 0
+	state.ejections++
+	duration := policy.BaseEjectionTime * time.Duration(state.ejections)
+	if policy.MaxEjectionTime > 0 && duration > policy.MaxEjectionTime {
+		duration = policy.MaxEjectionTime
+	}
+	state.ejectedUntil = d.now().Add(duration)
+	gatewayEjections.WithLabelValues(service, upstream).Inc()
+	gatewayEjected.WithLabelValues(service, upstream).Set(1)
+	logger.Warn().Msgf("[go-doudou] upstream %s of service %s is ejected for %s", upstream, service, duration)
+}
@@ -0,0 +1,172 @@
+package rest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultUpstreamPolicy(t *testing.T) {
+	t.Setenv("GDD_GATEWAY_TIMEOUT", "3s")
+	t.Setenv("GDD_GATEWAY_RETRIES", "2")
+	t.Setenv("GDD_GATEWAY_OUTLIER_CONSECUTIVE_ERRORS", "0")
+	assert.Equal(t, UpstreamPolicy{
+		Timeout:           3 * time.Second,
+		Retries:           2,
+		ConsecutiveErrors: 0,
+		BaseEjectionTime:  30 * time.Second,
+		MaxEjectionTime:   5 * time.Minute,
+	}, DefaultUpstreamPolicy())
+}
+
+func TestParsePolicies(t *testing.T) {
+	base := UpstreamPolicy{Retries: 1, ConsecutiveErrors: 5, BaseEjectionTime: time.Second}
+	policies, err := ParsePolicies("order=timeout:3s, retries:2;billing=consecutiveErrors:3,baseEjectionTime:1m,maxEjectionTime:10m;", base)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]UpstreamPolicy{
+		"order":   {Timeout: 3 * time.Second, Retries: 2, ConsecutiveErrors: 5, BaseEjectionTime: time.Second},
+		"billing": {Retries: 1, ConsecutiveErrors: 3, BaseEjectionTime: time.Minute, MaxEjectionTime: 10 * time.Minute},
+	}, policies)
+
+	for _, s := range []string{
+		"order",
+		"=timeout:3s",
+		"order=timeout",
+		"order=timeout:abc",
+		"order=retries:x",
+		"order=unknown:1",
+	} {
+		_, err = ParsePolicies(s, base)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestOutlierDetector(t *testing.T) {
+	now := time.Now()
+	d := newOutlierDetector()
+	d.now = func() time.Time {
+		return now
+	}
+	policy := UpstreamPolicy{ConsecutiveErrors: 2, BaseEjectionTime: time.Minute, MaxEjectionTime: 90 * time.Second}
+
+	d.report("svc", "http://a", policy, true)
+	d.report("svc", "http://a", policy, false)
+	d.report("svc", "http://a", policy, true)
+	assert.False(t, d.ejected("svc", "http://a"), "errors are not consecutive")
+	d.report("svc", "http://a", policy, true)
+	assert.True(t, d.ejected("svc", "http://a"))
+	assert.False(t, d.ejected("other", "http://a"))
+
+	now = now.Add(time.Minute)
+	assert.False(t, d.ejected("svc", "http://a"))
+	// ejection time grows with continuous ejections and is capped by MaxEjectionTime
+	d.report("svc", "http://a", policy, true)
+	d.report("svc", "http://a", policy, true)
+	now = now.Add(89 * time.Second)
+	assert.True(t, d.ejected("svc", "http://a"))
+	now = now.Add(time.Second)
+	assert.False(t, d.ejected("svc", "http://a"))
+
+	d.report("svc", "http://b", UpstreamPolicy{}, true)
+	d.report("svc", "http://b", UpstreamPolicy{}, true)
+	assert.False(t, d.ejected("svc", "http://b"), "outlier ejection is disabled")
+}
+
+func TestProxy_Retry(t *testing.T) {
+	var badHits, goodHits int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&badHits, 1)
+		http.Error(w, "bad", http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&goodHits, 1)
+		io.WriteString(w, "good")
+	}))
+	defer good.Close()
+	t.Setenv("GDD_SERVICE_DISCOVERY_MODE", "")
+
+	gateway := Proxy(ProxyConfig{
+		Upstreams: map[string][]Upstream{
+			"svc": {{URL: bad.URL, Weight: 1}, {URL: good.URL, Weight: 1}},
+		},
+		Policies: map[string]UpstreamPolicy{
+			"svc": {Retries: 1, ConsecutiveErrors: 2, BaseEjectionTime: time.Minute},
+		},
+	})(nil)
+	serve := func(method string) (int, string) {
+		rec := httptest.NewRecorder()
+		gateway.ServeHTTP(rec, httptest.NewRequest(method, "/svc/hello", nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	for i := 0; i < 4; i++ {
+		code, body := serve(http.MethodGet)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "good", body)
+	}
+	// bad instance is ejected after two consecutive 503
+	assert.Equal(t, int32(2), atomic.LoadInt32(&badHits))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&goodHits))
+}
+
+func TestProxy_NoRetryForNonIdempotent(t *testing.T) {
+	var hits int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		http.Error(w, "bad", http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+	t.Setenv("GDD_SERVICE_DISCOVERY_MODE", "")
+
+	gateway := Proxy(ProxyConfig{
+		Upstreams: map[string][]Upstream{
+			"svc": {{URL: bad.URL}},
+		},
+		Policies: map[string]UpstreamPolicy{
+			"svc": {Retries: 3},
+		},
+	})(nil)
+	rec := httptest.NewRecorder()
+	gateway.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/svc/hello", strings.NewReader(`{}`)))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+	// the last attempt passes 5xx response through
+	rec = httptest.NewRecorder()
+	gateway.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/svc/hello", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, "bad\n", rec.Body.String())
+}
+
+func TestProxy_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+	t.Setenv("GDD_SERVICE_DISCOVERY_MODE", "")
+
+	gateway := Proxy(ProxyConfig{
+		Upstreams: map[string][]Upstream{
+			"svc": {{URL: slow.URL}},
+		},
+		Policies: map[string]UpstreamPolicy{
+			"svc": {Timeout: 50 * time.Millisecond},
+		},
+	})(nil)
+	rec := httptest.NewRecorder()
+	gateway.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/svc/hello", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+}
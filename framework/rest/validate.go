@@ -24,6 +24,25 @@ func SetTranslator(trans ut.Translator) {
 	translator = trans
 }
 
+// FieldError describes a failed validation rule of a field
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors is returned by ValidateStruct and ValidateVar, it keeps field level errors
+// and its error message is translated messages joined by comma
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	errmsgs := make([]string, 0, len(v))
+	for _, item := range v {
+		errmsgs = append(errmsgs, item.Message)
+	}
+	return strings.Join(errmsgs, ", ")
+}
+
 func handleValidationErr(err error) error {
 	if err == nil {
 		return nil
@@ -32,12 +51,20 @@ func handleValidationErr(err error) error {
 	if !ok {
 		return err
 	}
-	translations := errs.Translate(translator)
-	var errmsgs []string
-	for _, v := range translations {
-		errmsgs = append(errmsgs, v)
+	result := make(ValidationErrors, 0, len(errs))
+	for _, fe := range errs {
+		field := fe.Namespace()
+		// remove the top level struct name
+		if idx := strings.Index(field, "."); idx >= 0 {
+			field = field[idx+1:]
+		}
+		result = append(result, FieldError{
+			Field:   field,
+			Rule:    fe.Tag(),
+			Message: fe.Translate(translator),
+		})
 	}
-	return errors.New(strings.Join(errmsgs, ", "))
+	return result
 }
 
 func ValidateStruct(value interface{}) error {
@@ -45,8 +72,15 @@ func ValidateStruct(value interface{}) error {
 }
 
 func ValidateVar(value interface{}, tag, param string) error {
+	err := handleValidationErr(validate.Var(value, tag))
 	if stringutils.IsNotEmpty(param) {
-		return errors.Wrap(handleValidationErr(validate.Var(value, tag)), param)
+		var verrs ValidationErrors
+		if errors.As(err, &verrs) {
+			for i := range verrs {
+				verrs[i].Field = param
+			}
+		}
+		return errors.Wrap(err, param)
 	}
-	return handleValidationErr(validate.Var(value, tag))
+	return err
 }
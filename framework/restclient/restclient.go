@@ -1,6 +1,7 @@
 package restclient
 
 import (
+	"context"
 	"net"
 	"net/http"
 	"os"
@@ -9,10 +10,14 @@ import (
 
 	"github.com/go-resty/resty/v2"
 	"github.com/klauspost/compress/gzhttp"
-	"github.com/opentracing-contrib/go-stdlib/nethttp"
+	"github.com/slok/goresilience"
 	"github.com/unionj-cloud/go-doudou/v2/framework/config"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
 	"github.com/unionj-cloud/toolkit/cast"
+	logger "github.com/unionj-cloud/toolkit/zlogger"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 // RestClient defines service client interface
@@ -66,8 +71,15 @@ func NewServiceProvider(env string) *ServiceProvider {
 	}
 }
 
-// NewClient creates new resty Client instance
+// NewClient creates new resty Client instance. Https requests present GDD_TLS_CERT_FILE certificate for mutual TLS
+// and verify server certificates by GDD_TLS_CA_FILE if they are set, see package tlsx for details.
+// If request context has a deadline, remaining time is forwarded by X-Request-Timeout header, and requests fail
+// fast without being sent once the deadline is exceeded.
 func NewClient() *resty.Client {
+	tlsConfig, err := tlsx.ClientConfig()
+	if err != nil {
+		logger.Panic().Err(err).Msg("[go-doudou] invalid tls config")
+	}
 	client := resty.New()
 	client.SetTimeout(1 * time.Minute)
 	dialer := &net.Dialer{
@@ -75,23 +87,58 @@ func NewClient() *resty.Client {
 		KeepAlive: 30 * time.Second,
 		DualStack: true,
 	}
-	client.SetTransport(gzhttp.Transport(&nethttp.Transport{
-		RoundTripper: &http.Transport{
-			Proxy:                 http.ProxyFromEnvironment,
-			DialContext:           dialer.DialContext,
-			ForceAttemptHTTP2:     true,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-			MaxIdleConnsPerHost:   runtime.GOMAXPROCS(0) + 1,
-			MaxConnsPerHost:       10000,
-		},
-	}))
+	// otelhttp transport starts a client span for each request and injects
+	// W3C traceparent and baggage headers from request context
+	client.SetTransport(gzhttp.Transport(otelhttp.NewTransport(&http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		MaxIdleConnsPerHost:   runtime.GOMAXPROCS(0) + 1,
+		MaxConnsPerHost:       10000,
+		TLSClientConfig:       tlsConfig,
+	})))
 	retryCnt := config.DefaultGddRetryCount
 	if cnt, err := cast.ToIntE(config.GddRetryCount.Load()); err == nil {
 		retryCnt = cnt
 	}
 	client.SetRetryCount(retryCnt)
+	client.OnBeforeRequest(ForwardDeadline)
 	return client
 }
+
+// ForwardDeadline is resty request middleware setting X-Request-Timeout header to remaining time till deadline of
+// request context, it returns error of the context if the request should not be sent at all
+func ForwardDeadline(_ *resty.Client, req *resty.Request) error {
+	ctx := req.Context()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	remaining := time.Until(deadline)
+	if remaining < time.Millisecond {
+		return context.DeadlineExceeded
+	}
+	req.SetHeader(rest.HeaderXRequestTimeout, rest.FormatTimeout(remaining))
+	return nil
+}
+
+// FailFast returns goresilience middleware returning error of the context instead of running f once the context
+// is done. Put it after retry middleware so that remaining attempts are skipped once the caller has given up.
+func FailFast() goresilience.Middleware {
+	return func(next goresilience.Runner) goresilience.Runner {
+		next = goresilience.SanitizeRunner(next)
+		return goresilience.RunnerFunc(func(ctx context.Context, f goresilience.Func) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return next.Run(ctx, f)
+		})
+	}
+}
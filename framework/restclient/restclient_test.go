@@ -1,13 +1,20 @@
 package restclient_test
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+	"github.com/slok/goresilience"
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/unionj-cloud/go-doudou/v2/framework/config"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
 	"github.com/unionj-cloud/go-doudou/v2/framework/restclient"
 	"github.com/wubin1989/nacos-sdk-go/v2/common/constant"
 )
@@ -76,6 +83,53 @@ func TestRetryCount(t *testing.T) {
 	})
 }
 
+func TestForwardDeadline(t *testing.T) {
+	Convey("Forward remaining time budget and fail fast once it is exhausted", t, func() {
+		var header string
+		var requests int
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			header = r.Header.Get(rest.HeaderXRequestTimeout)
+		}))
+		defer ts.Close()
+		client := restclient.NewClient().SetRetryCount(0)
+
+		_, err := client.R().Get(ts.URL)
+		So(err, ShouldBeNil)
+		So(header, ShouldBeEmpty)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err = client.R().SetContext(ctx).Get(ts.URL)
+		So(err, ShouldBeNil)
+		budget, err := rest.ParseTimeout(header)
+		So(err, ShouldBeNil)
+		So(budget, ShouldBeBetweenOrEqual, 900*time.Millisecond, time.Second)
+
+		expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+		defer cancel()
+		_, err = client.R().SetContext(expired).Get(ts.URL)
+		So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+		So(requests, ShouldEqual, 2)
+	})
+}
+
+func TestFailFast(t *testing.T) {
+	Convey("Skip running f once the context is done", t, func() {
+		runner := goresilience.RunnerChain(restclient.FailFast())
+		var calls int
+		f := func(ctx context.Context) error {
+			calls++
+			return nil
+		}
+		So(runner.Run(context.Background(), f), ShouldBeNil)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		So(errors.Is(runner.Run(ctx, f), context.Canceled), ShouldBeTrue)
+		So(calls, ShouldEqual, 1)
+	})
+}
+
 func TestMain(m *testing.M) {
 	setup()
 	m.Run()
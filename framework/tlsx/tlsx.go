@@ -0,0 +1,346 @@
+// Package tlsx provides TLS and mutual TLS configuration for servers and clients from GDD_TLS_* environment
+// variables. Certificate, private key and CA files are watched and reloaded when they change on disk, so rotated
+// certificates take effect for new connections without restarting the process.
+package tlsx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/loglevel"
+	"github.com/unionj-cloud/toolkit/cast"
+	"github.com/unionj-cloud/toolkit/stringutils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+var logger = loglevel.Named("tlsx")
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify_if_given":    tls.VerifyClientCertIfGiven,
+	"require_and_verify": tls.RequireAndVerifyClientCert,
+}
+
+// Config configures TLS of servers and clients
+type Config struct {
+	CertFile           string
+	KeyFile            string
+	CAFile             string
+	ClientAuth         tls.ClientAuthType
+	ReloadInterval     time.Duration
+	ServerName         string
+	InsecureSkipVerify bool
+	// ClientEnable makes grpc clients connect by TLS
+	ClientEnable bool
+}
+
+// LoadConfig loads Config from GDD_TLS_* environment variables
+func LoadConfig() (Config, error) {
+	conf := Config{
+		CertFile:       config.GddTLSCertFile.Load(),
+		KeyFile:        config.GddTLSKeyFile.Load(),
+		CAFile:         config.GddTLSCAFile.Load(),
+		ReloadInterval: config.GddTLSReloadInterval.LoadDurationOrDefault(config.DefaultGddTLSReloadInterval),
+		ServerName:     config.GddTLSServerName.Load(),
+		InsecureSkipVerify: cast.ToBoolOrDefault(config.GddTLSInsecureSkipVerify.Load(),
+			config.DefaultGddTLSInsecureSkipVerify),
+		ClientEnable: cast.ToBoolOrDefault(config.GddTLSClientEnable.Load(), config.DefaultGddTLSClientEnable),
+	}
+	clientAuth := strings.ToLower(config.GddTLSClientAuth.LoadOrDefault(config.DefaultGddTLSClientAuth))
+	authType, ok := clientAuthTypes[clientAuth]
+	if !ok {
+		return Config{}, errors.Errorf("invalid %s %s", config.GddTLSClientAuth, clientAuth)
+	}
+	conf.ClientAuth = authType
+	if stringutils.IsEmpty(conf.CertFile) != stringutils.IsEmpty(conf.KeyFile) {
+		return Config{}, errors.Errorf("%s and %s must be set together", config.GddTLSCertFile, config.GddTLSKeyFile)
+	}
+	if authType >= tls.VerifyClientCertIfGiven && stringutils.IsEmpty(conf.CAFile) {
+		return Config{}, errors.Errorf("%s is required to verify client certificates", config.GddTLSCAFile)
+	}
+	return conf, nil
+}
+
+// ServerEnabled reports whether servers should serve TLS
+func (c Config) ServerEnabled() bool {
+	return stringutils.IsNotEmpty(c.CertFile) && stringutils.IsNotEmpty(c.KeyFile)
+}
+
+// ClientEnabled reports whether grpc clients should connect by TLS. It is opted in by ClientEnable only,
+// because serving TLS doesn't mean that peers serve TLS as well.
+func (c Config) ClientEnabled() bool {
+	return c.ClientEnable
+}
+
+// clientConfigured reports whether https clients have anything other than defaults to use
+func (c Config) clientConfigured() bool {
+	return c.ClientEnable || c.ServerEnabled() || stringutils.IsNotEmpty(c.CAFile) || c.InsecureSkipVerify
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func stampOf(file string) fileStamp {
+	if stringutils.IsEmpty(file) {
+		return fileStamp{}
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
+
+// Reloader keeps the latest certificate and CA pool loaded from files
+type Reloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	cert     atomic.Pointer[tls.Certificate]
+	pool     atomic.Pointer[x509.CertPool]
+	lock     sync.Mutex
+	stamps   [3]fileStamp
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewReloader loads certificate, key and CA files, any of them can be empty. If interval is positive,
+// files are checked for changes every interval until Close is called.
+func NewReloader(certFile, keyFile, caFile string, interval time.Duration) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		done:     make(chan struct{}),
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		go r.watch(interval)
+	}
+	return r, nil
+}
+
+func (r *Reloader) currentStamps() [3]fileStamp {
+	return [3]fileStamp{stampOf(r.certFile), stampOf(r.keyFile), stampOf(r.caFile)}
+}
+
+func (r *Reloader) changed() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.currentStamps() != r.stamps
+}
+
+// Reload loads files again, the previous certificate and CA pool are kept if any file is invalid
+func (r *Reloader) Reload() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	stamps := r.currentStamps()
+	var cert *tls.Certificate
+	if stringutils.IsNotEmpty(r.certFile) {
+		pair, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to load tls certificate")
+		}
+		cert = &pair
+	}
+	var pool *x509.CertPool
+	if stringutils.IsNotEmpty(r.caFile) {
+		data, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to load tls ca file")
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return errors.Errorf("no certificate found in tls ca file %s", r.caFile)
+		}
+	}
+	r.cert.Store(cert)
+	r.pool.Store(pool)
+	r.stamps = stamps
+	return nil
+}
+
+func (r *Reloader) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				logger.Error().Err(err).Msg("[go-doudou] failed to reload tls files, keep using the previous ones")
+				continue
+			}
+			logger.Info().Msg("[go-doudou] tls files reloaded")
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Certificate returns the latest certificate, it is nil if no certificate file is given
+func (r *Reloader) Certificate() *tls.Certificate {
+	return r.cert.Load()
+}
+
+// CertPool returns the latest CA pool, it is nil if no CA file is given
+func (r *Reloader) CertPool() *x509.CertPool {
+	return r.pool.Load()
+}
+
+// Close stops watching files
+func (r *Reloader) Close() {
+	r.once.Do(func() {
+		close(r.done)
+	})
+}
+
+// ServerTLSConfig returns tls.Config which serves the latest certificate and verifies client certificates
+// by the latest CA pool according to conf.ClientAuth
+func ServerTLSConfig(conf Config, r *Reloader, nextProtos ...string) *tls.Config {
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		ClientAuth: conf.ClientAuth,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if cert := r.Certificate(); cert != nil {
+				return cert, nil
+			}
+			return nil, errors.New("no tls certificate")
+		},
+	}
+	ret := base.Clone()
+	ret.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cfg := base.Clone()
+		cfg.ClientCAs = r.CertPool()
+		return cfg, nil
+	}
+	return ret
+}
+
+// ClientTLSConfig returns tls.Config which presents the latest certificate if the server asks for it, and
+// verifies server certificates by the latest CA pool at each handshake, or by system roots if no CA file is given
+func ClientTLSConfig(conf Config, r *Reloader) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         conf.ServerName,
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+	}
+	if !conf.InsecureSkipVerify && stringutils.IsNotEmpty(conf.CAFile) {
+		// RootCAs is fixed once the config is used, so the default verification is replaced by
+		// VerifyConnection against the CA pool reloaded from file
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyServer(cs, r.CertPool())
+		}
+	}
+	if stringutils.IsNotEmpty(conf.CertFile) {
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert := r.Certificate(); cert != nil {
+				return cert, nil
+			}
+			return &tls.Certificate{}, nil
+		}
+	}
+	return cfg
+}
+
+// verifyServer verifies server certificate chain and name like crypto/tls does with RootCAs set to roots
+func verifyServer(cs tls.ConnectionState, roots *x509.CertPool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no server certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return errors.Wrap(err, "failed to verify server certificate")
+}
+
+var (
+	defaultOnce     sync.Once
+	defaultConf     Config
+	defaultReloader *Reloader
+	defaultErr      error
+)
+
+func loadDefault() (Config, *Reloader, error) {
+	defaultOnce.Do(func() {
+		if defaultConf, defaultErr = LoadConfig(); defaultErr != nil {
+			return
+		}
+		if !defaultConf.clientConfigured() {
+			return
+		}
+		defaultReloader, defaultErr = NewReloader(defaultConf.CertFile, defaultConf.KeyFile, defaultConf.CAFile,
+			defaultConf.ReloadInterval)
+	})
+	return defaultConf, defaultReloader, defaultErr
+}
+
+// ServerEnabled reports whether servers serve TLS according to GDD_TLS_* environment variables
+func ServerEnabled() bool {
+	conf, _, err := loadDefault()
+	return err == nil && conf.ServerEnabled()
+}
+
+// ServerConfig returns server tls.Config from GDD_TLS_* environment variables, it returns nil if TLS is not enabled
+func ServerConfig(nextProtos ...string) (*tls.Config, error) {
+	conf, r, err := loadDefault()
+	if err != nil || !conf.ServerEnabled() {
+		return nil, err
+	}
+	return ServerTLSConfig(conf, r, nextProtos...), nil
+}
+
+// ClientConfig returns client tls.Config of https requests from GDD_TLS_* environment variables, it returns nil if
+// none of certificate, CA file, insecure skip verify and GDD_TLS_CLIENT_ENABLE is set
+func ClientConfig() (*tls.Config, error) {
+	conf, r, err := loadDefault()
+	if err != nil || !conf.clientConfigured() {
+		return nil, err
+	}
+	return ClientTLSConfig(conf, r), nil
+}
+
+// GrpcDialOptions returns dial option of TLS transport credentials from GDD_TLS_* environment variables,
+// it returns nothing unless GDD_TLS_CLIENT_ENABLE is true. Transport credentials given later override it.
+func GrpcDialOptions() ([]grpc.DialOption, error) {
+	conf, r, err := loadDefault()
+	if err != nil {
+		return nil, err
+	}
+	if !conf.ClientEnabled() {
+		return nil, nil
+	}
+	return []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(ClientTLSConfig(conf, r)))}, nil
+}
+
+// Scheme returns https if servers serve TLS, otherwise http
+func Scheme() string {
+	if ServerEnabled() {
+		return "https"
+	}
+	return "http"
+}
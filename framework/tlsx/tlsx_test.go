@@ -0,0 +1,212 @@
+package tlsx
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns PEM encoded certificate and key signed by the CA
+func (ca *testCA) issue(t *testing.T, serial int64, commonName string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func writeFile(t *testing.T, file string, data []byte) {
+	require.NoError(t, os.WriteFile(file, data, 0600))
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("GDD_TLS_CLIENT_AUTH", "unknown")
+	_, err := LoadConfig()
+	assert.Error(t, err)
+
+	t.Setenv("GDD_TLS_CLIENT_AUTH", "require_and_verify")
+	t.Setenv("GDD_TLS_CERT_FILE", "server.pem")
+	t.Setenv("GDD_TLS_KEY_FILE", "server-key.pem")
+	_, err = LoadConfig()
+	assert.Error(t, err, "ca file is required")
+
+	t.Setenv("GDD_TLS_CA_FILE", "ca.pem")
+	conf, err := LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, conf.ClientAuth)
+	assert.True(t, conf.ServerEnabled())
+	assert.False(t, conf.ClientEnabled(), "serving tls doesn't enable grpc client tls")
+
+	t.Setenv("GDD_TLS_KEY_FILE", "")
+	_, err = LoadConfig()
+	assert.Error(t, err, "cert and key must be set together")
+
+	t.Setenv("GDD_TLS_CERT_FILE", "")
+	t.Setenv("GDD_TLS_CLIENT_AUTH", "")
+	conf, err = LoadConfig()
+	require.NoError(t, err)
+	assert.False(t, conf.ServerEnabled())
+	assert.False(t, conf.ClientEnabled())
+	assert.True(t, conf.clientConfigured(), "ca file is used by https clients")
+
+	t.Setenv("GDD_TLS_CLIENT_ENABLE", "true")
+	conf, err = LoadConfig()
+	require.NoError(t, err)
+	assert.True(t, conf.ClientEnabled())
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	caFile := filepath.Join(dir, "ca.pem")
+	cert, key := ca.issue(t, 2, "first")
+	writeFile(t, certFile, cert)
+	writeFile(t, keyFile, key)
+	writeFile(t, caFile, ca.pem)
+
+	conf := Config{
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		CAFile:     caFile,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	}
+	r, err := NewReloader(certFile, keyFile, caFile, 10*time.Millisecond)
+	require.NoError(t, err)
+	defer r.Close()
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, req.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	srv.TLS = ServerTLSConfig(conf, r, "http/1.1")
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(tlsConfig *tls.Config) (string, string, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			return "", "", err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), resp.TLS.PeerCertificates[0].Subject.CommonName, nil
+	}
+
+	peer, server, err := get(ClientTLSConfig(conf, r))
+	require.NoError(t, err)
+	assert.Equal(t, "first", peer)
+	assert.Equal(t, "first", server)
+
+	_, _, err = get(ClientTLSConfig(Config{CAFile: caFile}, r))
+	assert.Error(t, err, "client certificate is required")
+
+	cert, key = ca.issue(t, 3, "second")
+	writeFile(t, certFile, cert)
+	writeFile(t, keyFile, key)
+	// make sure modification time changes on file systems with coarse timestamps
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	require.NoError(t, os.Chtimes(keyFile, later, later))
+	require.Eventually(t, func() bool {
+		return r.Certificate() != nil && r.Certificate().Leaf != nil && r.Certificate().Leaf.Subject.CommonName == "second"
+	}, 2*time.Second, 10*time.Millisecond)
+	_, server, err = get(ClientTLSConfig(conf, r))
+	require.NoError(t, err)
+	assert.Equal(t, "second", server, "reloaded certificate is served to new connections")
+
+	writeFile(t, caFile, []byte("invalid"))
+	require.NoError(t, os.Chtimes(caFile, later.Add(time.Second), later.Add(time.Second)))
+	assert.Error(t, r.Reload())
+	assert.NotNil(t, r.CertPool(), "previous ca pool is kept")
+}
+
+func TestClientTLSConfig_ReloadCA(t *testing.T) {
+	dir := t.TempDir()
+	oldCA, newCA := newTestCA(t), newTestCA(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	writeFile(t, caFile, oldCA.pem)
+	r, err := NewReloader("", "", caFile, 0)
+	require.NoError(t, err)
+
+	cert, key := newCA.issue(t, 2, "server")
+	pair, err := tls.X509KeyPair(cert, key)
+	require.NoError(t, err)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{pair}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// the same config is used before and after the ca file is rotated
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   ClientTLSConfig(Config{CAFile: caFile}, r),
+		DisableKeepAlives: true,
+	}}
+	_, err = client.Get(srv.URL)
+	assert.Error(t, err, "server certificate is not signed by the old ca")
+
+	writeFile(t, caFile, newCA.pem)
+	require.NoError(t, r.Reload())
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+}
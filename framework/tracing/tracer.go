@@ -1,67 +1,189 @@
 package tracing
 
 import (
+	"context"
 	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 
-	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
-	"github.com/rs/zerolog"
-	"github.com/uber/jaeger-client-go/config"
-	"github.com/uber/jaeger-client-go/rpcmetrics"
-	"github.com/uber/jaeger-lib/metrics"
-	jprom "github.com/uber/jaeger-lib/metrics/prometheus"
 	ddconfig "github.com/unionj-cloud/go-doudou/v2/framework/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
+	"github.com/unionj-cloud/go-doudou/v2/framework/loglevel"
+	"github.com/unionj-cloud/toolkit/cast"
 	"github.com/unionj-cloud/toolkit/stringutils"
-	logger "github.com/unionj-cloud/toolkit/zlogger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-// Init returns an instance of Jaeger Tracer.
-func Init() (opentracing.Tracer, io.Closer) {
-	cfg := &config.Configuration{
-		Sampler:  &config.SamplerConfig{},
-		Reporter: &config.ReporterConfig{},
+var logger = loglevel.Named("tracing")
+
+const (
+	ExporterOtlpGrpc = "otlpgrpc"
+	ExporterOtlpHttp = "otlphttp"
+	ExporterStdout   = "stdout"
+	ExporterFile     = "file"
+	ExporterNone     = "none"
+)
+
+const (
+	SamplerAlwaysOn                = "always_on"
+	SamplerAlwaysOff               = "always_off"
+	SamplerTraceIdRatio            = "traceidratio"
+	SamplerParentBasedAlwaysOn     = "parentbased_always_on"
+	SamplerParentBasedAlwaysOff    = "parentbased_always_off"
+	SamplerParentBasedTraceIdRatio = "parentbased_traceidratio"
+)
+
+type closer func() error
+
+func (c closer) Close() error {
+	return c()
+}
+
+// Init returns an instance of OpenTelemetry TracerProvider configured from GDD_TRACING_* environment variables.
+// The provider and the W3C traceparent/baggage propagators are registered as global, so the instrumentation
+// of RestServer, GrpcServer, restclient and gorm picks them up automatically.
+// Pending spans are flushed on shutdown by lifecycle hook, the returned io.Closer can also be called to flush them
+// before the process exits, it is safe to call it more than once.
+func Init() (*sdktrace.TracerProvider, io.Closer) {
+	exporter, output, err := newExporter()
+	if err != nil {
+		logger.Panic().Err(errors.Wrap(err, "[go-doudou] cannot initialize OpenTelemetry exporter")).Msg("")
+	}
+	res, err := newResource()
+	if err != nil {
+		logger.Panic().Err(errors.Wrap(err, "[go-doudou] cannot initialize OpenTelemetry resource")).Msg("")
+	}
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(newSampler()),
+	}
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
 	}
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	var (
+		once     sync.Once
+		closeErr error
+	)
+	c := closer(func() error {
+		once.Do(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), ddconfig.GddConfig.GraceTimeout)
+			defer cancel()
+			closeErr = tp.Shutdown(ctx)
+			if output != nil {
+				output.Close()
+			}
+		})
+		return closeErr
+	})
+	lifecycle.OnShutdown("tracing", lifecycle.PriorityTracer, func(ctx context.Context) error {
+		return c.Close()
+	})
+	return tp, c
+}
+
+func newResource() (*resource.Resource, error) {
 	service := ddconfig.DefaultGddServiceName
 	if stringutils.IsNotEmpty(ddconfig.GddServiceName.Load()) {
 		service = ddconfig.GddServiceName.Load()
 	}
-	cfg.ServiceName = service
-	cfg.Sampler.Type = "const"
-	cfg.Sampler.Param = 1
-	cfg.Reporter.LogSpans = true
-	_, err := cfg.FromEnv()
-	if err != nil {
-		logger.Panic().Err(errors.Wrap(err, "[go-doudou] cannot parse Jaeger env vars")).Msg("")
+	attrs := []resource.Option{
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
 	}
-	jaegerLogger := jaegerLoggerAdapter{logger: logger.Logger}
-	metricsRoot := ddconfig.DefaultGddTracingMetricsRoot
-	if stringutils.IsNotEmpty(ddconfig.GddTracingMetricsRoot.Load()) {
-		metricsRoot = ddconfig.GddTracingMetricsRoot.Load()
+	if stringutils.IsNotEmpty(service) {
+		attrs = append(attrs, resource.WithAttributes(semconv.ServiceName(service)))
 	}
-	metricsFactory := jprom.New().Namespace(metrics.NSOptions{Name: metricsRoot, Tags: nil})
-	tracer, closer, err := cfg.NewTracer(
-		config.Logger(jaegerLogger),
-		config.Metrics(metricsFactory),
-		config.Observer(rpcmetrics.NewObserver(metricsFactory, rpcmetrics.DefaultNameNormalizer)),
-	)
-	if err != nil {
-		logger.Panic().Err(errors.Wrap(err, "[go-doudou] cannot initialize Jaeger Tracer")).Msg("")
+	if version := ddconfig.GddServiceVersion.LoadOrDefault(ddconfig.DefaultGddServiceVersion); stringutils.IsNotEmpty(version) {
+		attrs = append(attrs, resource.WithAttributes(semconv.ServiceVersion(version)))
 	}
-	return tracer, closer
+	return resource.New(context.Background(), attrs...)
 }
 
-type jaegerLoggerAdapter struct {
-	logger zerolog.Logger
-}
-
-func (l jaegerLoggerAdapter) Error(msg string) {
-	l.logger.Error().Msg(msg)
-}
-
-func (l jaegerLoggerAdapter) Infof(msg string, args ...interface{}) {
-	l.logger.Info().Msgf(msg, args...)
+func newExporter() (sdktrace.SpanExporter, io.WriteCloser, error) {
+	endpoint := ddconfig.GddTracingEndpoint.LoadOrDefault(ddconfig.DefaultGddTracingEndpoint)
+	insecure := cast.ToBoolOrDefault(ddconfig.GddTracingInsecure.Load(), ddconfig.DefaultGddTracingInsecure)
+	timeout := ddconfig.GddTracingTimeout.LoadDurationOrDefault(ddconfig.DefaultGddTracingTimeout)
+	switch exporter := strings.ToLower(ddconfig.GddTracingExporter.LoadOrDefault(ddconfig.DefaultGddTracingExporter)); exporter {
+	case ExporterOtlpGrpc:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithTimeout(timeout)}
+		if stringutils.IsNotEmpty(endpoint) {
+			opts = append(opts, otlptracegrpc.WithEndpoint(endpoint))
+		}
+		if insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exp, err := otlptracegrpc.New(context.Background(), opts...)
+		return exp, nil, err
+	case ExporterOtlpHttp:
+		opts := []otlptracehttp.Option{otlptracehttp.WithTimeout(timeout)}
+		if stringutils.IsNotEmpty(endpoint) {
+			opts = append(opts, otlptracehttp.WithEndpoint(endpoint))
+		}
+		if insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exp, err := otlptracehttp.New(context.Background(), opts...)
+		return exp, nil, err
+	case ExporterStdout:
+		exp, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		return exp, nil, err
+	case ExporterFile:
+		file := ddconfig.GddTracingFile.LoadOrDefault(ddconfig.DefaultGddTracingFile)
+		f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0664)
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return exp, f, nil
+	case ExporterNone, "":
+		return nil, nil, nil
+	default:
+		return nil, nil, errors.Errorf("unknown exporter: %s", exporter)
+	}
 }
 
-func (l jaegerLoggerAdapter) Debugf(msg string, args ...interface{}) {
-	l.logger.Debug().Msgf(msg, args...)
+func newSampler() sdktrace.Sampler {
+	ratio := ddconfig.DefaultGddTracingSamplerArg
+	if arg := ddconfig.GddTracingSamplerArg.Load(); stringutils.IsNotEmpty(arg) {
+		if value, err := strconv.ParseFloat(arg, 64); err != nil {
+			logger.Error().Err(err).Msgf("[go-doudou] cast %s to float64 failed, use %v instead", arg, ratio)
+		} else {
+			ratio = value
+		}
+	}
+	switch sampler := strings.ToLower(ddconfig.GddTracingSampler.LoadOrDefault(ddconfig.DefaultGddTracingSampler)); sampler {
+	case SamplerAlwaysOn:
+		return sdktrace.AlwaysSample()
+	case SamplerAlwaysOff:
+		return sdktrace.NeverSample()
+	case SamplerTraceIdRatio:
+		return sdktrace.TraceIDRatioBased(ratio)
+	case SamplerParentBasedAlwaysOff:
+		return sdktrace.ParentBased(sdktrace.NeverSample())
+	case SamplerParentBasedTraceIdRatio:
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+	case SamplerParentBasedAlwaysOn:
+		return sdktrace.ParentBased(sdktrace.AlwaysSample())
+	default:
+		logger.Warn().Msgf("[go-doudou] unknown sampler %s, use %s instead", sampler, SamplerParentBasedAlwaysOn)
+		return sdktrace.ParentBased(sdktrace.AlwaysSample())
+	}
 }